@@ -0,0 +1,60 @@
+package auxpow
+
+import (
+	"errors"
+	"math/big"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/auxpow"
+	ela "github.com/elastos/Elastos.ELA/core"
+)
+
+// CheckSideAuxPow verifies the side aux pow strictly for merged mining. The
+// parent block must commit the main chain block header at the slot of the
+// given chain ID and its hash must meet the side chain target, the side chain
+// pow transaction must be included in the main chain block, and it must
+// commit the side chain block hash of the chain with the given genesis hash.
+func (sap *SideAuxPow) CheckSideAuxPow(hashAuxBlock Uint256, genesisHash Uint256,
+	chainID int, target *big.Int) error {
+	mainBlockHeader := sap.MainBlockHeader
+	mainBlockHeaderHash := mainBlockHeader.Hash()
+	if !mainBlockHeader.AuxPow.Check(&mainBlockHeaderHash, chainID) {
+		return errors.New("parent block does not commit the main chain block header")
+	}
+
+	parentHash := mainBlockHeader.AuxPow.ParBlockHeader.Hash()
+	if hashToBig(&parentHash).Cmp(target) > 0 {
+		return errors.New("parent block hash does not meet the side chain target")
+	}
+
+	if sap.SideAuxBlockTx.TxType != ela.SideChainPow {
+		return errors.New("side aux block transaction is not a side chain pow transaction")
+	}
+	sideAuxPowMerkleRoot := auxpow.GetMerkleRoot(sap.SideAuxBlockTx.Hash(), sap.SideAuxMerkleBranch, sap.SideAuxMerkleIndex)
+	if sideAuxPowMerkleRoot != mainBlockHeader.MerkleRoot {
+		return errors.New("side aux merkle branch does not match the main chain block")
+	}
+
+	payload, ok := sap.SideAuxBlockTx.Payload.(*ela.PayloadSideChainPow)
+	if !ok {
+		return errors.New("invalid side chain pow transaction payload")
+	}
+	if !payload.SideGenesisHash.IsEqual(genesisHash) {
+		return errors.New("side chain pow transaction commits a different side chain")
+	}
+	if !payload.SideBlockHash.IsEqual(hashAuxBlock) {
+		return errors.New("side chain pow transaction does not commit the block hash")
+	}
+
+	return nil
+}
+
+// hashToBig converts the little-endian hash to a big integer.
+func hashToBig(hash *Uint256) *big.Int {
+	buf := *hash
+	blen := len(buf)
+	for i := 0; i < blen/2; i++ {
+		buf[i], buf[blen-1-i] = buf[blen-1-i], buf[i]
+	}
+	return new(big.Int).SetBytes(buf[:])
+}
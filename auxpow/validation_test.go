@@ -0,0 +1,73 @@
+package auxpow
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/auxpow"
+	ela "github.com/elastos/Elastos.ELA/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSideAuxPow_CheckSideAuxPow(t *testing.T) {
+	var blockHash, genesisHash Uint256
+	rand.Read(blockHash[:])
+	rand.Read(genesisHash[:])
+	maxTarget := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+	// serialized side aux pow blob as it is carried in block header
+	buf := new(bytes.Buffer)
+	err := GenerateSideAuxPow(blockHash, genesisHash).Serialize(buf)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	blob := buf.Bytes()
+	newSideAuxPow := func() *SideAuxPow {
+		sap := new(SideAuxPow)
+		if err := sap.Deserialize(bytes.NewReader(blob)); err != nil {
+			t.Fatal(err)
+		}
+		return sap
+	}
+
+	// normal
+	err = newSideAuxPow().CheckSideAuxPow(blockHash, genesisHash, auxpow.AuxPowChainID, maxTarget)
+	assert.NoError(t, err)
+
+	// other block hash
+	var otherHash Uint256
+	rand.Read(otherHash[:])
+	err = newSideAuxPow().CheckSideAuxPow(otherHash, genesisHash, auxpow.AuxPowChainID, maxTarget)
+	assert.EqualError(t, err, "side chain pow transaction does not commit the block hash")
+
+	// other side chain
+	err = newSideAuxPow().CheckSideAuxPow(blockHash, otherHash, auxpow.AuxPowChainID, maxTarget)
+	assert.EqualError(t, err, "side chain pow transaction commits a different side chain")
+
+	// parent block hash above target
+	err = newSideAuxPow().CheckSideAuxPow(blockHash, genesisHash, auxpow.AuxPowChainID, big.NewInt(0))
+	assert.EqualError(t, err, "parent block hash does not meet the side chain target")
+
+	// merkle branch not match
+	sap := newSideAuxPow()
+	sap.SideAuxMerkleBranch = append(sap.SideAuxMerkleBranch, otherHash)
+	err = sap.CheckSideAuxPow(blockHash, genesisHash, auxpow.AuxPowChainID, maxTarget)
+	assert.EqualError(t, err, "side aux merkle branch does not match the main chain block")
+
+	// not a side chain pow transaction
+	sap = newSideAuxPow()
+	sap.SideAuxBlockTx.TxType = ela.TransferAsset
+	err = sap.CheckSideAuxPow(blockHash, genesisHash, auxpow.AuxPowChainID, maxTarget)
+	assert.EqualError(t, err, "side aux block transaction is not a side chain pow transaction")
+
+	// main chain block header changed after parent block committed it
+	sap = newSideAuxPow()
+	sap.MainBlockHeader.Nonce++
+	err = sap.CheckSideAuxPow(blockHash, genesisHash, auxpow.AuxPowChainID, maxTarget)
+	assert.EqualError(t, err, "parent block does not commit the main chain block header")
+
+	t.Log("[TestSideAuxPow_CheckSideAuxPow] PASSED")
+}
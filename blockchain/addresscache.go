@@ -0,0 +1,28 @@
+package blockchain
+
+import (
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// addressCache memoizes the program hashes of the addresses decoded in a
+// validation pass, a cache is created by each check so the decoded addresses
+// do not leak between transactions.
+type addressCache map[string]*Uint168
+
+func newAddressCache() addressCache {
+	return make(addressCache)
+}
+
+// programHash returns the program hash of the address, decoding the address
+// only the first time it is seen.
+func (c addressCache) programHash(address string) (*Uint168, error) {
+	if programHash, ok := c[address]; ok {
+		return programHash, nil
+	}
+	programHash, err := Uint168FromAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	c[address] = programHash
+	return programHash, nil
+}
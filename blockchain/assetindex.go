@@ -0,0 +1,46 @@
+package blockchain
+
+import (
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// assetIndex maps the canonical names of the registered assets to their IDs,
+// so a name lookup does not scan the asset table.
+type assetIndex struct {
+	sync.RWMutex
+	ids map[string]Uint256
+}
+
+func newAssetIndex() *assetIndex {
+	return &assetIndex{ids: make(map[string]Uint256)}
+}
+
+// Add indexes the asset ID by the canonical name of the asset.
+func (i *assetIndex) Add(name string, id Uint256) {
+	i.Lock()
+	i.ids[core.NormalizeAssetName(name)] = id
+	i.Unlock()
+}
+
+// Remove removes the canonical name of the asset if it is indexed to the
+// asset ID.
+func (i *assetIndex) Remove(name string, id Uint256) {
+	key := core.NormalizeAssetName(name)
+	i.Lock()
+	if indexed, ok := i.ids[key]; ok && indexed.IsEqual(id) {
+		delete(i.ids, key)
+	}
+	i.Unlock()
+}
+
+// Get returns the ID of the asset of the same canonical name.
+func (i *assetIndex) Get(name string) (Uint256, bool) {
+	i.RLock()
+	defer i.RUnlock()
+	id, ok := i.ids[core.NormalizeAssetName(name)]
+	return id, ok
+}
@@ -0,0 +1,171 @@
+package blockchain
+
+import (
+	"bytes"
+	"container/heap"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// BlockAssembler selects transactions from a mempool snapshot for a new
+// block. Transactions are picked by descending fee rate, a transaction is
+// only picked after all of its in snapshot parents, and the result is
+// deterministic for the same snapshot.
+type BlockAssembler struct {
+	height       uint32
+	medianTime   time.Time
+	maxSize      int
+	maxTxs       int
+	maxRecharges int
+}
+
+// NewBlockAssembler creates a block assembler for the block at the given
+// height following a block of the given median time past, reservedSize and
+// reservedTxs are taken by the coinbase.
+func NewBlockAssembler(height uint32, medianTime time.Time, reservedSize, reservedTxs int) *BlockAssembler {
+	return &BlockAssembler{
+		height:       height,
+		medianTime:   medianTime,
+		maxSize:      config.Parameters.MaxBlockSize - reservedSize,
+		maxTxs:       config.Parameters.MaxTxInBlock - reservedTxs,
+		maxRecharges: config.Parameters.MaxRechargeTxInBlock,
+	}
+}
+
+// Assemble returns the ordered transactions to be packed in the block and
+// the total fee of them.
+func (a *BlockAssembler) Assemble(txs map[Uint256]*core.Transaction) ([]*core.Transaction, Fixed64) {
+	// count the unpicked in snapshot parents of each transaction
+	pending := make(map[Uint256]int, len(txs))
+	children := make(map[Uint256][]*core.Transaction)
+	var ready assembleQueue
+	for hash, tx := range txs {
+		parents := make(map[Uint256]struct{})
+		for _, input := range tx.Inputs {
+			parent := input.Previous.TxID
+			if _, ok := txs[parent]; !ok {
+				continue
+			}
+			if _, ok := parents[parent]; ok {
+				continue
+			}
+			parents[parent] = struct{}{}
+			children[parent] = append(children[parent], tx)
+		}
+		pending[hash] = len(parents)
+		if len(parents) == 0 {
+			ready = append(ready, &assembleItem{tx: tx, hash: hash})
+		}
+	}
+	heap.Init(&ready)
+
+	var packed []*core.Transaction
+	var totalFee Fixed64
+	totalSize := 0
+	recharges := 0
+	mainchainTxs := make(map[Uint256]struct{})
+	assetNames := make(map[string]struct{})
+	for ready.Len() > 0 && len(packed) < a.maxTxs {
+		item := heap.Pop(&ready).(*assembleItem)
+		tx := item.tx
+
+		// the transaction and all its descendants are left out if it can
+		// not be packed
+		size := tx.GetSize()
+		if totalSize+size > a.maxSize {
+			continue
+		}
+		if !IsFinalizedTransaction(tx, a.height, a.medianTime) {
+			continue
+		}
+		var mainchainTxHashes []Uint256
+		if tx.IsRechargeToSideChainTx() {
+			if a.maxRecharges > 0 && recharges >= a.maxRecharges {
+				continue
+			}
+			payload, ok := tx.Payload.(*core.PayloadRechargeToSideChain)
+			if !ok {
+				continue
+			}
+			hashes, err := payload.GetMainchainTxHashes()
+			if err != nil || hasMainchainTx(mainchainTxs, hashes) {
+				continue
+			}
+			mainchainTxHashes = hashes
+		}
+		if tx.TxType == core.RegisterAsset {
+			payload, ok := tx.Payload.(*core.PayloadRegisterAsset)
+			if !ok {
+				continue
+			}
+			// two registrations of an asset name invalidate the block
+			name := core.NormalizeAssetName(payload.Asset.Name)
+			if _, ok := assetNames[name]; ok {
+				continue
+			}
+			assetNames[name] = struct{}{}
+		}
+
+		packed = append(packed, tx)
+		totalFee += tx.Fee
+		totalSize += size
+		if mainchainTxHashes != nil {
+			for _, hash := range mainchainTxHashes {
+				mainchainTxs[hash] = struct{}{}
+			}
+			recharges++
+		}
+
+		for _, child := range children[item.hash] {
+			childHash := child.Hash()
+			pending[childHash]--
+			if pending[childHash] == 0 {
+				heap.Push(&ready, &assembleItem{tx: child, hash: childHash})
+			}
+		}
+	}
+
+	return packed, totalFee
+}
+
+// hasMainchainTx returns if any of the main chain transactions is already
+// packed.
+func hasMainchainTx(packed map[Uint256]struct{}, hashes []Uint256) bool {
+	for _, hash := range hashes {
+		if _, ok := packed[hash]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+type assembleItem struct {
+	tx   *core.Transaction
+	hash Uint256
+}
+
+// assembleQueue orders transactions by descending fee rate, ties are broken
+// by transaction hash.
+type assembleQueue []*assembleItem
+
+func (q assembleQueue) Len() int      { return len(q) }
+func (q assembleQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q assembleQueue) Less(i, j int) bool {
+	if q[i].tx.FeePerKB != q[j].tx.FeePerKB {
+		return q[i].tx.FeePerKB > q[j].tx.FeePerKB
+	}
+	return bytes.Compare(q[i].hash[:], q[j].hash[:]) < 0
+}
+
+func (q *assembleQueue) Push(x interface{}) { *q = append(*q, x.(*assembleItem)) }
+
+func (q *assembleQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,91 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockAssembler_Assemble(t *testing.T) {
+	maxBlockSize := config.Parameters.MaxBlockSize
+	maxTxInBlock := config.Parameters.MaxTxInBlock
+	config.Parameters.MaxTxInBlock = 100
+	defer func() {
+		config.Parameters.MaxBlockSize = maxBlockSize
+		config.Parameters.MaxTxInBlock = maxTxInBlock
+	}()
+
+	newTx := func(feePerKB common.Fixed64, parent *core.Transaction) *core.Transaction {
+		tx := buildTx()
+		if parent != nil {
+			tx.Inputs = []*core.Input{
+				{Previous: *core.NewOutPoint(parent.Hash(), 0)},
+			}
+		}
+		tx.Fee = feePerKB
+		tx.FeePerKB = feePerKB
+		return tx
+	}
+	snapshot := func(txs ...*core.Transaction) map[common.Uint256]*core.Transaction {
+		txMap := make(map[common.Uint256]*core.Transaction)
+		for _, tx := range txs {
+			txMap[tx.Hash()] = tx
+		}
+		return txMap
+	}
+
+	// low fee parent should be packed before its high fee child
+	parent := newTx(1, nil)
+	child := newTx(1000, parent)
+	other := newTx(100, nil)
+	config.Parameters.MaxBlockSize = parent.GetSize() + child.GetSize() + other.GetSize()
+	txs, fee := NewBlockAssembler(1, time.Unix(0, 0), 0, 0).Assemble(snapshot(child, other, parent))
+	assert.Equal(t, []*core.Transaction{other, parent, child}, txs)
+	assert.Equal(t, common.Fixed64(1101), fee)
+
+	// the same snapshot always gets the same template
+	for i := 0; i < 10; i++ {
+		again, _ := NewBlockAssembler(1, time.Unix(0, 0), 0, 0).Assemble(snapshot(child, other, parent))
+		assert.Equal(t, txs, again)
+	}
+
+	// the template never exceeds the size cap
+	high, low := newTx(1000, nil), newTx(1, nil)
+	reserved := 100
+	config.Parameters.MaxBlockSize = reserved + high.GetSize() + low.GetSize() - 1
+	txs, fee = NewBlockAssembler(1, time.Unix(0, 0), reserved, 0).Assemble(snapshot(high, low))
+	assert.Equal(t, []*core.Transaction{high}, txs)
+	assert.Equal(t, common.Fixed64(1000), fee)
+
+	// child is never packed without its parent
+	config.Parameters.MaxBlockSize = child.GetSize() + other.GetSize()
+	txs, _ = NewBlockAssembler(1, time.Unix(0, 0), 0, 0).Assemble(snapshot(child, other, parent))
+	for _, tx := range txs {
+		assert.NotEqual(t, child.Hash(), tx.Hash())
+	}
+
+	// transaction count limit
+	config.Parameters.MaxBlockSize = maxBlockSize
+	config.Parameters.MaxTxInBlock = 2
+	txs, _ = NewBlockAssembler(1, time.Unix(0, 0), 0, 1).Assemble(snapshot(high, low))
+	assert.Equal(t, []*core.Transaction{high}, txs)
+
+	// one registration of an asset name
+	config.Parameters.MaxTxInBlock = 100
+	register := func(feePerKB common.Fixed64, name string) *core.Transaction {
+		tx := newTx(feePerKB, nil)
+		tx.TxType = core.RegisterAsset
+		tx.Payload = &core.PayloadRegisterAsset{Asset: core.Asset{Name: name}}
+		return tx
+	}
+	gold, goldAgain := register(100, "Gold Coin"), register(10, "gold coin")
+	txs, _ = NewBlockAssembler(1, time.Unix(0, 0), 0, 0).Assemble(snapshot(gold, goldAgain))
+	assert.Equal(t, []*core.Transaction{gold}, txs)
+
+	t.Log("[TestBlockAssembler_Assemble] PASSED")
+}
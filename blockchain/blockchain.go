@@ -9,7 +9,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/elastos/Elastos.ELA.SideChain/auxpow"
 	"github.com/elastos/Elastos.ELA.SideChain/config"
 	"github.com/elastos/Elastos.ELA.SideChain/core"
 	. "github.com/elastos/Elastos.ELA.SideChain/errors"
@@ -26,6 +25,10 @@ const (
 	medianTimeBlocks       = 11
 )
 
+// DefaultMaxReorgDepth is the max number of blocks disconnected by a chain
+// reorganization when MaxReorgDepth is not configured.
+const DefaultMaxReorgDepth = 100
+
 var (
 	maxOrphanBlocks = config.Parameters.ChainParam.MaxOrphanBlocks
 	MinMemoryNodes  = config.Parameters.ChainParam.MinMemoryNodes
@@ -92,60 +95,14 @@ func Init(store IChainStore) error {
 	return nil
 }
 
+// GetGenesisBlock returns the genesis block of the configured side chain.
 func GetGenesisBlock() (*core.Block, error) {
-	// ELA coin
-	elaCoin := core.Transaction{
-		TxType:         core.RegisterAsset,
-		PayloadVersion: 0,
-		Payload: &core.PayloadRegisterAsset{
-			Asset: core.Asset{
-				Name:      "ELA",
-				Precision: 0x08,
-				AssetType: 0x00,
-			},
-			Amount:     0 * 100000000,
-			Controller: Uint168{},
-		},
-		Attributes: []*core.Attribute{},
-		Inputs:     []*core.Input{},
-		Outputs:    []*core.Output{},
-		Programs:   []*core.Program{},
-	}
-
-	// header
-	header := core.Header{
-		Version:    core.BlockVersion,
-		Previous:   EmptyHash,
-		MerkleRoot: EmptyHash,
-		Timestamp:  uint32(time.Unix(time.Date(2018, time.June, 30, 12, 0, 0, 0, time.UTC).Unix(), 0).Unix()),
-		Bits:       0x1d03ffff,
-		Nonce:      core.GenesisNonce,
-		Height:     uint32(0),
-		SideAuxPow: auxpow.SideAuxPow{
-			SideAuxBlockTx: ela.Transaction{
-				TxType:         ela.SideChainPow,
-				PayloadVersion: ela.SideChainPowPayloadVersion,
-				Payload:        new(ela.PayloadSideChainPow),
-			},
-		},
-	}
-
-	//block
-	block := &core.Block{
-		Header:       header,
-		Transactions: []*core.Transaction{&elaCoin},
-	}
-	hashes := make([]Uint256, 0, len(block.Transactions))
-	for _, tx := range block.Transactions {
-		hashes = append(hashes, tx.Hash())
-	}
-	var err error
-	block.Header.MerkleRoot, err = crypto.ComputeRoot(hashes)
+	builder, err := NewGenesisBlockBuilder()
 	if err != nil {
-		return nil, errors.New("[GenesisBlock] ,BuildMerkleRoot failed.")
+		return nil, err
 	}
-
-	return block, nil
+	block, _, err := builder.Build()
+	return block, err
 }
 
 func NewCoinBaseTransaction(coinBasePayload *core.PayloadCoinBase, currentHeight uint32) *core.Transaction {
@@ -349,6 +306,7 @@ type BlockNode struct {
 	Version     uint32
 	Bits        uint32
 	Timestamp   uint32
+	StateRoot   Uint256
 	WorkSum     *big.Int
 	InMainChain bool
 	Parent      *BlockNode
@@ -366,6 +324,7 @@ func NewBlockNode(header *core.Header, hash *Uint256) *BlockNode {
 		Version:    header.Version,
 		Bits:       header.Bits,
 		Timestamp:  header.Timestamp,
+		StateRoot:  header.StateRoot,
 		WorkSum:    CalcWork(header.Bits),
 	}
 	return &node
@@ -711,27 +670,35 @@ func (bc *Blockchain) ReorganizeChain(detachNodes, attachNodes *list.List) error
 	//}
 
 	// Disconnect blocks from the main chain.
+	var detached []*BlockNode
 	for e := detachNodes.Front(); e != nil; e = e.Next() {
 		n := e.Value.(*BlockNode)
 		block, err := DefaultLedger.Store.GetBlock(*n.Hash)
-		if err != nil {
-			return err
+		if err == nil {
+			err = bc.DisconnectBlock(n, block)
 		}
-		err = bc.DisconnectBlock(n, block)
 		if err != nil {
+			bc.restoreChain(nil, detached)
 			return err
 		}
+		detached = append(detached, n)
 	}
 
-	// Connect the new best chain blocks.
+	// Connect the new best chain blocks, the old chain is restored if any
+	// of them fails validation.
+	var attached []*BlockNode
 	for e := attachNodes.Front(); e != nil; e = e.Next() {
 		n := e.Value.(*BlockNode)
 		block := bc.BlockCache[*n.Hash]
 		err := bc.ConnectBlock(n, block)
 		if err != nil {
+			log.Errorf("REORGANIZE: Block %x failed to connect, restoring the old chain, %v",
+				n.Hash.Bytes(), err)
+			bc.restoreChain(attached, detached)
 			return err
 		}
 		delete(bc.BlockCache, *n.Hash)
+		attached = append(attached, n)
 	}
 
 	// Log the point where the chain forked.
@@ -750,6 +717,52 @@ func (bc *Blockchain) ReorganizeChain(detachNodes, attachNodes *list.List) error
 	return nil
 }
 
+// restoreChain restores the main chain after a failed reorganization, the
+// attached blocks of the new chain are disconnected from the end of the main
+// chain, and the detached blocks of the old chain are connected again.
+func (bc *Blockchain) restoreChain(attached, detached []*BlockNode) {
+	for i := len(attached) - 1; i >= 0; i-- {
+		n := attached[i]
+		block, err := DefaultLedger.Store.GetBlock(*n.Hash)
+		if err == nil {
+			err = bc.DisconnectBlock(n, block)
+		}
+		if err != nil {
+			log.Errorf("REORGANIZE: Failed to disconnect block %x, %v", n.Hash.Bytes(), err)
+			return
+		}
+	}
+
+	for i := len(detached) - 1; i >= 0; i-- {
+		n := detached[i]
+		if err := bc.ConnectBlock(n, bc.BlockCache[*n.Hash]); err != nil {
+			log.Errorf("REORGANIZE: Failed to reconnect block %x, %v", n.Hash.Bytes(), err)
+			return
+		}
+		delete(bc.BlockCache, *n.Hash)
+	}
+}
+
+// checkReorgDepth refuses a reorganization disconnecting more blocks than
+// MaxReorgDepth, the node is likely on a different consensus with the peers.
+func checkReorgDepth(detachNodes *list.List) error {
+	maxDepth := maxReorgDepth()
+	if uint32(detachNodes.Len()) <= maxDepth {
+		return nil
+	}
+	tip := detachNodes.Front().Value.(*BlockNode)
+	log.Errorf("CONSENSUS ALERT: reorganization of %d blocks from block %x at height %d "+
+		"exceeds the max depth %d, refused", detachNodes.Len(), tip.Hash.Bytes(), tip.Height, maxDepth)
+	return fmt.Errorf("reorganization depth %d exceeds the max depth %d", detachNodes.Len(), maxDepth)
+}
+
+func maxReorgDepth() uint32 {
+	if config.Parameters.MaxReorgDepth > 0 {
+		return config.Parameters.MaxReorgDepth
+	}
+	return DefaultMaxReorgDepth
+}
+
 //// disconnectBlock handles disconnecting the passed node/block from the end of
 //// the main (best) chain.
 func (bc *Blockchain) DisconnectBlock(node *BlockNode, block *core.Block) error {
@@ -790,11 +803,22 @@ func (bc *Blockchain) DisconnectBlock(node *BlockNode, block *core.Block) error
 // connectBlock handles connecting the passed node/block to the end of the main
 // (best) chain.
 func (bc *Blockchain) ConnectBlock(node *BlockNode, block *core.Block) error {
+	defer blockConnectDuration.ObserveSince(time.Now())
 
+	height := DefaultLedger.Store.GetHeight()
 	for _, txVerify := range block.Transactions {
-		if errCode := CheckTransactionContext(txVerify); errCode != Success {
-			fmt.Println("CheckTransactionContext failed when verifiy block", errCode)
-			return errors.New(fmt.Sprintf("CheckTransactionContext failed when verifiy block"))
+		if errCode := checkTransaction(txVerify, height, true, false); errCode != Success {
+			log.Warn("[ConnectBlock] CheckTransaction failed when verify block", errCode)
+			return RuleError{ErrorCode: errCode, Description: "CheckTransaction failed when verifiy block"}
+		}
+	}
+
+	// Signatures of transactions in checkpointed blocks are not verified,
+	// others are verified in parallel once the other checks passed.
+	if !IsCheckpointed(block.Header.Height) {
+		if err := VerifyBlockSignatures(block.Transactions); err != nil {
+			log.Warn("[ConnectBlock] VerifyBlockSignatures failed when verify block", err)
+			return err
 		}
 	}
 
@@ -816,7 +840,7 @@ func (bc *Blockchain) ConnectBlock(node *BlockNode, block *core.Block) error {
 	node.InMainChain = true
 	//bc.Index[*node.Hash] = node
 	bc.AddNodeToIndex(node)
-	bc.DepNodes[*prevHash] = append(bc.DepNodes[*prevHash], node)
+	bc.DepNodes[*prevHash] = append(RemoveChildNode(bc.DepNodes[*prevHash], node), node)
 
 	// This node is now the end of the best chain.
 	bc.BestChain = node
@@ -991,6 +1015,10 @@ func (bc *Blockchain) ConnectBestChain(node *BlockNode, block *core.Block) (bool
 	//	fmt.Println("attach", n.Hash)
 	//}
 
+	if err := checkReorgDepth(detachNodes); err != nil {
+		return false, err
+	}
+
 	// Reorganize the chain.
 	log.Infof("REORGANIZE: Block %v is causing a reorganize.", node.Hash)
 	err := bc.ReorganizeChain(detachNodes, attachNodes)
@@ -1028,6 +1056,11 @@ func (bc *Blockchain) ProcessBlock(block *core.Block, timeSource MedianTimeSourc
 
 	log.Tracef("[ProcessBLock] orphan already exist= %v", exists)
 
+	// The block at a checkpoint height must match the checkpoint.
+	if err := CheckCheckpoint(block.Header.Height, blockHash); err != nil {
+		return false, false, err
+	}
+
 	// Perform preliminary sanity checks on the block and its transactions.
 	//err = PowCheckBlockSanity(block, PowLimit, bc.TimeSource)
 	err = PowCheckBlockSanity(block, config.Parameters.ChainParam.PowLimit, bc.TimeSource)
@@ -1227,7 +1260,13 @@ func (b *Blockchain) LatestLocatorHash(locator []*Uint256) *Uint256 {
 
 func (b *Blockchain) MedianAdjustedTime() time.Time {
 	newTimestamp := b.TimeSource.AdjustedTime()
-	minTimestamp := b.MedianTimePast.Add(time.Second)
+	medianTime := b.MedianTimePast
+	if b.BestChain != nil {
+		if t, err := b.GetMedianTimePast(*b.BestChain.Hash); err == nil {
+			medianTime = t
+		}
+	}
+	minTimestamp := medianTime.Add(time.Second)
 
 	if newTimestamp.Before(minTimestamp) {
 		newTimestamp = minTimestamp
@@ -1250,20 +1289,61 @@ func (s timeSorter) Less(i, j int) bool {
 	return s[i] < s[j]
 }
 
+// MedianTimePast returns the median timestamp of the last n blocks of the
+// best chain.
+func MedianTimePast(n int) time.Time {
+	return calcPastMedianTime(DefaultLedger.Blockchain.BestChain, n)
+}
+
 func CalcPastMedianTime(node *BlockNode) time.Time {
-	timestamps := make([]int64, medianTimeBlocks)
-	numNodes := 0
+	return calcPastMedianTime(node, medianTimeBlocks)
+}
+
+func calcPastMedianTime(node *BlockNode, n int) time.Time {
+	if node == nil || n <= 0 {
+		return time.Unix(0, 0)
+	}
+	timestamps := make([]int64, 0, n)
 	iterNode := node
-	for i := 0; i < medianTimeBlocks && iterNode != nil; i++ {
-		timestamps[i] = int64(iterNode.Timestamp)
-		numNodes++
+	for i := 0; i < n && iterNode != nil; i++ {
+		timestamps = append(timestamps, int64(iterNode.Timestamp))
 
 		iterNode = iterNode.Parent
 	}
 
-	timestamps = timestamps[:numNodes]
-	sort.Sort(timeSorter(timestamps))
+	return medianTimestamp(timestamps)
+}
 
-	medianTimestamp := timestamps[numNodes/2]
-	return time.Unix(medianTimestamp, 0)
+// GetMedianTimePast returns the median timestamp of the last medianTimeBlocks
+// blocks ending with the block of the given hash. The blocks are looked up
+// from the block index, and from the headers in store if they are not in
+// memory.
+func (b *Blockchain) GetMedianTimePast(hash Uint256) (time.Time, error) {
+	timestamps := make([]int64, 0, medianTimeBlocks)
+	for len(timestamps) < medianTimeBlocks {
+		var timestamp, height uint32
+		var previous Uint256
+		if node, ok := b.LookupNodeInIndex(&hash); ok {
+			timestamp, height, previous = node.Timestamp, node.Height, *node.ParentHash
+		} else {
+			header, err := b.GetHeader(hash)
+			if err != nil {
+				return time.Time{}, err
+			}
+			timestamp, height, previous = header.Timestamp, header.Height, header.Previous
+		}
+
+		timestamps = append(timestamps, int64(timestamp))
+		if height == 0 {
+			break
+		}
+		hash = previous
+	}
+
+	return medianTimestamp(timestamps), nil
+}
+
+func medianTimestamp(timestamps []int64) time.Time {
+	sort.Sort(timeSorter(timestamps))
+	return time.Unix(timestamps[len(timestamps)/2], 0)
 }
@@ -2,6 +2,8 @@ package blockchain
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"math"
 	"math/big"
 	"time"
@@ -12,6 +14,7 @@ import (
 
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA.Utility/crypto"
+	"github.com/elastos/Elastos.ELA/auxpow"
 )
 
 const (
@@ -27,7 +30,13 @@ func PowCheckBlockSanity(block *Block, powLimit *big.Int, timeSource MedianTimeS
 	//	return err
 	//}
 
-	if !header.SideAuxPow.SideAuxPowCheck(header.Hash()) {
+	if config.Parameters.EnableMergedMining {
+		err := header.SideAuxPow.CheckSideAuxPow(header.Hash(), DefaultLedger.Blockchain.GenesisHash,
+			auxPowChainID(), CompactToBig(header.Bits))
+		if err != nil {
+			return fmt.Errorf("[PowCheckBlockSanity] block check aux pow failed, %s", err)
+		}
+	} else if !header.SideAuxPow.SideAuxPowCheck(header.Hash()) {
 		return errors.New("[PowCheckBlockSanity] block check proof is failed")
 	}
 	if CheckProofOfWork(&header, powLimit) != nil {
@@ -41,7 +50,7 @@ func PowCheckBlockSanity(block *Block, powLimit *big.Int, timeSource MedianTimeS
 	}
 
 	// Ensure the block time is not too far in the future.
-	maxTimestamp := timeSource.AdjustedTime().Add(time.Second * MaxTimeOffsetSeconds)
+	maxTimestamp := timeSource.AdjustedTime().Add(MaxBlockTimeOffset())
 	if tempTime.After(maxTimestamp) {
 		return errors.New("[PowCheckBlockSanity] block timestamp of is too far in the future")
 	}
@@ -93,56 +102,175 @@ func PowCheckBlockSanity(block *Block, powLimit *big.Int, timeSource MedianTimeS
 		return errors.New("[PowCheckBlockSanity] reward amount in coinbase not correct")
 	}
 
+	// Check for duplicate transactions, UTXO inputs and mainchain txs
+	if err := ValidateBlockTransactions(transactions); err != nil {
+		return err
+	}
+
 	txIds := make([]Uint256, 0, len(transactions))
-	existingTxIds := make(map[Uint256]struct{})
-	existingTxInputs := make(map[string]struct{})
-	existingMainTxs := make(map[Uint256]struct{})
 	for _, txn := range transactions {
-		txId := txn.Hash()
-		// Check for duplicate transactions.
-		if _, exists := existingTxIds[txId]; exists {
-			return errors.New("[PowCheckBlockSanity] block contains duplicate transaction")
+		// Check for transaction sanity
+		if errCode := checkTransactionSanity(txn, header.Height); errCode != Success {
+			return RuleError{ErrorCode: errCode, Description: "CheckTransactionSanity failed when verifiy block"}
 		}
-		existingTxIds[txId] = struct{}{}
 
-		// Check for transaction sanity
-		if errCode := CheckTransactionSanity(txn); errCode != Success {
-			return errors.New("CheckTransactionSanity failed when verifiy block")
+		// Append transaction to list
+		txIds = append(txIds, txn.Hash())
+	}
+	calcTransactionsRoot, err := crypto.ComputeRoot(txIds)
+	if err != nil {
+		return errors.New("[PowCheckBlockSanity] merkleTree compute failed")
+	}
+	if !header.MerkleRoot.IsEqual(calcTransactionsRoot) {
+		return errors.New("[PowCheckBlockSanity] block merkle root is invalid")
+	}
+
+	return nil
+}
+
+// ValidateBlockTransactions checks the transactions of a block together, a
+// transaction, an UTXO input, a mainchain tx or a canonical asset name must
+// not appear twice in the block. The transactions are checked against the
+// ledger one by one, so the conflicts within the block are only caught here.
+func ValidateBlockTransactions(transactions []*Transaction) error {
+	existing := newBlockTransactions()
+	for _, txn := range transactions {
+		if err := existing.add(txn); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		// Check for duplicate UTXO inputs in a block
-		for _, input := range txn.Inputs {
-			referKey := input.ReferKey()
-			if _, exists := existingTxInputs[referKey]; exists {
-				return errors.New("[PowCheckBlockSanity] block contains duplicate UTXO")
-			}
-			existingTxInputs[referKey] = struct{}{}
+// blockTransactions is the state of the transactions of a block checked so
+// far needed to find the conflicts within the block.
+type blockTransactions struct {
+	txIds      map[Uint256]struct{}
+	txInputs   map[string]struct{}
+	mainTxs    map[Uint256]struct{}
+	assetNames map[string]struct{}
+}
+
+func newBlockTransactions() *blockTransactions {
+	return &blockTransactions{
+		txIds:      make(map[Uint256]struct{}),
+		txInputs:   make(map[string]struct{}),
+		mainTxs:    make(map[Uint256]struct{}),
+		assetNames: make(map[string]struct{}),
+	}
+}
+
+// add checks the transaction does not conflict with the transactions added
+// before and adds it.
+func (b *blockTransactions) add(txn *Transaction) error {
+	txId := txn.Hash()
+	// Check for duplicate transactions.
+	if _, exists := b.txIds[txId]; exists {
+		return errors.New("[ValidateBlockTransactions] block contains duplicate transaction")
+	}
+	b.txIds[txId] = struct{}{}
+
+	// Check for duplicate UTXO inputs in a block
+	for _, input := range txn.Inputs {
+		referKey := input.ReferKey()
+		if _, exists := b.txInputs[referKey]; exists {
+			return fmt.Errorf("[ValidateBlockTransactions] block contains duplicate UTXO %s:%d",
+				input.Previous.TxID.String(), input.Previous.Index)
 		}
+		b.txInputs[referKey] = struct{}{}
+	}
 
-		if txn.IsRechargeToSideChainTx() {
-			rechargePayload := txn.Payload.(*PayloadRechargeToSideChain)
-			// Check for duplicate mainchain tx in a block
-			hash, err := rechargePayload.GetMainchainTxHash()
-			if err != nil {
-				return err
-			}
-			if _, exists := existingMainTxs[*hash]; exists {
-				return errors.New("[PowCheckBlockSanity] block contains duplicate mainchain Tx")
+	if txn.IsRechargeToSideChainTx() {
+		rechargePayload := txn.Payload.(*PayloadRechargeToSideChain)
+		// Check for duplicate mainchain tx in a block
+		hashes, err := rechargePayload.GetMainchainTxHashes()
+		if err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if _, exists := b.mainTxs[hash]; exists {
+				return errors.New("[ValidateBlockTransactions] block contains duplicate mainchain Tx")
 			}
-			existingMainTxs[*hash] = struct{}{}
+			b.mainTxs[hash] = struct{}{}
 		}
+	}
 
-		// Append transaction to list
-		txIds = append(txIds, txId)
+	if txn.TxType == RegisterAsset {
+		// Check for duplicate asset names in a block
+		name := NormalizeAssetName(txn.Payload.(*PayloadRegisterAsset).Asset.Name)
+		if _, exists := b.assetNames[name]; exists {
+			return fmt.Errorf("[ValidateBlockTransactions] block contains duplicate asset name %s", name)
+		}
+		b.assetNames[name] = struct{}{}
 	}
-	calcTransactionsRoot, err := crypto.ComputeRoot(txIds)
+	return nil
+}
+
+// ValidateTransactionStream validates the transactions of a block body read
+// from r, the transaction count followed by the transactions, as the block at
+// the given height. The transactions are deserialized and checked one at a
+// time, only the state to find the conflicts within the block is kept, so a
+// block near MaxBlockSize can be validated with little memory. The time locks
+// are compared to the median time past of the best chain.
+func ValidateTransactionStream(r io.Reader, height uint32) error {
+	count, err := ReadVarUint(r, 0)
 	if err != nil {
-		return errors.New("[PowCheckBlockSanity] merkleTree compute failed")
+		return fmt.Errorf("[ValidateTransactionStream] read transaction count failed, %s", err)
 	}
-	if !header.MerkleRoot.IsEqual(calcTransactionsRoot) {
-		return errors.New("[PowCheckBlockSanity] block merkle root is invalid")
+	if count == 0 {
+		return errors.New("[ValidateTransactionStream] block does not contain any transactions")
+	}
+	if count > uint64(config.Parameters.MaxTxInBlock) {
+		return errors.New("[ValidateTransactionStream] block contains too many transactions")
 	}
 
+	medianTime := MedianTimePast(medianTimeBlocks)
+	existing := newBlockTransactions()
+	blockSize := 0
+	var rewardInCoinbase = Fixed64(0)
+	var totalTxFee = Fixed64(0)
+	for index := uint64(0); index < count; index++ {
+		txn := new(Transaction)
+		if err := txn.Deserialize(r); err != nil {
+			return fmt.Errorf("[ValidateTransactionStream] transaction %d deserialize failed, %s", index, err)
+		}
+		blockSize += txn.GetSize()
+		if blockSize > config.Parameters.MaxBlockSize {
+			return errors.New("[ValidateTransactionStream] serialized block is too big")
+		}
+
+		// The first transaction in a block must be a coinbase.
+		if index == 0 {
+			if !txn.IsCoinBaseTx() {
+				return errors.New("[ValidateTransactionStream] first transaction in block is not a coinbase")
+			}
+			for _, output := range txn.Outputs {
+				rewardInCoinbase += output.Value
+			}
+		} else {
+			// A block must not have more than one coinbase.
+			if txn.IsCoinBaseTx() {
+				return errors.New("[ValidateTransactionStream] block contains second coinbase")
+			}
+			if !IsFinalizedTransaction(txn, height, medianTime) {
+				return errors.New("[ValidateTransactionStream] block contains unfinalized transaction")
+			}
+			totalTxFee += GetTxFee(txn, DefaultLedger.Blockchain.AssetID)
+		}
+
+		if errCode := checkTransactionSanity(txn, height); errCode != Success {
+			return fmt.Errorf("[ValidateTransactionStream] transaction %d sanity check failed, %s",
+				index, errCode.Message())
+		}
+		if err := existing.add(txn); err != nil {
+			return err
+		}
+	}
+
+	// Reward in coinbase must match total transaction fee
+	if rewardInCoinbase != totalTxFee {
+		return errors.New("[ValidateTransactionStream] reward amount in coinbase not correct")
+	}
 	return nil
 }
 
@@ -154,7 +282,7 @@ func PowCheckBlockContext(block *Block, prevNode *BlockNode, ledger *Ledger) err
 
 	header := block.Header
 	expectedDifficulty, err := CalcNextRequiredDifficulty(prevNode,
-		time.Unix(int64(header.Timestamp), 0))
+		time.Unix(int64(header.Timestamp), 0), config.Parameters.ChainParam)
 	if err != nil {
 		return err
 	}
@@ -165,11 +293,12 @@ func PowCheckBlockContext(block *Block, prevNode *BlockNode, ledger *Ledger) err
 
 	// Ensure the timestamp for the block header is after the
 	// median time of the last several blocks (medianTimeBlocks).
-	medianTime := CalcPastMedianTime(prevNode)
-	tempTime := time.Unix(int64(header.Timestamp), 0)
-
-	if !tempTime.After(medianTime) {
-		return errors.New("block timestamp is not after expected")
+	medianTime, err := ledger.Blockchain.GetMedianTimePast(*prevNode.Hash)
+	if err != nil {
+		return err
+	}
+	if err := checkMedianTimePast(header.Timestamp, medianTime); err != nil {
+		return err
 	}
 
 	// The height of this block is one more than the referenced
@@ -178,12 +307,12 @@ func PowCheckBlockContext(block *Block, prevNode *BlockNode, ledger *Ledger) err
 
 	// Ensure all transactions in the block are finalized.
 	for _, txn := range block.Transactions[1:] {
-		if !IsFinalizedTransaction(txn, blockHeight) {
+		if !IsFinalizedTransaction(txn, blockHeight, medianTime) {
 			return errors.New("block contains unfinalized transaction")
 		}
 	}
 
-	return nil
+	return checkStateRoot(block, prevNode)
 }
 
 func CheckProofOfWork(header *Header, powLimit *big.Int) error {
@@ -209,25 +338,70 @@ func CheckProofOfWork(header *Header, powLimit *big.Int) error {
 	return nil
 }
 
-func IsFinalizedTransaction(msgTx *Transaction, blockHeight uint32) bool {
+// MaxBlockTimeOffset returns how far the block timestamp is allowed to be
+// ahead of the adjusted time.
+func MaxBlockTimeOffset() time.Duration {
+	if config.Parameters.MaxBlockTimeOffset > 0 {
+		return time.Second * time.Duration(config.Parameters.MaxBlockTimeOffset)
+	}
+	return time.Second * MaxTimeOffsetSeconds
+}
+
+func checkMedianTimePast(timestamp uint32, medianTime time.Time) error {
+	if !time.Unix(int64(timestamp), 0).After(medianTime) {
+		return errors.New("block timestamp is not after expected")
+	}
+	return nil
+}
+
+func auxPowChainID() int {
+	if config.Parameters.AuxPowChainID > 0 {
+		return config.Parameters.AuxPowChainID
+	}
+	return auxpow.AuxPowChainID
+}
+
+// IsFinalizedTransaction returns if the transaction can be packed in the
+// block at the given height, lock times below LockTimeThreshold are compared
+// to the block height, others to the median time past of the previous block.
+// A transaction is also finalized when all its input sequences are maxed out.
+// Below LockTimeHeight every lock time is compared to the block height and
+// a maxed out sequence is math.MaxUint16.
+func IsFinalizedTransaction(msgTx *Transaction, blockHeight uint32, medianTime time.Time) bool {
 	// Lock time of zero means the transaction is finalized.
 	lockTime := msgTx.LockTime
 	if lockTime == 0 {
 		return true
 	}
 
-	//FIXME only height
-	if lockTime < blockHeight {
+	active := lockTimeHeightActive(blockHeight)
+	blockTimeOrHeight := int64(blockHeight)
+	if active && lockTime >= LockTimeThreshold {
+		blockTimeOrHeight = medianTime.Unix()
+	}
+	if int64(lockTime) < blockTimeOrHeight {
 		return true
 	}
 
 	// At this point, the transaction's lock time hasn't occurred yet, but
 	// the transaction might still be finalized if the sequence number
 	// for all transaction inputs is maxed out.
+	maxSequence := uint32(math.MaxUint16)
+	if active {
+		maxSequence = math.MaxUint32
+	}
 	for _, txIn := range msgTx.Inputs {
-		if txIn.Sequence != math.MaxUint16 {
+		if txIn.Sequence != maxSequence {
 			return false
 		}
 	}
 	return true
 }
+
+// lockTimeHeightActive returns if the lock time of a transaction in a block
+// at the given height follows the median time past rules, a zero
+// LockTimeHeight keeps the height only rules.
+func lockTimeHeightActive(height uint32) bool {
+	forkHeight := config.Parameters.ChainParam.LockTimeHeight
+	return forkHeight != 0 && height >= forkHeight
+}
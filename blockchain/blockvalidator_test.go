@@ -0,0 +1,141 @@
+package blockchain
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockchain_GetMedianTimePast(t *testing.T) {
+	bc := NewBlockchain(0)
+
+	// a chain with descending timestamps
+	var parent *BlockNode
+	var previous common.Uint256
+	for height := uint32(0); height < 20; height++ {
+		var hash common.Uint256
+		rand.Read(hash[:])
+		header := &core.Header{
+			Previous:  previous,
+			Height:    height,
+			Timestamp: 2000 - height*10,
+		}
+		node := NewBlockNode(header, &hash)
+		node.Parent = parent
+		bc.AddNodeToIndex(node)
+		parent, previous = node, hash
+	}
+
+	// median of the last 11 blocks, timestamps from 1810 to 1910
+	medianTime, err := bc.GetMedianTimePast(previous)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1860, 0), medianTime)
+	assert.Equal(t, CalcPastMedianTime(parent), medianTime)
+
+	// the next block continues the descending timestamps
+	err = checkMedianTimePast(1800, medianTime)
+	assert.EqualError(t, err, "block timestamp is not after expected")
+	err = checkMedianTimePast(1860, medianTime)
+	assert.EqualError(t, err, "block timestamp is not after expected")
+	err = checkMedianTimePast(1861, medianTime)
+	assert.NoError(t, err)
+
+	// chain shorter than 11 blocks
+	var short common.Uint256
+	for hash, node := range bc.Index {
+		if node.Height == 2 {
+			short = hash
+		}
+	}
+	medianTime, err = bc.GetMedianTimePast(short)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1990, 0), medianTime)
+
+	t.Log("[TestBlockchain_GetMedianTimePast] PASSED")
+}
+
+func TestValidateBlockTransactions(t *testing.T) {
+	tx1, tx2 := buildTx(), buildTx()
+
+	// transactions spending different UTXOs
+	err := ValidateBlockTransactions([]*core.Transaction{tx1, tx2})
+	assert.NoError(t, err)
+
+	// two transactions spending one UTXO
+	spent := tx1.Inputs[0].Previous
+	tx2.Inputs = append(tx2.Inputs, &core.Input{Previous: spent, Sequence: ^uint32(0)})
+	err = ValidateBlockTransactions([]*core.Transaction{tx1, tx2})
+	assert.EqualError(t, err, fmt.Sprintf("[ValidateBlockTransactions] block contains duplicate UTXO %s:%d",
+		spent.TxID.String(), spent.Index))
+
+	// duplicate transaction
+	err = ValidateBlockTransactions([]*core.Transaction{tx1, tx1})
+	assert.EqualError(t, err, "[ValidateBlockTransactions] block contains duplicate transaction")
+
+	// two registrations of the same asset name
+	register := func(name string) *core.Transaction {
+		tx := buildTx()
+		tx.TxType = core.RegisterAsset
+		tx.Payload = &core.PayloadRegisterAsset{Asset: core.Asset{Name: name}}
+		return tx
+	}
+	err = ValidateBlockTransactions([]*core.Transaction{register("Gold Coin"), register("Silver Coin")})
+	assert.NoError(t, err)
+	err = ValidateBlockTransactions([]*core.Transaction{register("Gold Coin"), register(" gold  COIN")})
+	assert.EqualError(t, err, "[ValidateBlockTransactions] block contains duplicate asset name gold coin")
+
+	t.Log("[TestValidateBlockTransactions] PASSED")
+}
+
+func TestIsFinalizedTransaction(t *testing.T) {
+	lockTimeHeight := config.Parameters.ChainParam.LockTimeHeight
+	defer func() { config.Parameters.ChainParam.LockTimeHeight = lockTimeHeight }()
+	config.Parameters.ChainParam.LockTimeHeight = 100
+
+	medianTime := time.Unix(int64(core.LockTimeThreshold)+1000, 0)
+	tx := &core.Transaction{
+		Inputs: []*core.Input{{Sequence: math.MaxUint32 - 1}},
+	}
+
+	// case: no lock time
+	assert.True(t, IsFinalizedTransaction(tx, 100, medianTime))
+
+	// case: height based lock time
+	tx.LockTime = 100
+	assert.False(t, IsFinalizedTransaction(tx, 100, medianTime))
+	assert.True(t, IsFinalizedTransaction(tx, 101, medianTime))
+
+	// case: time based lock time is compared to the median time
+	tx.LockTime = uint32(medianTime.Unix())
+	assert.False(t, IsFinalizedTransaction(tx, math.MaxUint32, medianTime))
+	assert.True(t, IsFinalizedTransaction(tx, 100, medianTime.Add(time.Second)))
+
+	// case: all the input sequences are maxed out
+	tx.Inputs = append(tx.Inputs, &core.Input{Sequence: math.MaxUint32})
+	assert.False(t, IsFinalizedTransaction(tx, 100, medianTime))
+	tx.Inputs[0].Sequence = math.MaxUint32
+	assert.True(t, IsFinalizedTransaction(tx, 100, medianTime))
+
+	// case: below LockTimeHeight every lock time is compared to the height
+	assert.False(t, IsFinalizedTransaction(tx, 99, medianTime.Add(time.Second)))
+	tx.Inputs[0].Sequence, tx.Inputs[1].Sequence = math.MaxUint16, math.MaxUint16
+	assert.True(t, IsFinalizedTransaction(tx, 99, medianTime))
+	tx.LockTime = 50
+	tx.Inputs[0].Sequence = 0
+	assert.True(t, IsFinalizedTransaction(tx, 51, medianTime))
+
+	// case: a zero LockTimeHeight keeps the height only rules
+	config.Parameters.ChainParam.LockTimeHeight = 0
+	tx.LockTime = uint32(medianTime.Unix())
+	assert.False(t, IsFinalizedTransaction(tx, 1000, medianTime.Add(time.Second)))
+
+	t.Log("[TestIsFinalizedTransaction] PASSED")
+}
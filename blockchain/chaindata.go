@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/elastos/Elastos.ELA.SideChain/config"
 	"github.com/elastos/Elastos.ELA.SideChain/core"
 
 	. "github.com/elastos/Elastos.ELA.Utility/common"
@@ -106,6 +107,47 @@ func (c *ChainStore) RollbackCurrentBlock(b *core.Block) error {
 	return nil
 }
 
+// key: SYS_AssetCount
+// value: registered asset count
+func (c *ChainStore) PersistAssetCount(b *core.Block) error {
+	var count uint32
+	for _, txn := range b.Transactions {
+		if txn.TxType == core.RegisterAsset {
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	return c.putAssetCount(c.GetAssetCount() + count)
+}
+
+func (c *ChainStore) RollbackAssetCount(b *core.Block) error {
+	var count uint32
+	for _, txn := range b.Transactions {
+		if txn.TxType == core.RegisterAsset {
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	current := c.GetAssetCount()
+	if current < count {
+		return fmt.Errorf("registered asset count %d less than rollback count %d", current, count)
+	}
+	return c.putAssetCount(current - count)
+}
+
+func (c *ChainStore) putAssetCount(count uint32) error {
+	value := new(bytes.Buffer)
+	if err := WriteUint32(value, count); err != nil {
+		return err
+	}
+	c.BatchPut([]byte{byte(SYS_AssetCount)}, value.Bytes())
+	return nil
+}
+
 func (c *ChainStore) PersistUnspendUTXOs(b *core.Block) error {
 	unspendUTXOs := make(map[Uint168]map[Uint256]map[uint32][]*UTXO)
 	curHeight := b.Header.Height
@@ -291,6 +333,7 @@ func (c *ChainStore) RollbackUnspendUTXOs(b *core.Block) error {
 }
 
 func (c *ChainStore) PersistTransactions(b *core.Block) error {
+	identifications := newIdentificationBatch()
 	for _, txn := range b.Transactions {
 		if err := c.PersistTransaction(txn, b.Header.Height); err != nil {
 			return err
@@ -303,19 +346,17 @@ func (c *ChainStore) PersistTransactions(b *core.Block) error {
 		}
 		if txn.TxType == core.RechargeToSideChain {
 			rechargePayload := txn.Payload.(*core.PayloadRechargeToSideChain)
-			hash, err := rechargePayload.GetMainchainTxHash()
+			hashes, err := rechargePayload.GetMainchainTxHashes()
 			if err != nil {
 				return err
 			}
-			c.PersistMainchainTx(*hash)
+			for _, hash := range hashes {
+				c.PersistMainchainTx(hash)
+			}
 		}
 		if txn.TxType == core.RegisterIdentification {
-			regPayload := txn.Payload.(*core.PayloadRegisterIdentification)
-			for _, content := range regPayload.Contents {
-				buf := new(bytes.Buffer)
-				buf.WriteString(regPayload.ID)
-				buf.WriteString(content.Path)
-				c.PersistRegisterIdentificationTx(buf.Bytes(), txn.Hash())
+			if err := c.PersistIdentification(txn, identifications); err != nil {
+				return err
 			}
 		}
 	}
@@ -323,6 +364,14 @@ func (c *ChainStore) PersistTransactions(b *core.Block) error {
 }
 
 func (c *ChainStore) RollbackTransactions(b *core.Block) error {
+	for i := len(b.Transactions) - 1; i >= 0; i-- {
+		txn := b.Transactions[i]
+		if txn.TxType == core.RegisterIdentification {
+			if err := c.RollbackIdentification(txn); err != nil {
+				return err
+			}
+		}
+	}
 	for _, txn := range b.Transactions {
 		if err := c.RollbackTransaction(txn); err != nil {
 			return err
@@ -334,11 +383,13 @@ func (c *ChainStore) RollbackTransactions(b *core.Block) error {
 		}
 		if txn.TxType == core.RechargeToSideChain {
 			rechargePayload := txn.Payload.(*core.PayloadRechargeToSideChain)
-			hash, err := rechargePayload.GetMainchainTxHash()
+			hashes, err := rechargePayload.GetMainchainTxHashes()
 			if err != nil {
 				return err
 			}
-			c.RollbackMainchainTx(*hash)
+			for _, hash := range hashes {
+				c.RollbackMainchainTx(hash)
+			}
 		}
 	}
 
@@ -357,6 +408,9 @@ func (c *ChainStore) RollbackTransaction(txn *core.Transaction) error {
 }
 
 func (c *ChainStore) RollbackAsset(assetId Uint256) error {
+	if asset, err := c.GetAsset(assetId); err == nil {
+		c.assetIndex.Remove(asset.Name, assetId)
+	}
 	key := new(bytes.Buffer)
 	key.WriteByte(byte(ST_Info))
 	assetId.Serialize(key)
@@ -409,6 +463,7 @@ func (c *ChainStore) PersistUnspend(b *core.Block) error {
 		}
 	}
 
+	var spentTxs []Uint256
 	for txhash, value := range unspents {
 		key := bytes.NewBuffer(nil)
 		key.WriteByte(byte(IX_Unspent))
@@ -416,12 +471,18 @@ func (c *ChainStore) PersistUnspend(b *core.Block) error {
 
 		if len(value) == 0 {
 			c.BatchDelete(key.Bytes())
+			spentTxs = append(spentTxs, txhash)
 		} else {
 			unspentArray := ToByteArray(value)
 			c.BatchPut(key.Bytes(), unspentArray)
 		}
 	}
 
+	// record the fully spent transactions to be pruned later
+	if config.Parameters.PruneMode && len(spentTxs) > 0 {
+		return c.putSpentTxs(b.Header.Height, spentTxs)
+	}
+
 	return nil
 }
 
@@ -467,10 +528,33 @@ func (c *ChainStore) RollbackUnspend(b *core.Block) error {
 			c.BatchPut(key.Bytes(), unspentArray)
 		}
 	}
+	c.BatchDelete(spentTxsKey(b.Header.Height))
 
 	return nil
 }
 
+// key: IX_Spent_Tx || height
+// value: hashes of the transactions fully spent by the block at height
+func (c *ChainStore) putSpentTxs(height uint32, hashes []Uint256) error {
+	value := new(bytes.Buffer)
+	if err := WriteVarUint(value, uint64(len(hashes))); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if err := hash.Serialize(value); err != nil {
+			return err
+		}
+	}
+	c.BatchPut(spentTxsKey(height), value.Bytes())
+	return nil
+}
+
+func spentTxsKey(height uint32) []byte {
+	key := bytes.NewBuffer([]byte{byte(IX_Spent_Tx)})
+	WriteUint32(key, height)
+	return key.Bytes()
+}
+
 func GetUint16Array(source []byte) ([]uint16, error) {
 	if source == nil {
 		return nil, errors.New("[Common] , GetUint16Array err, source = nil")
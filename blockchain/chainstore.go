@@ -4,14 +4,17 @@ import (
 	"bytes"
 	"container/list"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/elastos/Elastos.ELA.SideChain/config"
 	"github.com/elastos/Elastos.ELA.SideChain/core"
 	"github.com/elastos/Elastos.ELA.SideChain/events"
 	"github.com/elastos/Elastos.ELA.SideChain/log"
 
 	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
 )
 
 const ValueNone = 0
@@ -19,8 +22,16 @@ const ValueExist = 1
 
 const TaskChanCap = 4
 
+// DefaultPruneRetention is the number of recent blocks not pruned when
+// PruneRetention is not configured.
+const DefaultPruneRetention = 2880
+
 var (
 	ErrDBNotFound = errors.New("leveldb: not found")
+
+	// ErrBlockPruned is returned when the transactions of a block are
+	// deleted in prune mode.
+	ErrBlockPruned = errors.New("block data pruned")
 )
 
 type persistTask interface{}
@@ -48,6 +59,9 @@ type ChainStore struct {
 
 	currentBlockHeight uint32
 	storedHeaderCount  uint32
+
+	mainchainTxFilter *mainchainTxFilter
+	assetIndex        *assetIndex
 }
 
 func NewChainStore() (IChainStore, error) {
@@ -66,13 +80,20 @@ func NewChainStore() (IChainStore, error) {
 		storedHeaderCount:  0,
 		taskCh:             make(chan persistTask, TaskChanCap),
 		quit:               make(chan chan bool, 1),
+		mainchainTxFilter:  newMainchainTxFilter(),
+		assetIndex:         newAssetIndex(),
 	}
 
+	store.loadMainchainTxFilter()
+	store.loadAssetIndex()
+
 	go store.loop()
 
 	return store, nil
 }
 
+// Close closes the store after the block being persisted or rolled back is
+// fully committed, the blocks queued after it are discarded.
 func (c *ChainStore) Close() {
 	closed := make(chan bool)
 	c.quit <- closed
@@ -120,6 +141,22 @@ func (c *ChainStore) clearCache(b *core.Block) {
 	}
 }
 
+// checkNetwork checks the data directory was created by the active network,
+// a directory created before the network was stamped is stamped with it.
+func (c *ChainStore) checkNetwork() error {
+	key := []byte{byte(CFG_Network)}
+	network := config.Parameters.ChainParam.Name
+	stored, err := c.Get(key)
+	if err != nil {
+		return c.Put(key, []byte(network))
+	}
+	if string(stored) != network {
+		return fmt.Errorf("the data directory was created by network %s, can not open it on %s",
+			string(stored), network)
+	}
+	return nil
+}
+
 func (c *ChainStore) InitWithGenesisBlock(genesisBlock *core.Block) (uint32, error) {
 	prefix := []byte{byte(CFG_Version)}
 	version, err := c.Get(prefix)
@@ -127,6 +164,12 @@ func (c *ChainStore) InitWithGenesisBlock(genesisBlock *core.Block) (uint32, err
 		version = []byte{0x00}
 	}
 
+	if version[0] != 0x00 {
+		if err := c.checkNetwork(); err != nil {
+			return 0, err
+		}
+	}
+
 	if version[0] == 0x00 {
 		// batch delete old data
 		c.NewBatch()
@@ -151,13 +194,22 @@ func (c *ChainStore) InitWithGenesisBlock(genesisBlock *core.Block) (uint32, err
 		if err != nil {
 			return 0, err
 		}
+		err = c.Put([]byte{byte(CFG_Network)}, []byte(config.Parameters.ChainParam.Name))
+		if err != nil {
+			return 0, err
+		}
 	}
 
 	// GenesisBlock should exist in chain
-	// Or the bookkeepers are not consistent with the chain
+	// Or the genesis parameters are not consistent with the chain
 	hash := genesisBlock.Hash()
-	if !c.IsBlockInStore(hash) {
-		return 0, errors.New("genesis block is not consistent with the chain")
+	storedHash, err := c.GetBlockHash(0)
+	if err != nil {
+		return 0, errors.New("genesis block is not found in the chain")
+	}
+	if !storedHash.IsEqual(hash) || !c.IsBlockInStore(hash) {
+		return 0, fmt.Errorf("stored genesis block %s does not match the configured genesis block %s",
+			BytesToHexString(BytesReverse(storedHash.Bytes())), BytesToHexString(BytesReverse(hash.Bytes())))
 	}
 	DefaultLedger.Blockchain.GenesisHash = hash
 
@@ -174,6 +226,11 @@ func (c *ChainStore) InitWithGenesisBlock(genesisBlock *core.Block) (uint32, err
 	c.currentBlockHeight, err = ReadUint32(r)
 	endHeight := c.currentBlockHeight
 
+	// Repair the best block record if the node stopped in a block write
+	if err := c.checkBestBlock(blockHash, endHeight); err != nil {
+		return 0, err
+	}
+
 	startHeight := uint32(0)
 	if endHeight > MinMemoryNodes {
 		startHeight = endHeight - MinMemoryNodes
@@ -213,6 +270,14 @@ func (c *ChainStore) IsTxHashDuplicate(txhash Uint256) bool {
 }
 
 func (c *ChainStore) IsDoubleSpend(txn *core.Transaction) bool {
+	return c.IsDoubleSpendWithView(txn, nil)
+}
+
+// IsDoubleSpendWithView checks the inputs of the transaction spend unspent
+// outputs in the store, the inputs spending the outputs of the unconfirmed
+// transactions in the view are not checked, the spends of them conflict with
+// each other in the transaction pool.
+func (c *ChainStore) IsDoubleSpendWithView(txn *core.Transaction, view MempoolView) bool {
 	if len(txn.Inputs) == 0 {
 		return false
 	}
@@ -222,6 +287,12 @@ func (c *ChainStore) IsDoubleSpend(txn *core.Transaction) bool {
 		txhash := txn.Inputs[i].Previous.TxID
 		unspentValue, err_get := c.Get(append(unspentPrefix, txhash.Bytes()...))
 		if err_get != nil {
+			if view != nil && !c.IsTxHashDuplicate(txhash) {
+				if parent := view.GetTransaction(txhash); parent != nil &&
+					int(txn.Inputs[i].Previous.Index) < len(parent.Outputs) {
+					continue
+				}
+			}
 			return true
 		}
 
@@ -243,15 +314,48 @@ func (c *ChainStore) IsDoubleSpend(txn *core.Transaction) bool {
 }
 
 func (c *ChainStore) IsMainchainTxHashDuplicate(mainchainTxHash Uint256) bool {
+	if !c.mainchainTxFilter.MayContain(mainchainTxHash) {
+		return false
+	}
+
 	prefix := []byte{byte(IX_MainChain_Tx)}
 	_, err := c.Get(append(prefix, mainchainTxHash.Bytes()...))
 	if err != nil {
+		c.mainchainTxFilter.FalsePositive()
 		return false
 	} else {
 		return true
 	}
 }
 
+// MainchainTxFilterStats returns the number of lookups, matches and false
+// positives of the main chain transaction filter.
+func (c *ChainStore) MainchainTxFilterStats() (lookups, positives, falsePositives uint64) {
+	return c.mainchainTxFilter.Stats()
+}
+
+// loadMainchainTxFilter adds the stored main chain transaction hashes to the
+// filter.
+func (c *ChainStore) loadMainchainTxFilter() {
+	iter := c.NewIterator([]byte{byte(IX_MainChain_Tx)})
+	defer iter.Release()
+	for iter.Next() {
+		var hash Uint256
+		if err := hash.Deserialize(bytes.NewReader(iter.Key()[1:])); err != nil {
+			log.Warn("[loadMainchainTxFilter] invalid mainchain tx key:", err.Error())
+			continue
+		}
+		c.mainchainTxFilter.Add(hash)
+	}
+}
+
+// loadAssetIndex indexes the stored assets by their canonical names.
+func (c *ChainStore) loadAssetIndex() {
+	for id, asset := range c.GetAssets() {
+		c.assetIndex.Add(asset.Name, id)
+	}
+}
+
 func (c *ChainStore) GetBlockHash(height uint32) (Uint256, error) {
 	queryKey := bytes.NewBuffer(nil)
 	queryKey.WriteByte(byte(DATA_BlockHash))
@@ -331,6 +435,23 @@ func (c *ChainStore) GetHeader(hash Uint256) (*core.Header, error) {
 	return h, err
 }
 
+// GetStateRoot returns the state root committed by the header of the block at
+// the given height.
+func (c *ChainStore) GetStateRoot(height uint32) (Uint256, error) {
+	hash, err := c.GetBlockHash(height)
+	if err != nil {
+		return Uint256{}, err
+	}
+	header, err := c.GetHeader(hash)
+	if err != nil {
+		return Uint256{}, err
+	}
+	if header.Version < core.StateRootVersion {
+		return Uint256{}, fmt.Errorf("block %d has no state root", height)
+	}
+	return header.StateRoot, nil
+}
+
 func (c *ChainStore) PersistAsset(assetId Uint256, asset core.Asset) error {
 	w := bytes.NewBuffer(nil)
 
@@ -348,9 +469,22 @@ func (c *ChainStore) PersistAsset(assetId Uint256, asset core.Asset) error {
 	// PUT VALUE
 	c.BatchPut(assetKey.Bytes(), w.Bytes())
 
+	// index the asset by its canonical name
+	c.assetIndex.Add(asset.Name, assetId)
+
 	return nil
 }
 
+// GetAssetByName returns the registered asset of the same canonical name, it
+// looks up the in memory asset index instead of scanning the asset table.
+func (c *ChainStore) GetAssetByName(name string) (*core.Asset, error) {
+	id, ok := c.assetIndex.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("asset %s not found", name)
+	}
+	return c.GetAsset(id)
+}
+
 func (c *ChainStore) GetAsset(hash Uint256) (*core.Asset, error) {
 	log.Debugf("GetAsset Hash: %s", hash.String())
 
@@ -374,6 +508,7 @@ func (c *ChainStore) PersistMainchainTx(mainchainTxHash Uint256) {
 
 	// PUT VALUE
 	c.BatchPut(key, []byte{byte(ValueExist)})
+	c.mainchainTxFilter.Add(mainchainTxHash)
 }
 
 func (c *ChainStore) GetMainchainTx(mainchainTxHash Uint256) (byte, error) {
@@ -426,22 +561,60 @@ func (c *ChainStore) GetTransaction(txId Uint256) (*core.Transaction, uint32, er
 }
 
 func (c *ChainStore) GetTxReference(tx *core.Transaction) (map[*core.Input]*core.Output, error) {
+	return c.GetTxReferenceWithView(tx, nil)
+}
+
+// GetTxReferenceWithView returns the outputs referenced by the inputs of the
+// transaction, the referenced transactions not found in the store are looked
+// up in the view, so a transaction can spend the outputs of the unconfirmed
+// transactions in the view.
+func (c *ChainStore) GetTxReferenceWithView(tx *core.Transaction, view MempoolView) (map[*core.Input]*core.Output, error) {
 	if tx.TxType == core.RegisterAsset {
 		return nil, nil
 	}
+	return c.getTxReferences([]*core.Transaction{tx}, view)
+}
+
+// GetTxReferences returns the outputs referenced by the inputs of the
+// transactions, each referenced transaction is read from the store once no
+// matter how many inputs spend its outputs.
+func (c *ChainStore) GetTxReferences(txs []*core.Transaction) (map[*core.Input]*core.Output, error) {
+	return c.getTxReferences(txs, nil)
+}
+
+func (c *ChainStore) getTxReferences(txs []*core.Transaction, view MempoolView) (map[*core.Input]*core.Output, error) {
 	//UTXO input /  Outputs
 	reference := make(map[*core.Input]*core.Output)
-	// Key index，v UTXOInput
-	for _, utxo := range tx.Inputs {
-		transaction, _, err := c.GetTransaction(utxo.Previous.TxID)
-		if err != nil {
-			return nil, errors.New("GetTxReference failed, previous transaction not found")
+	parents := make(map[Uint256]*core.Transaction)
+	for _, tx := range txs {
+		if tx.TxType == core.RegisterAsset {
+			continue
 		}
-		index := utxo.Previous.Index
-		if int(index) >= len(transaction.Outputs) {
-			return nil, errors.New("GetTxReference failed, refIdx out of range.")
+		for _, utxo := range tx.Inputs {
+			transaction, ok := parents[utxo.Previous.TxID]
+			if !ok {
+				var err error
+				transaction, _, err = c.GetTransaction(utxo.Previous.TxID)
+				if err == nil {
+					txReferenceStoreHits.Inc()
+				} else if view != nil {
+					transaction = view.GetTransaction(utxo.Previous.TxID)
+					if transaction != nil {
+						txReferenceViewHits.Inc()
+					}
+				}
+				if transaction == nil {
+					txReferenceMisses.Inc()
+					return nil, errors.New("GetTxReference failed, previous transaction not found")
+				}
+				parents[utxo.Previous.TxID] = transaction
+			}
+			index := utxo.Previous.Index
+			if int(index) >= len(transaction.Outputs) {
+				return nil, errors.New("GetTxReference failed, refIdx out of range.")
+			}
+			reference[utxo] = transaction.Outputs[index]
 		}
-		reference[utxo] = transaction.Outputs[index]
 	}
 	return reference, nil
 }
@@ -497,6 +670,9 @@ func (c *ChainStore) GetBlock(hash Uint256) (*core.Block, error) {
 	for i, txn := range b.Transactions {
 		tmp, _, err := c.GetTransaction(txn.Hash())
 		if err != nil {
+			if b.Header.Height < c.GetPrunedHeight() {
+				return nil, ErrBlockPruned
+			}
 			return nil, err
 		}
 		b.Transactions[i] = tmp
@@ -510,10 +686,14 @@ func (c *ChainStore) rollback(b *core.Block) error {
 	c.RollbackTrimmedBlock(b)
 	c.RollbackBlockHash(b)
 	c.RollbackTransactions(b)
+	c.RollbackAssetCount(b)
 	c.RollbackUnspendUTXOs(b)
 	c.RollbackUnspend(b)
 	c.RollbackCurrentBlock(b)
-	c.BatchCommit()
+	if err := c.BatchCommit(); err != nil {
+		return err
+	}
+	c.putBestBlock(b.Header.Previous, b.Header.Height-1)
 
 	DefaultLedger.Blockchain.UpdateBestHeight(b.Header.Height - 1)
 	c.mu.Lock()
@@ -536,6 +716,9 @@ func (c *ChainStore) persist(b *core.Block) error {
 	if err := c.PersistTransactions(b); err != nil {
 		return err
 	}
+	if err := c.PersistAssetCount(b); err != nil {
+		return err
+	}
 	if err := c.PersistUnspendUTXOs(b); err != nil {
 		return err
 	}
@@ -545,7 +728,10 @@ func (c *ChainStore) persist(b *core.Block) error {
 	if err := c.PersistCurrentBlock(b); err != nil {
 		return err
 	}
-	return c.BatchCommit()
+	if err := c.BatchCommit(); err != nil {
+		return err
+	}
+	return c.putBestBlock(b.Hash(), b.Header.Height)
 }
 
 // can only be invoked by backend write goroutine
@@ -604,9 +790,164 @@ func (c *ChainStore) persistBlock(block *core.Block) {
 	c.currentBlockHeight = block.Header.Height
 	c.mu.Unlock()
 
+	if height := pruneHeight(block.Header.Height); config.Parameters.PruneMode && height > 0 {
+		if err := c.PruneBelow(height); err != nil {
+			log.Error("[persistBlocks]: error to prune blocks:", err.Error())
+		}
+	}
+
 	DefaultLedger.Blockchain.BCEvents.Notify(events.EventBlockPersistCompleted, block)
 }
 
+// PruneBelow deletes the bodies of the transactions fully spent by blocks
+// below the height, while headers, unspent transactions and the main chain
+// transaction index are kept. Blocks below the height can not be rolled back
+// after pruning. It can only be invoked by backend write goroutine.
+func (c *ChainStore) PruneBelow(height uint32) error {
+	prunedHeight := c.GetPrunedHeight()
+	if height <= prunedHeight {
+		return nil
+	}
+
+	c.NewBatch()
+	for h := prunedHeight; h < height; h++ {
+		key := spentTxsKey(h)
+		data, err := c.Get(key)
+		if err != nil {
+			continue
+		}
+
+		r := bytes.NewReader(data)
+		count, err := ReadVarUint(r, 0)
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < count; i++ {
+			var hash Uint256
+			if err := hash.Deserialize(r); err != nil {
+				return err
+			}
+			c.BatchDelete(append([]byte{byte(DATA_Transaction)}, hash.Bytes()...))
+		}
+		c.BatchDelete(key)
+	}
+
+	value := new(bytes.Buffer)
+	if err := WriteUint32(value, height); err != nil {
+		return err
+	}
+	c.BatchPut([]byte{byte(SYS_PrunedHeight)}, value.Bytes())
+	return c.BatchCommit()
+}
+
+// GetPrunedHeight returns the height below which the blocks are pruned.
+func (c *ChainStore) GetPrunedHeight() uint32 {
+	data, err := c.Get([]byte{byte(SYS_PrunedHeight)})
+	if err != nil {
+		return 0
+	}
+	height, err := ReadUint32(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	return height
+}
+
+// putBestBlock advances the best block record, it is written only after the
+// batch of the block is synced to disk, so a current block ahead of the best
+// block record means the node stopped in the block write.
+func (c *ChainStore) putBestBlock(hash Uint256, height uint32) error {
+	value := new(bytes.Buffer)
+	if err := hash.Serialize(value); err != nil {
+		return err
+	}
+	if err := WriteUint32(value, height); err != nil {
+		return err
+	}
+	return c.Put([]byte{byte(SYS_BestBlock)}, value.Bytes())
+}
+
+// getBestBlock returns the best block record.
+func (c *ChainStore) getBestBlock() (Uint256, uint32, error) {
+	var hash Uint256
+	data, err := c.Get([]byte{byte(SYS_BestBlock)})
+	if err != nil {
+		return hash, 0, err
+	}
+	r := bytes.NewReader(data)
+	if err := hash.Deserialize(r); err != nil {
+		return hash, 0, err
+	}
+	height, err := ReadUint32(r)
+	return hash, height, err
+}
+
+// checkBestBlock compares the current block with the best block record, the
+// current block is validated again if they differ, and the record is repaired
+// if the block is complete.
+func (c *ChainStore) checkBestBlock(hash Uint256, height uint32) error {
+	bestHash, bestHeight, err := c.getBestBlock()
+	if err == nil && bestHash.IsEqual(hash) && bestHeight == height {
+		return nil
+	}
+
+	if err := c.validateBlock(hash, height); err != nil {
+		return fmt.Errorf("torn write of block %d detected, %s", height, err)
+	}
+	return c.putBestBlock(hash, height)
+}
+
+// validateBlock checks the block is fully stored at the height, the header,
+// the block hash index and all the transactions matching the merkle root.
+func (c *ChainStore) validateBlock(hash Uint256, height uint32) error {
+	indexHash, err := c.GetBlockHash(height)
+	if err != nil || !indexHash.IsEqual(hash) {
+		return errors.New("block hash index mismatch")
+	}
+	block, err := c.GetBlock(hash)
+	if err != nil {
+		return fmt.Errorf("block data missing, %s", err)
+	}
+	if block.Header.Height != height {
+		return errors.New("block height mismatch")
+	}
+	txIds := make([]Uint256, 0, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		txIds = append(txIds, tx.Hash())
+	}
+	root, err := crypto.ComputeRoot(txIds)
+	if err != nil || !root.IsEqual(block.Header.MerkleRoot) {
+		return errors.New("block transactions mismatch merkle root")
+	}
+	return nil
+}
+
+// pruneHeight returns the height below which the blocks can be pruned when
+// the chain tip is at the given height. The blocks within PruneRetention or
+// MaxReorgDepth of the tip, and the blocks after the latest checkpoint are
+// never pruned.
+func pruneHeight(tip uint32) uint32 {
+	keep := pruneRetention()
+	if depth := maxReorgDepth(); depth > keep {
+		keep = depth
+	}
+	if tip <= keep {
+		return 0
+	}
+	height := tip - keep
+	if latest := LatestCheckpoint(); latest != nil && latest.Height+1 < height {
+		height = latest.Height + 1
+	}
+	return height
+}
+
+func pruneRetention() uint32 {
+	if config.Parameters.PruneRetention > 0 {
+		return config.Parameters.PruneRetention
+	}
+	return DefaultPruneRetention
+}
+
 func (c *ChainStore) GetUnspent(txid Uint256, index uint16) (*core.Output, error) {
 	if ok, _ := c.ContainsUnspent(txid, index); ok {
 		tx, _, err := c.GetTransaction(txid)
@@ -794,6 +1135,76 @@ func (c *ChainStore) GetUnspentsFromProgramHash(programHash Uint168) (map[Uint25
 	return uxtoUnspents, nil
 }
 
+// GetUTXOsByProgramHash returns the unspent outputs of all assets paid to
+// the program hash, it reads the program hash indexed unspent bucket which is
+// updated when blocks are connected and disconnected.
+func (c *ChainStore) GetUTXOsByProgramHash(programHash Uint168) ([]*UTXO, error) {
+	utxos := make([]*UTXO, 0)
+
+	key := []byte{byte(IX_Unspent_UTXO)}
+	key = append(key, programHash.Bytes()...)
+	iter := c.NewIterator(key)
+	defer iter.Release()
+	for iter.Next() {
+		r := bytes.NewReader(iter.Value())
+		listNum, err := ReadVarUint(r, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < int(listNum); i++ {
+			uu := new(UTXO)
+			if err := uu.Deserialize(r); err != nil {
+				return nil, err
+			}
+			utxos = append(utxos, uu)
+		}
+	}
+
+	return utxos, nil
+}
+
+// GetUnspentOutputsFromProgramHash returns the unspent outputs of the asset
+// paid to the program hash, with the heights they were confirmed at.
+func (c *ChainStore) GetUnspentOutputsFromProgramHash(programHash Uint168, assetid Uint256) ([]*UnspentOutput, error) {
+	unspents := make([]*UnspentOutput, 0)
+
+	key := []byte{byte(IX_Unspent_UTXO)}
+	key = append(key, programHash.Bytes()...)
+	key = append(key, assetid.Bytes()...)
+	iter := c.NewIterator(key)
+	defer iter.Release()
+	for iter.Next() {
+		// read height from key
+		rk := bytes.NewReader(iter.Key()[len(key):])
+		height, err := ReadUint32(rk)
+		if err != nil {
+			return nil, err
+		}
+
+		r := bytes.NewReader(iter.Value())
+		listNum, err := ReadVarUint(r, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < int(listNum); i++ {
+			uu := new(UTXO)
+			if err := uu.Deserialize(r); err != nil {
+				return nil, err
+			}
+			unspents = append(unspents, &UnspentOutput{
+				OutPoint: *core.NewOutPoint(uu.TxId, uint16(uu.Index)),
+				AssetID:  assetid,
+				Value:    uu.Value,
+				Height:   height,
+			})
+		}
+	}
+
+	return unspents, nil
+}
+
 func (c *ChainStore) PersistUnspentWithProgramHash(programHash Uint168, assetid Uint256, height uint32, unspents []*UTXO) error {
 	prefix := []byte{byte(IX_Unspent_UTXO)}
 	prefix = append(prefix, programHash.Bytes()...)
@@ -821,6 +1232,20 @@ func (c *ChainStore) PersistUnspentWithProgramHash(programHash Uint168, assetid
 	return nil
 }
 
+// GetAssetCount returns the number of registered assets, stores created
+// before the count was recorded fall back to counting the asset table.
+func (c *ChainStore) GetAssetCount() uint32 {
+	data, err := c.Get([]byte{byte(SYS_AssetCount)})
+	if err != nil {
+		return uint32(len(c.GetAssets()))
+	}
+	count, err := ReadUint32(bytes.NewReader(data))
+	if err != nil {
+		return uint32(len(c.GetAssets()))
+	}
+	return count
+}
+
 func (c *ChainStore) GetAssets() map[Uint256]*core.Asset {
 	assets := make(map[Uint256]*core.Asset)
 
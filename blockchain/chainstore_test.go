@@ -2,8 +2,10 @@ package blockchain
 
 import (
 	"container/list"
+	"crypto/rand"
 	"testing"
 
+	"github.com/elastos/Elastos.ELA.SideChain/config"
 	"github.com/elastos/Elastos.ELA.SideChain/core"
 
 	"bytes"
@@ -29,6 +31,8 @@ func newTestChainStore() (*ChainStore, error) {
 		storedHeaderCount:  0,
 		taskCh:             make(chan persistTask, TaskChanCap),
 		quit:               make(chan chan bool, 1),
+		mainchainTxFilter:  newMainchainTxFilter(),
+		assetIndex:         newAssetIndex(),
 	}
 
 	go store.loop()
@@ -199,6 +203,345 @@ func TestChainStore_IsMainchainTxHashDuplicate(t *testing.T) {
 	}
 }
 
+func TestChainStore_GetUTXOsByProgramHash(t *testing.T) {
+	if testChainStore == nil {
+		t.Error("Chainstore init failed")
+	}
+
+	var programHash, otherProgramHash common.Uint168
+	programHash[0], otherProgramHash[0] = common.PrefixStandard, common.PrefixMultisig
+	assetA, assetB := common.Uint256{1}, common.Uint256{2}
+	utxoA := &UTXO{TxId: common.Uint256{3}, Index: 0, Value: 100}
+	utxoB := &UTXO{TxId: common.Uint256{4}, Index: 1, Value: 200}
+	utxoOther := &UTXO{TxId: common.Uint256{5}, Index: 0, Value: 300}
+
+	// 1. Persist unspents of two assets and another program hash
+	testChainStore.PersistUnspentWithProgramHash(programHash, assetA, 10, []*UTXO{utxoA})
+	testChainStore.PersistUnspentWithProgramHash(programHash, assetB, 11, []*UTXO{utxoB})
+	testChainStore.PersistUnspentWithProgramHash(otherProgramHash, assetA, 10, []*UTXO{utxoOther})
+	testChainStore.BatchCommit()
+
+	// 2. Only the unspents of the program hash are returned
+	utxos, err := testChainStore.GetUTXOsByProgramHash(programHash)
+	if err != nil {
+		t.Error("Get UTXOs by program hash failed")
+	}
+	if len(utxos) != 2 || *utxos[0] != *utxoA || *utxos[1] != *utxoB {
+		t.Error("UTXOs of the program hash matched wrong value")
+	}
+
+	// 3. Remove the unspents
+	testChainStore.PersistUnspentWithProgramHash(programHash, assetA, 10, nil)
+	testChainStore.PersistUnspentWithProgramHash(programHash, assetB, 11, nil)
+	testChainStore.PersistUnspentWithProgramHash(otherProgramHash, assetA, 10, nil)
+	testChainStore.BatchCommit()
+
+	utxos, err = testChainStore.GetUTXOsByProgramHash(programHash)
+	if err != nil {
+		t.Error("Get UTXOs by program hash failed")
+	}
+	if len(utxos) != 0 {
+		t.Error("Found UTXOs which should been deleted")
+	}
+}
+
+func TestChainStore_GetUnspentOutputsFromProgramHash(t *testing.T) {
+	if testChainStore == nil {
+		t.Error("Chainstore init failed")
+	}
+
+	var programHash common.Uint168
+	programHash[0] = common.PrefixStandard
+	elaAsset, tokenAsset := common.Uint256{1}, common.Uint256{2}
+	elaUTXO := &UTXO{TxId: common.Uint256{3}, Index: 0, Value: 100}
+	tokenUTXO := &UTXO{TxId: common.Uint256{3}, Index: 1, Value: 5000}
+
+	// 1. Persist an ELA unspent and a token unspent of the same address
+	testChainStore.PersistUnspentWithProgramHash(programHash, elaAsset, 10, []*UTXO{elaUTXO})
+	testChainStore.PersistUnspentWithProgramHash(programHash, tokenAsset, 12, []*UTXO{tokenUTXO})
+	testChainStore.BatchCommit()
+
+	// 2. Only the unspents of the asset are returned
+	unspents, err := testChainStore.GetUnspentOutputsFromProgramHash(programHash, elaAsset)
+	if err != nil {
+		t.Error("Get unspent outputs of ELA failed")
+	}
+	expect := UnspentOutput{
+		OutPoint: *core.NewOutPoint(elaUTXO.TxId, 0),
+		AssetID:  elaAsset,
+		Value:    100,
+		Height:   10,
+	}
+	if len(unspents) != 1 || *unspents[0] != expect {
+		t.Error("Unspent outputs of ELA matched wrong value")
+	}
+
+	unspents, err = testChainStore.GetUnspentOutputsFromProgramHash(programHash, tokenAsset)
+	if err != nil {
+		t.Error("Get unspent outputs of token failed")
+	}
+	expect = UnspentOutput{
+		OutPoint: *core.NewOutPoint(tokenUTXO.TxId, 1),
+		AssetID:  tokenAsset,
+		Value:    5000,
+		Height:   12,
+	}
+	if len(unspents) != 1 || *unspents[0] != expect {
+		t.Error("Unspent outputs of token matched wrong value")
+	}
+
+	// 3. Remove the unspents
+	testChainStore.PersistUnspentWithProgramHash(programHash, elaAsset, 10, nil)
+	testChainStore.PersistUnspentWithProgramHash(programHash, tokenAsset, 12, nil)
+	testChainStore.BatchCommit()
+}
+
+func TestChainStore_MainchainTxFilter(t *testing.T) {
+	if testChainStore == nil {
+		t.Error("Chainstore init failed")
+	}
+
+	hashes := make([]common.Uint256, 100)
+	for i := range hashes {
+		rand.Read(hashes[i][:])
+	}
+
+	// 1. Record the mainchain transactions
+	testChainStore.NewBatch()
+	for _, hash := range hashes {
+		testChainStore.PersistMainchainTx(hash)
+	}
+	testChainStore.BatchCommit()
+
+	// 2. Recorded hashes are never filtered out
+	for _, hash := range hashes {
+		if !testChainStore.IsMainchainTxHashDuplicate(hash) {
+			t.Error("Recorded mainchain transaction filtered out")
+		}
+	}
+
+	// 3. Recorded hashes are never filtered out after reloading the filter
+	testChainStore.mainchainTxFilter = newMainchainTxFilter()
+	testChainStore.loadMainchainTxFilter()
+	for _, hash := range hashes {
+		if !testChainStore.IsMainchainTxHashDuplicate(hash) {
+			t.Error("Recorded mainchain transaction filtered out after reloading")
+		}
+	}
+
+	// 4. Unrecorded hashes are not duplicate
+	var unrecorded common.Uint256
+	rand.Read(unrecorded[:])
+	if testChainStore.IsMainchainTxHashDuplicate(unrecorded) {
+		t.Error("Unrecorded mainchain transaction is duplicate")
+	}
+
+	lookups, positives, falsePositives := testChainStore.MainchainTxFilterStats()
+	if lookups != 101 || positives != 100+falsePositives {
+		t.Error("Mainchain transaction filter stats matched wrong value")
+	}
+
+	// 5. Remove the mainchain transactions
+	testChainStore.NewBatch()
+	for _, hash := range hashes {
+		testChainStore.RollbackMainchainTx(hash)
+	}
+	testChainStore.BatchCommit()
+}
+
+func TestChainStore_PruneBelow(t *testing.T) {
+	if testChainStore == nil {
+		t.Error("Chainstore init failed")
+	}
+
+	tx := buildTx()
+	txHash := tx.Hash()
+	depositHash := common.Uint256{4}
+
+	// 1. Persist a transaction spent by the block at height 5
+	testChainStore.NewBatch()
+	testChainStore.PersistTransaction(tx, 5)
+	testChainStore.PersistMainchainTx(depositHash)
+	testChainStore.putSpentTxs(5, []common.Uint256{txHash})
+	testChainStore.BatchCommit()
+
+	// 2. Blocks below the spending block pruned, the transaction is kept
+	if err := testChainStore.PruneBelow(5); err != nil {
+		t.Error("Prune below height 5 failed")
+	}
+	if _, _, err := testChainStore.GetTransaction(txHash); err != nil {
+		t.Error("Transaction pruned before the spending block")
+	}
+
+	// 3. The spending block pruned, the transaction is removed
+	if err := testChainStore.PruneBelow(6); err != nil {
+		t.Error("Prune below height 6 failed")
+	}
+	if _, _, err := testChainStore.GetTransaction(txHash); err == nil {
+		t.Error("Transaction not pruned")
+	}
+	if testChainStore.GetPrunedHeight() != 6 {
+		t.Error("Pruned height matched wrong value")
+	}
+
+	// 4. The mainchain transaction index is kept
+	if !testChainStore.IsMainchainTxHashDuplicate(depositHash) {
+		t.Error("Mainchain transaction index pruned")
+	}
+
+	// 5. Remove the mainchain transaction and the pruned height
+	testChainStore.NewBatch()
+	testChainStore.RollbackMainchainTx(depositHash)
+	testChainStore.BatchDelete([]byte{byte(SYS_PrunedHeight)})
+	testChainStore.BatchCommit()
+}
+
+func TestChainStore_CheckBestBlock(t *testing.T) {
+	if testChainStore == nil {
+		t.Error("Chainstore init failed")
+	}
+
+	bestHash := common.Uint256{5}
+	tornHash := common.Uint256{6}
+
+	// 1. Put the best block record
+	if err := testChainStore.putBestBlock(bestHash, 10); err != nil {
+		t.Error("Put best block failed")
+	}
+
+	// 2. The current block matches the best block record
+	if err := testChainStore.checkBestBlock(bestHash, 10); err != nil {
+		t.Error("Best block check failed")
+	}
+
+	// 3. The current block ahead of the record is not fully stored
+	if err := testChainStore.checkBestBlock(tornHash, 11); err == nil {
+		t.Error("Torn block write not detected")
+	}
+	hash, height, err := testChainStore.getBestBlock()
+	if err != nil || !hash.IsEqual(bestHash) || height != 10 {
+		t.Error("Best block record changed by torn block")
+	}
+
+	// 4. Remove the best block record
+	testChainStore.Delete([]byte{byte(SYS_BestBlock)})
+}
+
+func TestChainStore_CheckNetwork(t *testing.T) {
+	if testChainStore == nil {
+		t.Error("Chainstore init failed")
+	}
+
+	chainParam := config.Parameters.ChainParam
+	defer func() { config.Parameters.ChainParam = chainParam }()
+	key := []byte{byte(CFG_Network)}
+	stored, storedErr := testChainStore.Get(key)
+
+	// 1. A directory not stamped is stamped with the active network
+	testChainStore.Delete(key)
+	config.Parameters.ChainParam = &config.ChainParams{Name: "TestNet"}
+	if err := testChainStore.checkNetwork(); err != nil {
+		t.Error("Stamp the network failed")
+	}
+	if network, err := testChainStore.Get(key); err != nil || string(network) != "TestNet" {
+		t.Error("Network not stamped")
+	}
+
+	// 2. The same network opens the directory
+	if err := testChainStore.checkNetwork(); err != nil {
+		t.Error("Network check failed")
+	}
+
+	// 3. Another network can not open the directory
+	config.Parameters.ChainParam = &config.ChainParams{Name: "MainNet"}
+	if err := testChainStore.checkNetwork(); err == nil {
+		t.Error("Directory of another network opened")
+	}
+
+	// 4. Restore the network stamp
+	if storedErr == nil {
+		testChainStore.Put(key, stored)
+	} else {
+		testChainStore.Delete(key)
+	}
+}
+
+// newTestReferences stores parent transactions of 5 outputs each and returns
+// a transaction spending all the outputs of the parents.
+func newTestReferences(store *ChainStore, parents int) (*core.Transaction, []*core.Transaction) {
+	tx := &core.Transaction{TxType: core.TransferAsset, Payload: new(core.PayloadTransferAsset)}
+	txs := make([]*core.Transaction, 0, parents)
+	for i := 0; i < parents; i++ {
+		parent := &core.Transaction{
+			TxType:     core.TransferAsset,
+			Payload:    new(core.PayloadTransferAsset),
+			Attributes: []*core.Attribute{{Usage: core.Nonce, Data: []byte{byte(i)}}},
+		}
+		for j := 0; j < 5; j++ {
+			parent.Outputs = append(parent.Outputs, &core.Output{Value: common.Fixed64(i*10 + j)})
+		}
+		hash := parent.Hash()
+		value := new(bytes.Buffer)
+		common.WriteUint32(value, 1)
+		parent.Serialize(value)
+		store.BatchPut(append([]byte{byte(DATA_Transaction)}, hash.Bytes()...), value.Bytes())
+		for j := range parent.Outputs {
+			tx.Inputs = append(tx.Inputs, &core.Input{Previous: *core.NewOutPoint(hash, uint16(j))})
+		}
+		txs = append(txs, parent)
+	}
+	store.BatchCommit()
+	return tx, txs
+}
+
+func TestChainStore_GetTxReferences(t *testing.T) {
+	if testChainStore == nil {
+		t.Error("Chainstore init failed")
+		return
+	}
+
+	// 1. 50 inputs across 10 parents
+	tx, parents := newTestReferences(testChainStore, 10)
+	references, err := testChainStore.GetTxReferences([]*core.Transaction{tx})
+	if err != nil {
+		t.Error("Get references failed")
+	}
+	if len(references) != 50 {
+		t.Error("Get references returned wrong count")
+	}
+	for i, input := range tx.Inputs {
+		output, ok := references[input]
+		if !ok || output.Value != parents[i/5].Outputs[i%5].Value {
+			t.Error("Reference of input matched wrong output")
+		}
+	}
+
+	// 2. The references of a single transaction are the same
+	single, err := testChainStore.GetTxReference(tx)
+	if err != nil || len(single) != len(references) {
+		t.Error("Get reference of the transaction failed")
+	}
+
+	// 3. Reference out of range
+	tx.Inputs[0].Previous.Index = 5
+	if _, err := testChainStore.GetTxReferences([]*core.Transaction{tx}); err == nil {
+		t.Error("Found the reference out of range")
+	}
+
+	// 4. Unknown parent
+	tx.Inputs[0].Previous.TxID = common.Uint256{}
+	if _, err := testChainStore.GetTxReferences([]*core.Transaction{tx}); err == nil {
+		t.Error("Found the reference of an unknown transaction")
+	}
+
+	// 5. Remove the parents
+	for _, parent := range parents {
+		hash := parent.Hash()
+		testChainStore.BatchDelete(append([]byte{byte(DATA_Transaction)}, hash.Bytes()...))
+	}
+	testChainStore.BatchCommit()
+}
+
 func TestChainStoreDone(t *testing.T) {
 	if testChainStore == nil {
 		t.Error("Chainstore init failed")
@@ -213,3 +556,28 @@ func TestChainStoreDone(t *testing.T) {
 	testChainStore.BatchCommit()
 	testChainStore.Close()
 }
+
+func BenchmarkChainStore_GetTxReferences(b *testing.B) {
+	store, err := newTestChainStore()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer store.Close()
+
+	// 50 inputs across 10 parents
+	tx, parents := newTestReferences(store, 10)
+	defer func() {
+		for _, parent := range parents {
+			hash := parent.Hash()
+			store.BatchDelete(append([]byte{byte(DATA_Transaction)}, hash.Bytes()...))
+		}
+		store.BatchCommit()
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := store.GetTxReferences([]*core.Transaction{tx}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
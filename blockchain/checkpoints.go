@@ -0,0 +1,54 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// ErrCheckpointMismatch is returned when a block at a checkpoint height does
+// not match the checkpoint hash, the peer sent it should be disconnected.
+var ErrCheckpointMismatch = errors.New("block does not match the checkpoint")
+
+// LatestCheckpoint returns the checkpoint with the highest height, or nil if
+// checkpoints are disabled or there is none.
+func LatestCheckpoint() *config.Checkpoint {
+	if config.Parameters.DisableCheckpoints {
+		return nil
+	}
+
+	var latest *config.Checkpoint
+	checkpoints := config.Parameters.ChainParam.Checkpoints
+	for i := range checkpoints {
+		if latest == nil || checkpoints[i].Height > latest.Height {
+			latest = &checkpoints[i]
+		}
+	}
+	return latest
+}
+
+// IsCheckpointed returns if the block at the given height is at or below the
+// latest checkpoint, the signatures of transactions in such block need not be
+// verified.
+func IsCheckpointed(height uint32) bool {
+	latest := LatestCheckpoint()
+	return latest != nil && height <= latest.Height
+}
+
+// CheckCheckpoint returns ErrCheckpointMismatch if there is a checkpoint at
+// the given height and the block hash does not match it.
+func CheckCheckpoint(height uint32, hash Uint256) error {
+	if config.Parameters.DisableCheckpoints {
+		return nil
+	}
+
+	hashStr := BytesToHexString(BytesReverse(hash.Bytes()))
+	for _, checkpoint := range config.Parameters.ChainParam.Checkpoints {
+		if checkpoint.Height == height && checkpoint.Hash != hashStr {
+			return ErrCheckpointMismatch
+		}
+	}
+	return nil
+}
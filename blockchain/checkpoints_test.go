@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCheckpoint(t *testing.T) {
+	var hash, otherHash common.Uint256
+	rand.Read(hash[:])
+	rand.Read(otherHash[:])
+
+	chainParam := config.Parameters.ChainParam
+	disableCheckpoints := config.Parameters.DisableCheckpoints
+	config.Parameters.ChainParam = &config.ChainParams{
+		Checkpoints: []config.Checkpoint{
+			{Height: 100, Hash: common.BytesToHexString(common.BytesReverse(hash.Bytes()))},
+			{Height: 50, Hash: common.BytesToHexString(common.BytesReverse(otherHash.Bytes()))},
+		},
+	}
+	defer func() {
+		config.Parameters.ChainParam = chainParam
+		config.Parameters.DisableCheckpoints = disableCheckpoints
+	}()
+
+	// latest checkpoint
+	config.Parameters.DisableCheckpoints = false
+	assert.Equal(t, uint32(100), LatestCheckpoint().Height)
+	assert.True(t, IsCheckpointed(50))
+	assert.True(t, IsCheckpointed(100))
+	assert.False(t, IsCheckpointed(101))
+
+	// block matches the checkpoint
+	assert.NoError(t, CheckCheckpoint(100, hash))
+
+	// block contradicts the checkpoint
+	assert.Equal(t, ErrCheckpointMismatch, CheckCheckpoint(100, otherHash))
+
+	// no checkpoint at the height
+	assert.NoError(t, CheckCheckpoint(99, otherHash))
+
+	// checkpoints disabled
+	config.Parameters.DisableCheckpoints = true
+	assert.Nil(t, LatestCheckpoint())
+	assert.False(t, IsCheckpointed(50))
+	assert.NoError(t, CheckCheckpoint(100, otherHash))
+
+	t.Log("[TestCheckCheckpoint] PASSED")
+}
+
+func TestPruneHeight(t *testing.T) {
+	chainParam := config.Parameters.ChainParam
+	disableCheckpoints := config.Parameters.DisableCheckpoints
+	retention := config.Parameters.PruneRetention
+	maxReorgDepth := config.Parameters.MaxReorgDepth
+	config.Parameters.ChainParam = &config.ChainParams{}
+	defer func() {
+		config.Parameters.ChainParam = chainParam
+		config.Parameters.DisableCheckpoints = disableCheckpoints
+		config.Parameters.PruneRetention = retention
+		config.Parameters.MaxReorgDepth = maxReorgDepth
+	}()
+	config.Parameters.DisableCheckpoints = false
+	config.Parameters.PruneRetention = 100
+	config.Parameters.MaxReorgDepth = 50
+
+	// blocks within the retention are kept
+	assert.Equal(t, uint32(0), pruneHeight(100))
+	assert.Equal(t, uint32(900), pruneHeight(1000))
+
+	// never prune within the max reorganization depth
+	config.Parameters.MaxReorgDepth = 200
+	assert.Equal(t, uint32(800), pruneHeight(1000))
+
+	// blocks after the latest checkpoint are kept
+	config.Parameters.ChainParam.Checkpoints = []config.Checkpoint{{Height: 500}}
+	assert.Equal(t, uint32(501), pruneHeight(1000))
+	assert.Equal(t, uint32(300), pruneHeight(500))
+
+	t.Log("[TestPruneHeight] PASSED")
+}
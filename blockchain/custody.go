@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/elastos/Elastos.ELA.SideChain/common"
+	"github.com/elastos/Elastos.ELA.SideChain/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// ArbitratorsSource looks up the program hash of the multisig program of the
+// current main chain arbitrators, which hold the deposits of the side chain
+// when the cross chain custody rotates with the arbitrator set.
+type ArbitratorsSource interface {
+	// GetArbitratorsProgramHash returns the program hash of the multisig
+	// program of the current arbitrators.
+	GetArbitratorsProgramHash() (*Uint168, error)
+}
+
+// Arbitrators is set at startup if the deposits are held by the arbitrators,
+// the deposits are only checked against the genesis program hash while it
+// is nil.
+var Arbitrators ArbitratorsSource
+
+// StaticArbitrators is an ArbitratorsSource of a fixed program hash, such as
+// the ArbitratorsAddress in config.
+type StaticArbitrators Uint168
+
+func (a StaticArbitrators) GetArbitratorsProgramHash() (*Uint168, error) {
+	programHash := Uint168(a)
+	return &programHash, nil
+}
+
+// custodyProgramHashes returns the program hashes the main chain deposits to
+// this side chain are paid to, the program hash of the current arbitrators
+// if known, and the genesis program hash as the fallback.
+func custodyProgramHashes() ([]Uint168, error) {
+	genesisHash, _ := DefaultLedger.Store.GetBlockHash(uint32(0))
+	genesisProgramHash, err := common.GetGenesisProgramHash(genesisHash)
+	if err != nil {
+		return nil, errors.New("Genesis block bytes to program hash failed")
+	}
+
+	var programHashes []Uint168
+	if Arbitrators != nil {
+		programHash, err := Arbitrators.GetArbitratorsProgramHash()
+		if err != nil {
+			log.Warn("Get arbitrators program hash failed,", err)
+		} else {
+			programHashes = append(programHashes, *programHash)
+		}
+	}
+	return append(programHashes, *genesisProgramHash), nil
+}
+
+// isCustodyProgramHash returns if the program hash is one of the custody
+// program hashes.
+func isCustodyProgramHash(custody []Uint168, programHash Uint168) bool {
+	for _, custodyProgramHash := range custody {
+		if programHash.IsEqual(custodyProgramHash) {
+			return true
+		}
+	}
+	return false
+}
@@ -16,6 +16,10 @@ const (
 	IX_SideChain_Tx   DataEntryPrefix = 0x92
 	IX_MainChain_Tx   DataEntryPrefix = 0x93
 	IX_IDENTIFICATION DataEntryPrefix = 0x94
+	IX_Spent_Tx       DataEntryPrefix = 0x95
+	IX_ID_Controller  DataEntryPrefix = 0x96
+	IX_ID_Undo        DataEntryPrefix = 0x97
+	IX_ID_Content     DataEntryPrefix = 0x98
 
 	// ASSET
 	ST_Info DataEntryPrefix = 0xc0
@@ -23,7 +27,11 @@ const (
 	//SYSTEM
 	SYS_CurrentBlock      DataEntryPrefix = 0x40
 	SYS_CurrentBookKeeper DataEntryPrefix = 0x42
+	SYS_AssetCount        DataEntryPrefix = 0x43
+	SYS_PrunedHeight      DataEntryPrefix = 0x44
+	SYS_BestBlock         DataEntryPrefix = 0x45
 
 	//CONFIG
 	CFG_Version DataEntryPrefix = 0xf0
+	CFG_Network DataEntryPrefix = 0xf1
 )
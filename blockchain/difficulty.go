@@ -11,31 +11,49 @@ import (
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
-var (
-	targetTimespan      = int64(config.Parameters.ChainParam.TargetTimespan / time.Second)
-	targetTimePerBlock  = int64(config.Parameters.ChainParam.TargetTimePerBlock / time.Second)
-	blocksPerRetarget   = uint32(targetTimespan / targetTimePerBlock)
-	minRetargetTimespan = int64(targetTimespan / config.Parameters.ChainParam.AdjustmentFactor)
-	maxRetargetTimespan = int64(targetTimespan * config.Parameters.ChainParam.AdjustmentFactor)
-)
-
-func CalcNextRequiredDifficulty(prevNode *BlockNode, newBlockTime time.Time) (uint32, error) {
+// CalcNextRequiredDifficulty calculates the required difficulty of the block
+// after prevNode with the given chain params. It depends on nothing but its
+// arguments, so the block validator and the miner always agree on it.
+func CalcNextRequiredDifficulty(prevNode *BlockNode, newBlockTime time.Time,
+	params *config.ChainParams) (uint32, error) {
 	// Genesis block.
-	if (prevNode.Height == 0) || (config.Parameters.ChainParam.Name == "RegNet") {
-		return uint32(config.Parameters.ChainParam.PowLimitBits), nil
+	if (prevNode.Height == 0) || (params.Name == "RegNet") {
+		return params.PowLimitBits, nil
+	}
 
+	targetTimespan := int64(params.TargetTimespan / time.Second)
+	targetTimePerBlock := int64(params.TargetTimePerBlock / time.Second)
+	if targetTimePerBlock <= 0 || targetTimespan < targetTimePerBlock {
+		return 0, errors.New("invalid target timespan of chain params")
+	}
+	if params.AdjustmentFactor <= 0 {
+		return 0, errors.New("invalid adjustment factor of chain params")
 	}
+	blocksPerRetarget := uint32(targetTimespan / targetTimePerBlock)
+	minRetargetTimespan := targetTimespan / params.AdjustmentFactor
+	maxRetargetTimespan := targetTimespan * params.AdjustmentFactor
 
 	// Return the previous block's difficulty requirements if this block
 	// is not at a difficulty retarget interval.
 	if (prevNode.Height+1)%blocksPerRetarget != 0 {
+		// Networks that reduce the minimum difficulty allow a block at the
+		// proof of work limit when no block has been found for a while,
+		// otherwise the difficulty of the last normal block is required.
+		if params.ReduceMinDifficulty {
+			reductionTime := int64(params.MinDiffReductionTime / time.Second)
+			allowMinTime := int64(prevNode.Timestamp) + reductionTime
+			if newBlockTime.Unix() > allowMinTime {
+				return params.PowLimitBits, nil
+			}
+			return findPrevTestNetDifficulty(prevNode, blocksPerRetarget, params), nil
+		}
 		return prevNode.Bits, nil
 	}
 
 	// Get the block node at the previous retarget (targetTimespan days
 	// worth of blocks).
 	height := prevNode.Height - blocksPerRetarget + 1
-	if height < 0 || height > prevNode.Height {
+	if height > prevNode.Height {
 		return 0, errors.New("unable to obtain previous retarget block")
 	}
 
@@ -43,9 +61,12 @@ func CalcNextRequiredDifficulty(prevNode *BlockNode, newBlockTime time.Time) (ui
 	for ; firstNode != nil && firstNode.Height != height; firstNode = firstNode.Parent {
 		// Intentionally left blank
 	}
+	if firstNode == nil {
+		return 0, errors.New("unable to obtain previous retarget block")
+	}
 
 	// Limit the amount of adjustment that can occur to the previous difficulty.
-	actualTimespan := int64(prevNode.Timestamp - firstNode.Timestamp)
+	actualTimespan := int64(prevNode.Timestamp) - int64(firstNode.Timestamp)
 	adjustedTimespan := actualTimespan
 	if actualTimespan < minRetargetTimespan {
 		adjustedTimespan = minRetargetTimespan
@@ -53,18 +74,25 @@ func CalcNextRequiredDifficulty(prevNode *BlockNode, newBlockTime time.Time) (ui
 		adjustedTimespan = maxRetargetTimespan
 	}
 
+	// The previous target must be a positive number within the proof of
+	// work limit, an out of range compact value would otherwise produce an
+	// arbitrary large or negative target.
+	oldTarget := CompactToBig(prevNode.Bits)
+	if oldTarget.Sign() <= 0 || oldTarget.Cmp(params.PowLimit) > 0 {
+		return 0, errors.New("previous block difficulty bits out of range")
+	}
+
 	// Calculate new target difficulty as:
 	//  currentDifficulty * (adjustedTimespan / targetTimespan)
 	// The result uses integer division which means it will be slightly
 	// rounded down.  Bitcoind also uses integer division to calculate this
 	// result.
-	oldTarget := CompactToBig(prevNode.Bits)
 	newTarget := new(big.Int).Mul(oldTarget, big.NewInt(adjustedTimespan))
 	newTarget.Div(newTarget, big.NewInt(targetTimespan))
 
 	// Limit new value to the proof of work limit.
-	if newTarget.Cmp(config.Parameters.ChainParam.PowLimit) > 0 {
-		newTarget.Set(config.Parameters.ChainParam.PowLimit)
+	if newTarget.Cmp(params.PowLimit) > 0 {
+		newTarget.Set(params.PowLimit)
 	}
 
 	// Log new target difficulty and return it.  The new target logging is
@@ -78,11 +106,28 @@ func CalcNextRequiredDifficulty(prevNode *BlockNode, newBlockTime time.Time) (ui
 	log.Tracef("Actual timespan %v, adjusted timespan %v, target timespan %v",
 		time.Duration(actualTimespan)*time.Second,
 		time.Duration(adjustedTimespan)*time.Second,
-		config.Parameters.ChainParam.TargetTimespan)
+		params.TargetTimespan)
 
 	return newTargetBits, nil
 }
 
+// findPrevTestNetDifficulty returns the difficulty of the last block which
+// did not take the minimum difficulty, walking back no further than the last
+// retarget.
+func findPrevTestNetDifficulty(startNode *BlockNode, blocksPerRetarget uint32,
+	params *config.ChainParams) uint32 {
+	iterNode := startNode
+	for iterNode != nil && iterNode.Height%blocksPerRetarget != 0 &&
+		iterNode.Bits == params.PowLimitBits {
+		iterNode = iterNode.Parent
+	}
+
+	if iterNode == nil {
+		return params.PowLimitBits
+	}
+	return iterNode.Bits
+}
+
 func BigToCompact(n *big.Int) uint32 {
 	// No need to do any work if it's zero.
 	if n.Sign() == 0 {
@@ -0,0 +1,126 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalcNextRequiredDifficulty(t *testing.T) {
+	params := &config.ChainParams{
+		Name:               "TestParams",
+		PowLimit:           CompactToBig(0x207fffff),
+		PowLimitBits:       0x207fffff,
+		TargetTimespan:     time.Second * 100,
+		TargetTimePerBlock: time.Second * 10,
+		AdjustmentFactor:   int64(4),
+	}
+	bits := uint32(0x1d00ffff)
+
+	// a chain of count blocks with the given block interval
+	newChain := func(count uint32, interval uint32) *BlockNode {
+		var node *BlockNode
+		for height := uint32(0); height < count; height++ {
+			node = &BlockNode{
+				Height:    height,
+				Bits:      bits,
+				Timestamp: 1000 + height*interval,
+				Parent:    node,
+			}
+		}
+		return node
+	}
+	newTime := func(node *BlockNode, offset int64) time.Time {
+		return time.Unix(int64(node.Timestamp)+offset, 0)
+	}
+	adjusted := func(timespan int64) uint32 {
+		target := new(big.Int).Mul(CompactToBig(bits), big.NewInt(timespan))
+		return BigToCompact(target.Div(target, big.NewInt(100)))
+	}
+
+	// genesis block
+	genesis := newChain(1, 10)
+	difficulty, err := CalcNextRequiredDifficulty(genesis, newTime(genesis, 10), params)
+	assert.NoError(t, err)
+	assert.Equal(t, params.PowLimitBits, difficulty)
+
+	// not at a retarget interval
+	prevNode := newChain(5, 10)
+	difficulty, err = CalcNextRequiredDifficulty(prevNode, newTime(prevNode, 10), params)
+	assert.NoError(t, err)
+	assert.Equal(t, bits, difficulty)
+
+	// retarget on time
+	prevNode = newChain(10, 10)
+	difficulty, err = CalcNextRequiredDifficulty(prevNode, newTime(prevNode, 10), params)
+	assert.NoError(t, err)
+	assert.Equal(t, adjusted(90), difficulty)
+
+	// blocks too fast, adjustment clamped to 4x up
+	prevNode = newChain(10, 1)
+	difficulty, err = CalcNextRequiredDifficulty(prevNode, newTime(prevNode, 1), params)
+	assert.NoError(t, err)
+	assert.Equal(t, adjusted(25), difficulty)
+
+	// blocks too slow, adjustment clamped to 4x down
+	prevNode = newChain(10, 1000)
+	difficulty, err = CalcNextRequiredDifficulty(prevNode, newTime(prevNode, 1000), params)
+	assert.NoError(t, err)
+	assert.Equal(t, adjusted(400), difficulty)
+
+	// target never exceeds the proof of work limit
+	prevNode = newChain(10, 1000)
+	prevNode.Bits = params.PowLimitBits
+	difficulty, err = CalcNextRequiredDifficulty(prevNode, newTime(prevNode, 1000), params)
+	assert.NoError(t, err)
+	assert.Equal(t, params.PowLimitBits, difficulty)
+
+	// previous bits out of range
+	for _, invalidBits := range []uint32{0, 0x1d80ffff, 0x217fffff, 0xff7fffff} {
+		prevNode = newChain(10, 10)
+		prevNode.Bits = invalidBits
+		_, err = CalcNextRequiredDifficulty(prevNode, newTime(prevNode, 10), params)
+		assert.EqualError(t, err, "previous block difficulty bits out of range")
+	}
+
+	// previous retarget block not found
+	prevNode = newChain(10, 10)
+	prevNode.Parent = nil
+	_, err = CalcNextRequiredDifficulty(prevNode, newTime(prevNode, 10), params)
+	assert.EqualError(t, err, "unable to obtain previous retarget block")
+
+	// invalid adjustment factor
+	invalidParams := *params
+	invalidParams.AdjustmentFactor = 0
+	_, err = CalcNextRequiredDifficulty(prevNode, newTime(prevNode, 10), &invalidParams)
+	assert.EqualError(t, err, "invalid adjustment factor of chain params")
+
+	// minimum difficulty after the idle period
+	testNetParams := *params
+	testNetParams.ReduceMinDifficulty = true
+	testNetParams.MinDiffReductionTime = time.Second * 20
+	prevNode = newChain(5, 10)
+	difficulty, err = CalcNextRequiredDifficulty(prevNode, newTime(prevNode, 21), &testNetParams)
+	assert.NoError(t, err)
+	assert.Equal(t, params.PowLimitBits, difficulty)
+	difficulty, err = CalcNextRequiredDifficulty(prevNode, newTime(prevNode, 20), &testNetParams)
+	assert.NoError(t, err)
+	assert.Equal(t, bits, difficulty)
+
+	// the last normal difficulty after a minimum difficulty block
+	minNode := &BlockNode{
+		Height:    prevNode.Height + 1,
+		Bits:      params.PowLimitBits,
+		Timestamp: prevNode.Timestamp + 21,
+		Parent:    prevNode,
+	}
+	difficulty, err = CalcNextRequiredDifficulty(minNode, newTime(minNode, 10), &testNetParams)
+	assert.NoError(t, err)
+	assert.Equal(t, bits, difficulty)
+
+	t.Log("[TestCalcNextRequiredDifficulty] PASSED")
+}
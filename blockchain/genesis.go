@@ -0,0 +1,158 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain/auxpow"
+	"github.com/elastos/Elastos.ELA.SideChain/common"
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+	ela "github.com/elastos/Elastos.ELA/core"
+)
+
+const (
+	// DefaultGenesisAssetName is the name of the asset registered by the
+	// genesis block when GenesisAssetName is not configured.
+	DefaultGenesisAssetName = "ELA"
+
+	// DefaultGenesisAssetPrecision is the precision of the default genesis
+	// asset.
+	DefaultGenesisAssetPrecision = 0x08
+
+	// genesisBits is the difficulty bits of the genesis block header.
+	genesisBits = 0x1d03ffff
+)
+
+// DefaultGenesisTimestamp is the timestamp of the genesis block when
+// GenesisTimestamp is not configured.
+var DefaultGenesisTimestamp = uint32(time.Date(2018, time.June, 30, 12, 0, 0, 0, time.UTC).Unix())
+
+// GenesisBlockBuilder builds the genesis block of a side chain from its
+// parameters, the same parameters always build the same block.
+type GenesisBlockBuilder struct {
+	// MainChainGenesisHash is the genesis hash of the main chain the side
+	// chain is bound to, the genesis block has no coinbase if it is empty.
+	MainChainGenesisHash Uint256
+
+	// FoundationAddress is paid the coinbase of the genesis block, it is
+	// only read if MainChainGenesisHash is set.
+	FoundationAddress string
+
+	AssetName      string
+	AssetPrecision byte
+	Timestamp      uint32
+}
+
+// NewGenesisBlockBuilder returns the builder of the genesis block of the
+// configured side chain.
+func NewGenesisBlockBuilder() (*GenesisBlockBuilder, error) {
+	builder := &GenesisBlockBuilder{
+		FoundationAddress: config.Parameters.FoundationAddress,
+		AssetName:         DefaultGenesisAssetName,
+		AssetPrecision:    DefaultGenesisAssetPrecision,
+		Timestamp:         DefaultGenesisTimestamp,
+	}
+	if hash := config.Parameters.MainChainGenesisHash; hash != "" {
+		hashBytes, err := HexStringToBytes(hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid main chain genesis hash %s, %s", hash, err)
+		}
+		mainChainGenesisHash, err := Uint256FromBytes(BytesReverse(hashBytes))
+		if err != nil {
+			return nil, fmt.Errorf("invalid main chain genesis hash %s, %s", hash, err)
+		}
+		builder.MainChainGenesisHash = *mainChainGenesisHash
+	}
+	if config.Parameters.GenesisAssetName != "" {
+		builder.AssetName = config.Parameters.GenesisAssetName
+		builder.AssetPrecision = config.Parameters.GenesisAssetPrecision
+	}
+	if config.Parameters.GenesisTimestamp != 0 {
+		builder.Timestamp = config.Parameters.GenesisTimestamp
+	}
+	return builder, nil
+}
+
+// Build returns the genesis block and the genesis program hash the main chain
+// deposits to the side chain are paid to.
+func (b *GenesisBlockBuilder) Build() (*core.Block, *Uint168, error) {
+	if b.AssetPrecision > core.MaxPrecision {
+		return nil, nil, fmt.Errorf("invalid genesis asset precision %d", b.AssetPrecision)
+	}
+
+	asset := &core.Transaction{
+		TxType:         core.RegisterAsset,
+		PayloadVersion: 0,
+		Payload: &core.PayloadRegisterAsset{
+			Asset: core.Asset{
+				Name:      b.AssetName,
+				Precision: b.AssetPrecision,
+				AssetType: core.Token,
+			},
+			Amount:     0,
+			Controller: Uint168{},
+		},
+		Attributes: []*core.Attribute{},
+		Inputs:     []*core.Input{},
+		Outputs:    []*core.Output{},
+		Programs:   []*core.Program{},
+	}
+	transactions := []*core.Transaction{asset}
+
+	// the side chain issues no coins, they are recharged from the main chain,
+	// so the coinbase pays nothing and only binds the genesis block to the
+	// main chain and the foundation
+	if !b.MainChainGenesisHash.IsEqual(EmptyHash) {
+		foundation, err := Uint168FromAddress(b.FoundationAddress)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid foundation address %s, %s", b.FoundationAddress, err)
+		}
+		coinbase := NewCoinBaseTransaction(&core.PayloadCoinBase{
+			CoinbaseData: b.MainChainGenesisHash.Bytes(),
+		}, 0)
+		coinbase.Outputs = []*core.Output{
+			{AssetID: asset.Hash(), Value: 0, ProgramHash: *foundation},
+		}
+		transactions = append(transactions, coinbase)
+	}
+
+	block := &core.Block{
+		Header: core.Header{
+			Version:    core.BlockVersion,
+			Previous:   EmptyHash,
+			MerkleRoot: EmptyHash,
+			Timestamp:  b.Timestamp,
+			Bits:       genesisBits,
+			Nonce:      core.GenesisNonce,
+			Height:     uint32(0),
+			SideAuxPow: auxpow.SideAuxPow{
+				SideAuxBlockTx: ela.Transaction{
+					TxType:         ela.SideChainPow,
+					PayloadVersion: ela.SideChainPowPayloadVersion,
+					Payload:        new(ela.PayloadSideChainPow),
+				},
+			},
+		},
+		Transactions: transactions,
+	}
+	hashes := make([]Uint256, 0, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		hashes = append(hashes, tx.Hash())
+	}
+	var err error
+	block.Header.MerkleRoot, err = crypto.ComputeRoot(hashes)
+	if err != nil {
+		return nil, nil, errors.New("[GenesisBlock] ,BuildMerkleRoot failed.")
+	}
+
+	programHash, err := common.GetGenesisProgramHash(block.Hash())
+	if err != nil {
+		return nil, nil, errors.New("[GenesisBlock], genesis program hash failed, " + err.Error())
+	}
+	return block, programHash, nil
+}
@@ -0,0 +1,130 @@
+package blockchain
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files")
+
+// genesisSummary returns the genesis block hash, the asset ID and the genesis
+// address in the format of the golden files.
+func genesisSummary(block *core.Block, programHash *common.Uint168) (string, error) {
+	address, err := programHash.ToAddress()
+	if err != nil {
+		return "", err
+	}
+	hash := block.Hash()
+	assetID := block.Transactions[0].Hash()
+	return fmt.Sprintf("hash %s\nassetid %s\naddress %s\n",
+		common.BytesToHexString(common.BytesReverse(hash.Bytes())),
+		common.BytesToHexString(common.BytesReverse(assetID.Bytes())),
+		address), nil
+}
+
+func TestGenesisBlockBuilder_Golden(t *testing.T) {
+	parameters := *config.Parameters.Configuration
+	chainParam := config.Parameters.ChainParam
+	defer func() {
+		*config.Parameters.Configuration = parameters
+		config.Parameters.ChainParam = chainParam
+	}()
+	config.Parameters.MainChainGenesisHash = ""
+	config.Parameters.GenesisAssetName = ""
+	config.Parameters.GenesisTimestamp = 0
+
+	for _, net := range config.NetParams() {
+		if net.Name != "MainNet" && net.Name != "TestNet" {
+			continue
+		}
+		config.Parameters.ChainParam = net
+
+		builder, err := NewGenesisBlockBuilder()
+		if !assert.NoError(t, err) {
+			return
+		}
+		block, programHash, err := builder.Build()
+		if !assert.NoError(t, err) {
+			return
+		}
+		summary, err := genesisSummary(block, programHash)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		golden := filepath.Join("testdata", "genesis_"+strings.ToLower(net.Name)+".golden")
+		if *updateGolden {
+			if err := ioutil.WriteFile(golden, []byte(summary), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expected, err := ioutil.ReadFile(golden)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, string(expected), summary, net.Name)
+	}
+
+	t.Log("[TestGenesisBlockBuilder_Golden] PASSED")
+}
+
+func TestGenesisBlockBuilder_MainChainGenesisHash(t *testing.T) {
+	legacy := &GenesisBlockBuilder{
+		AssetName:      DefaultGenesisAssetName,
+		AssetPrecision: DefaultGenesisAssetPrecision,
+		Timestamp:      DefaultGenesisTimestamp,
+	}
+	legacyBlock, _, err := legacy.Build()
+	assert.NoError(t, err)
+
+	builder := *legacy
+	builder.MainChainGenesisHash = common.Uint256{0x01}
+	builder.FoundationAddress = "8VYXVxKKSAxkmRrfmGpQR2Kc66XhG6m3ta"
+
+	// case 1: the same parameters build the same block
+	block, programHash, err := builder.Build()
+	assert.NoError(t, err)
+	other, otherProgramHash, err := builder.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, block.Hash(), other.Hash())
+	assert.Equal(t, *programHash, *otherProgramHash)
+
+	// case 2: the coinbase binds the block to the main chain genesis
+	assert.Equal(t, 2, len(block.Transactions))
+	assert.Equal(t, legacyBlock.Transactions[0].Hash(), block.Transactions[0].Hash())
+	coinbase := block.Transactions[1]
+	assert.True(t, coinbase.IsCoinBaseTx())
+	assert.Equal(t, builder.MainChainGenesisHash.Bytes(),
+		coinbase.Payload.(*core.PayloadCoinBase).CoinbaseData)
+	assert.NotEqual(t, legacyBlock.Hash(), block.Hash())
+
+	// case 3: another main chain genesis builds another block
+	builder.MainChainGenesisHash = common.Uint256{0x02}
+	other, otherProgramHash, err = builder.Build()
+	assert.NoError(t, err)
+	assert.NotEqual(t, block.Hash(), other.Hash())
+	assert.NotEqual(t, *programHash, *otherProgramHash)
+
+	// case 4: invalid foundation address
+	builder.FoundationAddress = "invalid"
+	_, _, err = builder.Build()
+	assert.Error(t, err)
+
+	// case 5: invalid asset precision
+	builder = *legacy
+	builder.AssetPrecision = core.MaxPrecision + 1
+	_, _, err = builder.Build()
+	assert.Error(t, err)
+
+	t.Log("[TestGenesisBlockBuilder_MainChainGenesisHash] PASSED")
+}
@@ -0,0 +1,220 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+)
+
+// identificationController returns the controller of an identification
+// registration, the lowest program hash of the transaction programs other
+// than the program of the ID itself.
+func identificationController(txn *core.Transaction, idHash Uint168) (*Uint168, error) {
+	var hashes []Uint168
+	for _, program := range txn.Programs {
+		hash, err := crypto.ToProgramHash(program.Code)
+		if err != nil {
+			return nil, err
+		}
+		if !hash.IsEqual(idHash) {
+			hashes = append(hashes, *hash)
+		}
+	}
+	if len(hashes) == 0 {
+		return nil, errors.New("no controller program")
+	}
+	SortProgramHashes(hashes)
+	return &hashes[0], nil
+}
+
+// IdentificationContent is the hash of the content registered to a path of an
+// ID and the nonce of the registration.
+type IdentificationContent struct {
+	Hash  Uint256
+	Nonce uint64
+}
+
+func (c *IdentificationContent) Serialize(w io.Writer) error {
+	if err := c.Hash.Serialize(w); err != nil {
+		return err
+	}
+	return WriteUint64(w, c.Nonce)
+}
+
+func (c *IdentificationContent) Deserialize(r io.Reader) error {
+	if err := c.Hash.Deserialize(r); err != nil {
+		return err
+	}
+	nonce, err := ReadUint64(r)
+	if err != nil {
+		return err
+	}
+	c.Nonce = nonce
+	return nil
+}
+
+// identificationBatch tracks the identification index entries put by the
+// block being saved, they are not readable from the store before the batch is
+// committed.
+type identificationBatch struct {
+	entries map[string][]byte
+}
+
+func newIdentificationBatch() *identificationBatch {
+	return &identificationBatch{entries: make(map[string][]byte)}
+}
+
+// identificationUndo records the index entries replaced by an identification
+// registration, so the registration can be rolled back.
+type identificationUndo struct {
+	store *ChainStore
+	batch *identificationBatch
+	buf   *bytes.Buffer
+	count uint64
+}
+
+// put puts the index entry and records the entry it replaces.
+func (u *identificationUndo) put(key, value []byte) error {
+	previous, ok := u.batch.entries[string(key)]
+	if !ok {
+		if data, err := u.store.Get(key); err == nil {
+			previous, ok = data, true
+		}
+	}
+	if err := WriteVarString(u.buf, string(key)); err != nil {
+		return err
+	}
+	if ok {
+		u.buf.WriteByte(1)
+		if err := WriteVarString(u.buf, string(previous)); err != nil {
+			return err
+		}
+	} else {
+		u.buf.WriteByte(0)
+	}
+	u.count++
+	u.batch.entries[string(key)] = value
+	u.store.BatchPut(key, value)
+	return nil
+}
+
+// PersistIdentification indexes the contents of an identification
+// registration by the ID and path, and records the controller of the ID if it
+// is registered for the first time. The replaced index entries are kept so
+// the registration can be rolled back.
+func (c *ChainStore) PersistIdentification(txn *core.Transaction, batch *identificationBatch) error {
+	payload := txn.Payload.(*core.PayloadRegisterIdentification)
+	hash := txn.Hash()
+
+	undo := &identificationUndo{store: c, batch: batch, buf: new(bytes.Buffer)}
+	for _, content := range payload.Contents {
+		idKey := payload.ID + content.Path
+		if err := undo.put(append([]byte{byte(IX_IDENTIFICATION)}, idKey...), hash.Bytes()); err != nil {
+			return err
+		}
+		record := IdentificationContent{Hash: content.Hash(), Nonce: payload.Nonce}
+		buf := new(bytes.Buffer)
+		if err := record.Serialize(buf); err != nil {
+			return err
+		}
+		if err := undo.put(append([]byte{byte(IX_ID_Content)}, idKey...), buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	controllerKey := identificationControllerKey(payload.ID)
+	_, pending := batch.entries[string(controllerKey)]
+	if _, err := c.Get(controllerKey); err != nil && !pending {
+		idHash, err := Uint168FromAddress(payload.ID)
+		if err != nil {
+			return err
+		}
+		controller, err := identificationController(txn, *idHash)
+		if err != nil {
+			return err
+		}
+		if err := undo.put(controllerKey, controller.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	data := new(bytes.Buffer)
+	if err := WriteVarUint(data, undo.count); err != nil {
+		return err
+	}
+	data.Write(undo.buf.Bytes())
+	c.BatchPut(append([]byte{byte(IX_ID_Undo)}, hash.Bytes()...), data.Bytes())
+	return nil
+}
+
+// RollbackIdentification restores the index entries replaced by an
+// identification registration, the registrations of a block must be rolled
+// back in the reverse order.
+func (c *ChainStore) RollbackIdentification(txn *core.Transaction) error {
+	hash := txn.Hash()
+	undoKey := append([]byte{byte(IX_ID_Undo)}, hash.Bytes()...)
+	data, err := c.Get(undoKey)
+	if err != nil {
+		return err
+	}
+
+	undo := bytes.NewReader(data)
+	count, err := ReadVarUint(undo, 0)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		key, err := ReadVarString(undo)
+		if err != nil {
+			return err
+		}
+		replaced, err := undo.ReadByte()
+		if err != nil {
+			return err
+		}
+		if replaced == 0 {
+			c.BatchDelete([]byte(key))
+			continue
+		}
+		previous, err := ReadVarString(undo)
+		if err != nil {
+			return err
+		}
+		c.BatchPut([]byte(key), []byte(previous))
+	}
+	c.BatchDelete(undoKey)
+	return nil
+}
+
+// GetIdentificationController returns the controller program hash recorded by
+// the first registration of the ID.
+func (c *ChainStore) GetIdentificationController(id string) (*Uint168, error) {
+	data, err := c.Get(identificationControllerKey(id))
+	if err != nil {
+		return nil, err
+	}
+	return Uint168FromBytes(data)
+}
+
+// GetIdentificationContent returns the content registered to the path of the
+// ID by the latest registration.
+func (c *ChainStore) GetIdentificationContent(id, path string) (*IdentificationContent, error) {
+	data, err := c.Get(append([]byte{byte(IX_ID_Content)}, id+path...))
+	if err != nil {
+		return nil, err
+	}
+	content := new(IdentificationContent)
+	if err := content.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+func identificationControllerKey(id string) []byte {
+	return append([]byte{byte(IX_ID_Controller)}, id...)
+}
@@ -6,6 +6,12 @@ import (
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
+// MempoolView provides the unconfirmed transactions whose outputs can be spent
+// before they are confirmed, the transaction pool is a MempoolView.
+type MempoolView interface {
+	GetTransaction(hash Uint256) *core.Transaction
+}
+
 // IChainStore provides func with store package.
 type IChainStore interface {
 	InitWithGenesisBlock(genesisblock *core.Block) (uint32, error)
@@ -14,22 +20,29 @@ type IChainStore interface {
 	GetBlock(hash Uint256) (*core.Block, error)
 	GetBlockHash(height uint32) (Uint256, error)
 	IsDoubleSpend(tx *core.Transaction) bool
+	IsDoubleSpendWithView(tx *core.Transaction, view MempoolView) bool
 
 	GetHeader(hash Uint256) (*core.Header, error)
+	GetStateRoot(height uint32) (Uint256, error)
 
 	RollbackBlock(hash Uint256) error
 
 	GetTransaction(txId Uint256) (*core.Transaction, uint32, error)
 	GetTxReference(tx *core.Transaction) (map[*core.Input]*core.Output, error)
+	GetTxReferenceWithView(tx *core.Transaction, view MempoolView) (map[*core.Input]*core.Output, error)
+	GetTxReferences(txs []*core.Transaction) (map[*core.Input]*core.Output, error)
 
 	PersistAsset(assetid Uint256, asset core.Asset) error
 	GetAsset(hash Uint256) (*core.Asset, error)
+	GetAssetByName(name string) (*core.Asset, error)
 
 	PersistMainchainTx(mainchainTxHash Uint256)
 	GetMainchainTx(mainchainTxHash Uint256) (byte, error)
 
 	PersistRegisterIdentificationTx(idKey []byte, txHash Uint256)
 	GetRegisterIdentificationTx(idKey []byte) ([]byte, error)
+	GetIdentificationController(id string) (*Uint168, error)
+	GetIdentificationContent(id, path string) (*IdentificationContent, error)
 
 	GetCurrentBlockHash() Uint256
 	GetHeight() uint32
@@ -40,10 +53,15 @@ type IChainStore interface {
 	ContainsUnspent(txid Uint256, index uint16) (bool, error)
 	GetUnspentFromProgramHash(programHash Uint168, assetid Uint256) ([]*UTXO, error)
 	GetUnspentsFromProgramHash(programHash Uint168) (map[Uint256][]*UTXO, error)
+	GetUTXOsByProgramHash(programHash Uint168) ([]*UTXO, error)
+	GetUnspentOutputsFromProgramHash(programHash Uint168, assetid Uint256) ([]*UnspentOutput, error)
 	GetAssets() map[Uint256]*core.Asset
+	GetAssetCount() uint32
 
 	IsTxHashDuplicate(txhash Uint256) bool
 	IsMainchainTxHashDuplicate(mainchainTxHash Uint256) bool
+	MainchainTxFilterStats() (lookups, positives, falsePositives uint64)
 	IsBlockInStore(hash Uint256) bool
+	GetPrunedHeight() uint32
 	Close()
 }
@@ -65,8 +65,10 @@ func (db *LevelDB) BatchDelete(key []byte) {
 	db.batch.Delete(key)
 }
 
+// BatchCommit writes the batch atomically and waits for it to be synced to
+// disk, so a batch is either fully applied or discarded after a crash.
 func (db *LevelDB) BatchCommit() error {
-	return db.db.Write(db.batch, nil)
+	return db.db.Write(db.batch, &opt.WriteOptions{Sync: true})
 }
 
 func (db *LevelDB) Close() error {
@@ -0,0 +1,68 @@
+package blockchain
+
+import (
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SideChain/bloom"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const (
+	// MainchainTxFilterElements is the number of recorded main chain
+	// transaction hashes the filter is sized for.
+	MainchainTxFilterElements = 10000
+
+	// MainchainTxFilterFPRate is the expected false positive rate of the
+	// filter when it holds MainchainTxFilterElements hashes.
+	MainchainTxFilterFPRate = 0.0001
+)
+
+// mainchainTxFilter is a bloom filter of the recorded main chain transaction
+// hashes, a hash not matched by the filter is definitely not recorded. Hashes
+// are never removed on rollback, which only causes false positives.
+type mainchainTxFilter struct {
+	filter *bloom.Filter
+
+	sync.Mutex
+	lookups        uint64
+	positives      uint64
+	falsePositives uint64
+}
+
+func newMainchainTxFilter() *mainchainTxFilter {
+	return &mainchainTxFilter{
+		filter: bloom.NewFilter(MainchainTxFilterElements, 0, MainchainTxFilterFPRate),
+	}
+}
+
+// Add adds the main chain transaction hash to the filter.
+func (f *mainchainTxFilter) Add(hash Uint256) {
+	f.filter.AddHash(&hash)
+}
+
+// MayContain returns false if the hash is definitely not recorded.
+func (f *mainchainTxFilter) MayContain(hash Uint256) bool {
+	match := f.filter.Matches(hash[:])
+	f.Lock()
+	f.lookups++
+	if match {
+		f.positives++
+	}
+	f.Unlock()
+	return match
+}
+
+// FalsePositive records a hash matched by the filter but not found in store.
+func (f *mainchainTxFilter) FalsePositive() {
+	f.Lock()
+	f.falsePositives++
+	f.Unlock()
+}
+
+// Stats returns the number of lookups, matches and false positives.
+func (f *mainchainTxFilter) Stats() (lookups, positives, falsePositives uint64) {
+	f.Lock()
+	defer f.Unlock()
+	return f.lookups, f.positives, f.falsePositives
+}
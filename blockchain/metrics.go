@@ -0,0 +1,36 @@
+package blockchain
+
+import (
+	"github.com/elastos/Elastos.ELA.SideChain/metrics"
+)
+
+var (
+	txContextChecks = metrics.NewCounterVec("elastos_tx_context_checks_total",
+		"Transaction context checks by result code.", "code")
+
+	txPoolAccepted = metrics.NewCounter("elastos_txpool_accepted_total",
+		"Transactions accepted by the transaction pool.")
+
+	txPoolRejected = metrics.NewCounterVec("elastos_txpool_rejected_total",
+		"Transactions rejected by the transaction pool by error code.", "code")
+
+	txPoolSize = metrics.NewGauge("elastos_txpool_transactions",
+		"Transactions in the transaction pool.")
+
+	txPoolBytes = metrics.NewGauge("elastos_txpool_bytes",
+		"Serialized size of the transactions in the transaction pool.")
+
+	blockConnectDuration = metrics.NewSummary("elastos_block_connect_seconds",
+		"Duration of the block connections.")
+
+	// the references of the transaction inputs are found in the store, in
+	// the mempool view or not found
+	txReferenceStoreHits = metrics.NewCounter("elastos_tx_reference_store_hits_total",
+		"Transaction references found in the chain store.")
+
+	txReferenceViewHits = metrics.NewCounter("elastos_tx_reference_view_hits_total",
+		"Transaction references found in the mempool view.")
+
+	txReferenceMisses = metrics.NewCounter("elastos_tx_reference_misses_total",
+		"Transaction references not found.")
+)
@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+)
+
+// MaxMultisigKeys is the max number of public keys in a multisig program.
+const MaxMultisigKeys = 24
+
+// MultisigProgram is a parsed M-of-N multisig program code.
+type MultisigProgram struct {
+	M          int
+	N          int
+	PublicKeys [][]byte
+}
+
+// ParseMultisigProgram parses the framing of a multisig program code, the
+// push of M, the N pushed public keys, the push of N and MULTISIG. The public
+// keys are not checked, see ValidateMultisigProgram.
+func ParseMultisigProgram(code []byte) (*MultisigProgram, error) {
+	if len(code) < crypto.MinMultiSignCodeLength || code[len(code)-1] != MULTISIG {
+		return nil, errors.New("not a multisig program code")
+	}
+	m := int(code[0]-crypto.PUSH1) + 1
+	n := int(code[len(code)-2]-crypto.PUSH1) + 1
+	keysCode := code[1 : len(code)-2]
+	keyLength := crypto.PublicKeyScriptLength - 1
+	if len(keysCode) != n*keyLength {
+		return nil, errors.New("invalid multisig program code length")
+	}
+
+	program := &MultisigProgram{M: m, N: n, PublicKeys: make([][]byte, 0, n)}
+	for i := 0; i < n; i++ {
+		keyCode := keysCode[i*keyLength : (i+1)*keyLength]
+		if int(keyCode[0]) != keyLength-1 {
+			return nil, fmt.Errorf("invalid multisig public key %d push", i)
+		}
+		program.PublicKeys = append(program.PublicKeys, keyCode[1:])
+	}
+	return program, nil
+}
+
+// ValidateMultisigProgram checks a multisig program code is well formed,
+// 1 <= M <= N <= MaxMultisigKeys and the public keys are valid points sorted
+// in ascending order without duplicates, as created by
+// crypto.CreateMultiSignRedeemScript.
+func ValidateMultisigProgram(code []byte) error {
+	program, err := ParseMultisigProgram(code)
+	if err != nil {
+		return err
+	}
+	if program.M < 1 || program.M > program.N || program.N > MaxMultisigKeys {
+		return fmt.Errorf("invalid multisig %d of %d", program.M, program.N)
+	}
+	for i, publicKey := range program.PublicKeys {
+		if _, err := crypto.DecodePoint(publicKey); err != nil {
+			return fmt.Errorf("invalid multisig public key %d", i)
+		}
+		if i == 0 {
+			continue
+		}
+		// keys are sorted by the X coordinate following the compression prefix
+		switch bytes.Compare(program.PublicKeys[i-1][1:], publicKey[1:]) {
+		case 0:
+			return fmt.Errorf("duplicate multisig public key %d", i)
+		case 1:
+			return fmt.Errorf("multisig public key %d is not sorted", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastos/Elastos.ELA.SideChain/bloom"
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	elabloom "github.com/elastos/Elastos.ELA/bloom"
+	ela "github.com/elastos/Elastos.ELA/core"
+)
+
+// MainChainHeaderStore looks up the main chain block headers known to the
+// side chain.
+type MainChainHeaderStore interface {
+	// GetHeader returns the merkle root and the height of the main chain
+	// block of the hash.
+	GetHeader(blockHash Uint256) (merkleRoot Uint256, height uint32, err error)
+
+	// GetBestHeight returns the height of the best main chain block.
+	GetBestHeight() uint32
+}
+
+// MainChainHeaders is set to the SPV header store at startup, recharge
+// proofs are not checked against the main chain headers while it is nil.
+var MainChainHeaders MainChainHeaderStore
+
+// checkRechargeProof checks the merkle proof chains the main chain
+// transaction to the merkle root of a known main chain block header, which
+// must be buried under RechargeConfirmations blocks.
+func checkRechargeProof(proof *elabloom.MerkleProof, tx *ela.Transaction) error {
+	if MainChainHeaders == nil {
+		return nil
+	}
+	root, height, err := MainChainHeaders.GetHeader(proof.BlockHash)
+	if err != nil {
+		return fmt.Errorf("main chain block %s of the proof is unknown", proof.BlockHash.String())
+	}
+	if err := checkRechargeConfirmations(height, MainChainHeaders.GetBestHeight()); err != nil {
+		return err
+	}
+
+	txIds, err := bloom.CheckMerkleBlock(msg.MerkleBlock{
+		Header:       &core.Header{MerkleRoot: root},
+		Transactions: proof.Transactions,
+		Hashes:       proof.Hashes,
+		Flags:        proof.Flags,
+	})
+	if err != nil {
+		return fmt.Errorf("recharge proof does not match the main chain block, %s", err.Error())
+	}
+	txHash := tx.Hash()
+	for _, txId := range txIds {
+		if txId.IsEqual(txHash) {
+			return nil
+		}
+	}
+	return errors.New("recharge proof does not prove the main chain transaction")
+}
+
+// checkRechargeConfirmations checks the main chain block of the given height
+// has at least RechargeConfirmations confirmations at the best height, the
+// block itself counts as one confirmation.
+func checkRechargeConfirmations(height, bestHeight uint32) error {
+	required := config.Parameters.RechargeConfirmations
+	if required == 0 {
+		return nil
+	}
+	var confirmations uint32
+	if bestHeight >= height {
+		confirmations = bestHeight - height + 1
+	}
+	if confirmations < required {
+		return fmt.Errorf("main chain block %d has %d confirmations, %d required",
+			height, confirmations, required)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// FoundationRewardFraction is the min fraction of the coinbase reward paid to
+// the foundation.
+const FoundationRewardFraction = 0.3
+
+// RewardRule is a constraint on the distribution of the coinbase reward.
+type RewardRule interface {
+	// CheckReward checks the coinbase outputs paying the total reward.
+	CheckReward(outputs []*core.Output, totalReward Fixed64) error
+
+	// Reward returns the program hash and the amount a coinbase paying the
+	// total reward should pay to satisfy the rule.
+	Reward(totalReward Fixed64) (Uint168, Fixed64)
+}
+
+// rewardRules are the reward rules checked against every coinbase, the
+// foundation rule is always the first.
+var rewardRules = []RewardRule{foundationRewardRule{}}
+
+// RegisterRewardRule adds a reward rule checked against every coinbase, the
+// rules must be registered before the node starts.
+func RegisterRewardRule(rule RewardRule) {
+	rewardRules = append(rewardRules, rule)
+}
+
+// RewardRules returns the registered reward rules in the registration order.
+func RewardRules() []RewardRule {
+	return rewardRules
+}
+
+// AddressRewardRule requires the coinbase to pay at least MinFraction of the
+// total reward to ProgramHash.
+type AddressRewardRule struct {
+	Name        string
+	ProgramHash Uint168
+	MinFraction float64
+}
+
+// NewAddressRewardRule returns a rule requiring the coinbase to pay at least
+// minFraction of the total reward to the program hash, name is shown in the
+// errors.
+func NewAddressRewardRule(name string, programHash Uint168, minFraction float64) *AddressRewardRule {
+	return &AddressRewardRule{Name: name, ProgramHash: programHash, MinFraction: minFraction}
+}
+
+func (r *AddressRewardRule) CheckReward(outputs []*core.Output, totalReward Fixed64) error {
+	var reward Fixed64
+	for _, output := range outputs {
+		if output.ProgramHash.IsEqual(r.ProgramHash) {
+			reward += output.Value
+		}
+	}
+	if reward < Fixed64(float64(totalReward)*r.MinFraction) {
+		return fmt.Errorf("Reward to %s in coinbase < %.4g%%", r.Name, r.MinFraction*100)
+	}
+	return nil
+}
+
+func (r *AddressRewardRule) Reward(totalReward Fixed64) (Uint168, Fixed64) {
+	return r.ProgramHash, Fixed64(float64(totalReward) * r.MinFraction)
+}
+
+// foundationRewardRule is the built in rule of the foundation reward, the
+// FoundationAddress is read when checked as it is set at startup.
+type foundationRewardRule struct{}
+
+func (foundationRewardRule) rule() *AddressRewardRule {
+	return NewAddressRewardRule("foundation", FoundationAddress, FoundationRewardFraction)
+}
+
+func (r foundationRewardRule) CheckReward(outputs []*core.Output, totalReward Fixed64) error {
+	return r.rule().CheckReward(outputs, totalReward)
+}
+
+func (r foundationRewardRule) Reward(totalReward Fixed64) (Uint168, Fixed64) {
+	return r.rule().Reward(totalReward)
+}
@@ -0,0 +1,248 @@
+package blockchain
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"runtime"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+	"github.com/elastos/Elastos.ELA.SideChain/spv"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// SigCacheSize is the max number of verified programs kept in the signature
+// cache.
+const SigCacheSize = 50000
+
+// verifiedSigs caches programs verified when transactions enter the pool, so
+// they are not verified again when the block including them is connected.
+var verifiedSigs = newSigCache(SigCacheSize)
+
+// sigCacheKey identifies a program verified against a transaction. The
+// transaction hash does not cover the programs, so the program is identified
+// by the hash of its code and parameter.
+type sigCacheKey struct {
+	txHash      Uint256
+	programHash Uint256
+}
+
+func newSigCacheKey(tx *core.Transaction, program *core.Program) sigCacheKey {
+	buf := new(bytes.Buffer)
+	WriteVarBytes(buf, program.Code)
+	WriteVarBytes(buf, program.Parameter)
+	return sigCacheKey{txHash: tx.Hash(), programHash: sha256.Sum256(buf.Bytes())}
+}
+
+// sigCache is a LRU cache of verified programs.
+type sigCache struct {
+	sync.Mutex
+	capacity int
+	items    map[sigCacheKey]*list.Element
+	order    *list.List
+	hits     uint64
+	misses   uint64
+}
+
+func newSigCache(capacity int) *sigCache {
+	return &sigCache{
+		capacity: capacity,
+		items:    make(map[sigCacheKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Exists returns if the key is in the cache and marks it recently used.
+func (c *sigCache) Exists(key sigCacheKey) bool {
+	c.Lock()
+	defer c.Unlock()
+	elem, ok := c.items[key]
+	if ok {
+		c.hits++
+		c.order.MoveToFront(elem)
+	} else {
+		c.misses++
+	}
+	return ok
+}
+
+// Add adds the key to the cache, the least recently used key is evicted if
+// the cache is full.
+func (c *sigCache) Add(key sigCacheKey) {
+	c.Lock()
+	defer c.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	if c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(sigCacheKey))
+	}
+	c.items[key] = c.order.PushFront(key)
+}
+
+// Stats returns the number of cached programs and the lookup hits and misses.
+func (c *sigCache) Stats() (size int, hits, misses uint64) {
+	c.Lock()
+	defer c.Unlock()
+	return c.order.Len(), c.hits, c.misses
+}
+
+// SigCacheStats returns the number of cached programs and the lookup hits and
+// misses of the signature cache shared by the transaction pool and the block
+// validation.
+func SigCacheStats() (size int, hits, misses uint64) {
+	return verifiedSigs.Stats()
+}
+
+// sigJob verifies a program of a transaction against its program hash, or
+// the main chain deposits of a recharge transaction if program is nil.
+type sigJob struct {
+	tx      *core.Transaction
+	hash    Uint168
+	program *core.Program
+}
+
+func (j *sigJob) verify() error {
+	// The main chain deposits of a recharge transaction are never cached, the
+	// proofs embedded may differ between transactions of the same hash.
+	if j.program == nil {
+		return spv.VerifyTransaction(j.tx)
+	}
+
+	key := newSigCacheKey(j.tx, j.program)
+	if verifiedSigs.Exists(key) {
+		return nil
+	}
+	if err := runProgram(j.tx, j.hash, j.program); err != nil {
+		return multiSigError(j.tx, j.hash, j.program, err)
+	}
+	verifiedSigs.Add(key)
+	return nil
+}
+
+// VerifyBlockSignatures verifies the signatures of the transactions in a
+// block across GOMAXPROCS workers, it returns the first error found and the
+// remaining jobs are cancelled.
+func VerifyBlockSignatures(txs []*core.Transaction) error {
+	var jobs []*sigJob
+	for _, tx := range txs {
+		if tx.IsCoinBaseTx() {
+			continue
+		}
+		txJobs, err := signatureJobs(tx, nil)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, txJobs...)
+	}
+	return runSigJobs(jobs, runtime.GOMAXPROCS(0))
+}
+
+// VerifySignatures verifies the signatures of the transactions across
+// GOMAXPROCS workers and returns the verification result of each transaction,
+// errs[i] is nil if the signatures of txns[i] are valid. ECDSA signatures can
+// not be aggregated, so the batch shares the workers and the signature cache
+// instead, and every transaction is verified even if another one fails.
+func VerifySignatures(txns []*core.Transaction) ([]error, error) {
+	errs := make([]error, len(txns))
+	var jobs []*sigJob
+	var owners []int
+	for i, tx := range txns {
+		if tx == nil {
+			return nil, errors.New("invalid nil transaction")
+		}
+		if tx.IsCoinBaseTx() {
+			continue
+		}
+		txJobs, err := signatureJobs(tx, nil)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		for _, job := range txJobs {
+			jobs = append(jobs, job)
+			owners = append(owners, i)
+		}
+	}
+
+	for i, err := range verifySigJobs(jobs, runtime.GOMAXPROCS(0)) {
+		if err != nil && errs[owners[i]] == nil {
+			errs[owners[i]] = err
+		}
+	}
+	return errs, nil
+}
+
+// verifySigJobs runs all the jobs and returns the result of each job.
+func verifySigJobs(jobs []*sigJob, workers int) []error {
+	errs := make([]error, len(jobs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				errs[index] = jobs[index].verify()
+			}
+		}()
+	}
+
+	for i := range jobs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
+
+func runSigJobs(jobs []*sigJob, workers int) error {
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	jobCh := make(chan *sigJob)
+	quit := make(chan struct{})
+	errCh := make(chan error, 1)
+	var once sync.Once
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				if err := job.verify(); err != nil {
+					once.Do(func() {
+						errCh <- err
+						close(quit)
+					})
+					return
+				}
+			}
+		}()
+	}
+
+out:
+	for _, job := range jobs {
+		select {
+		case jobCh <- job:
+		case <-quit:
+			break out
+		}
+	}
+	close(jobCh)
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,163 @@
+package blockchain
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigCache(t *testing.T) {
+	cache := newSigCache(2)
+	keys := make([]sigCacheKey, 3)
+	for i := range keys {
+		rand.Read(keys[i].txHash[:])
+		rand.Read(keys[i].programHash[:])
+	}
+
+	// add and lookup
+	cache.Add(keys[0])
+	cache.Add(keys[1])
+	assert.True(t, cache.Exists(keys[0]))
+	assert.True(t, cache.Exists(keys[1]))
+
+	// the least recently used key is evicted
+	cache.Exists(keys[0])
+	cache.Add(keys[2])
+	assert.True(t, cache.Exists(keys[0]))
+	assert.False(t, cache.Exists(keys[1]))
+	assert.True(t, cache.Exists(keys[2]))
+
+	// hits and misses are counted
+	size, hits, misses := cache.Stats()
+	assert.Equal(t, 2, size)
+	assert.Equal(t, uint64(5), hits)
+	assert.Equal(t, uint64(1), misses)
+
+	t.Log("[TestSigCache] PASSED")
+}
+
+func TestRunSigJobs(t *testing.T) {
+	// signed transactions
+	var jobs []*sigJob
+	for i := 0; i < 20; i++ {
+		act := newAccount(t)
+		tx := buildTx()
+		signature, err := act.Sign(getData(tx))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		program := &core.Program{Code: act.redeemScript, Parameter: signature}
+		tx.Programs = []*core.Program{program}
+		jobs = append(jobs, &sigJob{tx: tx, hash: *act.programHash, program: program})
+	}
+
+	// all signatures valid
+	err := runSigJobs(jobs, 4)
+	assert.NoError(t, err)
+
+	// verified programs are cached
+	for _, job := range jobs {
+		assert.True(t, verifiedSigs.Exists(newSigCacheKey(job.tx, job.program)))
+	}
+
+	// one invalid signature fails the block
+	invalid := jobs[10]
+	fakeSignature := make([]byte, len(invalid.program.Parameter))
+	fakeSignature[0] = invalid.program.Parameter[0]
+	invalid.program = &core.Program{Code: invalid.program.Code, Parameter: fakeSignature}
+	err = runSigJobs(jobs, 4)
+	assert.Error(t, err)
+	assert.False(t, verifiedSigs.Exists(newSigCacheKey(invalid.tx, invalid.program)))
+
+	// more workers than jobs
+	err = runSigJobs(jobs[:2], 4)
+	assert.NoError(t, err)
+
+	// no jobs
+	err = runSigJobs(nil, 4)
+	assert.NoError(t, err)
+
+	t.Log("[TestRunSigJobs] PASSED")
+}
+
+// newSignedTx returns a single signature transaction with no inputs, the
+// program hash is given by a script attribute.
+func newSignedTx(tb testing.TB) *core.Transaction {
+	act := newAccount(tb)
+	tx := buildTx()
+	tx.Inputs = nil
+	tx.Attributes = []*core.Attribute{{Usage: core.Script, Data: act.programHash.Bytes()}}
+	signature, err := act.Sign(getData(tx))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tx.Programs = []*core.Program{{Code: act.redeemScript, Parameter: signature}}
+	return tx
+}
+
+func TestVerifySignatures(t *testing.T) {
+	ledger := DefaultLedger
+	DefaultLedger = &Ledger{Store: &ChainStore{}}
+	defer func() {
+		DefaultLedger = ledger
+	}()
+
+	txs := make([]*core.Transaction, 10)
+	for i := range txs {
+		txs[i] = newSignedTx(t)
+	}
+
+	// all signatures valid
+	errs, err := VerifySignatures(txs)
+	assert.NoError(t, err)
+	assert.Len(t, errs, len(txs))
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	// results map to the transactions one-to-one
+	invalid := txs[3].Programs[0]
+	txs[3].Programs[0] = &core.Program{Code: invalid.Code, Parameter: make([]byte, len(invalid.Parameter))}
+	txs[7].Programs = nil
+	errs, err = VerifySignatures(txs)
+	assert.NoError(t, err)
+	for i, err := range errs {
+		if i == 3 || i == 7 {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+
+	// nil transaction
+	_, err = VerifySignatures([]*core.Transaction{txs[0], nil})
+	assert.Error(t, err)
+
+	t.Log("[TestVerifySignatures] PASSED")
+}
+
+func BenchmarkVerifySignatures(b *testing.B) {
+	ledger := DefaultLedger
+	DefaultLedger = &Ledger{Store: &ChainStore{}}
+	defer func() {
+		DefaultLedger = ledger
+	}()
+
+	txs := make([]*core.Transaction, 1000)
+	for i := range txs {
+		txs[i] = newSignedTx(b)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		verifiedSigs = newSigCache(SigCacheSize)
+		b.StartTimer()
+		if _, err := VerifySignatures(txs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
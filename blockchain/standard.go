@@ -0,0 +1,157 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// DefaultMaxStandardAttributeSize is the max size in bytes of the data of a
+// standard attribute when MaxStandardAttributeSize is not configured.
+const DefaultMaxStandardAttributeSize = 100
+
+// The limits of the programs of a standard transaction when they are not
+// configured, they are stricter than the consensus limits.
+const (
+	DefaultMaxStandardCodeSize      = 1024
+	DefaultMaxStandardParameterSize = 2048
+	DefaultMaxStandardTxPrograms    = 64
+)
+
+// DefaultMemoFeePerByte is the extra fee per byte of memo data required by
+// the transaction pool when MemoFeePerByte is not configured.
+const DefaultMemoFeePerByte = 10
+
+// CheckTransactionStandard checks the transaction against the standardness
+// policy of the transaction pool. The policy is stricter than the consensus
+// rules, a non standard transaction is not relayed or mined by this node but
+// it is still valid in a block.
+func CheckTransactionStandard(txn *core.Transaction) error {
+	if err := checkDustOutputs(txn); err != nil {
+		return err
+	}
+	maxSize := maxStandardAttributeSize()
+	for _, attr := range txn.Attributes {
+		if !isStandardAttributeUsage(attr.Usage) {
+			return fmt.Errorf("attribute usage %v is not standard", attr.Usage)
+		}
+		// memos are limited by MaxMemoSize and paid by the memo fee
+		if attr.Usage != core.Memo && len(attr.Data) > maxSize {
+			return fmt.Errorf("attribute data size %d > %d", len(attr.Data), maxSize)
+		}
+	}
+	return checkProgramLimits(txn.Programs, maxStandardTxPrograms(), maxStandardCodeSize(),
+		maxStandardParameterSize())
+}
+
+// isStandardAttributeUsage returns if the attribute usage is listed in
+// StandardAttributeUsages, all the valid usages are standard if none is
+// listed.
+func isStandardAttributeUsage(usage core.AttributeUsage) bool {
+	usages := config.Parameters.StandardAttributeUsages
+	if len(usages) == 0 {
+		return core.IsValidAttributeType(usage)
+	}
+	for _, standard := range usages {
+		if core.AttributeUsage(standard) == usage {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoFee returns the extra fee required by the transaction pool for the memo
+// attributes of the transaction, proportional to the memo data size.
+func MemoFee(txn *core.Transaction) Fixed64 {
+	size := 0
+	for _, attr := range txn.Attributes {
+		if attr.Usage == core.Memo {
+			size += len(attr.Data)
+		}
+	}
+	return Fixed64(size * memoFeePerByte())
+}
+
+// checkMemoFee checks the fee of the transaction covers the minimum fee and
+// the memo fee.
+func checkMemoFee(txn *core.Transaction, fee Fixed64) error {
+	memoFee := MemoFee(txn)
+	if memoFee == 0 {
+		return nil
+	}
+	required := Fixed64(config.Parameters.PowConfiguration.MinTxFee) + memoFee
+	if fee < required {
+		return fmt.Errorf("transaction fee %s less than %s required with the memo",
+			fee.String(), required.String())
+	}
+	return nil
+}
+
+func memoFeePerByte() int {
+	if config.Parameters.MemoFeePerByte > 0 {
+		return config.Parameters.MemoFeePerByte
+	}
+	return DefaultMemoFeePerByte
+}
+
+func maxStandardCodeSize() int {
+	if config.Parameters.MaxStandardCodeSize > 0 {
+		return config.Parameters.MaxStandardCodeSize
+	}
+	return DefaultMaxStandardCodeSize
+}
+
+func maxStandardParameterSize() int {
+	if config.Parameters.MaxStandardParameterSize > 0 {
+		return config.Parameters.MaxStandardParameterSize
+	}
+	return DefaultMaxStandardParameterSize
+}
+
+func maxStandardTxPrograms() int {
+	if config.Parameters.MaxStandardTxPrograms > 0 {
+		return config.Parameters.MaxStandardTxPrograms
+	}
+	return DefaultMaxStandardTxPrograms
+}
+
+// checkDustOutputs checks no output of the transaction is below the dust
+// threshold of its asset. The coinbase and recharge outputs are not paid by
+// the sender, and the zero program hash outputs of a cross chain transaction
+// are the amounts transferred to the main chain, they are not dust.
+func checkDustOutputs(txn *core.Transaction) error {
+	if txn.IsCoinBaseTx() || txn.IsRechargeToSideChainTx() {
+		return nil
+	}
+	for _, output := range txn.Outputs {
+		if txn.IsTransferCrossChainAssetTx() && output.ProgramHash.IsEqual(Uint168{}) {
+			continue
+		}
+		if threshold := dustThreshold(output.AssetID); output.Value < threshold {
+			return fmt.Errorf("output value %s is below the dust threshold %s",
+				output.Value.String(), threshold.String())
+		}
+	}
+	return nil
+}
+
+// dustThreshold returns the minimum output value of the asset, the threshold
+// of the chain asset is DustThreshold, and the thresholds of other assets are
+// configured in AssetDustThresholds keyed by the reversed hex asset ID.
+func dustThreshold(assetID Uint256) Fixed64 {
+	if assetID.IsEqual(DefaultLedger.Blockchain.AssetID) {
+		return Fixed64(config.Parameters.DustThreshold)
+	}
+	key := BytesToHexString(BytesReverse(assetID.Bytes()))
+	return Fixed64(config.Parameters.AssetDustThresholds[key])
+}
+
+func maxStandardAttributeSize() int {
+	if config.Parameters.MaxStandardAttributeSize > 0 {
+		return config.Parameters.MaxStandardAttributeSize
+	}
+	return DefaultMaxStandardAttributeSize
+}
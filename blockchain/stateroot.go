@@ -0,0 +1,113 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+)
+
+const (
+	// stateSpent and stateCreated tag the UTXO set deltas of a block.
+	stateSpent   = 0x00
+	stateCreated = 0x01
+)
+
+// stateRootActive returns if the header of a block at the given height
+// commits to the state root, a zero StateRootHeight disables the state root.
+func stateRootActive(height uint32) bool {
+	forkHeight := config.Parameters.ChainParam.StateRootHeight
+	return forkHeight != 0 && height >= forkHeight
+}
+
+// CalcStateRoot returns the state root of the block, the hash of the state
+// root of the parent block and the merkle root of the sorted hashes of the
+// UTXOs spent and created by the block.
+func CalcStateRoot(parentRoot Uint256, block *core.Block) (Uint256, error) {
+	var deltas []Uint256
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinBaseTx() {
+			for _, input := range tx.Inputs {
+				buf := new(bytes.Buffer)
+				buf.WriteByte(stateSpent)
+				if err := input.Previous.Serialize(buf); err != nil {
+					return Uint256{}, err
+				}
+				deltas = append(deltas, Uint256(Sha256D(buf.Bytes())))
+			}
+		}
+		for index, output := range tx.Outputs {
+			buf := new(bytes.Buffer)
+			buf.WriteByte(stateCreated)
+			if err := core.NewOutPoint(tx.Hash(), uint16(index)).Serialize(buf); err != nil {
+				return Uint256{}, err
+			}
+			if err := output.Serialize(buf); err != nil {
+				return Uint256{}, err
+			}
+			deltas = append(deltas, Uint256(Sha256D(buf.Bytes())))
+		}
+	}
+	if len(deltas) == 0 {
+		return parentRoot, nil
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		return bytes.Compare(deltas[i][:], deltas[j][:]) < 0
+	})
+	deltaRoot, err := crypto.ComputeRoot(deltas)
+	if err != nil {
+		return Uint256{}, err
+	}
+	return Uint256(Sha256D(append(parentRoot.Bytes(), deltaRoot.Bytes()...))), nil
+}
+
+// SetStateRoot sets the version and the state root of a block to be mined on
+// the parent node when the state root is active at the block height.
+func SetStateRoot(block *core.Block, parent *BlockNode) error {
+	if !stateRootActive(block.Header.Height) {
+		return nil
+	}
+	root, err := CalcStateRoot(parentStateRoot(parent), block)
+	if err != nil {
+		return err
+	}
+	block.Header.Version = core.StateRootVersion
+	block.Header.StateRoot = root
+	return nil
+}
+
+// checkStateRoot checks the state root of a block connected to the parent
+// node, it must match the state root recomputed from the block after the
+// state root is active and must be absent before.
+func checkStateRoot(block *core.Block, parent *BlockNode) error {
+	height := parent.Height + 1
+	if !stateRootActive(height) {
+		if block.Header.Version >= core.StateRootVersion {
+			return fmt.Errorf("block %d has a state root before the activation height", height)
+		}
+		return nil
+	}
+	if block.Header.Version < core.StateRootVersion {
+		return fmt.Errorf("block %d has no state root", height)
+	}
+	root, err := CalcStateRoot(parentStateRoot(parent), block)
+	if err != nil {
+		return err
+	}
+	if !block.Header.StateRoot.IsEqual(root) {
+		return fmt.Errorf("block %d state root mismatch", height)
+	}
+	return nil
+}
+
+func parentStateRoot(parent *BlockNode) Uint256 {
+	if parent.Version < core.StateRootVersion {
+		return EmptyHash
+	}
+	return parent.StateRoot
+}
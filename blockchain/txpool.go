@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math/big"
 	"sync"
+	"time"
 
 	"github.com/elastos/Elastos.ELA.SideChain/config"
 	"github.com/elastos/Elastos.ELA.SideChain/core"
@@ -15,6 +17,26 @@ import (
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
+// MaxReplacementEvictions is the max count of transactions, including the
+// conflicting ones and their descendants, a replacement can evict from pool.
+const MaxReplacementEvictions = 100
+
+// DefaultMaxTxChainDepth is the max depth of the transaction dependency chain
+// in pool when MaxTxChainDepth is not configured.
+const DefaultMaxTxChainDepth = 1000
+
+// assetFeeRateUnit is the unit of the rates in AssetFeeRates, a rate of
+// assetFeeRateUnit values one unit of the asset as one unit of the chain asset.
+const assetFeeRateUnit = 100000000
+
+// Default limits of the unconfirmed transaction chain when they are not
+// configured.
+const (
+	DefaultMaxTxAncestors    = 25
+	DefaultMaxTxDescendants  = 25
+	DefaultMaxTxAncestorSize = 101000
+)
+
 type TxPool struct {
 	sync.RWMutex
 	txnCnt  uint64                        // count
@@ -22,6 +44,20 @@ type TxPool struct {
 	//issueSummary  map[Uint256]Fixed64           // transaction which pass the verify will summary the amout to this map
 	inputUTXOList   map[string]*core.Transaction  // transaction which pass the verify will add the UTXO to this map
 	mainchainTxList map[Uint256]*core.Transaction // mainchain tx pool
+	idPathList      map[string]*core.Transaction  // identification registrations by ID and path
+
+	txParents  map[Uint256]map[Uint256]struct{} // in pool parents of the transactions in pool
+	txChildren map[Uint256]map[Uint256]struct{} // in pool children of the transactions in pool
+
+	orphanLock   sync.RWMutex
+	orphans      map[Uint256]*OrphanTx   // transactions which refer to unknown transactions
+	prevOrphans  map[Uint256][]*OrphanTx // orphan transactions indexed by the missing parent TxID
+	oldestOrphan *OrphanTx
+}
+
+type OrphanTx struct {
+	Transaction *core.Transaction
+	Expiration  time.Time
 }
 
 func (pool *TxPool) Init() {
@@ -32,35 +68,111 @@ func (pool *TxPool) Init() {
 	//pool.issueSummary = make(map[Uint256]Fixed64)
 	pool.txnList = make(map[Uint256]*core.Transaction)
 	pool.mainchainTxList = make(map[Uint256]*core.Transaction)
+	pool.idPathList = make(map[string]*core.Transaction)
+	pool.txParents = make(map[Uint256]map[Uint256]struct{})
+	pool.txChildren = make(map[Uint256]map[Uint256]struct{})
+	txPoolSize.Set(0)
+	txPoolBytes.Set(0)
+
+	pool.orphanLock.Lock()
+	defer pool.orphanLock.Unlock()
+	pool.orphans = make(map[Uint256]*OrphanTx)
+	pool.prevOrphans = make(map[Uint256][]*OrphanTx)
+	pool.oldestOrphan = nil
 }
 
 //append transaction to txnpool when check ok.
 //1.check  2.check with ledger(db) 3.check with pool
 func (pool *TxPool) AppendToTxnPool(txn *core.Transaction) ErrCode {
-	//verify transaction with Concurrency
-	if errCode := CheckTransactionSanity(txn); errCode != Success {
-		log.Info("Transaction verification failed", txn.Hash())
-		return errCode
-	}
-	if errCode := CheckTransactionContext(txn); errCode != Success {
-		log.Info("Transaction verification with ledger failed", txn.Hash())
+	feeMap, errCode := pool.checkTransaction(txn, true)
+	if errCode != Success {
+		txPoolRejected.With(int(errCode)).Inc()
 		return errCode
 	}
 	//verify transaction by pool with lock
 	if errCode := pool.verifyTransactionWithTxnPool(txn); errCode != Success {
 		log.Warn("[TxPool verifyTransactionWithTxnPool] failed", txn.Hash())
+		txPoolRejected.With(int(errCode)).Inc()
 		return errCode
 	}
 
-	txn.Fee = GetTxFee(txn, DefaultLedger.Blockchain.AssetID)
+	txn.Fee = feeMap[DefaultLedger.Blockchain.AssetID]
 	buf := new(bytes.Buffer)
 	txn.Serialize(buf)
-	txn.FeePerKB = txn.Fee * 1000 / Fixed64(len(buf.Bytes()))
+	txn.FeePerKB = NormalizedFee(feeMap) * 1000 / Fixed64(len(buf.Bytes()))
 	//add the transaction to process scope
 	pool.addToTxList(txn)
+	txPoolAccepted.Inc()
+	//the orphans waiting for this transaction can be accepted now
+	pool.processOrphans([]*core.Transaction{txn})
 	return Success
 }
 
+// TestAcceptTransaction checks the transaction would be accepted by the pool
+// at the current tip, without adding it to the pool, the orphan pool or
+// replacing the conflicting transactions. The fees of the transaction by
+// asset are returned if it would be accepted.
+func (pool *TxPool) TestAcceptTransaction(txn *core.Transaction) (map[Uint256]Fixed64, ErrCode) {
+	if pool.GetTransaction(txn.Hash()) != nil {
+		return nil, ErrTxHashDuplicate
+	}
+	feeMap, errCode := pool.checkTransaction(txn, false)
+	if errCode != Success {
+		return nil, errCode
+	}
+	if errCode := pool.checkTransactionWithTxnPool(txn); errCode != Success {
+		return nil, errCode
+	}
+	return feeMap, Success
+}
+
+// checkTransaction checks the transaction with the ledger and the policy of
+// the pool without changing the pool, the transaction referring to unknown
+// transactions is held in the orphan pool if holdOrphan is true. The fees of
+// the transaction by asset are returned.
+func (pool *TxPool) checkTransaction(txn *core.Transaction, holdOrphan bool) (map[Uint256]Fixed64, ErrCode) {
+	//verify transaction with Concurrency
+	if errCode := CheckTransaction(txn, false); errCode != Success {
+		log.Info("Transaction verification failed", txn.Hash())
+		return nil, errCode
+	}
+	//reject the transactions out of the standardness policy
+	if err := CheckTransactionStandard(txn); err != nil {
+		log.Info("Transaction is not standard", txn.Hash(), err)
+		return nil, ErrNonStandard
+	}
+	//hold the transaction in orphan pool until all referenced transactions arrived
+	if parents := pool.missingParents(txn); len(parents) > 0 {
+		if holdOrphan {
+			pool.addOrphan(txn, parents)
+			log.Info("Transaction added to orphan pool", txn.Hash())
+		}
+		return nil, ErrUnknownReferedTxn
+	}
+	//the transaction can spend the outputs of the transactions in pool
+	if errCode := CheckTransactionContextWithView(txn, pool); errCode != Success {
+		log.Info("Transaction verification with ledger failed", txn.Hash())
+		return nil, errCode
+	}
+	//verify the unconfirmed transaction chain limits
+	if err := pool.checkTxChainLimits(txn); err != nil {
+		log.Warn("[TxPool checkTxChainLimits] failed", txn.Hash(), err)
+		return nil, ErrTxChainTooLong
+	}
+
+	feeMap, err := getTxFeeMap(txn, pool)
+	if err != nil {
+		log.Info("Transaction fee unknown", txn.Hash(), err)
+		return nil, ErrTransactionBalance
+	}
+	//the memo data is paid by an extra fee
+	if err := checkMemoFee(txn, feeMap[DefaultLedger.Blockchain.AssetID]); err != nil {
+		log.Info("Transaction memo fee not enough", txn.Hash(), err)
+		return nil, ErrNonStandard
+	}
+	return feeMap, Success
+}
+
 // GetTxInPool returns a transaction in transaction pool by the given
 // transaction id. If no transaction match the transaction id, return nil, false
 func (pool *TxPool) GetTxInPool(txId Uint256) (*core.Transaction, bool) {
@@ -87,6 +199,7 @@ func (pool *TxPool) CleanSubmittedTransactions(block *core.Block) error {
 	pool.cleanTransactionList(block.Transactions)
 	pool.cleanUTXOList(block.Transactions)
 	pool.cleanMainchainTx(block.Transactions)
+	pool.processOrphans(block.Transactions)
 	return nil
 }
 
@@ -107,6 +220,14 @@ func (pool *TxPool) verifyTransactionWithTxnPool(txn *core.Transaction) ErrCode
 		}
 	}
 
+	if txn.IsRegisterIdentificationTx() {
+		// check if the registration conflicts with a registration in pool
+		if err := pool.verifyDuplicateIdentification(txn); err != nil {
+			log.Warn(err)
+			return ErrIdentificationUpdate
+		}
+	}
+
 	// check if the transaction includes double spent UTXO inputs
 	if err := pool.verifyDoubleSpend(txn); err != nil {
 		log.Info(err)
@@ -116,12 +237,48 @@ func (pool *TxPool) verifyTransactionWithTxnPool(txn *core.Transaction) ErrCode
 	return Success
 }
 
+// checkTransactionWithTxnPool checks the transaction does not conflict with
+// the transactions in pool, or is allowed to replace them, without changing
+// the pool.
+func (pool *TxPool) checkTransactionWithTxnPool(txn *core.Transaction) ErrCode {
+	if txn.IsRechargeToSideChainTx() {
+		if err := pool.checkDuplicateMainchainTx(txn); err != nil {
+			log.Warn(err)
+			return ErrMainchainTxDuplicate
+		}
+	}
+
+	if txn.IsRegisterIdentificationTx() {
+		if err := pool.verifyDuplicateIdentification(txn); err != nil {
+			log.Warn(err)
+			return ErrIdentificationUpdate
+		}
+	}
+
+	if _, _, err := pool.checkDoubleSpend(txn); err != nil {
+		log.Info(err)
+		return ErrDoubleSpend
+	}
+
+	return Success
+}
+
 //remove from associated map
 func (pool *TxPool) removeTransaction(txn *core.Transaction) {
+	//0.remove the descendants which spend the outputs of this transaction
+	descendants, err := pool.getDescendants(map[Uint256]*core.Transaction{txn.Hash(): txn})
+	if err != nil {
+		log.Warn("[TxPool removeTransaction] get descendants failed", err)
+	}
+	for hash, descendant := range descendants {
+		if !hash.IsEqual(txn.Hash()) {
+			pool.removeReplacedTransaction(descendant)
+		}
+	}
 	//1.remove from txnList
 	pool.delFromTxList(txn.Hash())
 	//2.remove from UTXO list map
-	result, err := DefaultLedger.Store.GetTxReference(txn)
+	result, err := DefaultLedger.Store.GetTxReferenceWithView(txn, pool)
 	if err != nil {
 		log.Info(fmt.Sprintf("Transaction =%x not Exist in Pool when delete.", txn.Hash()))
 		return
@@ -133,26 +290,264 @@ func (pool *TxPool) removeTransaction(txn *core.Transaction) {
 
 //check and add to utxo list pool
 func (pool *TxPool) verifyDoubleSpend(txn *core.Transaction) error {
-	reference, err := DefaultLedger.Store.GetTxReference(txn)
+	inputs, evicts, err := pool.checkDoubleSpend(txn)
 	if err != nil {
 		return err
 	}
+	for _, evict := range evicts {
+		pool.removeReplacedTransaction(evict)
+		log.Info("Transaction replaced in pool", evict.Hash(), "by", txn.Hash())
+	}
+	for _, v := range inputs {
+		pool.addInputUTXOList(txn, v)
+	}
+
+	return nil
+}
+
+// checkDoubleSpend returns the inputs of the transaction and the transactions
+// in pool to be replaced by it, an error is returned if the transaction
+// conflicts with the transactions in pool which can not be replaced.
+func (pool *TxPool) checkDoubleSpend(txn *core.Transaction) ([]*core.Input, map[Uint256]*core.Transaction, error) {
+	// the outputs of the transactions in pool are reserved by their spends
+	// like the outputs in ledger, so two spends of them conflict
+	reference, err := DefaultLedger.Store.GetTxReferenceWithView(txn, pool)
+	if err != nil {
+		return nil, nil, err
+	}
 	inputs := []*core.Input{}
+	conflicts := make(map[Uint256]*core.Transaction)
 	for k := range reference {
 		if txn := pool.getInputUTXOList(k); txn != nil {
-			return errors.New(fmt.Sprintf("double spent UTXO inputs detected, "+
-				"transaction hash: %x, input: %s, index: %d",
-				txn.Hash(), k.Previous.TxID, k.Previous.Index))
+			if !config.Parameters.EnableRBF {
+				return nil, nil, errors.New(fmt.Sprintf("double spent UTXO inputs detected, "+
+					"transaction hash: %x, input: %s, index: %d",
+					txn.Hash(), k.Previous.TxID, k.Previous.Index))
+			}
+			conflicts[txn.Hash()] = txn
 		}
 		inputs = append(inputs, k)
 	}
-	for _, v := range inputs {
-		pool.addInputUTXOList(txn, v)
+	if len(conflicts) == 0 {
+		return inputs, nil, nil
+	}
+	evicts, err := pool.checkReplacement(txn, conflicts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return inputs, evicts, nil
+}
+
+// checkReplacement checks the replace-by-fee rules of a transaction which
+// conflicts with the transactions in pool, the conflicting transactions and
+// their descendants to be removed from pool are returned if the replacement
+// is allowed. A replacement spending the outputs of the transactions it
+// evicts is rejected, it would be left spending outputs no longer in pool.
+func (pool *TxPool) checkReplacement(txn *core.Transaction, conflicts map[Uint256]*core.Transaction) (map[Uint256]*core.Transaction, error) {
+	for hash, conflict := range conflicts {
+		if !SignalsReplacement(conflict) {
+			return nil, fmt.Errorf("double spent UTXO inputs detected, "+
+				"transaction %s is not replaceable", hash.String())
+		}
+	}
+
+	evicts, err := pool.getDescendants(conflicts)
+	if err != nil {
+		return nil, err
+	}
+	if len(evicts) > MaxReplacementEvictions {
+		return nil, fmt.Errorf("replacement evicts too many transactions, %d > %d",
+			len(evicts), MaxReplacementEvictions)
+	}
+	for _, input := range txn.Inputs {
+		if _, ok := evicts[input.Previous.TxID]; ok {
+			return nil, fmt.Errorf("replacement spends the output of the evicted transaction %s",
+				input.Previous.TxID.String())
+		}
+	}
+
+	var replacedFee Fixed64
+	for _, evict := range evicts {
+		replacedFee += evict.Fee
+	}
+	feeMap, err := getTxFeeMap(txn, pool)
+	if err != nil {
+		return nil, err
+	}
+	fee := feeMap[DefaultLedger.Blockchain.AssetID]
+	if fee < replacedFee+Fixed64(config.Parameters.PowConfiguration.MinTxFee) {
+		return nil, fmt.Errorf("replacement fee %s not enough, replaced fee %s",
+			fee.String(), replacedFee.String())
+	}
+	return evicts, nil
+}
+
+// getDescendants returns the given transactions and all the transactions in
+// pool which spend their outputs directly or indirectly.
+func (pool *TxPool) getDescendants(txs map[Uint256]*core.Transaction) (map[Uint256]*core.Transaction, error) {
+	pool.RLock()
+	defer pool.RUnlock()
+
+	reached, err := walkTxChain(txs, pool.txChildren)
+	if err != nil {
+		return nil, err
+	}
+	descendants := make(map[Uint256]*core.Transaction, len(txs)+len(reached))
+	for hash, tx := range txs {
+		descendants[hash] = tx
+	}
+	for hash := range reached {
+		descendants[hash] = pool.txnList[hash]
+	}
+	return descendants, nil
+}
+
+// getAncestors returns all the transactions in pool which the given
+// transaction spends directly or indirectly.
+func (pool *TxPool) getAncestors(txn *core.Transaction) (map[Uint256]*core.Transaction, error) {
+	pool.RLock()
+	defer pool.RUnlock()
+
+	ancestors := make(map[Uint256]*core.Transaction)
+	for _, input := range txn.Inputs {
+		if parent, ok := pool.txnList[input.Previous.TxID]; ok {
+			ancestors[input.Previous.TxID] = parent
+		}
 	}
 
+	reached, err := walkTxChain(ancestors, pool.txParents)
+	if err != nil {
+		return nil, err
+	}
+	for hash := range reached {
+		ancestors[hash] = pool.txnList[hash]
+	}
+	return ancestors, nil
+}
+
+// walkTxChain walks through the links from the given transactions iteratively
+// with an explicit stack, and returns the reached transactions excluding the
+// given ones. An error is returned if the chain is deeper than
+// maxTxChainDepth.
+func walkTxChain(txs map[Uint256]*core.Transaction,
+	links map[Uint256]map[Uint256]struct{}) (map[Uint256]struct{}, error) {
+	type stackItem struct {
+		hash  Uint256
+		depth int
+	}
+	maxDepth := maxTxChainDepth()
+	reached := make(map[Uint256]struct{})
+	stack := make([]stackItem, 0, len(txs))
+	for hash := range txs {
+		stack = append(stack, stackItem{hash: hash, depth: 0})
+	}
+	for len(stack) > 0 {
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for hash := range links[item.hash] {
+			if _, ok := txs[hash]; ok {
+				continue
+			}
+			if _, ok := reached[hash]; ok {
+				continue
+			}
+			if item.depth+1 > maxDepth {
+				return nil, fmt.Errorf("transaction dependency chain exceeds max depth %d", maxDepth)
+			}
+			reached[hash] = struct{}{}
+			stack = append(stack, stackItem{hash: hash, depth: item.depth + 1})
+		}
+	}
+	return reached, nil
+}
+
+func maxTxChainDepth() int {
+	if config.Parameters.MaxTxChainDepth > 0 {
+		return config.Parameters.MaxTxChainDepth
+	}
+	return DefaultMaxTxChainDepth
+}
+
+// checkTxChainLimits checks the count and size of the in pool ancestors of
+// the transaction, and the count of in pool descendants of each ancestor if
+// the transaction is added.
+func (pool *TxPool) checkTxChainLimits(txn *core.Transaction) error {
+	ancestors, err := pool.getAncestors(txn)
+	if err != nil {
+		return err
+	}
+
+	maxAncestors := config.Parameters.MaxTxAncestors
+	if maxAncestors <= 0 {
+		maxAncestors = DefaultMaxTxAncestors
+	}
+	// the ancestor count includes the transaction itself
+	if len(ancestors)+1 > maxAncestors {
+		return fmt.Errorf("too many unconfirmed ancestors, %d > %d", len(ancestors)+1, maxAncestors)
+	}
+
+	maxAncestorSize := config.Parameters.MaxTxAncestorSize
+	if maxAncestorSize <= 0 {
+		maxAncestorSize = DefaultMaxTxAncestorSize
+	}
+	size := txn.GetSize()
+	for _, ancestor := range ancestors {
+		size += ancestor.GetSize()
+	}
+	if size > maxAncestorSize {
+		return fmt.Errorf("unconfirmed ancestors too large, %d > %d bytes", size, maxAncestorSize)
+	}
+
+	maxDescendants := config.Parameters.MaxTxDescendants
+	if maxDescendants <= 0 {
+		maxDescendants = DefaultMaxTxDescendants
+	}
+	for hash, ancestor := range ancestors {
+		descendants, err := pool.getDescendants(map[Uint256]*core.Transaction{hash: ancestor})
+		if err != nil {
+			return err
+		}
+		// the descendant count includes the ancestor itself and the new
+		// transaction which is not in pool yet
+		if len(descendants)+1 > maxDescendants {
+			return fmt.Errorf("too many unconfirmed descendants of %s, %d > %d",
+				hash.String(), len(descendants)+1, maxDescendants)
+		}
+	}
 	return nil
 }
 
+// removeReplacedTransaction removes a replaced transaction from pool, along
+// with the UTXO inputs and mainchain tx it reserved.
+func (pool *TxPool) removeReplacedTransaction(txn *core.Transaction) {
+	pool.delFromTxList(txn.Hash())
+	for _, input := range txn.Inputs {
+		if tx := pool.getInputUTXOList(input); tx != nil && tx.Hash().IsEqual(txn.Hash()) {
+			pool.delInputUTXOList(input)
+		}
+	}
+	if txn.IsRechargeToSideChainTx() {
+		rechargePayload := txn.Payload.(*core.PayloadRechargeToSideChain)
+		if hashes, err := rechargePayload.GetMainchainTxHashes(); err == nil {
+			for _, hash := range hashes {
+				pool.delMainchainTx(hash)
+			}
+		}
+	}
+}
+
+// SignalsReplacement returns if the transaction signals it can be replaced by
+// a higher fee transaction, which means any of its input sequences is not
+// greater than MaxReplaceableSequence.
+func SignalsReplacement(txn *core.Transaction) bool {
+	for _, input := range txn.Inputs {
+		if input.Sequence <= core.MaxReplaceableSequence {
+			return true
+		}
+	}
+	return false
+}
+
 func (pool *TxPool) IsDuplicateMainchainTx(mainchainTxHash Uint256) bool {
 	_, ok := pool.mainchainTxList[mainchainTxHash]
 	if ok {
@@ -164,22 +559,55 @@ func (pool *TxPool) IsDuplicateMainchainTx(mainchainTxHash Uint256) bool {
 
 //check and add to mainchain tx pool
 func (pool *TxPool) verifyDuplicateMainchainTx(txn *core.Transaction) error {
+	if err := pool.checkDuplicateMainchainTx(txn); err != nil {
+		return err
+	}
+
+	pool.addMainchainTx(txn)
+
+	return nil
+}
+
+// checkDuplicateMainchainTx checks no transaction in pool recharges the
+// mainchain transactions recharged by the transaction.
+func (pool *TxPool) checkDuplicateMainchainTx(txn *core.Transaction) error {
 	rechargePayload, ok := txn.Payload.(*core.PayloadRechargeToSideChain)
 	if !ok {
 		return errors.New("convert the payload of recharge tx failed")
 	}
 
-	hash, err := rechargePayload.GetMainchainTxHash()
+	hashes, err := rechargePayload.GetMainchainTxHashes()
 	if err != nil {
 		return err
 	}
-	_, exist := pool.mainchainTxList[*hash]
-	if exist {
-		return errors.New("duplicate mainchain tx detected")
+	for _, hash := range hashes {
+		_, exist := pool.mainchainTxList[hash]
+		if exist {
+			return errors.New("duplicate mainchain tx detected")
+		}
 	}
+	return nil
+}
 
-	pool.addMainchainTx(txn)
-
+// verifyDuplicateIdentification checks no other transaction in pool registers
+// a path of the same ID.
+func (pool *TxPool) verifyDuplicateIdentification(txn *core.Transaction) error {
+	pool.RLock()
+	defer pool.RUnlock()
+	payload, ok := txn.Payload.(*core.PayloadRegisterIdentification)
+	if !ok {
+		return errors.New("convert the payload of register identification tx failed")
+	}
+	for _, content := range payload.Contents {
+		poolTx, ok := pool.idPathList[payload.ID+content.Path]
+		if !ok {
+			continue
+		}
+		if hash := poolTx.Hash(); !hash.IsEqual(txn.Hash()) {
+			return fmt.Errorf("identification ID %s path %s is registered by transaction %s in pool",
+				payload.ID, content.Path, hash.String())
+		}
+	}
 	return nil
 }
 
@@ -218,22 +646,31 @@ func (pool *TxPool) cleanMainchainTx(txs []*core.Transaction) {
 	for _, txn := range txs {
 		if txn.IsRechargeToSideChainTx() {
 			rechargePayload := txn.Payload.(*core.PayloadRechargeToSideChain)
-			mainTxHash, err := rechargePayload.GetMainchainTxHash()
+			mainTxHashes, err := rechargePayload.GetMainchainTxHashes()
 			if err != nil {
 				log.Error("get hash failed when clean mainchain tx:", txn.Hash())
 				continue
 			}
-			poolTx := pool.mainchainTxList[*mainTxHash]
-			if poolTx != nil {
-				// delete tx
-				pool.delFromTxList(poolTx.Hash())
-				// delete utxo
-				for _, input := range poolTx.Inputs {
-					pool.delInputUTXOList(input)
+			for _, mainTxHash := range mainTxHashes {
+				poolTx := pool.mainchainTxList[mainTxHash]
+				if poolTx != nil {
+					// delete tx
+					pool.delFromTxList(poolTx.Hash())
+					// delete utxo
+					for _, input := range poolTx.Inputs {
+						pool.delInputUTXOList(input)
+					}
+					// delete mainchain txs, a batched recharge may carry
+					// others than the committed one
+					poolPayload := poolTx.Payload.(*core.PayloadRechargeToSideChain)
+					poolTxHashes, err := poolPayload.GetMainchainTxHashes()
+					if err != nil {
+						poolTxHashes = []Uint256{mainTxHash}
+					}
+					for _, hash := range poolTxHashes {
+						pool.delMainchainTx(hash)
+					}
 				}
-				// delete mainchain tx
-				pool.delMainchainTx(*mainTxHash)
-
 			}
 		}
 	}
@@ -247,6 +684,14 @@ func (pool *TxPool) addToTxList(txn *core.Transaction) bool {
 		return false
 	}
 	pool.txnList[txnHash] = txn
+	pool.addTxLinks(txn)
+	txPoolSize.Add(1)
+	txPoolBytes.Add(int64(txn.GetSize()))
+	if payload, ok := txn.Payload.(*core.PayloadRegisterIdentification); ok {
+		for _, content := range payload.Contents {
+			pool.idPathList[payload.ID+content.Path] = txn
+		}
+	}
 	DefaultLedger.Blockchain.BCEvents.Notify(events.EventNewTransactionPutInPool, txn)
 	return true
 }
@@ -254,13 +699,64 @@ func (pool *TxPool) addToTxList(txn *core.Transaction) bool {
 func (pool *TxPool) delFromTxList(txId Uint256) bool {
 	pool.Lock()
 	defer pool.Unlock()
-	if _, ok := pool.txnList[txId]; !ok {
+	txn, ok := pool.txnList[txId]
+	if !ok {
 		return false
 	}
 	delete(pool.txnList, txId)
+	pool.delTxLinks(txId)
+	txPoolSize.Add(-1)
+	txPoolBytes.Add(-int64(txn.GetSize()))
+	if payload, ok := txn.Payload.(*core.PayloadRegisterIdentification); ok {
+		for _, content := range payload.Contents {
+			key := payload.ID + content.Path
+			if poolTx, ok := pool.idPathList[key]; ok && poolTx.Hash().IsEqual(txId) {
+				delete(pool.idPathList, key)
+			}
+		}
+	}
 	return true
 }
 
+// addTxLinks records the in pool parents and children of the transaction,
+// must be called with the pool lock held.
+func (pool *TxPool) addTxLinks(txn *core.Transaction) {
+	txnHash := txn.Hash()
+	for _, input := range txn.Inputs {
+		parent := input.Previous.TxID
+		if _, ok := pool.txnList[parent]; !ok {
+			continue
+		}
+		if pool.txParents[txnHash] == nil {
+			pool.txParents[txnHash] = make(map[Uint256]struct{})
+		}
+		pool.txParents[txnHash][parent] = struct{}{}
+		if pool.txChildren[parent] == nil {
+			pool.txChildren[parent] = make(map[Uint256]struct{})
+		}
+		pool.txChildren[parent][txnHash] = struct{}{}
+	}
+}
+
+// delTxLinks removes the transaction from the in pool parents and children
+// records, must be called with the pool lock held.
+func (pool *TxPool) delTxLinks(txId Uint256) {
+	for parent := range pool.txParents[txId] {
+		delete(pool.txChildren[parent], txId)
+		if len(pool.txChildren[parent]) == 0 {
+			delete(pool.txChildren, parent)
+		}
+	}
+	delete(pool.txParents, txId)
+	for child := range pool.txChildren[txId] {
+		delete(pool.txParents[child], txId)
+		if len(pool.txParents[child]) == 0 {
+			delete(pool.txParents, child)
+		}
+	}
+	delete(pool.txChildren, txId)
+}
+
 func (pool *TxPool) copyTxList() map[Uint256]*core.Transaction {
 	pool.RLock()
 	defer pool.RUnlock()
@@ -312,11 +808,13 @@ func (pool *TxPool) addMainchainTx(txn *core.Transaction) {
 	pool.Lock()
 	defer pool.Unlock()
 	rechargePayload := txn.Payload.(*core.PayloadRechargeToSideChain)
-	hash, err := rechargePayload.GetMainchainTxHash()
+	hashes, err := rechargePayload.GetMainchainTxHashes()
 	if err != nil {
 		return
 	}
-	pool.mainchainTxList[*hash] = txn
+	for _, hash := range hashes {
+		pool.mainchainTxList[hash] = txn
+	}
 }
 
 func (pool *TxPool) delMainchainTx(hash Uint256) bool {
@@ -330,6 +828,168 @@ func (pool *TxPool) delMainchainTx(hash Uint256) bool {
 	return true
 }
 
+// AddOrphan puts a transaction which refers to unknown transactions into the
+// orphan pool, it will be re-evaluated when the missing parents arrive.
+func (pool *TxPool) AddOrphan(txn *core.Transaction) bool {
+	parents := pool.missingParents(txn)
+	if len(parents) == 0 {
+		return false
+	}
+	return pool.addOrphan(txn, parents)
+}
+
+// IsOrphanInPool returns if the transaction is held in the orphan pool.
+func (pool *TxPool) IsOrphanInPool(txId Uint256) bool {
+	pool.orphanLock.RLock()
+	defer pool.orphanLock.RUnlock()
+	_, ok := pool.orphans[txId]
+	return ok
+}
+
+// GetOrphanCount returns the count of transactions in the orphan pool.
+func (pool *TxPool) GetOrphanCount() int {
+	pool.orphanLock.RLock()
+	defer pool.orphanLock.RUnlock()
+	return len(pool.orphans)
+}
+
+func (pool *TxPool) addOrphan(txn *core.Transaction, parents []Uint256) bool {
+	pool.orphanLock.Lock()
+	defer pool.orphanLock.Unlock()
+
+	txHash := txn.Hash()
+	if _, ok := pool.orphans[txHash]; ok {
+		return false
+	}
+
+	for _, orphan := range pool.orphans {
+		if time.Now().After(orphan.Expiration) {
+			pool.removeOrphan(orphan)
+		}
+	}
+
+	maxOrphanTxs := config.Parameters.ChainParam.MaxOrphanTxs
+	if maxOrphanTxs <= 0 {
+		return false
+	}
+	for len(pool.orphans)+1 > maxOrphanTxs {
+		if pool.oldestOrphan == nil {
+			for _, orphan := range pool.orphans {
+				if pool.oldestOrphan == nil || orphan.Expiration.Before(pool.oldestOrphan.Expiration) {
+					pool.oldestOrphan = orphan
+				}
+			}
+		}
+		log.Debug("Evict oldest orphan transaction", pool.oldestOrphan.Transaction.Hash())
+		pool.removeOrphan(pool.oldestOrphan)
+	}
+
+	// Insert the transaction into the orphan map with an expiration time
+	// 15 minutes from now.
+	orphan := &OrphanTx{
+		Transaction: txn,
+		Expiration:  time.Now().Add(time.Minute * 15),
+	}
+	pool.orphans[txHash] = orphan
+	if pool.oldestOrphan == nil || orphan.Expiration.Before(pool.oldestOrphan.Expiration) {
+		pool.oldestOrphan = orphan
+	}
+
+	// Add to missing parent lookup index for faster dependency lookups.
+	for _, parent := range parents {
+		pool.prevOrphans[parent] = append(pool.prevOrphans[parent], orphan)
+	}
+
+	return true
+}
+
+// removeOrphan must be called with the orphan lock held.
+func (pool *TxPool) removeOrphan(orphan *OrphanTx) {
+	txHash := orphan.Transaction.Hash()
+	if _, ok := pool.orphans[txHash]; !ok {
+		return
+	}
+	delete(pool.orphans, txHash)
+	if pool.oldestOrphan == orphan {
+		pool.oldestOrphan = nil
+	}
+
+	for _, input := range orphan.Transaction.Inputs {
+		parent := input.Previous.TxID
+		orphans, ok := pool.prevOrphans[parent]
+		if !ok {
+			continue
+		}
+		for i := 0; i < len(orphans); i++ {
+			if orphans[i] == orphan {
+				copy(orphans[i:], orphans[i+1:])
+				orphans[len(orphans)-1] = nil
+				orphans = orphans[:len(orphans)-1]
+				i--
+			}
+		}
+		if len(orphans) == 0 {
+			delete(pool.prevOrphans, parent)
+		} else {
+			pool.prevOrphans[parent] = orphans
+		}
+	}
+}
+
+// processOrphans re-evaluates the orphan transactions which refer to the
+// given transactions, the orphans will go through all the checks again and
+// be moved into the transaction pool once their parents are all available.
+func (pool *TxPool) processOrphans(txs []*core.Transaction) {
+	promotes := make([]*core.Transaction, 0)
+	pool.orphanLock.Lock()
+	for _, txn := range txs {
+		txHash := txn.Hash()
+		// the orphan itself has been packed into block
+		if orphan, ok := pool.orphans[txHash]; ok {
+			pool.removeOrphan(orphan)
+		}
+		for _, orphan := range pool.prevOrphans[txHash] {
+			promotes = append(promotes, orphan.Transaction)
+		}
+		for _, txn := range promotes {
+			if orphan, ok := pool.orphans[txn.Hash()]; ok {
+				pool.removeOrphan(orphan)
+			}
+		}
+	}
+	pool.orphanLock.Unlock()
+
+	for _, txn := range promotes {
+		if errCode := pool.AppendToTxnPool(txn); errCode != Success {
+			log.Debug("Orphan transaction not promoted", txn.Hash(), errCode.Message())
+			continue
+		}
+		log.Info("Orphan transaction promoted to transaction pool", txn.Hash())
+	}
+}
+
+// missingParents returns the referenced transactions which can not be found
+// in the ledger or the pool.
+func (pool *TxPool) missingParents(txn *core.Transaction) []Uint256 {
+	if txn.IsCoinBaseTx() || txn.IsRechargeToSideChainTx() {
+		return nil
+	}
+	var parents []Uint256
+	checked := make(map[Uint256]struct{})
+	for _, input := range txn.Inputs {
+		parent := input.Previous.TxID
+		if _, ok := checked[parent]; ok {
+			continue
+		}
+		checked[parent] = struct{}{}
+		if _, _, err := DefaultLedger.Store.GetTransaction(parent); err != nil &&
+			pool.GetTransaction(parent) == nil {
+			parents = append(parents, parent)
+		}
+	}
+	return parents
+}
+
 func (pool *TxPool) MaybeAcceptTransaction(txn *core.Transaction) error {
 	txHash := txn.Hash()
 
@@ -378,33 +1038,65 @@ func GetTxFee(tx *core.Transaction, assetId Uint256) Fixed64 {
 	return feeMap[assetId]
 }
 
+// NormalizedFee converts the fees paid in different assets to the chain asset
+// by the rates configured in AssetFeeRates, so that transactions paying fees
+// in different assets can be ranked together. The rates are keyed by the
+// reversed hex asset ID, and a rate is the value of one unit of the asset in
+// the chain asset with 8 decimals like Fixed64. Fees in assets without a
+// configured rate are ignored.
+func NormalizedFee(feeMap map[Uint256]Fixed64) Fixed64 {
+	var fee Fixed64
+	for assetID, amount := range feeMap {
+		if assetID.IsEqual(DefaultLedger.Blockchain.AssetID) {
+			fee += amount
+			continue
+		}
+		key := BytesToHexString(BytesReverse(assetID.Bytes()))
+		rate, ok := config.Parameters.AssetFeeRates[key]
+		if !ok {
+			continue
+		}
+		value := new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(rate))
+		fee += Fixed64(value.Div(value, big.NewInt(assetFeeRateUnit)).Int64())
+	}
+	return fee
+}
+
 func GetTxFeeMap(tx *core.Transaction) (map[Uint256]Fixed64, error) {
+	return getTxFeeMap(tx, nil)
+}
+
+// getTxFeeMap returns the fees of the transaction by asset, the referenced
+// outputs not in ledger are looked up in the view.
+func getTxFeeMap(tx *core.Transaction, view MempoolView) (map[Uint256]Fixed64, error) {
 	feeMap := make(map[Uint256]Fixed64)
 
 	if tx.IsRechargeToSideChainTx() {
 		depositPayload := tx.Payload.(*core.PayloadRechargeToSideChain)
-		mainChainTransaction := new(core.Transaction)
-		reader := bytes.NewReader(depositPayload.MainChainTransaction)
-		if err := mainChainTransaction.Deserialize(reader); err != nil {
-			return nil, errors.New("GetTxFeeMap mainChainTransaction deserialize failed")
-		}
+		for _, deposit := range depositPayload.GetDeposits() {
+			mainChainTransaction := new(core.Transaction)
+			reader := bytes.NewReader(deposit.MainChainTransaction)
+			if err := mainChainTransaction.Deserialize(reader); err != nil {
+				return nil, errors.New("GetTxFeeMap mainChainTransaction deserialize failed")
+			}
 
-		crossChainPayload := mainChainTransaction.Payload.(*core.PayloadTransferCrossChainAsset)
+			crossChainPayload := mainChainTransaction.Payload.(*core.PayloadTransferCrossChainAsset)
 
-		for _, v := range tx.Outputs {
-			for i := 0; i < len(crossChainPayload.CrossChainAddresses); i++ {
-				targetAddress, err := v.ProgramHash.ToAddress()
-				if err != nil {
-					return nil, err
-				}
-				if targetAddress == crossChainPayload.CrossChainAddresses[i] {
-					mcAmount := mainChainTransaction.Outputs[crossChainPayload.OutputIndexes[i]].Value
-
-					amount, ok := feeMap[v.AssetID]
-					if ok {
-						feeMap[v.AssetID] = amount + Fixed64(float64(mcAmount)*config.Parameters.ExchangeRate) - v.Value
-					} else {
-						feeMap[v.AssetID] = Fixed64(float64(mcAmount)*config.Parameters.ExchangeRate) - v.Value
+			for _, v := range tx.Outputs {
+				for i := 0; i < len(crossChainPayload.CrossChainAddresses); i++ {
+					targetAddress, err := v.ProgramHash.ToAddress()
+					if err != nil {
+						return nil, err
+					}
+					if targetAddress == crossChainPayload.CrossChainAddresses[i] {
+						mcAmount := mainChainTransaction.Outputs[crossChainPayload.OutputIndexes[i]].Value
+
+						amount, ok := feeMap[v.AssetID]
+						if ok {
+							feeMap[v.AssetID] = amount + Fixed64(float64(mcAmount)*config.Parameters.ExchangeRate) - v.Value
+						} else {
+							feeMap[v.AssetID] = Fixed64(float64(mcAmount)*config.Parameters.ExchangeRate) - v.Value
+						}
 					}
 				}
 			}
@@ -413,7 +1105,7 @@ func GetTxFeeMap(tx *core.Transaction) (map[Uint256]Fixed64, error) {
 		return feeMap, nil
 	}
 
-	reference, err := DefaultLedger.Store.GetTxReference(tx)
+	reference, err := DefaultLedger.Store.GetTxReferenceWithView(tx, view)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,646 @@
+package blockchain
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+	. "github.com/elastos/Elastos.ELA.SideChain/errors"
+	"github.com/elastos/Elastos.ELA.SideChain/log"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxPoolInit(t *testing.T) {
+	log.Init(
+		config.Parameters.PrintLevel,
+		config.Parameters.MaxPerLogSize,
+		config.Parameters.MaxLogsSize,
+	)
+	foundation, err := common.Uint168FromAddress("8VYXVxKKSAxkmRrfmGpQR2Kc66XhG6m3ta")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	FoundationAddress = *foundation
+	chainStore, err := newTestChainStore()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	err = Init(chainStore)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+}
+
+func TestTxPool_AddOrphan(t *testing.T) {
+	var pool TxPool
+	pool.Init()
+
+	maxOrphanTxs := config.Parameters.ChainParam.MaxOrphanTxs
+	config.Parameters.ChainParam.MaxOrphanTxs = 2
+	defer func() {
+		config.Parameters.ChainParam.MaxOrphanTxs = maxOrphanTxs
+	}()
+
+	parents := func(tx *core.Transaction) []common.Uint256 {
+		var hashes []common.Uint256
+		for _, input := range tx.Inputs {
+			hashes = append(hashes, input.Previous.TxID)
+		}
+		return hashes
+	}
+
+	tx1, tx2, tx3 := buildTx(), buildTx(), buildTx()
+	assert.True(t, pool.addOrphan(tx1, parents(tx1)))
+	assert.True(t, pool.addOrphan(tx2, parents(tx2)))
+	// duplicated orphan should be ignored
+	assert.False(t, pool.addOrphan(tx2, parents(tx2)))
+	assert.Equal(t, 2, pool.GetOrphanCount())
+
+	// the oldest orphan should be evicted when orphan pool is full
+	assert.True(t, pool.addOrphan(tx3, parents(tx3)))
+	assert.Equal(t, 2, pool.GetOrphanCount())
+	assert.False(t, pool.IsOrphanInPool(tx1.Hash()))
+	assert.True(t, pool.IsOrphanInPool(tx2.Hash()))
+	assert.True(t, pool.IsOrphanInPool(tx3.Hash()))
+
+	// the missing parent index should be cleaned with the evicted orphan
+	for _, input := range tx1.Inputs {
+		for _, orphan := range pool.prevOrphans[input.Previous.TxID] {
+			assert.NotEqual(t, tx1.Hash(), orphan.Transaction.Hash())
+		}
+	}
+	for _, input := range tx3.Inputs {
+		assert.NotEmpty(t, pool.prevOrphans[input.Previous.TxID])
+	}
+
+	t.Log("[TestTxPool_AddOrphan] PASSED")
+}
+
+func TestTxPool_GetDescendants(t *testing.T) {
+	var pool TxPool
+	pool.Init()
+
+	// build a very long dependency chain
+	chainLength := 10000
+	root := buildTx()
+	pool.txnList[root.Hash()] = root
+	txs := make([]*core.Transaction, 0, chainLength)
+	parent := root
+	for i := 0; i < chainLength; i++ {
+		tx := buildTx()
+		tx.Inputs = []*core.Input{
+			{Previous: *core.NewOutPoint(parent.Hash(), 0)},
+		}
+		pool.txnList[tx.Hash()] = tx
+		pool.addTxLinks(tx)
+		txs = append(txs, tx)
+		parent = tx
+	}
+	roots := map[common.Uint256]*core.Transaction{root.Hash(): root}
+
+	maxTxChainDepth := config.Parameters.MaxTxChainDepth
+	defer func() {
+		config.Parameters.MaxTxChainDepth = maxTxChainDepth
+	}()
+
+	// chain deeper than max depth
+	config.Parameters.MaxTxChainDepth = chainLength - 1
+	_, err := pool.getDescendants(roots)
+	assert.EqualError(t, err, fmt.Sprintf(
+		"transaction dependency chain exceeds max depth %d", chainLength-1))
+
+	// chain within max depth
+	config.Parameters.MaxTxChainDepth = chainLength
+	descendants, err := pool.getDescendants(roots)
+	assert.NoError(t, err)
+	assert.Equal(t, chainLength+1, len(descendants))
+	for _, tx := range txs {
+		assert.Contains(t, descendants, tx.Hash())
+	}
+
+	t.Log("[TestTxPool_GetDescendants] PASSED")
+}
+
+func TestTxPool_CheckTxChainLimits(t *testing.T) {
+	var pool TxPool
+	pool.Init()
+
+	maxAncestors := config.Parameters.MaxTxAncestors
+	maxDescendants := config.Parameters.MaxTxDescendants
+	maxAncestorSize := config.Parameters.MaxTxAncestorSize
+	config.Parameters.MaxTxAncestors = 3
+	config.Parameters.MaxTxDescendants = 3
+	config.Parameters.MaxTxAncestorSize = 0
+	defer func() {
+		config.Parameters.MaxTxAncestors = maxAncestors
+		config.Parameters.MaxTxDescendants = maxDescendants
+		config.Parameters.MaxTxAncestorSize = maxAncestorSize
+	}()
+
+	newTx := func(parent *core.Transaction, index uint16) *core.Transaction {
+		tx := buildTx()
+		tx.Inputs = []*core.Input{
+			{Previous: *core.NewOutPoint(parent.Hash(), index)},
+		}
+		tx.Outputs = tx.Outputs[:1]
+		return tx
+	}
+	addToPool := func(tx *core.Transaction) {
+		pool.txnList[tx.Hash()] = tx
+		pool.addTxLinks(tx)
+	}
+
+	// a chain of 3 transactions in pool
+	tx1 := newTx(buildTx(), 0)
+	addToPool(tx1)
+	tx2 := newTx(tx1, 0)
+	addToPool(tx2)
+	tx3 := newTx(tx2, 0)
+	assert.NoError(t, pool.checkTxChainLimits(tx3))
+	addToPool(tx3)
+
+	// too many ancestors
+	tx4 := newTx(tx3, 0)
+	assert.EqualError(t, pool.checkTxChainLimits(tx4), "too many unconfirmed ancestors, 4 > 3")
+
+	// too many descendants of tx1
+	config.Parameters.MaxTxAncestors = 10
+	tx4 = newTx(tx1, 1)
+	err := pool.checkTxChainLimits(tx4)
+	assert.EqualError(t, err, fmt.Sprintf(
+		"too many unconfirmed descendants of %s, 4 > 3", tx1.Hash().String()))
+
+	// ancestors too large
+	config.Parameters.MaxTxDescendants = 10
+	config.Parameters.MaxTxAncestorSize = tx1.GetSize() + tx4.GetSize() - 1
+	assert.Error(t, pool.checkTxChainLimits(tx4))
+	config.Parameters.MaxTxAncestorSize = tx1.GetSize() + tx4.GetSize()
+	assert.NoError(t, pool.checkTxChainLimits(tx4))
+
+	// removing tx2 unlinks tx3 from tx1
+	delete(pool.txnList, tx2.Hash())
+	pool.delTxLinks(tx2.Hash())
+	assert.Empty(t, pool.txParents[tx3.Hash()])
+	assert.Empty(t, pool.txChildren[tx1.Hash()])
+
+	t.Log("[TestTxPool_CheckTxChainLimits] PASSED")
+}
+
+func TestTxPool_VerifyDuplicateIdentification(t *testing.T) {
+	var pool TxPool
+	pool.Init()
+
+	newRegistration := func(lockTime uint32, paths ...string) *core.Transaction {
+		payload := &core.PayloadRegisterIdentification{ID: "ij8rfb6A4Ri7c5CRE1nDVdVCUMuUxkk2c6"}
+		for _, path := range paths {
+			payload.Contents = append(payload.Contents, core.RegisterIdentificationContent{Path: path})
+		}
+		return &core.Transaction{TxType: core.RegisterIdentification, Payload: payload, LockTime: lockTime}
+	}
+	tx1 := newRegistration(1, "kyc/person/identityCard")
+	pool.txnList[tx1.Hash()] = tx1
+	pool.idPathList["ij8rfb6A4Ri7c5CRE1nDVdVCUMuUxkk2c6kyc/person/identityCard"] = tx1
+
+	// the same transaction
+	assert.NoError(t, pool.verifyDuplicateIdentification(tx1))
+
+	// another path of the ID
+	assert.NoError(t, pool.verifyDuplicateIdentification(newRegistration(2, "kyc/person/phone")))
+
+	// the same path from another transaction
+	tx2 := newRegistration(2, "kyc/person/phone", "kyc/person/identityCard")
+	hash := tx1.Hash()
+	assert.EqualError(t, pool.verifyDuplicateIdentification(tx2), fmt.Sprintf(
+		"identification ID %s path %s is registered by transaction %s in pool",
+		"ij8rfb6A4Ri7c5CRE1nDVdVCUMuUxkk2c6", "kyc/person/identityCard", hash.String()))
+
+	// the path is released with the transaction
+	assert.True(t, pool.delFromTxList(tx1.Hash()))
+	assert.Empty(t, pool.idPathList)
+	assert.NoError(t, pool.verifyDuplicateIdentification(tx2))
+
+	t.Log("[TestTxPool_VerifyDuplicateIdentification] PASSED")
+}
+
+func TestTxPool_ReplaceByFee(t *testing.T) {
+	// deposit 100 ELA to foundation account
+	deposit := NewCoinBaseTransaction(new(core.PayloadCoinBase), 0)
+	deposit.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: common.Fixed64(100 * ELA)},
+	}
+	DefaultLedger.Store.(*ChainStore).NewBatch()
+	DefaultLedger.Store.(*ChainStore).PersistTransaction(deposit, 0)
+	DefaultLedger.Store.(*ChainStore).BatchCommit()
+
+	spend := func(value common.Fixed64, sequence uint32) *core.Transaction {
+		tx := buildTx()
+		tx.Inputs = []*core.Input{
+			{Previous: *core.NewOutPoint(deposit.Hash(), 0), Sequence: sequence},
+		}
+		tx.Outputs = []*core.Output{
+			{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: value},
+		}
+		return tx
+	}
+	appendToPool := func(pool *TxPool, tx *core.Transaction) ErrCode {
+		if errCode := pool.verifyTransactionWithTxnPool(tx); errCode != Success {
+			return errCode
+		}
+		tx.Fee = GetTxFee(tx, DefaultLedger.Blockchain.AssetID)
+		pool.addToTxList(tx)
+		return Success
+	}
+
+	var pool TxPool
+	pool.Init()
+	enableRBF := config.Parameters.EnableRBF
+	minTxFee := config.Parameters.PowConfiguration.MinTxFee
+	config.Parameters.PowConfiguration.MinTxFee = 100
+
+	// transaction with 1 ELA fee signals replacement
+	tx1 := spend(common.Fixed64(99*ELA), 0)
+	assert.Equal(t, Success, appendToPool(&pool, tx1))
+
+	// replacement disabled
+	config.Parameters.EnableRBF = false
+	tx2 := spend(common.Fixed64(99*ELA)-100, 0)
+	assert.Equal(t, ErrDoubleSpend, appendToPool(&pool, tx2))
+
+	// replacement fee not enough
+	config.Parameters.EnableRBF = true
+	tx2 = spend(common.Fixed64(99*ELA)-99, 0)
+	assert.Equal(t, ErrDoubleSpend, appendToPool(&pool, tx2))
+	assert.NotNil(t, pool.GetTransaction(tx1.Hash()))
+
+	// replace tx1
+	tx2 = spend(common.Fixed64(99*ELA)-100, math.MaxUint32)
+	assert.Equal(t, Success, appendToPool(&pool, tx2))
+	assert.Nil(t, pool.GetTransaction(tx1.Hash()))
+	assert.NotNil(t, pool.GetTransaction(tx2.Hash()))
+	assert.Equal(t, tx2.Hash(), pool.getInputUTXOList(tx2.Inputs[0]).Hash())
+
+	// tx2 does not signal replacement
+	tx3 := spend(common.Fixed64(90*ELA), 0)
+	assert.Equal(t, ErrDoubleSpend, appendToPool(&pool, tx3))
+	assert.NotNil(t, pool.GetTransaction(tx2.Hash()))
+
+	// the replacement spends the output of a transaction it evicts
+	var pool2 TxPool
+	pool2.Init()
+	parent := spend(common.Fixed64(97*ELA), 0)
+	assert.Equal(t, Success, appendToPool(&pool2, parent))
+	child := buildTx()
+	child.Inputs = []*core.Input{{Previous: *core.NewOutPoint(parent.Hash(), 0), Sequence: 0}}
+	child.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: common.Fixed64(96 * ELA)},
+	}
+	assert.Equal(t, Success, appendToPool(&pool2, child))
+	replacement := spend(common.Fixed64(90*ELA), 0)
+	replacement.Inputs = append(replacement.Inputs,
+		&core.Input{Previous: *core.NewOutPoint(parent.Hash(), 0), Sequence: 0})
+	_, _, err := pool2.checkDoubleSpend(replacement)
+	assert.EqualError(t, err, fmt.Sprintf("replacement spends the output of the evicted transaction %s",
+		parent.Hash().String()))
+	assert.Equal(t, ErrDoubleSpend, appendToPool(&pool2, replacement))
+	assert.NotNil(t, pool2.GetTransaction(parent.Hash()))
+	assert.NotNil(t, pool2.GetTransaction(child.Hash()))
+
+	config.Parameters.EnableRBF = enableRBF
+	config.Parameters.PowConfiguration.MinTxFee = minTxFee
+
+	// rollback deposit above
+	DefaultLedger.Store.(*ChainStore).NewBatch()
+	DefaultLedger.Store.(*ChainStore).RollbackTransaction(deposit)
+	DefaultLedger.Store.(*ChainStore).BatchCommit()
+
+	t.Log("[TestTxPool_ReplaceByFee] PASSED")
+}
+
+func TestTxPool_ChainedSpend(t *testing.T) {
+	act := newAccount(t)
+
+	// deposit 100 ELA to the account
+	deposit := buildTx()
+	deposit.Inputs = nil
+	deposit.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: *act.programHash, Value: common.Fixed64(100 * ELA)},
+	}
+	block := &core.Block{
+		Header:       core.Header{Height: DefaultLedger.Store.GetHeight()},
+		Transactions: []*core.Transaction{deposit},
+	}
+	store := DefaultLedger.Store.(*ChainStore)
+	store.NewBatch()
+	store.PersistTransactions(block)
+	store.PersistUnspend(block)
+	store.BatchCommit()
+
+	spend := func(parent *core.Transaction, value common.Fixed64) *core.Transaction {
+		tx := &core.Transaction{
+			TxType:  core.TransferAsset,
+			Payload: new(core.PayloadTransferAsset),
+			Inputs: []*core.Input{
+				{Previous: *core.NewOutPoint(parent.Hash(), 0), Sequence: math.MaxUint32},
+			},
+			Outputs: []*core.Output{
+				{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: *act.programHash, Value: value},
+			},
+		}
+		signature, err := act.Sign(getData(tx))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		tx.Programs = []*core.Program{{Code: act.redeemScript, Parameter: signature}}
+		return tx
+	}
+
+	var pool TxPool
+	pool.Init()
+	enableRBF := config.Parameters.EnableRBF
+	config.Parameters.EnableRBF = false
+
+	parent := spend(deposit, common.Fixed64(99*ELA))
+	assert.Equal(t, Success, pool.AppendToTxnPool(parent))
+
+	// case 1: the child spends the output of the parent in pool
+	child := spend(parent, common.Fixed64(98*ELA))
+	assert.NotEqual(t, Success, CheckTransactionContext(child))
+	assert.Equal(t, Success, CheckTransactionContextWithView(child, &pool))
+	references, err := store.GetTxReferenceWithView(child, &pool)
+	if assert.NoError(t, err) {
+		assert.Equal(t, parent.Outputs[0], references[child.Inputs[0]])
+	}
+	assert.Equal(t, Success, pool.AppendToTxnPool(child))
+	assert.NotNil(t, pool.GetTransaction(child.Hash()))
+	assert.Equal(t, common.Fixed64(ELA), child.Fee)
+	assert.Equal(t, 0, pool.GetOrphanCount())
+
+	// case 2: another child spends the same output of the parent
+	conflict := spend(parent, common.Fixed64(97*ELA))
+	assert.Equal(t, Success, CheckTransactionContextWithView(conflict, &pool))
+	assert.Equal(t, ErrDoubleSpend, pool.AppendToTxnPool(conflict))
+	assert.Nil(t, pool.GetTransaction(conflict.Hash()))
+	assert.Equal(t, child.Hash(), pool.getInputUTXOList(conflict.Inputs[0]).Hash())
+
+	// case 3: the orphan is promoted once its parent is accepted
+	next := spend(child, common.Fixed64(97*ELA))
+	orphan := spend(next, common.Fixed64(96*ELA))
+	assert.Equal(t, ErrUnknownReferedTxn, pool.AppendToTxnPool(orphan))
+	assert.True(t, pool.IsOrphanInPool(orphan.Hash()))
+	assert.Equal(t, Success, pool.AppendToTxnPool(next))
+	assert.NotNil(t, pool.GetTransaction(orphan.Hash()))
+	assert.Equal(t, 0, pool.GetOrphanCount())
+
+	config.Parameters.EnableRBF = enableRBF
+
+	// rollback deposit above
+	store.NewBatch()
+	store.RollbackTransactions(block)
+	store.RollbackUnspend(block)
+	store.BatchCommit()
+
+	t.Log("[TestTxPool_ChainedSpend] PASSED")
+}
+
+func TestTxPool_TestAcceptTransaction(t *testing.T) {
+	act := newAccount(t)
+
+	// deposit 100 ELA to the account
+	deposit := buildTx()
+	deposit.Inputs = nil
+	deposit.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: *act.programHash, Value: common.Fixed64(100 * ELA)},
+	}
+	block := &core.Block{
+		Header:       core.Header{Height: DefaultLedger.Store.GetHeight()},
+		Transactions: []*core.Transaction{deposit},
+	}
+	store := DefaultLedger.Store.(*ChainStore)
+	store.NewBatch()
+	store.PersistTransactions(block)
+	store.PersistUnspend(block)
+	store.BatchCommit()
+
+	spend := func(parent common.Uint256, value common.Fixed64, sequence uint32) *core.Transaction {
+		tx := &core.Transaction{
+			TxType:  core.TransferAsset,
+			Payload: new(core.PayloadTransferAsset),
+			Inputs: []*core.Input{
+				{Previous: *core.NewOutPoint(parent, 0), Sequence: sequence},
+			},
+			Outputs: []*core.Output{
+				{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: *act.programHash, Value: value},
+			},
+		}
+		signature, err := act.Sign(getData(tx))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		tx.Programs = []*core.Program{{Code: act.redeemScript, Parameter: signature}}
+		return tx
+	}
+
+	var pool TxPool
+	pool.Init()
+	enableRBF := config.Parameters.EnableRBF
+	config.Parameters.EnableRBF = true
+
+	// case 1: accepted with the fee, the pool is not changed
+	tx1 := spend(deposit.Hash(), common.Fixed64(99*ELA), 0)
+	feeMap, errCode := pool.TestAcceptTransaction(tx1)
+	assert.Equal(t, Success, errCode)
+	assert.Equal(t, common.Fixed64(ELA), feeMap[DefaultLedger.Blockchain.AssetID])
+	assert.Equal(t, 0, pool.GetTransactionCount())
+	assert.Nil(t, pool.getInputUTXOList(tx1.Inputs[0]))
+
+	// case 2: already in pool
+	assert.Equal(t, Success, pool.AppendToTxnPool(tx1))
+	_, errCode = pool.TestAcceptTransaction(tx1)
+	assert.Equal(t, ErrTxHashDuplicate, errCode)
+
+	// case 3: the replacement is accepted, the replaced is kept in pool
+	tx2 := spend(deposit.Hash(), common.Fixed64(98*ELA), math.MaxUint32)
+	_, errCode = pool.TestAcceptTransaction(tx2)
+	assert.Equal(t, Success, errCode)
+	assert.NotNil(t, pool.GetTransaction(tx1.Hash()))
+	assert.Equal(t, tx1.Hash(), pool.getInputUTXOList(tx2.Inputs[0]).Hash())
+
+	// case 4: the conflict is rejected without replacement
+	config.Parameters.EnableRBF = false
+	_, errCode = pool.TestAcceptTransaction(tx2)
+	assert.Equal(t, ErrDoubleSpend, errCode)
+
+	// case 5: the orphan is rejected and not held in the orphan pool
+	var unknown common.Uint256
+	rand.Read(unknown[:])
+	_, errCode = pool.TestAcceptTransaction(spend(unknown, common.Fixed64(ELA), math.MaxUint32))
+	assert.Equal(t, ErrUnknownReferedTxn, errCode)
+	assert.Equal(t, 0, pool.GetOrphanCount())
+
+	config.Parameters.EnableRBF = enableRBF
+
+	// rollback deposit above
+	store.NewBatch()
+	store.RollbackTransactions(block)
+	store.RollbackUnspend(block)
+	store.BatchCommit()
+
+	t.Log("[TestTxPool_TestAcceptTransaction] PASSED")
+}
+
+func TestCheckTransactionStandard(t *testing.T) {
+	maxStandardAttributeSize := config.Parameters.MaxStandardAttributeSize
+	standardAttributeUsages := config.Parameters.StandardAttributeUsages
+	defer func() {
+		config.Parameters.MaxStandardAttributeSize = maxStandardAttributeSize
+		config.Parameters.StandardAttributeUsages = standardAttributeUsages
+	}()
+	config.Parameters.MaxStandardAttributeSize = 0
+	config.Parameters.StandardAttributeUsages = nil
+
+	tx := buildTx()
+	description := core.NewAttribute(core.Description, make([]byte, DefaultMaxStandardAttributeSize))
+	tx.Attributes = []*core.Attribute{&description}
+	assert.NoError(t, CheckTransactionStandard(tx))
+
+	// oversized attribute
+	large := core.NewAttribute(core.Description, make([]byte, DefaultMaxStandardAttributeSize+1))
+	tx.Attributes = []*core.Attribute{&large}
+	assert.EqualError(t, CheckTransactionStandard(tx), fmt.Sprintf("attribute data size %d > %d",
+		DefaultMaxStandardAttributeSize+1, DefaultMaxStandardAttributeSize))
+	config.Parameters.MaxStandardAttributeSize = DefaultMaxStandardAttributeSize + 1
+	assert.NoError(t, CheckTransactionStandard(tx))
+
+	// attribute usage not listed
+	config.Parameters.StandardAttributeUsages = []byte{byte(core.Nonce)}
+	assert.EqualError(t, CheckTransactionStandard(tx), fmt.Sprintf("attribute usage %v is not standard", core.Description))
+
+	// memo is limited by the memo size only
+	config.Parameters.StandardAttributeUsages = nil
+	memo := core.NewAttribute(core.Memo, make([]byte, DefaultMaxMemoSize))
+	tx.Attributes = []*core.Attribute{&memo}
+	assert.NoError(t, CheckTransactionStandard(tx))
+
+	t.Log("[TestCheckTransactionStandard] PASSED")
+}
+
+func TestCheckTransactionStandardDust(t *testing.T) {
+	dustThreshold := config.Parameters.DustThreshold
+	defer func() {
+		config.Parameters.DustThreshold = dustThreshold
+	}()
+	config.Parameters.DustThreshold = 1000
+
+	// dust output
+	tx := buildTx()
+	tx.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: common.Fixed64(999)},
+	}
+	assert.EqualError(t, CheckTransactionStandard(tx), fmt.Sprintf("output value %s is below the dust threshold %s",
+		common.Fixed64(999).String(), common.Fixed64(1000).String()))
+	tx.Outputs[0].Value = common.Fixed64(1000)
+	assert.NoError(t, CheckTransactionStandard(tx))
+
+	// small cross chain output
+	tx.TxType = core.TransferCrossChainAsset
+	tx.Payload = &core.PayloadTransferCrossChainAsset{}
+	tx.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: common.Uint168{}, Value: common.Fixed64(1)},
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: common.Fixed64(1000)},
+	}
+	assert.NoError(t, CheckTransactionStandard(tx))
+
+	// dust is a policy, a block transaction with a dust output is valid
+	tx = buildTx()
+	tx.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: common.Fixed64(1)},
+	}
+	assert.NoError(t, CheckTransactionOutput(tx, 0))
+
+	t.Log("[TestCheckTransactionStandardDust] PASSED")
+}
+
+func TestCheckTransactionStandardPrograms(t *testing.T) {
+	maxStandardCodeSize := config.Parameters.MaxStandardCodeSize
+	maxStandardParameterSize := config.Parameters.MaxStandardParameterSize
+	maxStandardTxPrograms := config.Parameters.MaxStandardTxPrograms
+	defer func() {
+		config.Parameters.MaxStandardCodeSize = maxStandardCodeSize
+		config.Parameters.MaxStandardParameterSize = maxStandardParameterSize
+		config.Parameters.MaxStandardTxPrograms = maxStandardTxPrograms
+	}()
+	config.Parameters.MaxStandardCodeSize = 100
+	config.Parameters.MaxStandardParameterSize = 200
+	config.Parameters.MaxStandardTxPrograms = 2
+
+	tx := buildTx()
+	code := make([]byte, 100)
+	tx.Programs = []*core.Program{{Code: code, Parameter: make([]byte, 200)}}
+	assert.NoError(t, CheckTransactionStandard(tx))
+
+	// oversized program code
+	tx.Programs = []*core.Program{{Code: make([]byte, 101), Parameter: make([]byte, 1)}}
+	assert.EqualError(t, CheckTransactionStandard(tx), "program code size 101 > 100")
+
+	// oversized program parameter
+	tx.Programs = []*core.Program{{Code: code, Parameter: make([]byte, 201)}}
+	assert.EqualError(t, CheckTransactionStandard(tx), "program parameter size 201 > 200")
+
+	// too many programs
+	tx.Programs = make([]*core.Program, 3)
+	assert.EqualError(t, CheckTransactionStandard(tx), "too many programs, 3 > 2")
+
+	// default limits
+	config.Parameters.MaxStandardCodeSize = 0
+	config.Parameters.MaxStandardParameterSize = 0
+	config.Parameters.MaxStandardTxPrograms = 0
+	tx.Programs = []*core.Program{{Code: make([]byte, DefaultMaxStandardCodeSize+1), Parameter: make([]byte, 1)}}
+	assert.EqualError(t, CheckTransactionStandard(tx), fmt.Sprintf("program code size %d > %d",
+		DefaultMaxStandardCodeSize+1, DefaultMaxStandardCodeSize))
+	tx.Programs = []*core.Program{{Code: code, Parameter: make([]byte, DefaultMaxStandardParameterSize)}}
+	assert.NoError(t, CheckTransactionStandard(tx))
+
+	t.Log("[TestCheckTransactionStandardPrograms] PASSED")
+}
+
+func TestCheckMemoFee(t *testing.T) {
+	minTxFee := config.Parameters.PowConfiguration.MinTxFee
+	memoFeePerByte := config.Parameters.MemoFeePerByte
+	defer func() {
+		config.Parameters.PowConfiguration.MinTxFee = minTxFee
+		config.Parameters.MemoFeePerByte = memoFeePerByte
+	}()
+	config.Parameters.PowConfiguration.MinTxFee = 100
+	config.Parameters.MemoFeePerByte = 0
+
+	// no memo
+	tx := buildTx()
+	assert.Equal(t, common.Fixed64(0), MemoFee(tx))
+	assert.NoError(t, checkMemoFee(tx, 0))
+
+	// fee proportional to the memo size
+	memo := core.NewAttribute(core.Memo, []byte("anchored data"))
+	tx.Attributes = []*core.Attribute{&memo}
+	memoFee := common.Fixed64(len("anchored data") * DefaultMemoFeePerByte)
+	assert.Equal(t, memoFee, MemoFee(tx))
+	assert.NoError(t, checkMemoFee(tx, 100+memoFee))
+	fee, required := 100+memoFee-1, 100+memoFee
+	assert.EqualError(t, checkMemoFee(tx, fee), fmt.Sprintf(
+		"transaction fee %s less than %s required with the memo", fee.String(), required.String()))
+
+	// configured fee per byte
+	config.Parameters.MemoFeePerByte = 1
+	assert.Equal(t, common.Fixed64(len("anchored data")), MemoFee(tx))
+
+	t.Log("[TestCheckMemoFee] PASSED")
+}
+
+func TestTxPoolDone(t *testing.T) {
+	DefaultLedger.Store.Close()
+}
@@ -5,8 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"strings"
+	"time"
 
-	"github.com/elastos/Elastos.ELA.SideChain/common"
 	"github.com/elastos/Elastos.ELA.SideChain/config"
 	"github.com/elastos/Elastos.ELA.SideChain/core"
 	. "github.com/elastos/Elastos.ELA.SideChain/errors"
@@ -18,20 +19,110 @@ import (
 	ela "github.com/elastos/Elastos.ELA/core"
 )
 
+// DefaultMaxRegisteredAssets is the max number of registered assets when
+// MaxRegisteredAssets is not configured.
+const DefaultMaxRegisteredAssets = 10000
+
+// DefaultMaxAssetDescriptionLength is the max length of a registered asset
+// description when MaxAssetDescriptionLength is not configured.
+const DefaultMaxAssetDescriptionLength = 256
+
+// The limits of the registered asset names when they are not configured.
+const (
+	DefaultMinAssetNameLength = 1
+	DefaultMaxAssetNameLength = 64
+	DefaultAssetNameCharset   = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789 -_."
+)
+
+// DefaultMaxCrossChainOutputs is the max number of cross chain outputs in a
+// transfer cross chain asset transaction when MaxCrossChainOutputs is not
+// configured.
+const DefaultMaxCrossChainOutputs = 100
+
+// DefaultMaxNormalTxSize is the max size in bytes of a transaction other than
+// the coinbase and recharge transactions when MaxNormalTxSize is not
+// configured.
+const DefaultMaxNormalTxSize = 100000
+
+// DefaultMaxTxOutputs is the max number of outputs in a transaction when
+// MaxTxOutputs is not configured.
+const DefaultMaxTxOutputs = 1000
+
+// DefaultMaxRecordDataSize is the max size of the record data in a record
+// transaction when MaxRecordDataSize is not configured.
+const DefaultMaxRecordDataSize = 1024
+
+// DefaultMaxMemoSize is the max size in bytes of the data of a memo attribute
+// when MaxMemoSize is not configured.
+const DefaultMaxMemoSize = 256
+
+const (
+	// MaxProgramCodeSize is the max size in bytes of a program code.
+	MaxProgramCodeSize = 4096
+
+	// MaxProgramParameterSize is the max size in bytes of a program
+	// parameter.
+	MaxProgramParameterSize = 4096
+
+	// MaxTxPrograms is the max number of programs in a transaction.
+	MaxTxPrograms = 256
+)
+
+const (
+	// MaxIdentificationPathLength is the max length of an identification
+	// content path.
+	MaxIdentificationPathLength = 256
+
+	// MaxIdentificationProofLength is the max length of an identification
+	// value proof.
+	MaxIdentificationProofLength = 1024
+)
+
+// CheckTransaction verifys a transaction, the sanity checks are always run,
+// and the checks with history transactions in ledger are run if checkContext
+// is true. It returns the code of the first failed check. This is the
+// preferred entry point for transaction validation, CheckTransactionSanity and
+// CheckTransactionContext are kept for backward compatibility.
+func CheckTransaction(txn *core.Transaction, checkContext bool) ErrCode {
+	return checkTransaction(txn, DefaultLedger.Store.GetHeight(), checkContext, true)
+}
+
+// checkTransaction is CheckTransaction as if the chain tip is at the given
+// height, the signature checks are skipped if checkSignature is false.
+func checkTransaction(txn *core.Transaction, height uint32, checkContext, checkSignature bool) ErrCode {
+	if errCode := checkTransactionSanity(txn, height+1); errCode != Success {
+		return errCode
+	}
+	if !checkContext {
+		return Success
+	}
+	return checkTransactionContext(txn, height, checkSignature, nil)
+}
+
 // CheckTransactionSanity verifys received single transaction
 func CheckTransactionSanity(txn *core.Transaction) ErrCode {
+	return checkTransactionSanity(txn, DefaultLedger.Store.GetHeight()+1)
+}
 
-	if err := CheckTransactionSize(txn); err != nil {
+// checkTransactionSanity verifys a single transaction in a block at the given
+// height, the rules activated by a fork height are checked against it.
+func checkTransactionSanity(txn *core.Transaction, height uint32) ErrCode {
+	if err := CheckTransactionSize(txn, height); err != nil {
 		log.Warn("[CheckTransactionSize],", err)
 		return ErrTransactionSize
 	}
 
+	if err := CheckOutputAssetID(txn); err != nil {
+		log.Warn("[CheckOutputAssetID],", err)
+		return ErrInvalidOutput
+	}
+
 	if err := CheckTransactionInput(txn); err != nil {
 		log.Warn("[CheckTransactionInput],", err)
 		return ErrInvalidInput
 	}
 
-	if err := CheckTransactionOutput(txn); err != nil {
+	if err := CheckTransactionOutput(txn, height); err != nil {
 		log.Warn("[CheckTransactionOutput],", err)
 		return ErrInvalidOutput
 	}
@@ -41,12 +132,12 @@ func CheckTransactionSanity(txn *core.Transaction) ErrCode {
 		return ErrAssetPrecision
 	}
 
-	if err := CheckAttributeProgram(txn); err != nil {
+	if err := CheckAttributeProgram(txn, height); err != nil {
 		log.Warn("[CheckAttributeProgram],", err)
 		return ErrAttributeProgram
 	}
 
-	if err := CheckTransactionPayload(txn); err != nil {
+	if err := CheckTransactionPayload(txn, height); err != nil {
 		log.Warn("[CheckTransactionPayload],", err)
 		return ErrTransactionPayload
 	}
@@ -61,6 +152,34 @@ func CheckTransactionSanity(txn *core.Transaction) ErrCode {
 
 // CheckTransactionContext verifys a transaction with history transaction in ledger
 func CheckTransactionContext(txn *core.Transaction) ErrCode {
+	return CheckTransactionContextAtHeight(txn, DefaultLedger.Store.GetHeight())
+}
+
+// CheckTransactionContextAtHeight verifys a transaction with history
+// transaction in ledger as if the chain tip is at the given height, the
+// coinbase maturity and the height locks are evaluated against it.
+func CheckTransactionContextAtHeight(txn *core.Transaction, height uint32) ErrCode {
+	return checkTransactionContext(txn, height, true, nil)
+}
+
+// CheckTransactionContextWithView verifys a transaction with history
+// transaction in ledger and the unconfirmed transactions in the view, the
+// transaction can spend the outputs of the transactions in the view.
+func CheckTransactionContextWithView(txn *core.Transaction, view MempoolView) ErrCode {
+	return checkTransactionContext(txn, DefaultLedger.Store.GetHeight(), true, view)
+}
+
+// checkTransactionContext verifys a transaction with history transaction in
+// ledger, the signature and program checks are skipped if checkSignature is
+// false. The referenced transactions not in ledger are looked up in the view
+// if it is not nil. The result is counted in the metrics.
+func checkTransactionContext(txn *core.Transaction, height uint32, checkSignature bool, view MempoolView) ErrCode {
+	errCode := verifyTransactionContext(txn, height, checkSignature, view)
+	txContextChecks.With(int(errCode)).Inc()
+	return errCode
+}
+
+func verifyTransactionContext(txn *core.Transaction, height uint32, checkSignature bool, view MempoolView) ErrCode {
 	// check if duplicated with transaction in ledger
 	if exist := DefaultLedger.Store.IsTxHashDuplicate(txn.Hash()); exist {
 		log.Info("[CheckTransactionContext] duplicate transaction check faild.")
@@ -71,12 +190,28 @@ func CheckTransactionContext(txn *core.Transaction) ErrCode {
 		return Success
 	}
 
-	if err := CheckTransactionSignature(txn); err != nil {
-		log.Warn("[CheckTransactionSignature],", err)
-		return ErrTransactionSignature
+	if err := CheckTransactionExpiry(txn, height); err != nil {
+		log.Warn("[CheckTransactionExpiry],", err)
+		return ErrTransactionExpired
+	}
+
+	if err := CheckTransactionLockTime(txn, height); err != nil {
+		log.Warn("[CheckTransactionLockTime],", err)
+		return ErrTransactionLocked
+	}
+
+	if checkSignature {
+		if err := checkTransactionSignature(txn, view); err != nil {
+			log.Warn("[CheckTransactionSignature],", err)
+			return ErrTransactionSignature
+		}
 	}
 
 	if txn.IsRechargeToSideChainTx() {
+		if err := checkRechargePayloadVersion(txn, height); err != nil {
+			log.Warn("[CheckRechargePayloadVersion],", err)
+			return ErrRechargeToSideChain
+		}
 		if err := CheckRechargeToSideChainTransaction(txn); err != nil {
 			log.Warn("[CheckRechargeToSideChainTransaction],", err)
 			return ErrRechargeToSideChain
@@ -85,24 +220,44 @@ func CheckTransactionContext(txn *core.Transaction) ErrCode {
 	}
 
 	if txn.IsTransferCrossChainAssetTx() {
-		if err := CheckTransferCrossChainAssetTransaction(txn); err != nil {
+		if err := checkTransferCrossChainAssetTransaction(txn, height+1, view); err != nil {
 			log.Warn("[CheckTransferCrossChainAssetTransaction],", err)
+			if ruleErr, ok := err.(RuleError); ok {
+				return ruleErr.ErrorCode
+			}
 			return ErrInvalidOutput
 		}
 	}
 
+	if txn.TxType == core.RegisterAsset {
+		if err := CheckRegisterAssetTransaction(txn, height+1); err != nil {
+			log.Warn("[CheckRegisterAssetTransaction],", err)
+			if ruleErr, ok := err.(RuleError); ok {
+				return ruleErr.ErrorCode
+			}
+			return ErrTransactionPayload
+		}
+	}
+
+	if txn.IsRegisterIdentificationTx() {
+		if err := CheckRegisterIdentificationTransaction(txn); err != nil {
+			log.Warn("[CheckRegisterIdentificationTransaction],", err)
+			return ErrIdentificationUpdate
+		}
+	}
+
 	// check double spent transaction
-	if DefaultLedger.IsDoubleSpend(txn) {
+	if DefaultLedger.Store.IsDoubleSpendWithView(txn, view) {
 		log.Info("[CheckTransactionContext] IsDoubleSpend check faild.")
 		return ErrDoubleSpend
 	}
 
-	if err := CheckTransactionUTXOLock(txn); err != nil {
+	if err := checkTransactionUTXOLock(txn, height, view); err != nil {
 		log.Warn("[CheckTransactionUTXOLock],", err)
 		return ErrUTXOLocked
 	}
 
-	if err := CheckTransactionBalance(txn); err != nil {
+	if err := checkTransactionBalance(txn, view); err != nil {
 		log.Warn("[CheckTransactionBalance],", err)
 		return ErrTransactionBalance
 	}
@@ -111,8 +266,13 @@ func CheckTransactionContext(txn *core.Transaction) ErrCode {
 	for _, input := range txn.Inputs {
 		referHash := input.Previous.TxID
 		referTxnOutIndex := input.Previous.Index
-		referTxn, _, err := DefaultLedger.Store.GetTransaction(referHash)
-		if err != nil {
+		referTxn, referHeight, err := DefaultLedger.Store.GetTransaction(referHash)
+		if err != nil && view != nil {
+			// the unconfirmed transaction is not a coinbase, its height is
+			// never used
+			referTxn = view.GetTransaction(referHash)
+		}
+		if referTxn == nil {
 			log.Warn("Referenced transaction can not be found", BytesToHexString(referHash.Bytes()))
 			return ErrUnknownReferedTxn
 		}
@@ -121,11 +281,13 @@ func CheckTransactionContext(txn *core.Transaction) ErrCode {
 			log.Warn("Value of referenced transaction output is invalid")
 			return ErrInvalidReferedTxn
 		}
-		// coinbase transaction only can be spent after got SpendCoinbaseSpan times confirmations
+		// coinbase transaction only can be spent after got the coinbase maturity of the asset times confirmations
 		if referTxn.IsCoinBaseTx() {
 			lockHeight := referTxn.LockTime
-			currentHeight := DefaultLedger.Store.GetHeight()
-			if currentHeight-lockHeight < config.Parameters.ChainParam.SpendCoinbaseSpan {
+			if coinbaseMaturityHeightActive(height + 1) {
+				lockHeight = referHeight
+			}
+			if height < lockHeight || height-lockHeight < coinbaseMaturity(referTxnOut.AssetID) {
 				return ErrIneffectiveCoinbase
 			}
 		}
@@ -171,25 +333,44 @@ func CheckTransactionInput(txn *core.Transaction) error {
 	return nil
 }
 
-func CheckTransactionOutput(txn *core.Transaction) error {
+// CheckOutputAssetID rejects a transaction of any type with an output of the
+// empty asset ID, which is never valid. CheckTransactionOutput still checks
+// the asset ID of each output against the chain asset.
+func CheckOutputAssetID(txn *core.Transaction) error {
+	for i, output := range txn.Outputs {
+		if output.AssetID == EmptyHash {
+			return fmt.Errorf("output %d has an empty asset ID", i)
+		}
+	}
+	return nil
+}
+
+// CheckTransactionOutput checks the outputs of a transaction in a block at
+// the given height, from TxOutputsLimitHeight the number of outputs is
+// limited by MaxTxOutputs.
+func CheckTransactionOutput(txn *core.Transaction, height uint32) error {
+	if txOutputsLimitHeightActive(height) {
+		if maxOutputs := maxTxOutputs(); len(txn.Outputs) > maxOutputs {
+			return fmt.Errorf("too many transaction outputs, %d > %d", len(txn.Outputs), maxOutputs)
+		}
+	}
+
 	if txn.IsCoinBaseTx() {
 		if len(txn.Outputs) < 2 {
 			return errors.New("coinbase output is not enough, at least 2")
 		}
 
 		var totalReward = Fixed64(0)
-		var foundationReward = Fixed64(0)
 		for _, output := range txn.Outputs {
 			if output.AssetID != DefaultLedger.Blockchain.AssetID {
 				return errors.New("asset ID in coinbase is invalid")
 			}
 			totalReward += output.Value
-			if output.ProgramHash.IsEqual(FoundationAddress) {
-				foundationReward += output.Value
-			}
 		}
-		if Fixed64(foundationReward) < Fixed64(float64(totalReward)*0.3) {
-			return errors.New("Reward to foundation in coinbase < 30%")
+		for _, rule := range rewardRules {
+			if err := rule.CheckReward(txn.Outputs, totalReward); err != nil {
+				return err
+			}
 		}
 
 		return nil
@@ -212,11 +393,107 @@ func CheckTransactionOutput(txn *core.Transaction) error {
 		if !CheckOutputProgramHash(output.ProgramHash) {
 			return errors.New("output address is invalid")
 		}
+
+	}
+
+	return nil
+}
+
+func maxMemoSize() int {
+	if config.Parameters.MaxMemoSize > 0 {
+		return config.Parameters.MaxMemoSize
 	}
+	return DefaultMaxMemoSize
+}
+
+// coinbaseMaturity returns the confirmations required to spend a coinbase
+// output of the asset, configured in CoinbaseMaturities keyed by the reversed
+// hex asset ID, SpendCoinbaseSpan if the asset is not configured.
+func coinbaseMaturity(assetID Uint256) uint32 {
+	key := BytesToHexString(BytesReverse(assetID.Bytes()))
+	if maturity, ok := config.Parameters.CoinbaseMaturities[key]; ok && maturity >= 0 {
+		return uint32(maturity)
+	}
+	return config.Parameters.ChainParam.SpendCoinbaseSpan
+}
 
+// checkRechargePayloadVersion checks the batched recharge payload is only
+// used in the blocks from BatchRechargeHeight, a zero BatchRechargeHeight
+// disables it.
+func checkRechargePayloadVersion(txn *core.Transaction, height uint32) error {
+	if txn.PayloadVersion < core.RechargeToSideChainBatchPayloadVersion {
+		return nil
+	}
+	spendHeight := height + 1
+	forkHeight := config.Parameters.ChainParam.BatchRechargeHeight
+	if forkHeight == 0 || spendHeight < forkHeight {
+		return fmt.Errorf("recharge payload version %d is not active at height %d",
+			txn.PayloadVersion, spendHeight)
+	}
 	return nil
 }
 
+// coinbaseMaturityHeightActive returns if the coinbase maturity of a
+// transaction in a block at the given height counts from the height the
+// coinbase is stored at, a zero CoinbaseMaturityHeight keeps counting from the
+// coinbase lock time.
+func coinbaseMaturityHeightActive(height uint32) bool {
+	forkHeight := config.Parameters.ChainParam.CoinbaseMaturityHeight
+	return forkHeight != 0 && height >= forkHeight
+}
+
+// txSizeLimitHeightActive returns if a transaction in a block at the given
+// height is limited by the max size of its type, a zero TxSizeLimitHeight
+// limits it by MaxBlockSize only.
+func txSizeLimitHeightActive(height uint32) bool {
+	forkHeight := config.Parameters.ChainParam.TxSizeLimitHeight
+	return forkHeight != 0 && height >= forkHeight
+}
+
+// txOutputsLimitHeightActive returns if the number of outputs of a
+// transaction in a block at the given height is limited by MaxTxOutputs, a
+// zero TxOutputsLimitHeight leaves it unlimited.
+func txOutputsLimitHeightActive(height uint32) bool {
+	forkHeight := config.Parameters.ChainParam.TxOutputsLimitHeight
+	return forkHeight != 0 && height >= forkHeight
+}
+
+func maxTxOutputs() int {
+	if config.Parameters.MaxTxOutputs > 0 {
+		return config.Parameters.MaxTxOutputs
+	}
+	return DefaultMaxTxOutputs
+}
+
+// maxTxSize returns the max size in bytes of a transaction of the type, the
+// coinbase transaction is limited by the block size only, and a recharge
+// transaction embeds the main chain transaction so it may be larger than the
+// others. No transaction is larger than MaxBlockSize.
+func maxTxSize(txType core.TransactionType) int {
+	maxSize := config.Parameters.MaxBlockSize
+	switch txType {
+	case core.CoinBase:
+		return maxSize
+	case core.RechargeToSideChain:
+		if size := config.Parameters.MaxRechargeTxSize; size > 0 && size < maxSize {
+			return size
+		}
+		return maxSize
+	default:
+		size := config.Parameters.MaxNormalTxSize
+		if size <= 0 {
+			size = DefaultMaxNormalTxSize
+		}
+		if size < maxSize {
+			return size
+		}
+		return maxSize
+	}
+}
+
+// CheckOutputProgramHash checks the program hash of an output is empty or has
+// a built in prefix or a prefix listed in OutputProgramHashPrefixes, so a side
+// chain can add custom address types.
 func CheckOutputProgramHash(programHash Uint168) bool {
 	var empty = Uint168{}
 	prefix := programHash[0]
@@ -227,21 +504,32 @@ func CheckOutputProgramHash(programHash Uint168) bool {
 		programHash == empty {
 		return true
 	}
-	return false
+	return bytes.IndexByte(config.Parameters.OutputProgramHashPrefixes, prefix) >= 0
 }
 
 func CheckTransactionUTXOLock(txn *core.Transaction) error {
+	return checkTransactionUTXOLock(txn, DefaultLedger.Store.GetHeight(), nil)
+}
+
+// checkTransactionUTXOLock checks the UTXO locks as if the chain tip is at
+// the given height, the referenced outputs not in ledger are looked up in the
+// view. The output locks are checked against the chain and the lock time
+// types must match from LockTimeHeight.
+func checkTransactionUTXOLock(txn *core.Transaction, height uint32, view MempoolView) error {
 	if txn.IsCoinBaseTx() {
 		return nil
 	}
 	if len(txn.Inputs) <= 0 {
 		return errors.New("Transaction has no inputs")
 	}
-	references, err := DefaultLedger.Store.GetTxReference(txn)
+	references, err := DefaultLedger.Store.GetTxReferenceWithView(txn, view)
 	if err != nil {
 		return fmt.Errorf("GetReference failed: %s", err)
 	}
 	for input, output := range references {
+		if err := checkRelativeLock(input, height); err != nil {
+			return err
+		}
 
 		if output.OutputLock == 0 {
 			//check next utxo
@@ -250,18 +538,135 @@ func CheckTransactionUTXOLock(txn *core.Transaction) error {
 		if input.Sequence != math.MaxUint32-1 {
 			return errors.New("Invalid input sequence")
 		}
+		lockTimeActive := lockTimeHeightActive(height + 1)
+		if lockTimeActive &&
+			(txn.LockTime < core.LockTimeThreshold) != (output.OutputLock < core.LockTimeThreshold) {
+			return errors.New("UTXO output lock time type mismatch")
+		}
 		if txn.LockTime < output.OutputLock {
 			return errors.New("UTXO output locked")
 		}
+		if lockTimeActive {
+			if err := checkOutputLock(output.OutputLock, height); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CheckTransactionLockTime checks the transaction is finalized in the block
+// following the given height, so a transaction is accepted by the pool one
+// block before its lock time expires and can be packed in the next block.
+func CheckTransactionLockTime(txn *core.Transaction, height uint32) error {
+	if txn.LockTime == 0 {
+		return nil
+	}
+	var medianTime time.Time
+	if txn.LockTime >= core.LockTimeThreshold {
+		medianTime = MedianTimePast(medianTimeBlocks)
+	}
+	if !IsFinalizedTransaction(txn, height+1, medianTime) {
+		return fmt.Errorf("transaction lock time %d is not reached", txn.LockTime)
+	}
+	return nil
+}
+
+// checkOutputLock checks the output lock has been reached by the chain at the
+// given height, lock values below LockTimeThreshold are block heights compared
+// to the height of the next block, others are unix timestamps compared to the
+// median time past.
+func checkOutputLock(outputLock uint32, height uint32) error {
+	if outputLock < core.LockTimeThreshold {
+		if height+1 < outputLock {
+			return errors.New("UTXO output locked by height")
+		}
+		return nil
+	}
+
+	medianTime := MedianTimePast(medianTimeBlocks)
+	if medianTime.Unix() < int64(outputLock) {
+		return errors.New("UTXO output locked by time")
+	}
+	return nil
+}
+
+// checkRelativeLock checks the relative lock time encoded in the input
+// sequence, the referenced output can only be spent after the given blocks
+// or seconds since it was confirmed. It takes effect from RelativeLockHeight,
+// a zero RelativeLockHeight disables the relative lock time.
+func checkRelativeLock(input *core.Input, height uint32) error {
+	spendHeight := height + 1
+	forkHeight := config.Parameters.RelativeLockHeight
+	if forkHeight == 0 || spendHeight < forkHeight {
+		return nil
+	}
+	if input.Sequence&core.SequenceLockTimeDisabled != 0 {
+		return nil
+	}
+	relativeLock := input.Sequence & core.SequenceLockTimeMask
+	if relativeLock == 0 {
+		return nil
+	}
+
+	_, confirmHeight, err := DefaultLedger.Store.GetTransaction(input.Previous.TxID)
+	if err != nil {
+		return fmt.Errorf("GetTransaction failed: %s", err)
+	}
+
+	if input.Sequence&core.SequenceLockTimeIsSeconds != 0 {
+		hash, err := DefaultLedger.Store.GetBlockHash(confirmHeight)
+		if err != nil {
+			return fmt.Errorf("GetBlockHash failed: %s", err)
+		}
+		header, err := DefaultLedger.Store.GetHeader(hash)
+		if err != nil {
+			return fmt.Errorf("GetHeader failed: %s", err)
+		}
+		lockTime := int64(header.Timestamp) + int64(relativeLock)<<core.SequenceLockTimeGranularity
+		if MedianTimePast(medianTimeBlocks).Unix() < lockTime {
+			return errors.New("UTXO relative time locked")
+		}
+		return nil
+	}
+
+	if spendHeight < confirmHeight+relativeLock {
+		return errors.New("UTXO relative height locked")
 	}
 	return nil
 }
 
-func CheckTransactionSize(txn *core.Transaction) error {
+// CheckTransactionSize checks the size of a transaction in a block at the
+// given height, from TxSizeLimitHeight the size is limited by the max size of
+// the transaction type.
+func CheckTransactionSize(txn *core.Transaction, height uint32) error {
 	size := txn.GetSize()
 	if size <= 0 || size > config.Parameters.MaxBlockSize {
 		return fmt.Errorf("Invalid transaction size: %d bytes", size)
 	}
+	if txSizeLimitHeightActive(height) {
+		if limit := maxTxSize(txn.TxType); size > limit {
+			return fmt.Errorf("transaction size %d > %d", size, limit)
+		}
+	}
+
+	// the serialized bytes must decode back to a transaction of the same size
+	buf := new(bytes.Buffer)
+	if err := txn.Serialize(buf); err != nil {
+		return err
+	}
+	r := bytes.NewReader(buf.Bytes())
+	var decoded core.Transaction
+	if err := decoded.Deserialize(r); err != nil {
+		return fmt.Errorf("transaction serialization is inconsistent, %s", err)
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("transaction serialization is inconsistent, %d bytes left", r.Len())
+	}
+	if decodedSize := decoded.GetSize(); decodedSize != size {
+		return fmt.Errorf("transaction serialized size %d does not match size %d bytes",
+			decodedSize, size)
+	}
 
 	return nil
 }
@@ -291,12 +696,16 @@ func CheckAssetPrecision(txn *core.Transaction) error {
 }
 
 func CheckTransactionBalance(txn *core.Transaction) error {
+	return checkTransactionBalance(txn, nil)
+}
+
+func checkTransactionBalance(txn *core.Transaction, view MempoolView) error {
 	for _, v := range txn.Outputs {
 		if v.Value < Fixed64(0) {
 			return errors.New("Invalide transaction UTXO output.")
 		}
 	}
-	results, err := GetTxFeeMap(txn)
+	results, err := getTxFeeMap(txn, view)
 	if err != nil {
 		return err
 	}
@@ -308,7 +717,11 @@ func CheckTransactionBalance(txn *core.Transaction) error {
 	return nil
 }
 
-func CheckAttributeProgram(tx *core.Transaction) error {
+// CheckAttributeProgram checks the attributes and the programs of a
+// transaction in a block at the given height, from ProgramLimitHeight the
+// programs are limited by MaxTxPrograms, MaxProgramCodeSize and
+// MaxProgramParameterSize.
+func CheckAttributeProgram(tx *core.Transaction, height uint32) error {
 	// Check attributes
 	for _, attr := range tx.Attributes {
 		if !core.IsValidAttributeType(attr.Usage) {
@@ -316,6 +729,41 @@ func CheckAttributeProgram(tx *core.Transaction) error {
 		}
 	}
 
+	// Check memo attributes
+	for _, attr := range tx.Attributes {
+		if attr.Usage == core.Memo && len(attr.Data) > maxMemoSize() {
+			return fmt.Errorf("memo size %d > %d", len(attr.Data), maxMemoSize())
+		}
+	}
+
+	// Check expiry attribute
+	expiries := 0
+	for _, attr := range tx.Attributes {
+		if attr.Usage == core.Expiry {
+			expiries++
+		}
+	}
+	if expiries > 1 {
+		return fmt.Errorf("too many expiry attributes, %d > 1", expiries)
+	}
+
+	// Check required attributes
+	if !tx.IsCoinBaseTx() {
+		for _, usage := range config.Parameters.ChainParam.RequiredAttributeUsages {
+			if !hasAttribute(tx, core.AttributeUsage(usage)) {
+				return fmt.Errorf("required attribute usage %v not found", usage)
+			}
+		}
+	}
+
+	// Check program limits
+	if programLimitHeightActive(height) {
+		err := checkProgramLimits(tx.Programs, MaxTxPrograms, MaxProgramCodeSize, MaxProgramParameterSize)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Check programs
 	for _, program := range tx.Programs {
 		if program.Code == nil {
@@ -324,23 +772,103 @@ func CheckAttributeProgram(tx *core.Transaction) error {
 		if program.Parameter == nil {
 			return fmt.Errorf("invalid program parameter nil")
 		}
-		_, err := crypto.ToProgramHash(program.Code)
+		programHash, err := crypto.ToProgramHash(program.Code)
 		if err != nil {
 			return fmt.Errorf("invalid program code %x", program.Code)
 		}
+		if programHash[0] == PrefixMultisig {
+			if err := ValidateMultisigProgram(program.Code); err != nil {
+				return fmt.Errorf("invalid multisig program code, %s", err)
+			}
+		}
+	}
+	return nil
+}
+
+// programLimitHeightActive returns if the programs of a transaction in a
+// block at the given height are limited, a zero ProgramLimitHeight leaves
+// them unlimited.
+func programLimitHeightActive(height uint32) bool {
+	forkHeight := config.Parameters.ChainParam.ProgramLimitHeight
+	return forkHeight != 0 && height >= forkHeight
+}
+
+// checkProgramLimits checks the number of programs and the sizes of their
+// codes and parameters.
+func checkProgramLimits(programs []*core.Program, maxPrograms, maxCodeSize, maxParameterSize int) error {
+	if len(programs) > maxPrograms {
+		return fmt.Errorf("too many programs, %d > %d", len(programs), maxPrograms)
+	}
+	for _, program := range programs {
+		if len(program.Code) > maxCodeSize {
+			return fmt.Errorf("program code size %d > %d", len(program.Code), maxCodeSize)
+		}
+		if len(program.Parameter) > maxParameterSize {
+			return fmt.Errorf("program parameter size %d > %d", len(program.Parameter), maxParameterSize)
+		}
+	}
+	return nil
+}
+
+func hasAttribute(tx *core.Transaction, usage core.AttributeUsage) bool {
+	for _, attr := range tx.Attributes {
+		if attr.Usage == usage {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTransactionExpiry rejects the transaction if the given height exceeds
+// the expiry height carried in its expiry attribute, a transaction without
+// expiry attribute never expires.
+func CheckTransactionExpiry(txn *core.Transaction, height uint32) error {
+	for _, attr := range txn.Attributes {
+		if attr.Usage != core.Expiry {
+			continue
+		}
+		expiry, err := ReadUint32(bytes.NewReader(attr.Data))
+		if err != nil {
+			return errors.New("invalid expiry attribute data")
+		}
+		if height > expiry {
+			return fmt.Errorf("transaction expired at height %d", expiry)
+		}
 	}
 	return nil
 }
 
 func CheckTransactionSignature(txn *core.Transaction) error {
-	return VerifySignature(txn)
+	return checkTransactionSignature(txn, nil)
+}
+
+func checkTransactionSignature(txn *core.Transaction, view MempoolView) error {
+	return verifySignature(txn, view)
 }
 
+// checkAmountPrecise returns if the amount is representable at the precision,
+// the amount is stored in units of 10^-MaxPrecision.
 func checkAmountPrecise(amount Fixed64, precision byte) bool {
-	return amount.IntValue()%int64(math.Pow(10, float64(8-precision))) == 0
+	if precision > core.MaxPrecision {
+		return false
+	}
+	return amount.IntValue()%precisionScale(precision) == 0
+}
+
+// precisionScale returns the number of amount units in the smallest unit of
+// an asset of the precision.
+func precisionScale(precision byte) int64 {
+	scale := int64(1)
+	for i := precision; i < core.MaxPrecision; i++ {
+		scale *= 10
+	}
+	return scale
 }
 
-func CheckTransactionPayload(txn *core.Transaction) error {
+// CheckTransactionPayload checks the payload of a transaction in a block at
+// the given height, from RecordLimitHeight the record payload is limited by
+// MaxRecordDataSize and AllowedRecordTypes.
+func CheckTransactionPayload(txn *core.Transaction, height uint32) error {
 	switch pld := txn.Payload.(type) {
 	case *core.PayloadRegisterAsset:
 		if pld.Asset.Precision < core.MinPrecision || pld.Asset.Precision > core.MaxPrecision {
@@ -351,20 +879,302 @@ func CheckTransactionPayload(txn *core.Transaction) error {
 		}
 	case *core.PayloadTransferAsset:
 	case *core.PayloadRecord:
+		if recordLimitHeightActive(height) {
+			return checkRecordPayload(pld)
+		}
 	case *core.PayloadCoinBase:
 	case *core.PayloadRechargeToSideChain:
 	case *core.PayloadTransferCrossChainAsset:
 	case *core.PayloadRegisterIdentification:
+		return checkRegisterIdentificationPayload(txn, pld)
 	default:
 		return errors.New("[txValidator],invalidate transaction payload type.")
 	}
 	return nil
 }
 
-func CheckRechargeToSideChainTransaction(txn *core.Transaction) error {
-	proof := new(MerkleProof)
-	mainChainTransaction := new(ela.Transaction)
+// recordLimitHeightActive returns if the record payload of a transaction in a
+// block at the given height is limited, a zero RecordLimitHeight leaves it
+// unchecked.
+func recordLimitHeightActive(height uint32) bool {
+	forkHeight := config.Parameters.ChainParam.RecordLimitHeight
+	return forkHeight != 0 && height >= forkHeight
+}
 
+// checkRecordPayload checks the record data size is within MaxRecordDataSize
+// and the record type is one of AllowedRecordTypes, all record types are
+// allowed if AllowedRecordTypes is not configured.
+func checkRecordPayload(pld *core.PayloadRecord) error {
+	if maxSize := maxRecordDataSize(); len(pld.RecordData) > maxSize {
+		return fmt.Errorf("record data size %d exceeds the max size %d", len(pld.RecordData), maxSize)
+	}
+	allowed := config.Parameters.AllowedRecordTypes
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, recordType := range allowed {
+		if pld.RecordType == recordType {
+			return nil
+		}
+	}
+	return fmt.Errorf("record type %s is not allowed", pld.RecordType)
+}
+
+func maxRecordDataSize() int {
+	if config.Parameters.MaxRecordDataSize > 0 {
+		return config.Parameters.MaxRecordDataSize
+	}
+	return DefaultMaxRecordDataSize
+}
+
+// checkRegisterIdentificationPayload checks the contents of an identification
+// payload, the ID must be a register ID address signed by one of the programs
+// of the transaction.
+func checkRegisterIdentificationPayload(txn *core.Transaction, pld *core.PayloadRegisterIdentification) error {
+	if txn.PayloadVersion > core.RegisterIdentificationNonceVersion {
+		return fmt.Errorf("invalid identification payload version %d", txn.PayloadVersion)
+	}
+	if pld.ID == "" {
+		return errors.New("identification ID is empty")
+	}
+	idHash, err := Uint168FromAddress(pld.ID)
+	if err != nil || idHash[0] != PrefixRegisterId {
+		return fmt.Errorf("invalid identification ID %s", pld.ID)
+	}
+	if len(pld.Sign) == 0 {
+		return errors.New("identification sign is empty")
+	}
+
+	signed := false
+	for _, program := range txn.Programs {
+		if hash, err := crypto.ToProgramHash(program.Code); err == nil && hash.IsEqual(*idHash) {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return fmt.Errorf("identification ID %s not signed by transaction programs", pld.ID)
+	}
+
+	if len(pld.Contents) == 0 {
+		return errors.New("identification contents is empty")
+	}
+	for _, content := range pld.Contents {
+		if content.Path == "" {
+			return errors.New("identification content path is empty")
+		}
+		if len(content.Path) > MaxIdentificationPathLength {
+			return fmt.Errorf("identification content path length %d > %d",
+				len(content.Path), MaxIdentificationPathLength)
+		}
+		if len(content.Values) == 0 {
+			return fmt.Errorf("identification content %s has no values", content.Path)
+		}
+		for _, value := range content.Values {
+			if value.DataHash.IsEqual(Uint256{}) {
+				return fmt.Errorf("identification content %s value data hash is empty", content.Path)
+			}
+			if len(value.Proof) > MaxIdentificationProofLength {
+				return fmt.Errorf("identification content %s value proof length %d > %d",
+					content.Path, len(value.Proof), MaxIdentificationProofLength)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckRegisterIdentificationTransaction checks an identification
+// registration against the registered IDs, the first registration must have a
+// controller program, an update must be signed by the registered controller
+// of the ID and must not replay the registered contents.
+func CheckRegisterIdentificationTransaction(txn *core.Transaction) error {
+	payload, ok := txn.Payload.(*core.PayloadRegisterIdentification)
+	if !ok {
+		return errors.New("invalid register identification payload type")
+	}
+	idHash, err := Uint168FromAddress(payload.ID)
+	if err != nil {
+		return fmt.Errorf("invalid identification ID %s", payload.ID)
+	}
+
+	if registered, err := DefaultLedger.Store.GetIdentificationController(payload.ID); err != nil {
+		if _, err := identificationController(txn, *idHash); err != nil {
+			return fmt.Errorf("identification ID %s has %s", payload.ID, err)
+		}
+	} else {
+		signed := false
+		for _, program := range txn.Programs {
+			if hash, err := crypto.ToProgramHash(program.Code); err == nil && hash.IsEqual(*registered) {
+				signed = true
+				break
+			}
+		}
+		if !signed {
+			controller, _ := registered.ToAddress()
+			return fmt.Errorf("identification ID %s update not signed by its controller %s",
+				payload.ID, controller)
+		}
+	}
+
+	for _, content := range payload.Contents {
+		if err := checkIdentificationReplay(payload, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkIdentificationReplay checks the content is not the one registered to
+// the path of the ID, unless the payload has a higher nonce than the
+// registration.
+func checkIdentificationReplay(payload *core.PayloadRegisterIdentification,
+	content core.RegisterIdentificationContent) error {
+	registered, err := DefaultLedger.Store.GetIdentificationContent(payload.ID, content.Path)
+	if err != nil {
+		return nil
+	}
+	if registered.Hash == content.Hash() && payload.Nonce <= registered.Nonce {
+		return fmt.Errorf("identification ID %s path %s is already registered with nonce %d",
+			payload.ID, content.Path, registered.Nonce)
+	}
+	return nil
+}
+
+// CheckRegisterAssetTransaction checks a register asset transaction in a
+// block at the given height, from AssetNameLimitHeight the length and the
+// characters of the asset name are limited.
+func CheckRegisterAssetTransaction(txn *core.Transaction, height uint32) error {
+	payload, ok := txn.Payload.(*core.PayloadRegisterAsset)
+	if !ok {
+		return errors.New("invalid register asset payload type")
+	}
+	if err := checkAsset(&payload.Asset, height); err != nil {
+		return err
+	}
+	if payload.Amount < 0 {
+		return fmt.Errorf("invalid register amount %s", payload.Amount.String())
+	}
+	if !checkAmountPrecise(payload.Amount, payload.Asset.Precision) {
+		return RuleError{
+			ErrorCode: ErrAssetPrecision,
+			Description: fmt.Sprintf("register amount %s is not representable at precision %d",
+				payload.Amount.String(), payload.Asset.Precision),
+		}
+	}
+
+	maxAssets := maxRegisteredAssets()
+	if count := DefaultLedger.Store.GetAssetCount(); count >= maxAssets {
+		return RuleError{
+			ErrorCode:   ErrTooManyAssets,
+			Description: fmt.Sprintf("registered asset count reached the max %d", maxAssets),
+		}
+	}
+	return nil
+}
+
+// checkAsset checks the name, description and precision of the asset to be
+// registered, the canonical name must not equal the canonical name of a
+// registered asset.
+func checkAsset(asset *core.Asset, height uint32) error {
+	if len(asset.Name) == 0 {
+		return RuleError{ErrorCode: ErrEmptyAssetName, Description: "asset name is empty"}
+	}
+	if assetNameLimitHeightActive(height) {
+		if err := checkAssetName(asset.Name); err != nil {
+			return err
+		}
+	}
+
+	maxDescription := maxAssetDescriptionLength()
+	if len(asset.Description) > maxDescription {
+		return RuleError{
+			ErrorCode: ErrAssetDescription,
+			Description: fmt.Sprintf("asset description length %d exceeds the max %d",
+				len(asset.Description), maxDescription),
+		}
+	}
+	if asset.Precision < core.MinPrecision || asset.Precision > core.MaxPrecision {
+		return RuleError{
+			ErrorCode:   ErrAssetPrecision,
+			Description: fmt.Sprintf("invalid asset precision %d", asset.Precision),
+		}
+	}
+
+	if registered, err := DefaultLedger.Store.GetAssetByName(asset.Name); err == nil {
+		return RuleError{
+			ErrorCode: ErrDuplicateAssetName,
+			Description: fmt.Sprintf("asset name %s collides with registered asset %s",
+				asset.Name, registered.Name),
+		}
+	}
+	return nil
+}
+
+// assetNameLimitHeightActive returns if the name of an asset registered in a
+// block at the given height is limited, a zero AssetNameLimitHeight only
+// rejects the empty names.
+func assetNameLimitHeightActive(height uint32) bool {
+	forkHeight := config.Parameters.ChainParam.AssetNameLimitHeight
+	return forkHeight != 0 && height >= forkHeight
+}
+
+// checkAssetName checks the length of the asset name is within
+// MinAssetNameLength and MaxAssetNameLength, and the name only contains the
+// characters of AssetNameCharset.
+func checkAssetName(name string) error {
+	minLength, maxLength := assetNameLength()
+	if len(name) < minLength || len(name) > maxLength {
+		return RuleError{
+			ErrorCode: ErrAssetNameLength,
+			Description: fmt.Sprintf("asset name length %d is out of range [%d, %d]",
+				len(name), minLength, maxLength),
+		}
+	}
+	charset := assetNameCharset()
+	for _, c := range name {
+		if !strings.ContainsRune(charset, c) {
+			return RuleError{
+				ErrorCode:   ErrAssetNameCharset,
+				Description: fmt.Sprintf("asset name contains invalid character %q", c),
+			}
+		}
+	}
+	return nil
+}
+
+func assetNameLength() (int, int) {
+	minLength, maxLength := DefaultMinAssetNameLength, DefaultMaxAssetNameLength
+	if config.Parameters.MinAssetNameLength > 0 {
+		minLength = config.Parameters.MinAssetNameLength
+	}
+	if config.Parameters.MaxAssetNameLength > 0 {
+		maxLength = config.Parameters.MaxAssetNameLength
+	}
+	return minLength, maxLength
+}
+
+func assetNameCharset() string {
+	if config.Parameters.AssetNameCharset != "" {
+		return config.Parameters.AssetNameCharset
+	}
+	return DefaultAssetNameCharset
+}
+
+func maxAssetDescriptionLength() int {
+	if config.Parameters.MaxAssetDescriptionLength > 0 {
+		return config.Parameters.MaxAssetDescriptionLength
+	}
+	return DefaultMaxAssetDescriptionLength
+}
+
+func maxRegisteredAssets() uint32 {
+	if config.Parameters.MaxRegisteredAssets > 0 {
+		return config.Parameters.MaxRegisteredAssets
+	}
+	return DefaultMaxRegisteredAssets
+}
+
+func CheckRechargeToSideChainTransaction(txn *core.Transaction) error {
 	payloadRecharge, ok := txn.Payload.(*core.PayloadRechargeToSideChain)
 	if !ok {
 		return errors.New("Invalid recharge to side chain payload type")
@@ -374,76 +1184,276 @@ func CheckRechargeToSideChainTransaction(txn *core.Transaction) error {
 		return errors.New("Invalid config exchange rate")
 	}
 
-	reader := bytes.NewReader(payloadRecharge.MerkleProof)
+	custody, err := custodyProgramHashes()
+	if err != nil {
+		return err
+	}
+
+	// each deposit is verified individually, and paid by its own outputs
+	mainchainTxs := make(map[Uint256]struct{})
+	paidOutputs := make(map[int]struct{})
+	addresses := newAddressCache()
+	var oriOutputTotalAmount Fixed64
+	for _, deposit := range payloadRecharge.GetDeposits() {
+		amount, err := checkRechargeDeposit(txn, &deposit, custody,
+			mainchainTxs, paidOutputs, addresses)
+		if err != nil {
+			return err
+		}
+		oriOutputTotalAmount += amount
+	}
+
+	var targetOutputTotalAmount Fixed64
+	for _, output := range txn.Outputs {
+		if output.Value < 0 {
+			return errors.New("Invalid transaction output value")
+		}
+		targetOutputTotalAmount += output.Value
+	}
+
+	if targetOutputTotalAmount != oriOutputTotalAmount {
+		return errors.New("Output and fee verify failed")
+	}
+
+	return nil
+}
+
+// VerifyRechargeProof verifies the deposits of a recharge payload before the
+// recharge transaction is sent, it returns the error of the first deposit
+// failing to deserialize its merkle proof or main chain transaction, whose
+// proof does not chain to a known main chain block, or whose main chain
+// transaction is recharged before or by another deposit.
+func VerifyRechargeProof(payload *core.PayloadRechargeToSideChain) error {
+	mainchainTxs := make(map[Uint256]struct{})
+	for i, deposit := range payload.GetDeposits() {
+		if _, err := verifyRechargeDeposit(&deposit, mainchainTxs); err != nil {
+			return fmt.Errorf("deposit %d: %s", i, err.Error())
+		}
+	}
+	return nil
+}
+
+// verifyRechargeDeposit deserializes the merkle proof and the main chain
+// transaction of the deposit and checks the proof against the main chain
+// headers, the main chain transaction must not be recharged before or by
+// another deposit in mainchainTxs.
+func verifyRechargeDeposit(deposit *core.RechargeDeposit,
+	mainchainTxs map[Uint256]struct{}) (*ela.Transaction, error) {
+	proof := new(MerkleProof)
+	mainChainTransaction := new(ela.Transaction)
+
+	reader := bytes.NewReader(deposit.MerkleProof)
 	if err := proof.Deserialize(reader); err != nil {
-		return errors.New("RechargeToSideChain payload deserialize failed")
+		return nil, errors.New("RechargeToSideChain payload deserialize failed")
 	}
-	reader = bytes.NewReader(payloadRecharge.MainChainTransaction)
+	reader = bytes.NewReader(deposit.MainChainTransaction)
 	if err := mainChainTransaction.Deserialize(reader); err != nil {
-		return errors.New("RechargeToSideChain mainChainTransaction deserialize failed")
+		return nil, errors.New("RechargeToSideChain mainChainTransaction deserialize failed")
+	}
+	if err := checkRechargeProof(proof, mainChainTransaction); err != nil {
+		return nil, err
 	}
 
 	mainchainTxhash := mainChainTransaction.Hash()
 	if exist := DefaultLedger.Store.IsMainchainTxHashDuplicate(mainchainTxhash); exist {
-		return errors.New("Duplicate mainchain transaction hash in paylod")
+		return nil, errors.New("Duplicate mainchain transaction hash in paylod")
+	}
+	if _, exist := mainchainTxs[mainchainTxhash]; exist {
+		return nil, errors.New("Duplicate mainchain transaction hash in batch")
+	}
+	mainchainTxs[mainchainTxhash] = struct{}{}
+	return mainChainTransaction, nil
+}
+
+// checkRechargeDeposit verifies a main chain deposit of the recharge
+// transaction and returns the amount it recharges. The main chain transaction
+// must not be recharged before or by another deposit in mainchainTxs, and
+// each cross chain output must be paid by an output of the recharge
+// transaction not in paidOutputs.
+func checkRechargeDeposit(txn *core.Transaction, deposit *core.RechargeDeposit,
+	custody []Uint168, mainchainTxs map[Uint256]struct{},
+	paidOutputs map[int]struct{}, addresses addressCache) (Fixed64, error) {
+	mainChainTransaction, err := verifyRechargeDeposit(deposit, mainchainTxs)
+	if err != nil {
+		return 0, err
 	}
 
 	payloadObj, ok := mainChainTransaction.Payload.(*ela.PayloadTransferCrossChainAsset)
 	if !ok {
-		return errors.New("Invalid payload ela.PayloadTransferCrossChainAsset")
+		return 0, errors.New("Invalid payload ela.PayloadTransferCrossChainAsset")
 	}
 
-	genesisHash, _ := DefaultLedger.Store.GetBlockHash(uint32(0))
-	genesisProgramHash, err := common.GetGenesisProgramHash(genesisHash)
-	if err != nil {
-		return errors.New("Genesis block bytes to program hash failed")
+	if err := checkCrossChainTarget(mainChainTransaction, payloadObj, custody, addresses); err != nil {
+		return 0, err
 	}
 
 	//check output fee and rate
 	var oriOutputTotalAmount Fixed64
 	for i := 0; i < len(payloadObj.CrossChainAddresses); i++ {
-		if mainChainTransaction.Outputs[payloadObj.OutputIndexes[i]].ProgramHash.IsEqual(*genesisProgramHash) {
+		if isCustodyProgramHash(custody, mainChainTransaction.Outputs[payloadObj.OutputIndexes[i]].ProgramHash) {
 			if payloadObj.CrossChainAmounts[i] < 0 || payloadObj.CrossChainAmounts[i] >
 				mainChainTransaction.Outputs[payloadObj.OutputIndexes[i]].Value-Fixed64(config.Parameters.MinCrossChainTxFee) {
-				return errors.New("Invalid transaction cross chain amount")
+				return 0, errors.New("Invalid transaction cross chain amount")
 			}
 
 			crossChainAmount := Fixed64(float64(payloadObj.CrossChainAmounts[i]) * config.Parameters.ExchangeRate)
 			oriOutputTotalAmount += crossChainAmount
 
-			programHash, err := Uint168FromAddress(payloadObj.CrossChainAddresses[i])
+			programHash, err := addresses.programHash(payloadObj.CrossChainAddresses[i])
 			if err != nil {
-				return errors.New("Invalid transaction payload cross chain address")
+				return 0, errors.New("Invalid transaction payload cross chain address")
 			}
 			isContained := false
-			for _, output := range txn.Outputs {
+			for index, output := range txn.Outputs {
+				if _, paid := paidOutputs[index]; paid {
+					continue
+				}
 				if output.ProgramHash == *programHash && output.Value == crossChainAmount {
+					paidOutputs[index] = struct{}{}
 					isContained = true
 					break
 				}
 			}
 			if !isContained {
-				return errors.New("Invalid transaction outputs")
+				return 0, errors.New("Invalid transaction outputs")
 			}
 		}
 	}
 
-	var targetOutputTotalAmount Fixed64
-	for _, output := range txn.Outputs {
-		if output.Value < 0 {
-			return errors.New("Invalid transaction output value")
+	return oriOutputTotalAmount, nil
+}
+
+// checkCrossChainTarget checks the main chain cross chain transfer targets
+// this side chain, which means at least one of the cross chain outputs is paid
+// to a custody program hash of this side chain, and the destination addresses
+// of those outputs are valid side chain addresses.
+func checkCrossChainTarget(mainChainTransaction *ela.Transaction,
+	payloadObj *ela.PayloadTransferCrossChainAsset, custody []Uint168,
+	addresses addressCache) error {
+	if len(payloadObj.CrossChainAddresses) != len(payloadObj.OutputIndexes) ||
+		len(payloadObj.CrossChainAddresses) != len(payloadObj.CrossChainAmounts) {
+		return errors.New("Invalid main chain transaction payload content")
+	}
+
+	var targetCount int
+	for i, outputIndex := range payloadObj.OutputIndexes {
+		if int(outputIndex) >= len(mainChainTransaction.Outputs) {
+			return errors.New("Invalid main chain transaction cross chain index")
+		}
+		if !isCustodyProgramHash(custody, mainChainTransaction.Outputs[outputIndex].ProgramHash) {
+			continue
+		}
+		targetCount++
+
+		programHash, err := addresses.programHash(payloadObj.CrossChainAddresses[i])
+		if err != nil {
+			return errors.New("Invalid transaction payload cross chain address")
+		}
+		if !CheckOutputProgramHash(*programHash) {
+			return errors.New("Invalid transaction payload cross chain address prefix")
 		}
-		targetOutputTotalAmount += output.Value
 	}
 
-	if targetOutputTotalAmount != oriOutputTotalAmount {
-		return errors.New("Output and fee verify failed")
+	if targetCount == 0 {
+		return errors.New("Main chain transaction does not target this side chain")
 	}
 
 	return nil
 }
 
+// checkCrossChainOutputCount checks the number of cross chain outputs of a
+// transaction in a block at the given height does not exceed the max, so the
+// main chain does not relay oversized withdrawals. The number is not limited
+// below CrossChainOutputsHeight or if it is zero.
+func checkCrossChainOutputCount(count int, height uint32) error {
+	forkHeight := config.Parameters.ChainParam.CrossChainOutputsHeight
+	if forkHeight == 0 || height < forkHeight {
+		return nil
+	}
+	maxOutputs := DefaultMaxCrossChainOutputs
+	if config.Parameters.MaxCrossChainOutputs > 0 {
+		maxOutputs = config.Parameters.MaxCrossChainOutputs
+	}
+	if count > maxOutputs {
+		return fmt.Errorf("cross chain output count %d exceeds the max %d", count, maxOutputs)
+	}
+	return nil
+}
+
+// crossChainTxFee returns the fee each cross chain output pays to the main
+// chain besides the amount, the transaction fee must not be less than it too.
+func crossChainTxFee() Fixed64 {
+	return Fixed64(config.Parameters.MinCrossChainTxFee)
+}
+
+// EstimateCrossChainFee returns the min fee of a transfer cross chain asset
+// transaction of the cross chain amounts, the fee of each cross chain output
+// plus the transaction fee, as CheckTransferCrossChainAssetTransaction
+// enforces. The transaction fee is never below the min transaction fee
+// checkTransactionBalance enforces.
+func EstimateCrossChainFee(amounts []Fixed64) (Fixed64, error) {
+	if len(amounts) == 0 {
+		return 0, errors.New("no cross chain amount")
+	}
+	if err := checkCrossChainOutputCount(len(amounts), DefaultLedger.Store.GetHeight()+1); err != nil {
+		return 0, err
+	}
+	for _, amount := range amounts {
+		if amount < 0 {
+			return 0, fmt.Errorf("invalid cross chain amount %s", amount.String())
+		}
+	}
+	fee := crossChainTxFee()
+	txFee := fee
+	if minTxFee := Fixed64(config.Parameters.PowConfiguration.MinTxFee); minTxFee > txFee {
+		txFee = minTxFee
+	}
+	return fee*Fixed64(len(amounts)) + txFee, nil
+}
+
+// checkCrossChainAddressNetwork checks the cross chain address is an address
+// of the main chain network the side chain runs with, an address of another
+// network is reported with the name of the network.
+func checkCrossChainAddressNetwork(address string, programHash *Uint168) error {
+	active := config.Parameters.ChainParam
+	prefixes := []byte{PrefixStandard, PrefixMultisig}
+	if active != nil && len(active.AddressPrefixes) > 0 {
+		prefixes = active.AddressPrefixes
+	}
+	if bytes.IndexByte(prefixes, programHash[0]) >= 0 {
+		return nil
+	}
+	if active != nil {
+		for _, params := range config.NetParams() {
+			if bytes.IndexByte(params.AddressPrefixes, programHash[0]) >= 0 {
+				return fmt.Errorf("cross chain address %s is a %s address, the main chain network is %s",
+					address, params.Name, active.Name)
+			}
+		}
+	}
+	return errors.New("Invalid transaction cross chain address")
+}
+
 func CheckTransferCrossChainAssetTransaction(txn *core.Transaction) error {
+	return checkTransferCrossChainAssetTransaction(txn, DefaultLedger.Store.GetHeight()+1, nil)
+}
+
+// checkConfirmedInputs checks all the inputs of the transaction spend the
+// outputs of the transactions in ledger.
+func checkConfirmedInputs(txn *core.Transaction) error {
+	for _, input := range txn.Inputs {
+		if !DefaultLedger.Store.IsTxHashDuplicate(input.Previous.TxID) {
+			return RuleError{
+				ErrorCode: ErrUnconfirmedInput,
+				Description: fmt.Sprintf("input %s:%d spends an unconfirmed transaction",
+					input.Previous.TxID.String(), input.Previous.Index),
+			}
+		}
+	}
+	return nil
+}
+
+func checkTransferCrossChainAssetTransaction(txn *core.Transaction, height uint32, view MempoolView) error {
 	payloadObj, ok := txn.Payload.(*core.PayloadTransferCrossChainAsset)
 	if !ok {
 		return errors.New("Invalid transfer cross chain asset payload type")
@@ -454,6 +1464,9 @@ func CheckTransferCrossChainAssetTransaction(txn *core.Transaction) error {
 		len(payloadObj.CrossChainAmounts) != len(payloadObj.OutputIndexes) {
 		return errors.New("Invalid transaction payload content")
 	}
+	if err := checkCrossChainOutputCount(len(payloadObj.CrossChainAddresses), height); err != nil {
+		return err
+	}
 
 	//check cross chain output index in payload
 	outputIndexMap := make(map[uint64]struct{})
@@ -474,16 +1487,17 @@ func CheckTransferCrossChainAssetTransaction(txn *core.Transaction) error {
 	if len(payloadObj.CrossChainAddresses) != crossChainCount {
 		return errors.New("Invalid transaction cross chain counts")
 	}
+	addresses := newAddressCache()
 	for _, address := range payloadObj.CrossChainAddresses {
 		if address == "" {
 			return errors.New("Invalid transaction cross chain address")
 		}
-		programHash, err := Uint168FromAddress(address)
+		programHash, err := addresses.programHash(address)
 		if err != nil {
 			return errors.New("Invalid transaction cross chain address")
 		}
-		if !bytes.Equal(programHash[0:1], []byte{PrefixStandard}) && !bytes.Equal(programHash[0:1], []byte{PrefixMultisig}) {
-			return errors.New("Invalid transaction cross chain address")
+		if err := checkCrossChainAddressNetwork(address, programHash); err != nil {
+			return err
 		}
 	}
 
@@ -493,14 +1507,22 @@ func CheckTransferCrossChainAssetTransaction(txn *core.Transaction) error {
 			return errors.New("Invalid transaction output program hash")
 		}
 		if txn.Outputs[payloadObj.OutputIndexes[i]].Value < 0 || payloadObj.CrossChainAmounts[i] < 0 ||
-			payloadObj.CrossChainAmounts[i] > txn.Outputs[payloadObj.OutputIndexes[i]].Value-Fixed64(config.Parameters.MinCrossChainTxFee) {
+			payloadObj.CrossChainAmounts[i] > txn.Outputs[payloadObj.OutputIndexes[i]].Value-crossChainTxFee() {
 			return errors.New("Invalid transaction outputs")
 		}
 	}
 
+	//a withdrawal can not be reverted, so it is not built on a replaceable
+	//unconfirmed transaction if ConfirmedCrossChainInputs is set
+	if config.Parameters.ConfirmedCrossChainInputs {
+		if err := checkConfirmedInputs(txn); err != nil {
+			return err
+		}
+	}
+
 	//check transaction fee
 	var totalInput Fixed64
-	reference, err := DefaultLedger.Store.GetTxReference(txn)
+	reference, err := DefaultLedger.Store.GetTxReferenceWithView(txn, view)
 	if err != nil {
 		return errors.New("Invalid transaction inputs")
 	}
@@ -513,7 +1535,7 @@ func CheckTransferCrossChainAssetTransaction(txn *core.Transaction) error {
 		totalOutput += output.Value
 	}
 
-	if totalInput-totalOutput < Fixed64(config.Parameters.MinCrossChainTxFee) {
+	if totalInput-totalOutput < crossChainTxFee() {
 		return errors.New("Invalid transaction fee")
 	}
 
@@ -3,15 +3,24 @@ package blockchain
 import (
 	"bytes"
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"strings"
 	"testing"
 
+	sidecommon "github.com/elastos/Elastos.ELA.SideChain/common"
 	"github.com/elastos/Elastos.ELA.SideChain/config"
 	"github.com/elastos/Elastos.ELA.SideChain/core"
+	. "github.com/elastos/Elastos.ELA.SideChain/errors"
 	"github.com/elastos/Elastos.ELA.SideChain/log"
+	"github.com/elastos/Elastos.ELA.SideChain/vm"
 
 	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+	"github.com/elastos/Elastos.ELA/bloom"
+	ela "github.com/elastos/Elastos.ELA/core"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -50,17 +59,88 @@ func TestCheckTransactionSize(t *testing.T) {
 	size := tx.GetSize()
 	// normal
 	config.Parameters.MaxBlockSize = size
-	err = CheckTransactionSize(tx)
+	err = CheckTransactionSize(tx, 0)
 	assert.NoError(t, err, "[CheckTransactionSize] passed normal size")
 
 	// invalid
 	config.Parameters.MaxBlockSize = size - 1
-	err = CheckTransactionSize(tx)
+	err = CheckTransactionSize(tx, 0)
 	assert.EqualError(t, err, fmt.Sprintf("Invalid transaction size: %d bytes", size))
 
+	// attribute data long enough to take a multi byte length prefix
+	url := make([]byte, 300)
+	rand.Read(url)
+	attr := core.NewAttribute(core.DescriptionUrl, url)
+	buf.Reset()
+	attr.Serialize(buf)
+	assert.Equal(t, uint32(buf.Len()), attr.Size)
+
+	tx.Attributes = append(tx.Attributes, &attr)
+	config.Parameters.MaxBlockSize = tx.GetSize()
+	err = CheckTransactionSize(tx, 0)
+	assert.NoError(t, err)
+
 	t.Log("[TestCheckTransactionSize] PASSED")
 }
 
+func TestCheckTransactionSize_TypeLimits(t *testing.T) {
+	maxBlockSize := config.Parameters.MaxBlockSize
+	maxNormalTxSize := config.Parameters.MaxNormalTxSize
+	maxRechargeTxSize := config.Parameters.MaxRechargeTxSize
+	txSizeLimitHeight := config.Parameters.ChainParam.TxSizeLimitHeight
+	defer func() {
+		config.Parameters.MaxBlockSize = maxBlockSize
+		config.Parameters.MaxNormalTxSize = maxNormalTxSize
+		config.Parameters.MaxRechargeTxSize = maxRechargeTxSize
+		config.Parameters.ChainParam.TxSizeLimitHeight = txSizeLimitHeight
+	}()
+	config.Parameters.MaxBlockSize = 8000000
+	config.Parameters.MaxNormalTxSize = 1000
+	config.Parameters.MaxRechargeTxSize = 100000
+	config.Parameters.ChainParam.TxSizeLimitHeight = 100
+
+	// transfer padded over the normal size
+	tx := buildTx()
+	url := make([]byte, 1000)
+	rand.Read(url)
+	attr := core.NewAttribute(core.DescriptionUrl, url)
+	tx.Attributes = append(tx.Attributes, &attr)
+	err := CheckTransactionSize(tx, 100)
+	assert.EqualError(t, err, fmt.Sprintf("transaction size %d > 1000", tx.GetSize()))
+
+	// below TxSizeLimitHeight it is limited by the block size only
+	err = CheckTransactionSize(tx, 99)
+	assert.NoError(t, err)
+
+	// default normal size
+	config.Parameters.MaxNormalTxSize = 0
+	err = CheckTransactionSize(tx, 100)
+	assert.NoError(t, err)
+	config.Parameters.MaxNormalTxSize = 1000
+
+	// recharge embedding a large main chain transaction
+	mainChainTx := make([]byte, 50000)
+	rand.Read(mainChainTx)
+	recharge := &core.Transaction{
+		TxType:  core.RechargeToSideChain,
+		Payload: &core.PayloadRechargeToSideChain{MerkleProof: make([]byte, 100), MainChainTransaction: mainChainTx},
+	}
+	err = CheckTransactionSize(recharge, 100)
+	assert.NoError(t, err)
+
+	// recharge over the recharge size
+	config.Parameters.MaxRechargeTxSize = 10000
+	err = CheckTransactionSize(recharge, 100)
+	assert.EqualError(t, err, fmt.Sprintf("transaction size %d > 10000", recharge.GetSize()))
+
+	// a zero TxSizeLimitHeight never limits the type size
+	config.Parameters.ChainParam.TxSizeLimitHeight = 0
+	err = CheckTransactionSize(recharge, 100)
+	assert.NoError(t, err)
+
+	t.Log("[TestCheckTransactionSize_TypeLimits] PASSED")
+}
+
 func TestCheckOutputProgramHash(t *testing.T) {
 	programHash := common.Uint168{}
 
@@ -86,6 +166,28 @@ func TestCheckOutputProgramHash(t *testing.T) {
 	t.Log("[TestCheckOutputProgramHash] PASSED")
 }
 
+func TestCheckOutputProgramHash_ConfiguredPrefixes(t *testing.T) {
+	prefixes := config.Parameters.OutputProgramHashPrefixes
+	defer func() { config.Parameters.OutputProgramHashPrefixes = prefixes }()
+
+	const contractPrefix = 0x1c
+	config.Parameters.OutputProgramHashPrefixes = []byte{contractPrefix}
+
+	// case 1: configured custom prefix should pass
+	programHash := common.Uint168{contractPrefix}
+	assert.Equal(t, true, CheckOutputProgramHash(programHash))
+
+	// case 2: built in prefixes still pass
+	programHash[0] = common.PrefixStandard
+	assert.Equal(t, true, CheckOutputProgramHash(programHash))
+
+	// case 3: unconfigured prefix should not pass
+	programHash[0] = 0x34
+	assert.Equal(t, false, CheckOutputProgramHash(programHash))
+
+	t.Log("[TestCheckOutputProgramHash_ConfiguredPrefixes] PASSED")
+}
+
 func TestCheckTransactionInput(t *testing.T) {
 	// coinbase transaction
 	tx := NewCoinBaseTransaction(new(core.PayloadCoinBase), 0)
@@ -130,6 +232,19 @@ func TestCheckTransactionInput(t *testing.T) {
 	err = CheckTransactionInput(tx)
 	assert.EqualError(t, err, "duplicated transaction inputs")
 
+	// the replacement signal is pool policy, it is valid whether RBF is
+	// enabled or not
+	enableRBF := config.Parameters.EnableRBF
+	tx = buildTx()
+	tx.Inputs[0].Sequence = core.MaxReplaceableSequence
+	config.Parameters.EnableRBF = true
+	err = CheckTransactionInput(tx)
+	assert.NoError(t, err)
+	config.Parameters.EnableRBF = false
+	err = CheckTransactionInput(tx)
+	assert.NoError(t, err)
+	config.Parameters.EnableRBF = enableRBF
+
 	t.Log("[TestCheckTransactionInput] PASSED")
 }
 
@@ -140,14 +255,14 @@ func TestCheckTransactionOutput(t *testing.T) {
 		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress},
 		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress},
 	}
-	err := CheckTransactionOutput(tx)
+	err := CheckTransactionOutput(tx, 0)
 	assert.NoError(t, err)
 
 	// outputs < 2
 	tx.Outputs = []*core.Output{
 		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress},
 	}
-	err = CheckTransactionOutput(tx)
+	err = CheckTransactionOutput(tx, 0)
 	assert.EqualError(t, err, "coinbase output is not enough, at least 2")
 
 	// invalid asset id
@@ -155,7 +270,7 @@ func TestCheckTransactionOutput(t *testing.T) {
 		{AssetID: common.EmptyHash, ProgramHash: FoundationAddress},
 		{AssetID: common.EmptyHash, ProgramHash: FoundationAddress},
 	}
-	err = CheckTransactionOutput(tx)
+	err = CheckTransactionOutput(tx, 0)
 	assert.EqualError(t, err, "asset ID in coinbase is invalid")
 
 	// reward to foundation in coinbase = 30%
@@ -169,7 +284,7 @@ func TestCheckTransactionOutput(t *testing.T) {
 		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: foundationReward},
 		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: common.Uint168{}, Value: minerReward},
 	}
-	err = CheckTransactionOutput(tx)
+	err = CheckTransactionOutput(tx, 0)
 	assert.NoError(t, err)
 
 	// reward to foundation in coinbase < 30%
@@ -181,7 +296,7 @@ func TestCheckTransactionOutput(t *testing.T) {
 		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: foundationReward},
 		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: common.Uint168{}, Value: minerReward},
 	}
-	err = CheckTransactionOutput(tx)
+	err = CheckTransactionOutput(tx, 0)
 	assert.EqualError(t, err, "Reward to foundation in coinbase < 30%")
 
 	// normal transaction
@@ -190,12 +305,12 @@ func TestCheckTransactionOutput(t *testing.T) {
 		output.AssetID = DefaultLedger.Blockchain.AssetID
 		output.ProgramHash = common.Uint168{}
 	}
-	err = CheckTransactionOutput(tx)
+	err = CheckTransactionOutput(tx, 0)
 	assert.NoError(t, err)
 
 	// outputs < 1
 	tx.Outputs = nil
-	err = CheckTransactionOutput(tx)
+	err = CheckTransactionOutput(tx, 0)
 	assert.EqualError(t, err, "transaction has no outputs")
 
 	// invalid asset ID
@@ -204,7 +319,7 @@ func TestCheckTransactionOutput(t *testing.T) {
 		output.AssetID = common.EmptyHash
 		output.ProgramHash = common.Uint168{}
 	}
-	err = CheckTransactionOutput(tx)
+	err = CheckTransactionOutput(tx, 0)
 	assert.EqualError(t, err, "asset ID in output is invalid")
 
 	// invalid program hash
@@ -215,12 +330,134 @@ func TestCheckTransactionOutput(t *testing.T) {
 		address[0] = 0x23
 		output.ProgramHash = address
 	}
-	err = CheckTransactionOutput(tx)
+	err = CheckTransactionOutput(tx, 0)
 	assert.EqualError(t, err, "output address is invalid")
 
 	t.Log("[TestCheckTransactionOutput] PASSED")
 }
 
+func TestCheckOutputAssetID(t *testing.T) {
+	// case 1: coinbase paying the chain asset
+	tx := NewCoinBaseTransaction(new(core.PayloadCoinBase), 0)
+	tx.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress},
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress},
+	}
+	assert.NoError(t, CheckOutputAssetID(tx))
+
+	// case 2: coinbase with a zero asset output
+	tx.Outputs[1].AssetID = common.EmptyHash
+	assert.EqualError(t, CheckOutputAssetID(tx), "output 1 has an empty asset ID")
+	assert.Equal(t, ErrInvalidOutput, CheckTransactionSanity(tx))
+
+	// case 3: transfer with a zero asset output
+	tx = buildTx()
+	tx.Outputs[0].AssetID = common.EmptyHash
+	assert.EqualError(t, CheckOutputAssetID(tx), "output 0 has an empty asset ID")
+
+	t.Log("[TestCheckOutputAssetID] PASSED")
+}
+
+func TestCheckTransactionOutput_MaxOutputs(t *testing.T) {
+	maxTxOutputs := config.Parameters.MaxTxOutputs
+	txOutputsLimitHeight := config.Parameters.ChainParam.TxOutputsLimitHeight
+	defer func() {
+		config.Parameters.MaxTxOutputs = maxTxOutputs
+		config.Parameters.ChainParam.TxOutputsLimitHeight = txOutputsLimitHeight
+	}()
+	config.Parameters.MaxTxOutputs = 3
+	config.Parameters.ChainParam.TxOutputsLimitHeight = 100
+
+	output := func() *core.Output {
+		return &core.Output{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress,
+			Value: common.Fixed64(1000)}
+	}
+
+	// outputs count at the max
+	tx := buildTx()
+	tx.Outputs = []*core.Output{output(), output(), output()}
+	assert.NoError(t, CheckTransactionOutput(tx, 100))
+
+	// outputs count over the max
+	tx.Outputs = append(tx.Outputs, output())
+	assert.EqualError(t, CheckTransactionOutput(tx, 100), "too many transaction outputs, 4 > 3")
+
+	// below TxOutputsLimitHeight the outputs count is not limited
+	assert.NoError(t, CheckTransactionOutput(tx, 99))
+
+	// coinbase outputs are limited as well
+	coinbase := NewCoinBaseTransaction(new(core.PayloadCoinBase), 0)
+	coinbase.Outputs = []*core.Output{output(), output(), output(), output()}
+	assert.EqualError(t, CheckTransactionOutput(coinbase, 100), "too many transaction outputs, 4 > 3")
+
+	// default max outputs count
+	config.Parameters.MaxTxOutputs = 0
+	assert.NoError(t, CheckTransactionOutput(tx, 100))
+
+	t.Log("[TestCheckTransactionOutput_MaxOutputs] PASSED")
+}
+
+func TestCheckTransactionOutput_RewardRules(t *testing.T) {
+	rules := rewardRules
+	defer func() { rewardRules = rules }()
+
+	council := common.Uint168{0x12, 0x01}
+	RegisterRewardRule(NewAddressRewardRule("council", council, 0.2))
+	assert.Len(t, RewardRules(), 2)
+
+	totalReward := common.Fixed64(1 * ELA)
+	_, foundationReward := RewardRules()[0].Reward(totalReward)
+	programHash, councilReward := RewardRules()[1].Reward(totalReward)
+	assert.Equal(t, council, programHash)
+	assert.Equal(t, common.Fixed64(float64(totalReward)*0.3), foundationReward)
+	assert.Equal(t, common.Fixed64(float64(totalReward)*0.2), councilReward)
+
+	// case: both rules are satisfied
+	tx := NewCoinBaseTransaction(new(core.PayloadCoinBase), 0)
+	tx.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: foundationReward},
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: council, Value: councilReward},
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: common.Uint168{},
+			Value: totalReward - foundationReward - councilReward},
+	}
+	err := CheckTransactionOutput(tx, 0)
+	assert.NoError(t, err)
+
+	// case: reward to council < 20%
+	tx.Outputs[1].Value = councilReward - 1
+	tx.Outputs[2].Value += 1
+	err = CheckTransactionOutput(tx, 0)
+	assert.EqualError(t, err, "Reward to council in coinbase < 20%")
+
+	// case: no council output
+	tx.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: foundationReward},
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: common.Uint168{},
+			Value: totalReward - foundationReward},
+	}
+	err = CheckTransactionOutput(tx, 0)
+	assert.EqualError(t, err, "Reward to council in coinbase < 20%")
+
+	// case: the foundation rule is checked first
+	tx.Outputs[0].Value = foundationReward - 1
+	tx.Outputs[1].Value += 1
+	err = CheckTransactionOutput(tx, 0)
+	assert.EqualError(t, err, "Reward to foundation in coinbase < 30%")
+
+	// case: the council is paid by several outputs
+	tx.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: foundationReward},
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: council, Value: councilReward / 2},
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: council, Value: councilReward - councilReward/2},
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: common.Uint168{},
+			Value: totalReward - foundationReward - councilReward},
+	}
+	err = CheckTransactionOutput(tx, 0)
+	assert.NoError(t, err)
+
+	t.Log("[TestCheckTransactionOutput_RewardRules] PASSED")
+}
+
 func TestCheckAssetPrecision(t *testing.T) {
 	// normal transaction
 	tx := buildTx()
@@ -275,6 +512,35 @@ func TestCheckAssetPrecision(t *testing.T) {
 	err = CheckAssetPrecision(tx)
 	assert.EqualError(t, err, "The precision of asset is incorrect.")
 
+	// the precision declared by each asset is used
+	for _, precision := range []byte{core.MinPrecision, 2, 6, core.MaxPrecision} {
+		asset := core.Asset{
+			Name:      fmt.Sprintf("TEST%d", precision),
+			Precision: precision,
+			AssetType: 0x00,
+		}
+		register := &core.Transaction{
+			TxType:  core.RegisterAsset,
+			Payload: &core.PayloadRegisterAsset{Asset: asset},
+		}
+		DefaultLedger.Store.(*ChainStore).NewBatch()
+		DefaultLedger.Store.PersistAsset(register.Hash(), asset)
+		DefaultLedger.Store.(*ChainStore).BatchCommit()
+
+		// case: the smallest unit of the asset
+		unit := common.Fixed64(precisionScale(precision))
+		tx.Outputs = []*core.Output{{AssetID: register.Hash(), Value: 3 * unit}}
+		err = CheckAssetPrecision(tx)
+		assert.NoError(t, err, "precision %d", precision)
+
+		// case: below the smallest unit of the asset
+		if precision < core.MaxPrecision {
+			tx.Outputs[0].Value = 3*unit + unit/10
+			err = CheckAssetPrecision(tx)
+			assert.EqualError(t, err, "The precision of asset is incorrect.", "precision %d", precision)
+		}
+	}
+
 	t.Log("[TestCheckAssetPrecision] PASSED")
 }
 
@@ -289,6 +555,23 @@ func TestCheckAmountPrecision(t *testing.T) {
 	t.Log("[TestCheckAmountPrecision] PASSED")
 }
 
+func TestPrecisionScale(t *testing.T) {
+	// case: the max precision has divisor 1
+	assert.Equal(t, int64(1), precisionScale(core.MaxPrecision))
+	assert.True(t, checkAmountPrecise(common.Fixed64(1), core.MaxPrecision))
+
+	// case: the largest difference
+	assert.Equal(t, int64(100000000), precisionScale(core.MinPrecision))
+	assert.True(t, checkAmountPrecise(common.Fixed64(math.MaxInt64/100000000*100000000), core.MinPrecision))
+	assert.False(t, checkAmountPrecise(common.Fixed64(math.MaxInt64), core.MinPrecision))
+
+	// case: precisions above the max are rejected
+	assert.False(t, checkAmountPrecise(common.Fixed64(0), core.MaxPrecision+1))
+	assert.False(t, checkAmountPrecise(common.Fixed64(0), 18))
+
+	t.Log("[TestPrecisionScale] PASSED")
+}
+
 func TestCheckAttributeProgram(t *testing.T) {
 	// valid attributes
 	tx := buildTx()
@@ -298,12 +581,13 @@ func TestCheckAttributeProgram(t *testing.T) {
 		core.Description,
 		core.DescriptionUrl,
 		core.Memo,
+		core.Expiry,
 	}
 	for _, usage := range usages {
 		attr := core.NewAttribute(usage, nil)
 		tx.Attributes = append(tx.Attributes, &attr)
 	}
-	err := CheckAttributeProgram(tx)
+	err := CheckAttributeProgram(tx, 0)
 	assert.EqualError(t, err, "no programs found in transaction")
 
 	// invalid attributes
@@ -321,20 +605,20 @@ func TestCheckAttributeProgram(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		attr := core.NewAttribute(getInvalidUsage(), nil)
 		tx.Attributes = []*core.Attribute{&attr}
-		err := CheckAttributeProgram(tx)
+		err := CheckAttributeProgram(tx, 0)
 		assert.EqualError(t, err, fmt.Sprintf("invalid attribute usage %v", attr.Usage))
 	}
 	tx.Attributes = nil
 
 	// empty programs
 	tx.Programs = []*core.Program{}
-	err = CheckAttributeProgram(tx)
+	err = CheckAttributeProgram(tx, 0)
 	assert.EqualError(t, err, "no programs found in transaction")
 
 	// nil program code
 	program := &core.Program{}
 	tx.Programs = append(tx.Programs, program)
-	err = CheckAttributeProgram(tx)
+	err = CheckAttributeProgram(tx, 0)
 	assert.EqualError(t, err, "invalid program code nil")
 
 	// nil program parameter
@@ -342,7 +626,7 @@ func TestCheckAttributeProgram(t *testing.T) {
 	rand.Read(code)
 	program = &core.Program{Code: code}
 	tx.Programs = []*core.Program{program}
-	err = CheckAttributeProgram(tx)
+	err = CheckAttributeProgram(tx, 0)
 	assert.EqualError(t, err, "invalid program parameter nil")
 
 	// invalid program code
@@ -359,13 +643,125 @@ func TestCheckAttributeProgram(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		program = &core.Program{Code: getInvalidCode(), Parameter: make([]byte, 1)}
 		tx.Programs = []*core.Program{program}
-		err = CheckAttributeProgram(tx)
+		err = CheckAttributeProgram(tx, 0)
 		assert.EqualError(t, err, fmt.Sprintf("invalid program code %x", program.Code))
 	}
 
+	// oversized memo
+	memo := core.NewAttribute(core.Memo, make([]byte, DefaultMaxMemoSize+1))
+	tx.Attributes = []*core.Attribute{&memo}
+	err = CheckAttributeProgram(tx, 0)
+	assert.EqualError(t, err, fmt.Sprintf("memo size %d > %d", DefaultMaxMemoSize+1, DefaultMaxMemoSize))
+	tx.Attributes = nil
+
 	t.Log("[TestCheckAttributeProgram] PASSED")
 }
 
+func TestCheckAttributeProgram_ProgramLimits(t *testing.T) {
+	programLimitHeight := config.Parameters.ChainParam.ProgramLimitHeight
+	defer func() {
+		config.Parameters.ChainParam.ProgramLimitHeight = programLimitHeight
+	}()
+	config.Parameters.ChainParam.ProgramLimitHeight = 100
+
+	tx := buildTx()
+	var code = make([]byte, 21)
+	rand.Read(code)
+	code[len(code)-1] = common.STANDARD
+
+	// parameter at the max size
+	tx.Programs = []*core.Program{{Code: code, Parameter: make([]byte, MaxProgramParameterSize)}}
+	assert.NoError(t, CheckAttributeProgram(tx, 100))
+
+	// oversized program parameter
+	tx.Programs[0].Parameter = make([]byte, MaxProgramParameterSize+1)
+	assert.EqualError(t, CheckAttributeProgram(tx, 100), fmt.Sprintf("program parameter size %d > %d",
+		MaxProgramParameterSize+1, MaxProgramParameterSize))
+
+	// below ProgramLimitHeight the programs are not limited
+	assert.NoError(t, CheckAttributeProgram(tx, 99))
+
+	// oversized program code
+	tx.Programs = []*core.Program{{Code: make([]byte, MaxProgramCodeSize+1), Parameter: make([]byte, 1)}}
+	assert.EqualError(t, CheckAttributeProgram(tx, 100), fmt.Sprintf("program code size %d > %d",
+		MaxProgramCodeSize+1, MaxProgramCodeSize))
+
+	// too many programs
+	tx.Programs = nil
+	for i := 0; i <= MaxTxPrograms; i++ {
+		tx.Programs = append(tx.Programs, &core.Program{Code: code, Parameter: make([]byte, 1)})
+	}
+	assert.EqualError(t, CheckAttributeProgram(tx, 100), fmt.Sprintf("too many programs, %d > %d",
+		MaxTxPrograms+1, MaxTxPrograms))
+
+	t.Log("[TestCheckAttributeProgram_ProgramLimits] PASSED")
+}
+
+func TestCheckRequiredAttributes(t *testing.T) {
+	tx := buildTx()
+	var code = make([]byte, 21)
+	rand.Read(code)
+	code[len(code)-1] = common.STANDARD
+	tx.Programs = []*core.Program{{Code: code, Parameter: make([]byte, 1)}}
+
+	config.Parameters.ChainParam.RequiredAttributeUsages = []byte{byte(core.Description)}
+	defer func() {
+		config.Parameters.ChainParam.RequiredAttributeUsages = nil
+	}()
+
+	// missing required attribute
+	attr := core.NewAttribute(core.Memo, []byte("memo"))
+	tx.Attributes = []*core.Attribute{&attr}
+	err := CheckAttributeProgram(tx, 0)
+	assert.EqualError(t, err, fmt.Sprintf("required attribute usage %v not found", byte(core.Description)))
+
+	// required attribute included
+	kyc := core.NewAttribute(core.Description, []byte("kyc reference"))
+	tx.Attributes = append(tx.Attributes, &kyc)
+	err = CheckAttributeProgram(tx, 0)
+	assert.NoError(t, err)
+
+	t.Log("[TestCheckRequiredAttributes] PASSED")
+}
+
+func TestCheckTransactionExpiry(t *testing.T) {
+	newExpiry := func(height uint32) *core.Attribute {
+		buf := new(bytes.Buffer)
+		common.WriteUint32(buf, height)
+		attr := core.NewAttribute(core.Expiry, buf.Bytes())
+		return &attr
+	}
+	tx := buildTx()
+
+	// no expiry
+	err := CheckTransactionExpiry(tx, math.MaxUint32)
+	assert.NoError(t, err)
+
+	// not yet expired
+	tx.Attributes = []*core.Attribute{newExpiry(100)}
+	err = CheckTransactionExpiry(tx, 99)
+	assert.NoError(t, err)
+	err = CheckTransactionExpiry(tx, 100)
+	assert.NoError(t, err)
+
+	// expired
+	err = CheckTransactionExpiry(tx, 101)
+	assert.EqualError(t, err, "transaction expired at height 100")
+
+	// invalid expiry data
+	attr := core.NewAttribute(core.Expiry, []byte{0x01})
+	tx.Attributes = []*core.Attribute{&attr}
+	err = CheckTransactionExpiry(tx, 0)
+	assert.EqualError(t, err, "invalid expiry attribute data")
+
+	// more than one expiry
+	tx.Attributes = []*core.Attribute{newExpiry(100), newExpiry(200)}
+	err = CheckAttributeProgram(tx, 0)
+	assert.EqualError(t, err, "too many expiry attributes, 2 > 1")
+
+	t.Log("[TestCheckTransactionExpiry] PASSED")
+}
+
 func TestCheckTransactionPayload(t *testing.T) {
 	// normal
 	tx := new(core.Transaction)
@@ -378,23 +774,297 @@ func TestCheckTransactionPayload(t *testing.T) {
 		Amount: 3300 * 10000 * 10000000,
 	}
 	tx.Payload = payload
-	err := CheckTransactionPayload(tx)
+	err := CheckTransactionPayload(tx, 0)
 	assert.NoError(t, err)
 
 	// invalid precision
 	payload.Asset.Precision = 9
-	err = CheckTransactionPayload(tx)
+	err = CheckTransactionPayload(tx, 0)
 	assert.EqualError(t, err, "Invalide asset Precision.")
 
 	// invalid amount
 	payload.Asset.Precision = 0
 	payload.Amount = 1234567
-	err = CheckTransactionPayload(tx)
+	err = CheckTransactionPayload(tx, 0)
 	assert.EqualError(t, err, "Invalide asset value,out of precise.")
 
 	t.Log("[TestCheckTransactionPayload] PASSED")
 }
 
+func TestCheckRecordPayload(t *testing.T) {
+	maxSize := config.Parameters.MaxRecordDataSize
+	allowed := config.Parameters.AllowedRecordTypes
+	recordLimitHeight := config.Parameters.ChainParam.RecordLimitHeight
+	defer func() {
+		config.Parameters.MaxRecordDataSize = maxSize
+		config.Parameters.AllowedRecordTypes = allowed
+		config.Parameters.ChainParam.RecordLimitHeight = recordLimitHeight
+	}()
+	config.Parameters.ChainParam.RecordLimitHeight = 100
+
+	config.Parameters.MaxRecordDataSize = 100
+	config.Parameters.AllowedRecordTypes = nil
+	payload := &core.PayloadRecord{RecordType: "hash", RecordData: make([]byte, 100)}
+	tx := &core.Transaction{TxType: core.Record, Payload: payload}
+
+	// record data at the max size
+	err := CheckTransactionPayload(tx, 100)
+	assert.NoError(t, err)
+
+	// record data exceeds the max size
+	payload.RecordData = make([]byte, 101)
+	err = CheckTransactionPayload(tx, 100)
+	assert.EqualError(t, err, "record data size 101 exceeds the max size 100")
+
+	// below RecordLimitHeight the record payload is not checked
+	err = CheckTransactionPayload(tx, 99)
+	assert.NoError(t, err)
+
+	// default max size
+	config.Parameters.MaxRecordDataSize = 0
+	payload.RecordData = make([]byte, DefaultMaxRecordDataSize+1)
+	err = CheckTransactionPayload(tx, 100)
+	assert.EqualError(t, err, fmt.Sprintf("record data size %d exceeds the max size %d",
+		DefaultMaxRecordDataSize+1, DefaultMaxRecordDataSize))
+
+	// listed record type
+	config.Parameters.AllowedRecordTypes = []string{"hash", "proof"}
+	payload.RecordData = make([]byte, 1)
+	err = CheckTransactionPayload(tx, 100)
+	assert.NoError(t, err)
+
+	// unlisted record type
+	payload.RecordType = "file"
+	err = CheckTransactionPayload(tx, 100)
+	assert.EqualError(t, err, "record type file is not allowed")
+
+	t.Log("[TestCheckRecordPayload] PASSED")
+}
+
+func TestCheckRegisterIdentificationPayload(t *testing.T) {
+	account := newAccount(t)
+	code := append([]byte{}, account.redeemScript...)
+	code[len(code)-1] = vm.CHECKREGID
+	idHash, err := crypto.ToProgramHash(code)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	id, err := idHash.ToAddress()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	// well-formed identification payload
+	payload := &core.PayloadRegisterIdentification{
+		ID:   id,
+		Sign: make([]byte, 64),
+		Contents: []core.RegisterIdentificationContent{{
+			Path:   "kyc/person/identityCard",
+			Values: []core.RegisterIdentificationValue{{DataHash: common.Uint256{1}, Proof: "proof"}},
+		}},
+	}
+	tx := &core.Transaction{
+		TxType:   core.RegisterIdentification,
+		Payload:  payload,
+		Programs: []*core.Program{{Code: code, Parameter: make([]byte, 65)}},
+	}
+	err = CheckTransactionPayload(tx, 0)
+	assert.NoError(t, err)
+
+	// empty ID
+	payload.ID = ""
+	err = CheckTransactionPayload(tx, 0)
+	assert.EqualError(t, err, "identification ID is empty")
+
+	// ID not a register ID address
+	payload.ID, _ = account.programHash.ToAddress()
+	err = CheckTransactionPayload(tx, 0)
+	assert.EqualError(t, err, fmt.Sprintf("invalid identification ID %s", payload.ID))
+
+	// ID not signed by the programs
+	payload.ID = id
+	tx.Programs = []*core.Program{{Code: account.redeemScript, Parameter: make([]byte, 65)}}
+	err = CheckTransactionPayload(tx, 0)
+	assert.EqualError(t, err, fmt.Sprintf("identification ID %s not signed by transaction programs", id))
+	tx.Programs = []*core.Program{{Code: code, Parameter: make([]byte, 65)}}
+
+	// empty path
+	payload.Contents[0].Path = ""
+	err = CheckTransactionPayload(tx, 0)
+	assert.EqualError(t, err, "identification content path is empty")
+	payload.Contents[0].Path = "kyc/person/identityCard"
+
+	// oversized value
+	payload.Contents[0].Values[0].Proof = string(make([]byte, MaxIdentificationProofLength+1))
+	err = CheckTransactionPayload(tx, 0)
+	assert.EqualError(t, err, fmt.Sprintf("identification content %s value proof length %d > %d",
+		"kyc/person/identityCard", MaxIdentificationProofLength+1, MaxIdentificationProofLength))
+
+	// empty data hash
+	payload.Contents[0].Values[0] = core.RegisterIdentificationValue{Proof: "proof"}
+	err = CheckTransactionPayload(tx, 0)
+	assert.EqualError(t, err, "identification content kyc/person/identityCard value data hash is empty")
+
+	// no contents
+	payload.Contents = nil
+	err = CheckTransactionPayload(tx, 0)
+	assert.EqualError(t, err, "identification contents is empty")
+
+	t.Log("[TestCheckRegisterIdentificationPayload] PASSED")
+}
+
+func TestCheckRegisterIdentificationTransaction(t *testing.T) {
+	owner := newAccount(t)
+	controller := newAccount(t)
+	other := newAccount(t)
+	code := append([]byte{}, owner.redeemScript...)
+	code[len(code)-1] = vm.CHECKREGID
+	idHash, err := crypto.ToProgramHash(code)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	id, err := idHash.ToAddress()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	newRegistration := func(dataHash common.Uint256, signer *account) *core.Transaction {
+		return &core.Transaction{
+			TxType: core.RegisterIdentification,
+			Payload: &core.PayloadRegisterIdentification{
+				ID:   id,
+				Sign: make([]byte, 64),
+				Contents: []core.RegisterIdentificationContent{{
+					Path:   "kyc/person/identityCard",
+					Values: []core.RegisterIdentificationValue{{DataHash: dataHash, Proof: "proof"}},
+				}},
+			},
+			Programs: []*core.Program{
+				{Code: code, Parameter: make([]byte, 65)},
+				{Code: signer.redeemScript, Parameter: make([]byte, 65)},
+			},
+		}
+	}
+	store := DefaultLedger.Store.(*ChainStore)
+	idKey := []byte(id + "kyc/person/identityCard")
+
+	// first registration without a controller program
+	register := newRegistration(common.Uint256{1}, controller)
+	register.Programs = register.Programs[:1]
+	err = CheckRegisterIdentificationTransaction(register)
+	assert.EqualError(t, err, fmt.Sprintf("identification ID %s has no controller program", id))
+
+	// first registration
+	register = newRegistration(common.Uint256{1}, controller)
+	assert.NoError(t, CheckRegisterIdentificationTransaction(register))
+	store.NewBatch()
+	assert.NoError(t, store.PersistIdentification(register, newIdentificationBatch()))
+	store.BatchCommit()
+	registered, err := store.GetIdentificationController(id)
+	assert.NoError(t, err)
+	assert.Equal(t, *controller.programHash, *registered)
+
+	// update signed by the controller
+	update := newRegistration(common.Uint256{2}, controller)
+	assert.NoError(t, CheckRegisterIdentificationTransaction(update))
+	store.NewBatch()
+	assert.NoError(t, store.PersistIdentification(update, newIdentificationBatch()))
+	store.BatchCommit()
+	txHash, err := store.GetRegisterIdentificationTx(idKey)
+	assert.NoError(t, err)
+	updateHash := update.Hash()
+	assert.Equal(t, updateHash.Bytes(), txHash)
+
+	// update signed by a different key
+	rejected := newRegistration(common.Uint256{3}, other)
+	err = CheckRegisterIdentificationTransaction(rejected)
+	controllerAddress, _ := controller.programHash.ToAddress()
+	assert.EqualError(t, err, fmt.Sprintf("identification ID %s update not signed by its controller %s",
+		id, controllerAddress))
+
+	// rollback the update then the registration
+	store.NewBatch()
+	assert.NoError(t, store.RollbackIdentification(update))
+	store.BatchCommit()
+	txHash, err = store.GetRegisterIdentificationTx(idKey)
+	assert.NoError(t, err)
+	registerHash := register.Hash()
+	assert.Equal(t, registerHash.Bytes(), txHash)
+
+	store.NewBatch()
+	assert.NoError(t, store.RollbackIdentification(register))
+	store.BatchCommit()
+	_, err = store.GetRegisterIdentificationTx(idKey)
+	assert.Error(t, err)
+	_, err = store.GetIdentificationController(id)
+	assert.Error(t, err)
+
+	t.Log("[TestCheckRegisterIdentificationTransaction] PASSED")
+}
+
+func TestCheckIdentificationReplay(t *testing.T) {
+	owner := newAccount(t)
+	controller := newAccount(t)
+	code := append([]byte{}, owner.redeemScript...)
+	code[len(code)-1] = vm.CHECKREGID
+	idHash, err := crypto.ToProgramHash(code)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	id, err := idHash.ToAddress()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	newRegistration := func(dataHash common.Uint256, nonce uint64) *core.Transaction {
+		return &core.Transaction{
+			TxType:         core.RegisterIdentification,
+			PayloadVersion: core.RegisterIdentificationNonceVersion,
+			Payload: &core.PayloadRegisterIdentification{
+				ID:   id,
+				Sign: make([]byte, 64),
+				Contents: []core.RegisterIdentificationContent{{
+					Path:   "kyc/person/phone",
+					Values: []core.RegisterIdentificationValue{{DataHash: dataHash, Proof: "proof"}},
+				}},
+				Nonce: nonce,
+			},
+			Programs: []*core.Program{
+				{Code: code, Parameter: make([]byte, 65)},
+				{Code: controller.redeemScript, Parameter: make([]byte, 65)},
+			},
+		}
+	}
+	store := DefaultLedger.Store.(*ChainStore)
+	register := newRegistration(common.Uint256{1}, 1)
+	store.NewBatch()
+	assert.NoError(t, store.PersistIdentification(register, newIdentificationBatch()))
+	store.BatchCommit()
+
+	// the same content with the same nonce
+	err = CheckRegisterIdentificationTransaction(newRegistration(common.Uint256{1}, 1))
+	assert.EqualError(t, err, fmt.Sprintf(
+		"identification ID %s path kyc/person/phone is already registered with nonce 1", id))
+
+	// the same content with a lower nonce
+	err = CheckRegisterIdentificationTransaction(newRegistration(common.Uint256{1}, 0))
+	assert.Error(t, err)
+
+	// the same content with a higher nonce
+	err = CheckRegisterIdentificationTransaction(newRegistration(common.Uint256{1}, 2))
+	assert.NoError(t, err)
+
+	// another content with the same nonce
+	err = CheckRegisterIdentificationTransaction(newRegistration(common.Uint256{2}, 1))
+	assert.NoError(t, err)
+
+	// unknown payload version
+	tx := newRegistration(common.Uint256{2}, 1)
+	tx.PayloadVersion = core.RegisterIdentificationNonceVersion + 1
+	err = CheckTransactionPayload(tx, 0)
+	assert.EqualError(t, err, fmt.Sprintf("invalid identification payload version %d", tx.PayloadVersion))
+
+	t.Log("[TestCheckIdentificationReplay] PASSED")
+}
+
 func TestCheckTransactionBalance(t *testing.T) {
 	// WithdrawFromSideChain will pass check in any condition
 	tx := new(core.Transaction)
@@ -440,6 +1110,1648 @@ func TestCheckTransactionBalance(t *testing.T) {
 	t.Log("[TestCheckTransactionBalance] PASSED")
 }
 
+func TestCheckTransactionUTXOLock(t *testing.T) {
+	// deposit 100 ELA to foundation account at current height
+	deposit := NewCoinBaseTransaction(new(core.PayloadCoinBase), 0)
+	deposit.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: common.Fixed64(100 * ELA)},
+	}
+	height := DefaultLedger.Store.GetHeight()
+	DefaultLedger.Store.(*ChainStore).NewBatch()
+	DefaultLedger.Store.(*ChainStore).PersistTransaction(deposit, height)
+	DefaultLedger.Store.(*ChainStore).BatchCommit()
+
+	// spend the deposit with a relative lock of 2 blocks
+	tx := buildTx()
+	tx.Inputs = []*core.Input{
+		{Previous: *core.NewOutPoint(deposit.Hash(), 0), Sequence: 2},
+	}
+
+	// relative lock time disabled
+	config.Parameters.RelativeLockHeight = 0
+	err := CheckTransactionUTXOLock(tx)
+	assert.NoError(t, err)
+
+	// before the fork height
+	config.Parameters.RelativeLockHeight = height + 2
+	err = CheckTransactionUTXOLock(tx)
+	assert.NoError(t, err)
+
+	// relative lock not mature yet, the next block is only 1 block later
+	config.Parameters.RelativeLockHeight = height + 1
+	err = CheckTransactionUTXOLock(tx)
+	assert.EqualError(t, err, "UTXO relative height locked")
+
+	// relative lock disabled by sequence flag
+	tx.Inputs[0].Sequence = core.SequenceLockTimeDisabled | 2
+	err = CheckTransactionUTXOLock(tx)
+	assert.NoError(t, err)
+
+	// relative lock mature
+	tx.Inputs[0].Sequence = 1
+	err = CheckTransactionUTXOLock(tx)
+	assert.NoError(t, err)
+
+	// time based relative lock not mature yet
+	tx.Inputs[0].Sequence = core.SequenceLockTimeIsSeconds | 1
+	err = CheckTransactionUTXOLock(tx)
+	assert.EqualError(t, err, "UTXO relative time locked")
+
+	config.Parameters.RelativeLockHeight = 0
+
+	// rollback deposit above
+	DefaultLedger.Store.(*ChainStore).NewBatch()
+	DefaultLedger.Store.(*ChainStore).RollbackTransaction(deposit)
+	DefaultLedger.Store.(*ChainStore).BatchCommit()
+
+	t.Log("[TestCheckTransactionUTXOLock] PASSED")
+}
+
+func TestCheckTransactionLockTime(t *testing.T) {
+	lockTimeHeight := config.Parameters.ChainParam.LockTimeHeight
+	defer func() { config.Parameters.ChainParam.LockTimeHeight = lockTimeHeight }()
+	config.Parameters.ChainParam.LockTimeHeight = 1
+
+	height := DefaultLedger.Store.GetHeight()
+	tx := buildTx()
+	for _, input := range tx.Inputs {
+		input.Sequence = math.MaxUint32 - 1
+	}
+
+	// case: no lock time
+	err := CheckTransactionLockTime(tx, height)
+	assert.NoError(t, err)
+
+	// case: height based lock time is reached by the next block
+	tx.LockTime = height
+	err = CheckTransactionLockTime(tx, height)
+	assert.NoError(t, err)
+	tx.LockTime = height + 1
+	err = CheckTransactionLockTime(tx, height)
+	assert.EqualError(t, err, fmt.Sprintf("transaction lock time %d is not reached", height+1))
+
+	// case: time based lock time
+	medianTime := uint32(MedianTimePast(medianTimeBlocks).Unix())
+	if medianTime > core.LockTimeThreshold {
+		tx.LockTime = medianTime - 1
+		err = CheckTransactionLockTime(tx, height)
+		assert.NoError(t, err)
+	}
+	tx.LockTime = medianTime
+	if tx.LockTime < core.LockTimeThreshold {
+		tx.LockTime = core.LockTimeThreshold
+	}
+	err = CheckTransactionLockTime(tx, height)
+	assert.EqualError(t, err, fmt.Sprintf("transaction lock time %d is not reached", tx.LockTime))
+
+	// case: finalized by the input sequences
+	for _, input := range tx.Inputs {
+		input.Sequence = math.MaxUint32
+	}
+	err = CheckTransactionLockTime(tx, height)
+	assert.NoError(t, err)
+
+	t.Log("[TestCheckTransactionLockTime] PASSED")
+}
+
+func TestCheckOutputLock(t *testing.T) {
+	// height based output lock
+	height := DefaultLedger.Store.GetHeight()
+	err := checkOutputLock(height+1, height)
+	assert.NoError(t, err)
+	err = checkOutputLock(height+2, height)
+	assert.EqualError(t, err, "UTXO output locked by height")
+
+	// time based output lock
+	medianTime := uint32(MedianTimePast(medianTimeBlocks).Unix())
+	err = checkOutputLock(medianTime, height)
+	assert.NoError(t, err)
+	err = checkOutputLock(medianTime+1, height)
+	assert.EqualError(t, err, "UTXO output locked by time")
+
+	// deposit 100 ELA locked by time to foundation account
+	deposit := NewCoinBaseTransaction(new(core.PayloadCoinBase), 0)
+	deposit.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress,
+			Value: common.Fixed64(100 * ELA), OutputLock: medianTime},
+	}
+	DefaultLedger.Store.(*ChainStore).NewBatch()
+	DefaultLedger.Store.(*ChainStore).PersistTransaction(deposit, 0)
+	DefaultLedger.Store.(*ChainStore).BatchCommit()
+
+	tx := buildTx()
+	tx.Inputs = []*core.Input{
+		{Previous: *core.NewOutPoint(deposit.Hash(), 0), Sequence: math.MaxUint32 - 1},
+	}
+
+	lockTimeHeight := config.Parameters.ChainParam.LockTimeHeight
+	defer func() { config.Parameters.ChainParam.LockTimeHeight = lockTimeHeight }()
+	config.Parameters.ChainParam.LockTimeHeight = 1
+
+	// height based lock time can not unlock time based output lock
+	tx.LockTime = height + 1
+	err = CheckTransactionUTXOLock(tx)
+	assert.EqualError(t, err, "UTXO output lock time type mismatch")
+
+	// a zero LockTimeHeight only compares the lock time to the output lock
+	config.Parameters.ChainParam.LockTimeHeight = 0
+	err = CheckTransactionUTXOLock(tx)
+	assert.EqualError(t, err, "UTXO output locked")
+	config.Parameters.ChainParam.LockTimeHeight = 1
+
+	tx.LockTime = medianTime
+	err = CheckTransactionUTXOLock(tx)
+	assert.NoError(t, err)
+
+	// rollback deposit above
+	DefaultLedger.Store.(*ChainStore).NewBatch()
+	DefaultLedger.Store.(*ChainStore).RollbackTransaction(deposit)
+	DefaultLedger.Store.(*ChainStore).BatchCommit()
+
+	t.Log("[TestCheckOutputLock] PASSED")
+}
+
+func TestCheckCrossChainOutputCount(t *testing.T) {
+	maxCrossChainOutputs := config.Parameters.MaxCrossChainOutputs
+	crossChainOutputsHeight := config.Parameters.ChainParam.CrossChainOutputsHeight
+	config.Parameters.MaxCrossChainOutputs = 3
+	config.Parameters.ChainParam.CrossChainOutputsHeight = 1
+	defer func() {
+		config.Parameters.MaxCrossChainOutputs = maxCrossChainOutputs
+		config.Parameters.ChainParam.CrossChainOutputsHeight = crossChainOutputsHeight
+	}()
+
+	newCrossChainTx := func(count int) *core.Transaction {
+		payload := &core.PayloadTransferCrossChainAsset{}
+		tx := &core.Transaction{TxType: core.TransferCrossChainAsset, Payload: payload}
+		for i := 0; i < count; i++ {
+			payload.CrossChainAddresses = append(payload.CrossChainAddresses, "address")
+			payload.OutputIndexes = append(payload.OutputIndexes, uint64(i))
+			payload.CrossChainAmounts = append(payload.CrossChainAmounts, common.Fixed64(ELA))
+			tx.Outputs = append(tx.Outputs, &core.Output{Value: common.Fixed64(2 * ELA)})
+		}
+		return tx
+	}
+
+	// at the limit
+	tx := newCrossChainTx(3)
+	assert.NoError(t, checkCrossChainOutputCount(len(tx.Payload.(*core.PayloadTransferCrossChainAsset).CrossChainAddresses), 1))
+
+	// one over the limit
+	tx = newCrossChainTx(4)
+	err := CheckTransferCrossChainAssetTransaction(tx)
+	assert.EqualError(t, err, "cross chain output count 4 exceeds the max 3")
+
+	// below CrossChainOutputsHeight the count is not limited
+	assert.NoError(t, checkCrossChainOutputCount(4, 0))
+
+	// default limit
+	config.Parameters.MaxCrossChainOutputs = 0
+	tx = newCrossChainTx(DefaultMaxCrossChainOutputs)
+	assert.NoError(t, checkCrossChainOutputCount(len(tx.Payload.(*core.PayloadTransferCrossChainAsset).CrossChainAddresses), 1))
+	tx = newCrossChainTx(DefaultMaxCrossChainOutputs + 1)
+	err = CheckTransferCrossChainAssetTransaction(tx)
+	assert.EqualError(t, err, fmt.Sprintf("cross chain output count %d exceeds the max %d",
+		DefaultMaxCrossChainOutputs+1, DefaultMaxCrossChainOutputs))
+
+	t.Log("[TestCheckCrossChainOutputCount] PASSED")
+}
+
+func TestEstimateCrossChainFee(t *testing.T) {
+	minCrossChainTxFee := config.Parameters.MinCrossChainTxFee
+	minTxFee := config.Parameters.PowConfiguration.MinTxFee
+	config.Parameters.MinCrossChainTxFee = 10000
+	config.Parameters.PowConfiguration.MinTxFee = 100
+	defer func() {
+		config.Parameters.MinCrossChainTxFee = minCrossChainTxFee
+		config.Parameters.PowConfiguration.MinTxFee = minTxFee
+	}()
+	address, err := FoundationAddress.ToAddress()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	// one fee for each cross chain output and one for the transaction
+	amounts := []common.Fixed64{common.Fixed64(3 * ELA), common.Fixed64(2 * ELA)}
+	fee, err := EstimateCrossChainFee(amounts)
+	assert.NoError(t, err)
+	assert.Equal(t, common.Fixed64(30000), fee)
+
+	// deposit 10 ELA to foundation account
+	deposit := NewCoinBaseTransaction(new(core.PayloadCoinBase), 0)
+	deposit.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress,
+			Value: common.Fixed64(10 * ELA)},
+	}
+	DefaultLedger.Store.(*ChainStore).NewBatch()
+	DefaultLedger.Store.(*ChainStore).PersistTransaction(deposit, 0)
+	DefaultLedger.Store.(*ChainStore).BatchCommit()
+	defer func() {
+		DefaultLedger.Store.(*ChainStore).NewBatch()
+		DefaultLedger.Store.(*ChainStore).RollbackTransaction(deposit)
+		DefaultLedger.Store.(*ChainStore).BatchCommit()
+	}()
+
+	// transfer paying exactly the estimated fee
+	payload := &core.PayloadTransferCrossChainAsset{}
+	tx := &core.Transaction{
+		TxType:  core.TransferCrossChainAsset,
+		Payload: payload,
+		Inputs:  []*core.Input{{Previous: *core.NewOutPoint(deposit.Hash(), 0)}},
+	}
+	change := common.Fixed64(10*ELA) - fee
+	for i, amount := range amounts {
+		payload.CrossChainAddresses = append(payload.CrossChainAddresses, address)
+		payload.OutputIndexes = append(payload.OutputIndexes, uint64(i))
+		payload.CrossChainAmounts = append(payload.CrossChainAmounts, amount)
+		tx.Outputs = append(tx.Outputs, &core.Output{
+			AssetID: DefaultLedger.Blockchain.AssetID,
+			Value:   amount + crossChainTxFee(),
+		})
+		change -= amount
+	}
+	tx.Outputs = append(tx.Outputs, &core.Output{
+		AssetID:     DefaultLedger.Blockchain.AssetID,
+		ProgramHash: FoundationAddress,
+		Value:       change,
+	})
+	err = CheckTransferCrossChainAssetTransaction(tx)
+	assert.NoError(t, err)
+
+	// one unit below the estimated fee
+	tx.Outputs[len(tx.Outputs)-1].Value = change + 1
+	err = CheckTransferCrossChainAssetTransaction(tx)
+	assert.EqualError(t, err, "Invalid transaction fee")
+
+	// the min transaction fee above the cross chain fee is paid as the
+	// transaction fee
+	config.Parameters.PowConfiguration.MinTxFee = 20000
+	fee, err = EstimateCrossChainFee(amounts)
+	assert.NoError(t, err)
+	assert.Equal(t, common.Fixed64(40000), fee)
+	tx.Outputs[len(tx.Outputs)-1].Value = common.Fixed64(10*ELA) - fee - amounts[0] - amounts[1]
+	assert.NoError(t, CheckTransferCrossChainAssetTransaction(tx))
+	assert.NoError(t, CheckTransactionBalance(tx))
+
+	// one unit below the estimated fee leaves the transaction fee below the
+	// min transaction fee
+	tx.Outputs[len(tx.Outputs)-1].Value++
+	assert.NoError(t, CheckTransferCrossChainAssetTransaction(tx))
+	assert.EqualError(t, CheckTransactionBalance(tx), "Transaction fee not enough")
+
+	// invalid amounts
+	_, err = EstimateCrossChainFee(nil)
+	assert.EqualError(t, err, "no cross chain amount")
+	_, err = EstimateCrossChainFee([]common.Fixed64{-1})
+	assert.Error(t, err)
+
+	t.Log("[TestEstimateCrossChainFee] PASSED")
+}
+
+func TestCheckCrossChainAddressNetwork(t *testing.T) {
+	chainParam := config.Parameters.ChainParam
+	var mainNet, testNet *config.ChainParams
+	for _, params := range config.NetParams() {
+		switch params.Name {
+		case "MainNet":
+			mainNet = params
+		case "TestNet":
+			testNet = params
+		}
+	}
+	testNetPrefixes := testNet.AddressPrefixes
+	testNet.AddressPrefixes = []byte{0x1f}
+	defer func() {
+		config.Parameters.ChainParam = chainParam
+		testNet.AddressPrefixes = testNetPrefixes
+	}()
+
+	var mainNetHash, testNetHash, unknownHash common.Uint168
+	mainNetHash[0] = common.PrefixStandard
+	testNetHash[0] = 0x1f
+	unknownHash[0] = 0x01
+
+	// addresses of the configured network
+	config.Parameters.ChainParam = mainNet
+	assert.NoError(t, checkCrossChainAddressNetwork("main", &mainNetHash))
+	config.Parameters.ChainParam = testNet
+	assert.NoError(t, checkCrossChainAddressNetwork("test", &testNetHash))
+
+	// mainnet address on a testnet side chain
+	err := checkCrossChainAddressNetwork("main", &mainNetHash)
+	assert.EqualError(t, err, "cross chain address main is a MainNet address, the main chain network is TestNet")
+
+	// testnet address on a mainnet side chain
+	config.Parameters.ChainParam = mainNet
+	err = checkCrossChainAddressNetwork("test", &testNetHash)
+	assert.EqualError(t, err, "cross chain address test is a TestNet address, the main chain network is MainNet")
+
+	// address of no known network
+	err = checkCrossChainAddressNetwork("unknown", &unknownHash)
+	assert.EqualError(t, err, "Invalid transaction cross chain address")
+
+	t.Log("[TestCheckCrossChainAddressNetwork] PASSED")
+}
+
+func TestCheckCrossChainTarget(t *testing.T) {
+	var sideChain, otherSideChain common.Uint168
+	rand.Read(sideChain[:])
+	rand.Read(otherSideChain[:])
+	address, err := FoundationAddress.ToAddress()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	mainChainTx := &ela.Transaction{
+		Outputs: []*ela.Output{
+			{ProgramHash: sideChain, Value: common.Fixed64(10 * ELA)},
+		},
+	}
+	payload := &ela.PayloadTransferCrossChainAsset{
+		CrossChainAddresses: []string{address},
+		OutputIndexes:       []uint64{0},
+		CrossChainAmounts:   []common.Fixed64{common.Fixed64(9 * ELA)},
+	}
+
+	// main chain transfer targets this side chain
+	err = checkCrossChainTarget(mainChainTx, payload, []common.Uint168{sideChain}, newAddressCache())
+	assert.NoError(t, err)
+
+	// main chain transfer targets another side chain
+	mainChainTx.Outputs[0].ProgramHash = otherSideChain
+	err = checkCrossChainTarget(mainChainTx, payload, []common.Uint168{sideChain}, newAddressCache())
+	assert.EqualError(t, err, "Main chain transaction does not target this side chain")
+
+	// cross chain index out of range
+	payload.OutputIndexes = []uint64{1}
+	err = checkCrossChainTarget(mainChainTx, payload, []common.Uint168{sideChain}, newAddressCache())
+	assert.EqualError(t, err, "Invalid main chain transaction cross chain index")
+
+	t.Log("[TestCheckCrossChainTarget] PASSED")
+}
+
+func BenchmarkCheckCrossChainTarget(b *testing.B) {
+	var sideChain common.Uint168
+	rand.Read(sideChain[:])
+	address, err := FoundationAddress.ToAddress()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// a batch of cross chain outputs to the same address
+	mainChainTx := new(ela.Transaction)
+	payload := new(ela.PayloadTransferCrossChainAsset)
+	for i := 0; i < 1000; i++ {
+		mainChainTx.Outputs = append(mainChainTx.Outputs,
+			&ela.Output{ProgramHash: sideChain, Value: common.Fixed64(ELA)})
+		payload.CrossChainAddresses = append(payload.CrossChainAddresses, address)
+		payload.OutputIndexes = append(payload.OutputIndexes, uint64(i))
+		payload.CrossChainAmounts = append(payload.CrossChainAmounts, common.Fixed64(ELA/2))
+	}
+	custody := []common.Uint168{sideChain}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := checkCrossChainTarget(mainChainTx, payload, custody, newAddressCache()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCheckRegisterAssetTransaction(t *testing.T) {
+	store := DefaultLedger.Store.(*ChainStore)
+	newRegisterBlock := func(name string) *core.Block {
+		return &core.Block{
+			Header: core.Header{Height: DefaultLedger.Store.GetHeight() + 1},
+			Transactions: []*core.Transaction{
+				{
+					TxType: core.RegisterAsset,
+					Payload: &core.PayloadRegisterAsset{
+						Asset: core.Asset{Name: name, Precision: 0x08},
+					},
+				},
+			},
+		}
+	}
+
+	assertErrorCode := func(err error, code ErrCode) {
+		ruleErr, ok := err.(RuleError)
+		if assert.True(t, ok) {
+			assert.Equal(t, code, ruleErr.ErrorCode)
+		}
+	}
+
+	maxRegisteredAssets := config.Parameters.MaxRegisteredAssets
+	config.Parameters.MaxRegisteredAssets = DefaultLedger.Store.GetAssetCount() + 2
+	defer func() {
+		config.Parameters.MaxRegisteredAssets = maxRegisteredAssets
+	}()
+
+	// register assets until the cap is reached
+	block1, block2 := newRegisterBlock("TEST1"), newRegisterBlock("TEST2")
+	for _, block := range []*core.Block{block1, block2} {
+		err := CheckRegisterAssetTransaction(block.Transactions[0], 0)
+		assert.NoError(t, err)
+		store.NewBatch()
+		store.PersistTransactions(block)
+		store.PersistAssetCount(block)
+		store.BatchCommit()
+	}
+	assert.Equal(t, config.Parameters.MaxRegisteredAssets, DefaultLedger.Store.GetAssetCount())
+
+	// reached the cap
+	block3 := newRegisterBlock("TEST3")
+	err := CheckRegisterAssetTransaction(block3.Transactions[0], 0)
+	assert.EqualError(t, err, fmt.Sprintf("registered asset count reached the max %d",
+		config.Parameters.MaxRegisteredAssets))
+	assertErrorCode(err, ErrTooManyAssets)
+
+	// reorg frees a slot
+	store.NewBatch()
+	store.RollbackTransactions(block2)
+	store.RollbackAssetCount(block2)
+	store.BatchCommit()
+	err = CheckRegisterAssetTransaction(block3.Transactions[0], 0)
+	assert.NoError(t, err)
+
+	store.NewBatch()
+	store.RollbackTransactions(block1)
+	store.RollbackAssetCount(block1)
+	store.BatchCommit()
+
+	// empty name
+	err = CheckRegisterAssetTransaction(newRegisterBlock("").Transactions[0], 0)
+	assert.EqualError(t, err, "asset name is empty")
+	assertErrorCode(err, ErrEmptyAssetName)
+
+	// name limits from AssetNameLimitHeight
+	assetNameLimitHeight := config.Parameters.ChainParam.AssetNameLimitHeight
+	config.Parameters.ChainParam.AssetNameLimitHeight = 100
+	longName := strings.Repeat("A", DefaultMaxAssetNameLength+1)
+	err = CheckRegisterAssetTransaction(newRegisterBlock(longName).Transactions[0], 100)
+	assert.EqualError(t, err, fmt.Sprintf("asset name length %d is out of range [%d, %d]",
+		DefaultMaxAssetNameLength+1, DefaultMinAssetNameLength, DefaultMaxAssetNameLength))
+	assertErrorCode(err, ErrAssetNameLength)
+	err = CheckRegisterAssetTransaction(newRegisterBlock("TEST$").Transactions[0], 100)
+	assert.EqualError(t, err, `asset name contains invalid character '$'`)
+	assertErrorCode(err, ErrAssetNameCharset)
+	err = CheckRegisterAssetTransaction(newRegisterBlock("").Transactions[0], 100)
+	assertErrorCode(err, ErrEmptyAssetName)
+
+	// below AssetNameLimitHeight only the empty name is rejected
+	assert.NoError(t, CheckRegisterAssetTransaction(newRegisterBlock(longName).Transactions[0], 99))
+	assert.NoError(t, CheckRegisterAssetTransaction(newRegisterBlock("TEST$").Transactions[0], 99))
+	config.Parameters.ChainParam.AssetNameLimitHeight = assetNameLimitHeight
+
+	// over-length description
+	tx := newRegisterBlock("TEST4").Transactions[0]
+	tx.Payload.(*core.PayloadRegisterAsset).Asset.Description = strings.Repeat("a", DefaultMaxAssetDescriptionLength+1)
+	err = CheckRegisterAssetTransaction(tx, 0)
+	assert.EqualError(t, err, fmt.Sprintf("asset description length %d exceeds the max %d",
+		DefaultMaxAssetDescriptionLength+1, DefaultMaxAssetDescriptionLength))
+	assertErrorCode(err, ErrAssetDescription)
+
+	// invalid precision
+	tx = newRegisterBlock("TEST4").Transactions[0]
+	tx.Payload.(*core.PayloadRegisterAsset).Asset.Precision = core.MaxPrecision + 1
+	err = CheckRegisterAssetTransaction(tx, 0)
+	assert.EqualError(t, err, "invalid asset precision 9")
+	assertErrorCode(err, ErrAssetPrecision)
+
+	// amount of a precision 8 asset
+	tx = newRegisterBlock("TEST4").Transactions[0]
+	payload := tx.Payload.(*core.PayloadRegisterAsset)
+	payload.Amount = 12345678
+	assert.NoError(t, CheckRegisterAssetTransaction(tx, 0))
+	payload.Amount = -1
+	err = CheckRegisterAssetTransaction(tx, 0)
+	assert.EqualError(t, err, fmt.Sprintf("invalid register amount %s", payload.Amount.String()))
+
+	// amount of a precision 0 asset
+	payload.Asset.Precision = 0
+	payload.Amount = 1000 * 100000000
+	assert.NoError(t, CheckRegisterAssetTransaction(tx, 0))
+	for _, amount := range []common.Fixed64{1000*100000000 + 1, 150000000} {
+		payload.Amount = amount
+		err = CheckRegisterAssetTransaction(tx, 0)
+		assert.EqualError(t, err, fmt.Sprintf("register amount %s is not representable at precision 0",
+			amount.String()))
+	}
+
+	// name collides with the registered asset in different case
+	err = CheckRegisterAssetTransaction(newRegisterBlock("ela").Transactions[0], 0)
+	assert.EqualError(t, err, "asset name ela collides with registered asset ELA")
+	assertErrorCode(err, ErrDuplicateAssetName)
+
+	// name collides with the registered asset in different whitespaces
+	assert.Equal(t, "gold coin", core.NormalizeAssetName("  Gold \t Coin "))
+	block4 := newRegisterBlock("Gold Coin")
+	store.NewBatch()
+	store.PersistTransactions(block4)
+	store.BatchCommit()
+	for _, name := range []string{"gold coin", "Gold  Coin", " GOLD COIN "} {
+		err = CheckRegisterAssetTransaction(newRegisterBlock(name).Transactions[0], 0)
+		assert.EqualError(t, err, fmt.Sprintf("asset name %s collides with registered asset Gold Coin", name))
+	}
+	err = CheckRegisterAssetTransaction(newRegisterBlock("Gold Coins").Transactions[0], 0)
+	assert.NoError(t, err)
+
+	// canonical name released after rollback
+	store.NewBatch()
+	store.RollbackTransactions(block4)
+	store.BatchCommit()
+	err = CheckRegisterAssetTransaction(newRegisterBlock("gold coin").Transactions[0], 0)
+	assert.NoError(t, err)
+
+	// collision detected by the asset index without scanning the asset table
+	silver := core.Asset{Name: "Silver Coin", Precision: 0x08}
+	silverId := common.Uint256{0x51}
+	buf := new(bytes.Buffer)
+	silver.Serialize(buf)
+	store.NewBatch()
+	store.BatchPut(append([]byte{byte(ST_Info)}, silverId.Bytes()...), buf.Bytes())
+	store.BatchCommit()
+	assert.Contains(t, store.GetAssets(), silverId)
+	_, err = store.GetAssetByName("silver coin")
+	assert.EqualError(t, err, "asset silver coin not found")
+	err = CheckRegisterAssetTransaction(newRegisterBlock("silver coin").Transactions[0], 0)
+	assert.NoError(t, err)
+
+	// the stored assets indexed at startup
+	store.loadAssetIndex()
+	asset, err := store.GetAssetByName("silver coin")
+	assert.NoError(t, err)
+	assert.Equal(t, "Silver Coin", asset.Name)
+	err = CheckRegisterAssetTransaction(newRegisterBlock("silver coin").Transactions[0], 0)
+	assert.EqualError(t, err, "asset name silver coin collides with registered asset Silver Coin")
+	store.NewBatch()
+	store.RollbackAsset(silverId)
+	store.BatchCommit()
+	_, err = store.GetAssetByName("Silver Coin")
+	assert.Error(t, err)
+
+	t.Log("[TestCheckRegisterAssetTransaction] PASSED")
+}
+
+func TestCheckTransactionContextAtHeight(t *testing.T) {
+	act := newAccount(t)
+
+	// coinbase 100 ELA to the account
+	lockHeight := DefaultLedger.Store.GetHeight() + 10
+	deposit := NewCoinBaseTransaction(new(core.PayloadCoinBase), lockHeight)
+	deposit.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: *act.programHash, Value: common.Fixed64(100 * ELA)},
+	}
+	block := &core.Block{
+		Header:       core.Header{Height: lockHeight},
+		Transactions: []*core.Transaction{deposit},
+	}
+	store := DefaultLedger.Store.(*ChainStore)
+	store.NewBatch()
+	store.PersistTransactions(block)
+	store.PersistUnspend(block)
+	store.BatchCommit()
+
+	tx := &core.Transaction{
+		TxType:  core.TransferAsset,
+		Payload: new(core.PayloadTransferAsset),
+		Inputs: []*core.Input{
+			{Previous: *core.NewOutPoint(deposit.Hash(), 0), Sequence: math.MaxUint32},
+		},
+		Outputs: []*core.Output{
+			{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: *act.programHash, Value: common.Fixed64(99 * ELA)},
+		},
+	}
+	signature, err := act.Sign(getData(tx))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	tx.Programs = []*core.Program{{Code: act.redeemScript, Parameter: signature}}
+
+	// coinbase matured at height N
+	height := lockHeight + config.Parameters.ChainParam.SpendCoinbaseSpan
+	assert.Equal(t, Success, CheckTransactionContextAtHeight(tx, height))
+
+	// coinbase not matured at height N-1
+	assert.Equal(t, ErrIneffectiveCoinbase, CheckTransactionContextAtHeight(tx, height-1))
+
+	// coinbase not confirmed yet
+	assert.Equal(t, ErrIneffectiveCoinbase, CheckTransactionContextAtHeight(tx, lockHeight-1))
+
+	// rollback deposit above
+	store.NewBatch()
+	store.RollbackTransactions(block)
+	store.RollbackUnspend(block)
+	store.BatchCommit()
+
+	t.Log("[TestCheckTransactionContextAtHeight] PASSED")
+}
+
+func TestCoinbaseMaturityByAsset(t *testing.T) {
+	act := newAccount(t)
+	var token common.Uint256
+	rand.Read(token[:])
+	coinbaseMaturities := config.Parameters.CoinbaseMaturities
+	defer func() {
+		config.Parameters.CoinbaseMaturities = coinbaseMaturities
+	}()
+	spendCoinbaseSpan := config.Parameters.ChainParam.SpendCoinbaseSpan
+	tokenMaturity := spendCoinbaseSpan + 50
+	config.Parameters.CoinbaseMaturities = map[string]int{
+		common.BytesToHexString(common.BytesReverse(token.Bytes())): int(tokenMaturity),
+	}
+
+	// coinbase 100 ELA and 100 tokens to the account
+	lockHeight := DefaultLedger.Store.GetHeight() + 10
+	deposit := NewCoinBaseTransaction(new(core.PayloadCoinBase), lockHeight)
+	deposit.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: *act.programHash, Value: common.Fixed64(100 * ELA)},
+		{AssetID: token, ProgramHash: *act.programHash, Value: common.Fixed64(100 * ELA)},
+	}
+	block := &core.Block{
+		Header:       core.Header{Height: lockHeight},
+		Transactions: []*core.Transaction{deposit},
+	}
+	store := DefaultLedger.Store.(*ChainStore)
+	store.NewBatch()
+	store.PersistTransactions(block)
+	store.PersistUnspend(block)
+	store.BatchCommit()
+
+	spend := func(index uint16, assetID common.Uint256) *core.Transaction {
+		tx := &core.Transaction{
+			TxType:  core.TransferAsset,
+			Payload: new(core.PayloadTransferAsset),
+			Inputs: []*core.Input{
+				{Previous: *core.NewOutPoint(deposit.Hash(), index), Sequence: math.MaxUint32},
+			},
+			Outputs: []*core.Output{
+				{AssetID: assetID, ProgramHash: *act.programHash, Value: common.Fixed64(99 * ELA)},
+			},
+		}
+		signature, err := act.Sign(getData(tx))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		tx.Programs = []*core.Program{{Code: act.redeemScript, Parameter: signature}}
+		return tx
+	}
+	elaTx, tokenTx := spend(0, DefaultLedger.Blockchain.AssetID), spend(1, token)
+
+	// the ELA output matures with SpendCoinbaseSpan
+	height := lockHeight + spendCoinbaseSpan
+	assert.Equal(t, ErrIneffectiveCoinbase, CheckTransactionContextAtHeight(elaTx, height-1))
+	assert.Equal(t, Success, CheckTransactionContextAtHeight(elaTx, height))
+	assert.Equal(t, ErrIneffectiveCoinbase, CheckTransactionContextAtHeight(tokenTx, height))
+
+	// the token output matures with its configured maturity
+	height = lockHeight + tokenMaturity
+	assert.Equal(t, ErrIneffectiveCoinbase, CheckTransactionContextAtHeight(tokenTx, height-1))
+	assert.Equal(t, Success, CheckTransactionContextAtHeight(tokenTx, height))
+
+	// rollback deposit above
+	store.NewBatch()
+	store.RollbackTransactions(block)
+	store.RollbackUnspend(block)
+	store.BatchCommit()
+
+	t.Log("[TestCoinbaseMaturityByAsset] PASSED")
+}
+
+func TestCoinbaseMaturityByStoredHeight(t *testing.T) {
+	act := newAccount(t)
+	maturityHeight := config.Parameters.ChainParam.CoinbaseMaturityHeight
+	defer func() {
+		config.Parameters.ChainParam.CoinbaseMaturityHeight = maturityHeight
+	}()
+	spendCoinbaseSpan := config.Parameters.ChainParam.SpendCoinbaseSpan
+
+	// a coinbase with lock time 0 stored at a later height
+	storedHeight := DefaultLedger.Store.GetHeight() + 10
+	deposit := NewCoinBaseTransaction(new(core.PayloadCoinBase), 0)
+	deposit.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: *act.programHash, Value: common.Fixed64(100 * ELA)},
+	}
+	block := &core.Block{
+		Header:       core.Header{Height: storedHeight},
+		Transactions: []*core.Transaction{deposit},
+	}
+	store := DefaultLedger.Store.(*ChainStore)
+	store.NewBatch()
+	store.PersistTransactions(block)
+	store.PersistUnspend(block)
+	store.BatchCommit()
+
+	tx := &core.Transaction{
+		TxType:  core.TransferAsset,
+		Payload: new(core.PayloadTransferAsset),
+		Inputs: []*core.Input{
+			{Previous: *core.NewOutPoint(deposit.Hash(), 0), Sequence: math.MaxUint32},
+		},
+		Outputs: []*core.Output{
+			{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: *act.programHash, Value: common.Fixed64(99 * ELA)},
+		},
+	}
+	signature, err := act.Sign(getData(tx))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	tx.Programs = []*core.Program{{Code: act.redeemScript, Parameter: signature}}
+	height := storedHeight + spendCoinbaseSpan
+
+	// case: before the activation the maturity counts from the lock time
+	config.Parameters.ChainParam.CoinbaseMaturityHeight = 0
+	assert.Equal(t, Success, CheckTransactionContextAtHeight(tx, spendCoinbaseSpan))
+	config.Parameters.ChainParam.CoinbaseMaturityHeight = height + 2
+	assert.Equal(t, Success, CheckTransactionContextAtHeight(tx, height))
+
+	// case: spent one block too early
+	config.Parameters.ChainParam.CoinbaseMaturityHeight = storedHeight
+	assert.Equal(t, ErrIneffectiveCoinbase, CheckTransactionContextAtHeight(tx, spendCoinbaseSpan))
+	assert.Equal(t, ErrIneffectiveCoinbase, CheckTransactionContextAtHeight(tx, height-1))
+
+	// case: spent exactly at maturity
+	assert.Equal(t, Success, CheckTransactionContextAtHeight(tx, height))
+
+	// rollback deposit above
+	store.NewBatch()
+	store.RollbackTransactions(block)
+	store.RollbackUnspend(block)
+	store.BatchCommit()
+
+	t.Log("[TestCoinbaseMaturityByStoredHeight] PASSED")
+}
+
+func TestNormalizedFee(t *testing.T) {
+	var token common.Uint256
+	rand.Read(token[:])
+	tokenKey := common.BytesToHexString(common.BytesReverse(token.Bytes()))
+
+	assetFeeRates := config.Parameters.AssetFeeRates
+	config.Parameters.AssetFeeRates = map[string]int64{tokenKey: 50000000}
+	defer func() {
+		config.Parameters.AssetFeeRates = assetFeeRates
+	}()
+
+	// fee paid in native asset
+	nativeFee := NormalizedFee(map[common.Uint256]common.Fixed64{
+		DefaultLedger.Blockchain.AssetID: 100,
+	})
+	assert.Equal(t, common.Fixed64(100), nativeFee)
+
+	// fee paid in token, one token is 0.5 native asset
+	tokenFee := NormalizedFee(map[common.Uint256]common.Fixed64{
+		token: 300,
+	})
+	assert.Equal(t, common.Fixed64(150), tokenFee)
+
+	// token fee transaction ranks higher than native fee transaction
+	nativeTx, tokenTx := buildTx(), buildTx()
+	nativeTx.FeePerKB, tokenTx.FeePerKB = nativeFee, tokenFee
+	queue := assembleQueue{
+		{tx: nativeTx, hash: nativeTx.Hash()},
+		{tx: tokenTx, hash: tokenTx.Hash()},
+	}
+	assert.True(t, queue.Less(1, 0))
+
+	// fee in asset without rate is ignored
+	var unknown common.Uint256
+	rand.Read(unknown[:])
+	fee := NormalizedFee(map[common.Uint256]common.Fixed64{
+		DefaultLedger.Blockchain.AssetID: 100,
+		unknown:                          1000,
+	})
+	assert.Equal(t, common.Fixed64(100), fee)
+
+	t.Log("[TestNormalizedFee] PASSED")
+}
+
+func TestCheckRechargeToSideChainTransaction_Batch(t *testing.T) {
+	exchangeRate := config.Parameters.ExchangeRate
+	config.Parameters.ExchangeRate = 1
+	defer func() {
+		config.Parameters.ExchangeRate = exchangeRate
+	}()
+
+	genesisHash, err := DefaultLedger.Store.GetBlockHash(0)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	genesisProgramHash, err := sidecommon.GetGenesisProgramHash(genesisHash)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	address, err := FoundationAddress.ToAddress()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	proof := new(bytes.Buffer)
+	if err := new(bloom.MerkleProof).Serialize(proof); !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	// a deposit of the given amount to the foundation address
+	newDeposit := func(amount common.Fixed64) core.RechargeDeposit {
+		fee := common.Fixed64(config.Parameters.MinCrossChainTxFee)
+		mainChainTx := &ela.Transaction{
+			TxType: ela.TransferCrossChainAsset,
+			Payload: &ela.PayloadTransferCrossChainAsset{
+				CrossChainAddresses: []string{address},
+				OutputIndexes:       []uint64{0},
+				CrossChainAmounts:   []common.Fixed64{amount},
+			},
+			Outputs: []*ela.Output{
+				{ProgramHash: *genesisProgramHash, Value: amount + fee},
+			},
+		}
+		buf := new(bytes.Buffer)
+		if err := mainChainTx.Serialize(buf); err != nil {
+			t.Fatal(err)
+		}
+		return core.RechargeDeposit{
+			MerkleProof:          proof.Bytes(),
+			MainChainTransaction: buf.Bytes(),
+		}
+	}
+	newRecharge := func(deposits []core.RechargeDeposit, amounts ...common.Fixed64) *core.Transaction {
+		tx := &core.Transaction{
+			TxType:         core.RechargeToSideChain,
+			PayloadVersion: core.RechargeToSideChainBatchPayloadVersion,
+			Payload:        &core.PayloadRechargeToSideChain{Deposits: deposits},
+		}
+		for _, amount := range amounts {
+			tx.Outputs = append(tx.Outputs, &core.Output{
+				AssetID:     DefaultLedger.Blockchain.AssetID,
+				ProgramHash: FoundationAddress,
+				Value:       amount,
+			})
+		}
+		return tx
+	}
+	first := newDeposit(common.Fixed64(9 * ELA))
+	second := newDeposit(common.Fixed64(5 * ELA))
+
+	// two deposits batched
+	tx := newRecharge([]core.RechargeDeposit{first, second},
+		common.Fixed64(9*ELA), common.Fixed64(5*ELA))
+	err = CheckRechargeToSideChainTransaction(tx)
+	assert.NoError(t, err)
+
+	// batched payload round trip
+	buf := new(bytes.Buffer)
+	err = tx.Serialize(buf)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	var decoded core.Transaction
+	err = decoded.Deserialize(buf)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, tx.Hash(), decoded.Hash())
+	hashes, err := decoded.Payload.(*core.PayloadRechargeToSideChain).GetMainchainTxHashes()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(hashes))
+
+	// duplicate deposit in batch
+	tx = newRecharge([]core.RechargeDeposit{first, first},
+		common.Fixed64(9*ELA), common.Fixed64(9*ELA))
+	err = CheckRechargeToSideChainTransaction(tx)
+	assert.EqualError(t, err, "Duplicate mainchain transaction hash in batch")
+
+	// second deposit not paid
+	tx = newRecharge([]core.RechargeDeposit{first, second},
+		common.Fixed64(9*ELA))
+	err = CheckRechargeToSideChainTransaction(tx)
+	assert.EqualError(t, err, "Invalid transaction outputs")
+
+	t.Log("[TestCheckRechargeToSideChainTransaction_Batch] PASSED")
+}
+
+type testArbitrators struct {
+	err error
+}
+
+func (a testArbitrators) GetArbitratorsProgramHash() (*common.Uint168, error) {
+	return nil, a.err
+}
+
+func TestCheckRechargeToSideChainTransaction_Arbitrators(t *testing.T) {
+	exchangeRate := config.Parameters.ExchangeRate
+	arbitrators := Arbitrators
+	config.Parameters.ExchangeRate = 1
+	defer func() {
+		config.Parameters.ExchangeRate = exchangeRate
+		Arbitrators = arbitrators
+	}()
+
+	genesisHash, err := DefaultLedger.Store.GetBlockHash(0)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	genesisProgramHash, err := sidecommon.GetGenesisProgramHash(genesisHash)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	address, err := FoundationAddress.ToAddress()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	proof := new(bytes.Buffer)
+	if err := new(bloom.MerkleProof).Serialize(proof); !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	arbitratorsProgramHash := common.Uint168{PrefixMultisig, 0x01, 0x02, 0x03}
+
+	// a recharge of 9 ELA to the foundation address deposited to the custody
+	newRecharge := func(custody common.Uint168) *core.Transaction {
+		amount := common.Fixed64(9 * ELA)
+		fee := common.Fixed64(config.Parameters.MinCrossChainTxFee)
+		mainChainTx := &ela.Transaction{
+			TxType: ela.TransferCrossChainAsset,
+			Payload: &ela.PayloadTransferCrossChainAsset{
+				CrossChainAddresses: []string{address},
+				OutputIndexes:       []uint64{0},
+				CrossChainAmounts:   []common.Fixed64{amount},
+			},
+			Outputs: []*ela.Output{
+				{ProgramHash: custody, Value: amount + fee},
+			},
+		}
+		buf := new(bytes.Buffer)
+		if err := mainChainTx.Serialize(buf); err != nil {
+			t.Fatal(err)
+		}
+		deposit := core.RechargeDeposit{
+			MerkleProof:          proof.Bytes(),
+			MainChainTransaction: buf.Bytes(),
+		}
+		return &core.Transaction{
+			TxType:         core.RechargeToSideChain,
+			PayloadVersion: core.RechargeToSideChainBatchPayloadVersion,
+			Payload:        &core.PayloadRechargeToSideChain{Deposits: []core.RechargeDeposit{deposit}},
+			Outputs: []*core.Output{
+				{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: amount},
+			},
+		}
+	}
+
+	// case 1: the arbitrators custody is unknown
+	Arbitrators = nil
+	err = CheckRechargeToSideChainTransaction(newRecharge(arbitratorsProgramHash))
+	assert.EqualError(t, err, "Main chain transaction does not target this side chain")
+
+	// case 2: deposited to the current arbitrators
+	Arbitrators = StaticArbitrators(arbitratorsProgramHash)
+	assert.NoError(t, CheckRechargeToSideChainTransaction(newRecharge(arbitratorsProgramHash)))
+
+	// case 3: deposited to the genesis program hash
+	assert.NoError(t, CheckRechargeToSideChainTransaction(newRecharge(*genesisProgramHash)))
+
+	// case 4: the arbitrators custody can not be looked up
+	Arbitrators = testArbitrators{err: errors.New("arbitrators unavailable")}
+	err = CheckRechargeToSideChainTransaction(newRecharge(arbitratorsProgramHash))
+	assert.EqualError(t, err, "Main chain transaction does not target this side chain")
+	assert.NoError(t, CheckRechargeToSideChainTransaction(newRecharge(*genesisProgramHash)))
+
+	t.Log("[TestCheckRechargeToSideChainTransaction_Arbitrators] PASSED")
+}
+
+type testMainChainHeader struct {
+	merkleRoot common.Uint256
+	height     uint32
+}
+
+type testMainChainHeaders struct {
+	headers    map[common.Uint256]testMainChainHeader
+	bestHeight uint32
+}
+
+func (h *testMainChainHeaders) GetHeader(hash common.Uint256) (common.Uint256, uint32, error) {
+	header, ok := h.headers[hash]
+	if !ok {
+		return common.Uint256{}, 0, errors.New("header not found")
+	}
+	return header.merkleRoot, header.height, nil
+}
+
+func (h *testMainChainHeaders) GetBestHeight() uint32 {
+	return h.bestHeight
+}
+
+func TestCheckRechargeProof(t *testing.T) {
+	mainChainHeaders := MainChainHeaders
+	defer func() {
+		MainChainHeaders = mainChainHeaders
+	}()
+
+	// main chain block of two transactions
+	txs := []*ela.Transaction{
+		{TxType: ela.TransferCrossChainAsset, Payload: &ela.PayloadTransferCrossChainAsset{}},
+		{TxType: ela.TransferAsset, Payload: &ela.PayloadTransferAsset{}},
+	}
+	h0, h1 := txs[0].Hash(), txs[1].Hash()
+	root := common.Uint256(common.Sha256D(append(h0.Bytes(), h1.Bytes()...)))
+	var blockHash common.Uint256
+	rand.Read(blockHash[:])
+	MainChainHeaders = &testMainChainHeaders{
+		headers:    map[common.Uint256]testMainChainHeader{blockHash: {merkleRoot: root, height: 100}},
+		bestHeight: 100,
+	}
+
+	// proof of the first transaction
+	proof := &bloom.MerkleProof{
+		BlockHash:    blockHash,
+		Transactions: 2,
+		Hashes:       []*common.Uint256{&h0, &h1},
+		Flags:        []byte{0x03},
+	}
+	assert.NoError(t, checkRechargeProof(proof, txs[0]))
+
+	// proof of another transaction
+	err := checkRechargeProof(proof, txs[1])
+	assert.EqualError(t, err, "recharge proof does not prove the main chain transaction")
+
+	// proof not matching the merkle root
+	var fake common.Uint256
+	rand.Read(fake[:])
+	proof.Hashes = []*common.Uint256{&h0, &fake}
+	err = checkRechargeProof(proof, txs[0])
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "recharge proof does not match the main chain block")
+
+	// proof of an unknown main chain block
+	proof.Hashes = []*common.Uint256{&h0, &h1}
+	rand.Read(proof.BlockHash[:])
+	err = checkRechargeProof(proof, txs[0])
+	assert.EqualError(t, err, fmt.Sprintf("main chain block %s of the proof is unknown",
+		proof.BlockHash.String()))
+
+	t.Log("[TestCheckRechargeProof] PASSED")
+}
+
+func TestCheckRechargeConfirmations(t *testing.T) {
+	rechargeConfirmations := config.Parameters.RechargeConfirmations
+	mainChainHeaders := MainChainHeaders
+	defer func() {
+		config.Parameters.RechargeConfirmations = rechargeConfirmations
+		MainChainHeaders = mainChainHeaders
+	}()
+	config.Parameters.RechargeConfirmations = 6
+
+	tx := &ela.Transaction{TxType: ela.TransferCrossChainAsset, Payload: &ela.PayloadTransferCrossChainAsset{}}
+	txHash := tx.Hash()
+	var blockHash common.Uint256
+	rand.Read(blockHash[:])
+	headers := &testMainChainHeaders{
+		headers: map[common.Uint256]testMainChainHeader{blockHash: {merkleRoot: txHash, height: 100}},
+	}
+	MainChainHeaders = headers
+	proof := &bloom.MerkleProof{
+		BlockHash:    blockHash,
+		Transactions: 1,
+		Hashes:       []*common.Uint256{&txHash},
+		Flags:        []byte{0x01},
+	}
+
+	// just below the confirmations
+	headers.bestHeight = 104
+	err := checkRechargeProof(proof, tx)
+	assert.EqualError(t, err, "main chain block 100 has 5 confirmations, 6 required")
+
+	// just at the confirmations
+	headers.bestHeight = 105
+	assert.NoError(t, checkRechargeProof(proof, tx))
+
+	// best height behind the block
+	err = checkRechargeConfirmations(100, 99)
+	assert.EqualError(t, err, "main chain block 100 has 0 confirmations, 6 required")
+
+	// no confirmations required
+	config.Parameters.RechargeConfirmations = 0
+	assert.NoError(t, checkRechargeConfirmations(100, 100))
+
+	t.Log("[TestCheckRechargeConfirmations] PASSED")
+}
+
+func TestVerifyRechargeProof(t *testing.T) {
+	proof := new(bytes.Buffer)
+	if err := new(bloom.MerkleProof).Serialize(proof); !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	newDeposit := func(amount common.Fixed64) (core.RechargeDeposit, common.Uint256) {
+		mainChainTx := &ela.Transaction{
+			TxType: ela.TransferCrossChainAsset,
+			Payload: &ela.PayloadTransferCrossChainAsset{
+				CrossChainAmounts: []common.Fixed64{amount},
+			},
+		}
+		buf := new(bytes.Buffer)
+		if err := mainChainTx.Serialize(buf); err != nil {
+			t.Fatal(err)
+		}
+		return core.RechargeDeposit{
+			MerkleProof:          proof.Bytes(),
+			MainChainTransaction: buf.Bytes(),
+		}, mainChainTx.Hash()
+	}
+	first, firstHash := newDeposit(common.Fixed64(9 * ELA))
+	second, _ := newDeposit(common.Fixed64(5 * ELA))
+
+	// valid deposits
+	payload := &core.PayloadRechargeToSideChain{Deposits: []core.RechargeDeposit{first, second}}
+	assert.NoError(t, VerifyRechargeProof(payload))
+
+	// corrupted proof
+	corrupted := second
+	corrupted.MerkleProof = proof.Bytes()[:10]
+	payload = &core.PayloadRechargeToSideChain{Deposits: []core.RechargeDeposit{first, corrupted}}
+	err := VerifyRechargeProof(payload)
+	assert.EqualError(t, err, "deposit 1: RechargeToSideChain payload deserialize failed")
+
+	// corrupted main chain transaction
+	corrupted = second
+	corrupted.MainChainTransaction = []byte{0x08}
+	payload = &core.PayloadRechargeToSideChain{Deposits: []core.RechargeDeposit{corrupted}}
+	err = VerifyRechargeProof(payload)
+	assert.EqualError(t, err, "deposit 0: RechargeToSideChain mainChainTransaction deserialize failed")
+
+	// duplicate main chain transaction in payload
+	payload = &core.PayloadRechargeToSideChain{Deposits: []core.RechargeDeposit{first, second, first}}
+	err = VerifyRechargeProof(payload)
+	assert.EqualError(t, err, "deposit 2: Duplicate mainchain transaction hash in batch")
+
+	// main chain transaction recharged before
+	store := DefaultLedger.Store.(*ChainStore)
+	store.NewBatch()
+	store.PersistMainchainTx(firstHash)
+	store.BatchCommit()
+	payload = &core.PayloadRechargeToSideChain{Deposits: []core.RechargeDeposit{second, first}}
+	err = VerifyRechargeProof(payload)
+	assert.EqualError(t, err, "deposit 1: Duplicate mainchain transaction hash in paylod")
+	store.NewBatch()
+	store.RollbackMainchainTx(firstHash)
+	store.BatchCommit()
+
+	t.Log("[TestVerifyRechargeProof] PASSED")
+}
+
+func TestBlockchain_Reorganize(t *testing.T) {
+	// a main chain of 3 blocks and a side chain of 4 blocks from genesis
+	newNode := func(parent *BlockNode, height uint32, inMainChain bool) *BlockNode {
+		var hash common.Uint256
+		rand.Read(hash[:])
+		node := NewBlockNode(&core.Header{Height: height}, &hash)
+		node.Parent = parent
+		node.InMainChain = inMainChain
+		return node
+	}
+	genesis := newNode(nil, 0, true)
+	mainTip, sideTip := genesis, genesis
+	for height := uint32(1); height <= 3; height++ {
+		mainTip = newNode(mainTip, height, true)
+	}
+	for height := uint32(1); height <= 4; height++ {
+		sideTip = newNode(sideTip, height, false)
+	}
+
+	bc := &Blockchain{BestChain: mainTip}
+	detachNodes, attachNodes := bc.GetReorganizeNodes(sideTip)
+	assert.Equal(t, 3, detachNodes.Len())
+	assert.Equal(t, 4, attachNodes.Len())
+	assert.Equal(t, mainTip, detachNodes.Front().Value.(*BlockNode))
+	assert.Equal(t, sideTip, attachNodes.Back().Value.(*BlockNode))
+
+	// reorganization deeper than the max depth refused
+	maxDepth := config.Parameters.MaxReorgDepth
+	config.Parameters.MaxReorgDepth = 2
+	err := checkReorgDepth(detachNodes)
+	assert.EqualError(t, err, "reorganization depth 3 exceeds the max depth 2")
+	config.Parameters.MaxReorgDepth = 3
+	err = checkReorgDepth(detachNodes)
+	assert.NoError(t, err)
+	config.Parameters.MaxReorgDepth = maxDepth
+
+	// a recharge transaction on the losing branch is rolled back with it
+	store := DefaultLedger.Store.(*ChainStore)
+	address, err := FoundationAddress.ToAddress()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	mainChainTx := &ela.Transaction{
+		TxType: ela.TransferCrossChainAsset,
+		Payload: &ela.PayloadTransferCrossChainAsset{
+			CrossChainAddresses: []string{address},
+			OutputIndexes:       []uint64{0},
+			CrossChainAmounts:   []common.Fixed64{common.Fixed64(ELA)},
+		},
+	}
+	buf := new(bytes.Buffer)
+	if err := mainChainTx.Serialize(buf); !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	recharge := &core.Transaction{
+		TxType:         core.RechargeToSideChain,
+		PayloadVersion: core.RechargeToSideChainBatchPayloadVersion,
+		Payload: &core.PayloadRechargeToSideChain{
+			Deposits: []core.RechargeDeposit{{MainChainTransaction: buf.Bytes()}},
+		},
+		Outputs: []*core.Output{
+			{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress, Value: common.Fixed64(ELA)},
+		},
+	}
+	coinbase := NewCoinBaseTransaction(new(core.PayloadCoinBase), store.GetHeight()+1)
+	block := &core.Block{
+		Header: core.Header{
+			Previous: store.GetCurrentBlockHash(),
+			Height:   store.GetHeight() + 1,
+		},
+		Transactions: []*core.Transaction{coinbase, recharge},
+	}
+
+	err = store.persist(block)
+	assert.NoError(t, err)
+	assert.True(t, store.IsMainchainTxHashDuplicate(mainChainTx.Hash()))
+	err = store.rollback(block)
+	assert.NoError(t, err)
+	assert.False(t, store.IsMainchainTxHashDuplicate(mainChainTx.Hash()))
+	_, _, err = store.GetTransaction(recharge.Hash())
+	assert.Error(t, err)
+	assert.Equal(t, block.Header.Previous, store.GetCurrentBlockHash())
+
+	t.Log("[TestBlockchain_Reorganize] PASSED")
+}
+
+func TestStateRoot(t *testing.T) {
+	store := DefaultLedger.Store.(*ChainStore)
+	stateRootHeight := config.Parameters.ChainParam.StateRootHeight
+	config.Parameters.ChainParam.StateRootHeight = store.GetHeight() + 1
+	defer func() {
+		config.Parameters.ChainParam.StateRootHeight = stateRootHeight
+	}()
+
+	parentHash := store.GetCurrentBlockHash()
+	parentHeader, err := store.GetHeader(parentHash)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	parent := NewBlockNode(parentHeader, &parentHash)
+	transfer := buildTx()
+	transfer.Inputs = []*core.Input{{Previous: *core.NewOutPoint(common.Uint256{1}, 0)}}
+	transfer.Outputs = []*core.Output{{AssetID: DefaultLedger.Blockchain.AssetID, Value: common.Fixed64(ELA)}}
+	block := &core.Block{
+		Header: core.Header{
+			Previous: store.GetCurrentBlockHash(),
+			Height:   store.GetHeight() + 1,
+		},
+		Transactions: []*core.Transaction{
+			NewCoinBaseTransaction(new(core.PayloadCoinBase), store.GetHeight()+1), transfer,
+		},
+	}
+
+	// state root set after activation
+	err = SetStateRoot(block, parent)
+	assert.NoError(t, err)
+	assert.Equal(t, core.StateRootVersion, block.Header.Version)
+	assert.NotEqual(t, common.EmptyHash, block.Header.StateRoot)
+	assert.NoError(t, checkStateRoot(block, parent))
+
+	// state root committed by the header
+	buf := new(bytes.Buffer)
+	assert.NoError(t, block.Header.Serialize(buf))
+	var header core.Header
+	assert.NoError(t, header.Deserialize(buf))
+	assert.Equal(t, block.Header.StateRoot, header.StateRoot)
+	assert.Equal(t, block.Hash(), header.Hash())
+	header.StateRoot = common.Uint256{}
+	assert.NotEqual(t, block.Hash(), header.Hash())
+
+	// state root does not depend on the order of the deltas
+	reordered := &core.Block{Header: block.Header, Transactions: []*core.Transaction{
+		block.Transactions[1], block.Transactions[0],
+	}}
+	assert.NoError(t, checkStateRoot(reordered, parent))
+
+	// state root chained to the parent state root
+	hash := block.Hash()
+	child := &core.Block{Header: core.Header{Previous: hash, Height: block.Height + 1},
+		Transactions: block.Transactions[:1]}
+	err = SetStateRoot(child, NewBlockNode(&block.Header, &hash))
+	assert.NoError(t, err)
+	root, err := CalcStateRoot(common.EmptyHash, child)
+	assert.NoError(t, err)
+	assert.NotEqual(t, root, child.Header.StateRoot)
+
+	// mismatched state root
+	header = block.Header
+	header.StateRoot = common.Uint256{1}
+	err = checkStateRoot(&core.Block{Header: header, Transactions: block.Transactions}, parent)
+	assert.EqualError(t, err, fmt.Sprintf("block %d state root mismatch", block.Height))
+
+	// no state root after activation
+	header.Version = core.BlockVersion
+	err = checkStateRoot(&core.Block{Header: header, Transactions: block.Transactions}, parent)
+	assert.EqualError(t, err, fmt.Sprintf("block %d has no state root", block.Height))
+
+	// state root before activation
+	config.Parameters.ChainParam.StateRootHeight = block.Height + 1
+	err = checkStateRoot(block, parent)
+	assert.EqualError(t, err, fmt.Sprintf("block %d has a state root before the activation height", block.Height))
+
+	// state root read from the store
+	_, err = store.GetStateRoot(0)
+	assert.EqualError(t, err, "block 0 has no state root")
+	block.Transactions = block.Transactions[:1]
+	config.Parameters.ChainParam.StateRootHeight = block.Height
+	assert.NoError(t, SetStateRoot(block, parent))
+	err = store.persist(block)
+	assert.NoError(t, err)
+	root, err = store.GetStateRoot(block.Height)
+	assert.NoError(t, err)
+	assert.Equal(t, block.Header.StateRoot, root)
+	err = store.rollback(block)
+	assert.NoError(t, err)
+
+	t.Log("[TestStateRoot] PASSED")
+}
+
+func TestCheckConfirmedCrossChainInputs(t *testing.T) {
+	minCrossChainTxFee := config.Parameters.MinCrossChainTxFee
+	confirmedInputs := config.Parameters.ConfirmedCrossChainInputs
+	config.Parameters.MinCrossChainTxFee = 10000
+	defer func() {
+		config.Parameters.MinCrossChainTxFee = minCrossChainTxFee
+		config.Parameters.ConfirmedCrossChainInputs = confirmedInputs
+	}()
+	address, err := FoundationAddress.ToAddress()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	// deposit 10 ELA to foundation account
+	deposit := NewCoinBaseTransaction(new(core.PayloadCoinBase), 0)
+	deposit.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress,
+			Value: common.Fixed64(10 * ELA)},
+	}
+	DefaultLedger.Store.(*ChainStore).NewBatch()
+	DefaultLedger.Store.(*ChainStore).PersistTransaction(deposit, 0)
+	DefaultLedger.Store.(*ChainStore).BatchCommit()
+	defer func() {
+		DefaultLedger.Store.(*ChainStore).NewBatch()
+		DefaultLedger.Store.(*ChainStore).RollbackTransaction(deposit)
+		DefaultLedger.Store.(*ChainStore).BatchCommit()
+	}()
+
+	// unconfirmed transfer of 9 ELA to foundation account
+	parent := &core.Transaction{
+		TxType:  core.TransferAsset,
+		Payload: new(core.PayloadTransferAsset),
+		Inputs:  []*core.Input{{Previous: *core.NewOutPoint(deposit.Hash(), 0)}},
+		Outputs: []*core.Output{
+			{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress,
+				Value: common.Fixed64(9 * ELA)},
+		},
+	}
+	var pool TxPool
+	pool.Init()
+	pool.addToTxList(parent)
+
+	// withdraw 1 ELA from the first output of the referenced transaction
+	withdraw := func(refer *core.Transaction) *core.Transaction {
+		value := common.Fixed64(ELA) + crossChainTxFee()
+		return &core.Transaction{
+			TxType: core.TransferCrossChainAsset,
+			Payload: &core.PayloadTransferCrossChainAsset{
+				CrossChainAddresses: []string{address},
+				OutputIndexes:       []uint64{0},
+				CrossChainAmounts:   []common.Fixed64{common.Fixed64(ELA)},
+			},
+			Inputs: []*core.Input{{Previous: *core.NewOutPoint(refer.Hash(), 0)}},
+			Outputs: []*core.Output{
+				{AssetID: DefaultLedger.Blockchain.AssetID, Value: value},
+				{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress,
+					Value: refer.Outputs[0].Value - value - crossChainTxFee()},
+			},
+		}
+	}
+
+	// case 1: spending a confirmed output
+	config.Parameters.ConfirmedCrossChainInputs = true
+	assert.NoError(t, checkTransferCrossChainAssetTransaction(withdraw(deposit), 0, &pool))
+
+	// case 2: spending an unconfirmed output
+	err = checkTransferCrossChainAssetTransaction(withdraw(parent), 0, &pool)
+	ruleErr, ok := err.(RuleError)
+	if assert.True(t, ok) {
+		assert.Equal(t, ErrUnconfirmedInput, ruleErr.ErrorCode)
+		assert.Contains(t, ruleErr.Error(), parent.Hash().String()+":0")
+	}
+
+	// case 3: spending an unconfirmed output is allowed without the flag
+	config.Parameters.ConfirmedCrossChainInputs = false
+	assert.NoError(t, checkTransferCrossChainAssetTransaction(withdraw(parent), 0, &pool))
+
+	t.Log("[TestCheckConfirmedCrossChainInputs] PASSED")
+}
+
+func TestCheckRechargePayloadVersion(t *testing.T) {
+	batchRechargeHeight := config.Parameters.ChainParam.BatchRechargeHeight
+	defer func() { config.Parameters.ChainParam.BatchRechargeHeight = batchRechargeHeight }()
+
+	tx := &core.Transaction{
+		TxType:         core.RechargeToSideChain,
+		PayloadVersion: core.RechargeToSideChainBatchPayloadVersion,
+		Payload:        new(core.PayloadRechargeToSideChain),
+	}
+
+	// case 1: the batched payload is disabled
+	config.Parameters.ChainParam.BatchRechargeHeight = 0
+	assert.Error(t, checkRechargePayloadVersion(tx, 100))
+
+	// case 2: before and from the activation height
+	config.Parameters.ChainParam.BatchRechargeHeight = 100
+	assert.Error(t, checkRechargePayloadVersion(tx, 98))
+	assert.NoError(t, checkRechargePayloadVersion(tx, 99))
+
+	// case 3: the single deposit payload is always valid
+	config.Parameters.ChainParam.BatchRechargeHeight = 0
+	tx.PayloadVersion = core.RechargeToSideChainPayloadVersion
+	assert.NoError(t, checkRechargePayloadVersion(tx, 0))
+
+	t.Log("[TestCheckRechargePayloadVersion] PASSED")
+}
+
+func TestValidateTransactionStream(t *testing.T) {
+	maxBlockSize := config.Parameters.MaxBlockSize
+	maxTxInBlock := config.Parameters.MaxTxInBlock
+	config.Parameters.MaxBlockSize = 8000000
+	config.Parameters.MaxTxInBlock = 10000
+	defer func() {
+		config.Parameters.MaxBlockSize = maxBlockSize
+		config.Parameters.MaxTxInBlock = maxTxInBlock
+	}()
+	height := DefaultLedger.Store.GetHeight() + 1
+
+	coinbase := NewCoinBaseTransaction(new(core.PayloadCoinBase), height)
+	coinbase.Inputs[0].Previous.Index = math.MaxUint16
+	coinbase.Outputs = []*core.Output{
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: FoundationAddress},
+		{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: common.Uint168{}},
+	}
+	newTx := func() *core.Transaction {
+		tx := &core.Transaction{
+			TxType:  core.TransferAsset,
+			Payload: new(core.PayloadTransferAsset),
+			Outputs: []*core.Output{
+				{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: common.Uint168{}, Value: common.Fixed64(ELA)},
+			},
+		}
+		for i := 0; i < 1000; i++ {
+			var txId common.Uint256
+			rand.Read(txId[:])
+			tx.Inputs = append(tx.Inputs, &core.Input{
+				Previous: *core.NewOutPoint(txId, 0), Sequence: math.MaxUint32,
+			})
+		}
+		return tx
+	}
+	// stream writes the block body through a pipe, so the block is never
+	// held in memory as a whole
+	stream := func(txs ...*core.Transaction) io.Reader {
+		r, w := io.Pipe()
+		go func() {
+			if err := common.WriteVarUint(w, uint64(len(txs))); err != nil {
+				w.CloseWithError(err)
+				return
+			}
+			for _, tx := range txs {
+				if err := tx.Serialize(w); err != nil {
+					w.CloseWithError(err)
+					return
+				}
+			}
+			w.Close()
+		}()
+		return r
+	}
+
+	// case: a block of several megabytes
+	txs := []*core.Transaction{coinbase}
+	size := coinbase.GetSize()
+	for size < 4000000 {
+		tx := newTx()
+		txs = append(txs, tx)
+		size += tx.GetSize()
+	}
+	err := ValidateTransactionStream(stream(txs...), height)
+	assert.NoError(t, err)
+
+	// case: UTXO spent twice in the block
+	tx := newTx()
+	tx.Inputs[0].Previous = txs[1].Inputs[0].Previous
+	err = ValidateTransactionStream(stream(coinbase, txs[1], tx), height)
+	assert.EqualError(t, err, fmt.Sprintf("[ValidateBlockTransactions] block contains duplicate UTXO %s:%d",
+		tx.Inputs[0].Previous.TxID.String(), tx.Inputs[0].Previous.Index))
+
+	// case: the first transaction is not a coinbase
+	err = ValidateTransactionStream(stream(txs[1], txs[2]), height)
+	assert.EqualError(t, err, "[ValidateTransactionStream] first transaction in block is not a coinbase")
+
+	// case: second coinbase
+	err = ValidateTransactionStream(stream(coinbase, txs[1], coinbase), height)
+	assert.EqualError(t, err, "[ValidateTransactionStream] block contains second coinbase")
+
+	// case: over the max block size
+	config.Parameters.MaxBlockSize = size - 1
+	err = ValidateTransactionStream(stream(txs...), height)
+	assert.EqualError(t, err, "[ValidateTransactionStream] serialized block is too big")
+	config.Parameters.MaxBlockSize = 8000000
+
+	// case: truncated block body
+	r, w := io.Pipe()
+	go func() {
+		common.WriteVarUint(w, 2)
+		coinbase.Serialize(w)
+		w.Close()
+	}()
+	err = ValidateTransactionStream(r, height)
+	assert.Error(t, err)
+
+	t.Log("[TestValidateTransactionStream] PASSED")
+}
+
+func TestRuleErrorCodes(t *testing.T) {
+	maxBlockSize := config.Parameters.MaxBlockSize
+	defer func() {
+		config.Parameters.MaxBlockSize = maxBlockSize
+	}()
+
+	newTx := func() *core.Transaction {
+		tx := buildTx()
+		tx.Outputs = []*core.Output{
+			{AssetID: DefaultLedger.Blockchain.AssetID, ProgramHash: common.Uint168{}, Value: common.Fixed64(ELA)},
+		}
+		return tx
+	}
+	expiry := func(height uint32) *core.Attribute {
+		buf := new(bytes.Buffer)
+		common.WriteUint32(buf, height)
+		attr := core.NewAttribute(core.Expiry, buf.Bytes())
+		return &attr
+	}
+
+	// one transaction of each rejection class
+	sanityCases := []struct {
+		code   ErrCode
+		modify func(tx *core.Transaction)
+	}{
+		{ErrTransactionSize, func(tx *core.Transaction) { config.Parameters.MaxBlockSize = 10 }},
+		{ErrInvalidInput, func(tx *core.Transaction) { tx.Inputs = append(tx.Inputs, tx.Inputs[0]) }},
+		{ErrInvalidOutput, func(tx *core.Transaction) { tx.Outputs[0].AssetID = common.EmptyHash }},
+		{ErrAttributeProgram, func(tx *core.Transaction) {
+			tx.Attributes = []*core.Attribute{{Usage: 0xff, Data: []byte{0x01}}}
+		}},
+		{ErrTransactionPayload, func(tx *core.Transaction) {
+			tx.Payload = &core.PayloadRegisterAsset{Asset: core.Asset{Precision: core.MaxPrecision + 1}}
+		}},
+	}
+	for _, c := range sanityCases {
+		tx := newTx()
+		c.modify(tx)
+		assert.Equal(t, c.code, CheckTransactionSanity(tx), c.code.RuleMessage())
+		config.Parameters.MaxBlockSize = maxBlockSize
+	}
+
+	contextCases := []struct {
+		code   ErrCode
+		modify func(tx *core.Transaction)
+	}{
+		{ErrTransactionExpired, func(tx *core.Transaction) { tx.Attributes = []*core.Attribute{expiry(9)} }},
+		{ErrTransactionLocked, func(tx *core.Transaction) {
+			tx.LockTime = 100
+			tx.Inputs[0].Sequence = math.MaxUint32 - 1
+		}},
+		{ErrTransactionSignature, func(tx *core.Transaction) {}},
+	}
+	for _, c := range contextCases {
+		tx := newTx()
+		c.modify(tx)
+		assert.Equal(t, c.code, CheckTransactionContextAtHeight(tx, 10), c.code.RuleMessage())
+	}
+
+	// the rule error keeps the code of the rejected transaction
+	block := &core.Block{Transactions: []*core.Transaction{newTx()}}
+	block.Transactions[0].Outputs[0].AssetID = common.EmptyHash
+	err := DefaultLedger.Blockchain.ConnectBlock(nil, block)
+	ruleErr, ok := err.(RuleError)
+	if assert.True(t, ok) {
+		assert.Equal(t, ErrInvalidOutput, ruleErr.ErrorCode)
+	}
+
+	t.Log("[TestRuleErrorCodes] PASSED")
+}
+
 func TestTxValidatorDone(t *testing.T) {
 	DefaultLedger.Store.Close()
 }
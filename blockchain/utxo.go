@@ -3,6 +3,8 @@ package blockchain
 import (
 	"io"
 
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
@@ -31,3 +33,12 @@ func (uu *UTXO) Deserialize(r io.Reader) error {
 
 	return nil
 }
+
+// UnspentOutput is an unspent output of a program hash with the height of the
+// block it was confirmed in.
+type UnspentOutput struct {
+	OutPoint core.OutPoint
+	AssetID  Uint256
+	Value    Fixed64
+	Height   uint32
+}
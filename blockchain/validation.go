@@ -6,7 +6,6 @@ import (
 	"sort"
 
 	"github.com/elastos/Elastos.ELA.SideChain/core"
-	"github.com/elastos/Elastos.ELA.SideChain/spv"
 	"github.com/elastos/Elastos.ELA.SideChain/vm"
 
 	. "github.com/elastos/Elastos.ELA.Utility/common"
@@ -14,16 +13,34 @@ import (
 )
 
 func VerifySignature(tx *core.Transaction) error {
-	if tx.IsRechargeToSideChainTx() {
-		if err := spv.VerifyTransaction(tx); err != nil {
+	return verifySignature(tx, nil)
+}
+
+// verifySignature verifies the signatures of the transaction, the referenced
+// outputs not in ledger are looked up in the view.
+func verifySignature(tx *core.Transaction, view MempoolView) error {
+	jobs, err := signatureJobs(tx, view)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if err := job.verify(); err != nil {
 			return err
 		}
-		return nil
 	}
+	return nil
+}
 
-	hashes, err := GetTxProgramHashes(tx)
+// signatureJobs returns the jobs to verify the signatures of the transaction.
+func signatureJobs(tx *core.Transaction, view MempoolView) ([]*sigJob, error) {
+	if tx.IsRechargeToSideChainTx() {
+		return []*sigJob{{tx: tx}}, nil
+	}
+
+	hashes, err := getTxProgramHashes(tx, view)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Add ID program hash to hashes
@@ -39,10 +56,17 @@ func VerifySignature(tx *core.Transaction) error {
 	// Sort first
 	SortProgramHashes(hashes)
 	if err := SortPrograms(tx.Programs); err != nil {
-		return err
+		return nil, err
 	}
 
-	return RunPrograms(tx, hashes, tx.Programs)
+	if len(hashes) != len(tx.Programs) {
+		return nil, errors.New("The number of data hashes is different with number of programs.")
+	}
+	jobs := make([]*sigJob, 0, len(hashes))
+	for i, hash := range hashes {
+		jobs = append(jobs, &sigJob{tx: tx, hash: hash, program: tx.Programs[i]})
+	}
+	return jobs, nil
 }
 
 func RunPrograms(tx *core.Transaction, hashes []Uint168, programs []*core.Program) error {
@@ -54,45 +78,116 @@ func RunPrograms(tx *core.Transaction, hashes []Uint168, programs []*core.Progra
 	}
 
 	for i := 0; i < len(programs); i++ {
-		programHash, err := crypto.ToProgramHash(programs[i].Code)
-		if err != nil {
+		if err := runProgram(tx, hashes[i], programs[i]); err != nil {
 			return err
 		}
+	}
 
-		if !hashes[i].IsEqual(*programHash) {
-			return errors.New("The data hashes is different with corresponding program code.")
-		}
-		//execute program on VM
-		se := vm.NewExecutionEngine(tx.GetDataContainer(programHash), new(vm.CryptoECDsa), vm.MAXSTEPS, nil, nil)
-		se.LoadScript(programs[i].Code, false)
-		se.LoadScript(programs[i].Parameter, true)
-		se.Execute()
-
-		if se.GetState() != vm.HALT {
-			return errors.New("[VM] Finish State not equal to HALT.")
-		}
+	return nil
+}
 
-		if se.GetEvaluationStack().Count() != 1 {
-			return errors.New("[VM] Execute Engine Stack Count Error.")
-		}
+func runProgram(tx *core.Transaction, hash Uint168, program *core.Program) error {
+	programHash, err := crypto.ToProgramHash(program.Code)
+	if err != nil {
+		return err
+	}
 
-		success := se.GetExecuteResult()
-		if !success {
-			return errors.New("[VM] Check Sig FALSE.")
-		}
+	if !hash.IsEqual(*programHash) {
+		return errors.New("The data hashes is different with corresponding program code.")
+	}
+	//execute program on VM
+	se := vm.NewExecutionEngine(tx.GetDataContainer(programHash), new(vm.CryptoECDsa), vm.MAXSTEPS, nil, nil)
+	se.LoadScript(program.Code, false)
+	se.LoadScript(program.Parameter, true)
+	se.Execute()
+
+	if se.GetState() != vm.HALT {
+		return errors.New("[VM] Finish State not equal to HALT.")
+	}
+
+	if se.GetEvaluationStack().Count() != 1 {
+		return errors.New("[VM] Execute Engine Stack Count Error.")
+	}
+
+	success := se.GetExecuteResult()
+	if !success {
+		return errors.New("[VM] Check Sig FALSE.")
 	}
 
 	return nil
 }
 
+// MultiSigDetail is the signature detail of a multi signature program.
+type MultiSigDetail struct {
+	Required int // the m signatures required
+	Provided int // the signatures in the program parameter
+	Valid    int // the signatures matching distinct public keys
+}
+
+// VerifyMultiSigDetail counts the signatures of a multi signature program
+// which are valid against the transaction.
+func VerifyMultiSigDetail(tx *core.Transaction, programHash Uint168, program *core.Program) (*MultiSigDetail, error) {
+	multisig, err := ParseMultisigProgram(program.Code)
+	if err != nil {
+		return nil, err
+	}
+	if multisig.M < 1 || multisig.M > multisig.N {
+		return nil, errors.New("invalid multisig program code")
+	}
+	param := program.Parameter
+	if len(param)%crypto.SignatureScriptLength != 0 {
+		return nil, errors.New("invalid multisig program parameter")
+	}
+
+	pubKeys := append([][]byte{}, multisig.PublicKeys...)
+	detail := &MultiSigDetail{Required: multisig.M, Provided: len(param) / crypto.SignatureScriptLength}
+	data := tx.GetDataContainer(&programHash).GetData()
+	for i := 0; i < detail.Provided; i++ {
+		signature := param[i*crypto.SignatureScriptLength+1 : (i+1)*crypto.SignatureScriptLength]
+		for j, pubKey := range pubKeys {
+			if new(vm.CryptoECDsa).VerifySignature(data, signature, pubKey) == nil {
+				detail.Valid++
+				pubKeys = append(pubKeys[:j], pubKeys[j+1:]...)
+				break
+			}
+		}
+	}
+	return detail, nil
+}
+
+// multiSigError returns a precise error of a failed multi signature program,
+// or the original error if the program is not a multi signature program.
+func multiSigError(tx *core.Transaction, programHash Uint168, program *core.Program, err error) error {
+	if hash, e := crypto.ToProgramHash(program.Code); e != nil || !hash.IsEqual(programHash) {
+		return err
+	}
+	detail, e := VerifyMultiSigDetail(tx, programHash, program)
+	if e != nil {
+		return err
+	}
+	if detail.Provided < detail.Required {
+		return fmt.Errorf("not enough signatures for multisig, %d valid of %d required",
+			detail.Valid, detail.Required)
+	}
+	if detail.Valid < detail.Provided {
+		return fmt.Errorf("invalid signature for multisig, %d valid of %d required",
+			detail.Valid, detail.Required)
+	}
+	return err
+}
+
 func GetTxProgramHashes(tx *core.Transaction) ([]Uint168, error) {
+	return getTxProgramHashes(tx, nil)
+}
+
+func getTxProgramHashes(tx *core.Transaction, view MempoolView) ([]Uint168, error) {
 	if tx == nil {
 		return nil, errors.New("[Transaction],GetProgramHashes transaction is nil.")
 	}
 	hashes := make([]Uint168, 0)
 	uniqueHashes := make([]Uint168, 0)
 	// add inputUTXO's transaction
-	references, err := DefaultLedger.Store.GetTxReference(tx)
+	references, err := DefaultLedger.Store.GetTxReferenceWithView(tx, view)
 	if err != nil {
 		return nil, errors.New("[Transaction], GetProgramHashes failed.")
 	}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
 	math "math/rand"
 	"sort"
 	"testing"
@@ -189,6 +190,97 @@ func TestCheckMultiSigSignature(t *testing.T) {
 	t.Log("TestCheckMultisigSignature passed")
 }
 
+func TestVerifyMultiSigDetail(t *testing.T) {
+	tx := buildTx()
+	act := newMultiAccount(3, t)
+	signature, err := act.Sign(getData(tx))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	required := int(act.redeemScript[0]-crypto.PUSH1) + 1
+	verify := func(parameter []byte) (*MultiSigDetail, error) {
+		program := &core.Program{Code: act.redeemScript, Parameter: parameter}
+		job := &sigJob{tx: tx, hash: *act.programHash, program: program}
+		detail, err := VerifyMultiSigDetail(tx, *act.programHash, program)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return detail, job.verify()
+	}
+
+	// under threshold
+	detail, err := verify(signature[:crypto.SignatureScriptLength*(required-1)])
+	assert.Equal(t, MultiSigDetail{Required: required, Provided: required - 1, Valid: required - 1}, *detail)
+	assert.EqualError(t, err, fmt.Sprintf("not enough signatures for multisig, %d valid of %d required",
+		required-1, required))
+
+	// exact threshold
+	detail, err = verify(signature[:crypto.SignatureScriptLength*required])
+	assert.Equal(t, MultiSigDetail{Required: required, Provided: required, Valid: required}, *detail)
+	assert.NoError(t, err)
+
+	// invalid but sufficient count
+	fakeSignature := make([]byte, crypto.SignatureScriptLength*required)
+	copy(fakeSignature, signature)
+	rand.Read(fakeSignature[crypto.SignatureScriptLength+1 : crypto.SignatureScriptLength*2])
+	detail, err = verify(fakeSignature)
+	assert.Equal(t, MultiSigDetail{Required: required, Provided: required, Valid: required - 1}, *detail)
+	assert.EqualError(t, err, fmt.Sprintf("invalid signature for multisig, %d valid of %d required",
+		required-1, required))
+
+	// not a multisig program
+	single := newAccount(t)
+	_, err = VerifyMultiSigDetail(tx, *single.programHash, &core.Program{Code: single.redeemScript})
+	assert.EqualError(t, err, "not a multisig program code")
+
+	t.Log("[TestVerifyMultiSigDetail] PASSED")
+}
+
+func TestValidateMultisigProgram(t *testing.T) {
+	act := newMultiAccount(3, t)
+	keyLength := crypto.PublicKeyScriptLength - 1
+	withKeys := func(i, j int) []byte {
+		code := append([]byte{}, act.redeemScript...)
+		copy(code[1+i*keyLength:1+(i+1)*keyLength], act.redeemScript[1+j*keyLength:1+(j+1)*keyLength])
+		copy(code[1+j*keyLength:1+(j+1)*keyLength], act.redeemScript[1+i*keyLength:1+(i+1)*keyLength])
+		return code
+	}
+
+	// 2 of 3
+	program, err := ParseMultisigProgram(act.redeemScript)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, program.M)
+	assert.Equal(t, 3, program.N)
+	assert.Len(t, program.PublicKeys, 3)
+	assert.NoError(t, ValidateMultisigProgram(act.redeemScript))
+
+	// duplicate keys
+	code := append([]byte{}, act.redeemScript...)
+	copy(code[1+keyLength:1+2*keyLength], code[1:1+keyLength])
+	assert.EqualError(t, ValidateMultisigProgram(code), "duplicate multisig public key 1")
+
+	// unsorted keys
+	assert.EqualError(t, ValidateMultisigProgram(withKeys(0, 1)), "multisig public key 1 is not sorted")
+
+	// M > N
+	code = append([]byte{}, act.redeemScript...)
+	code[0] = crypto.PUSH1 + 3
+	assert.EqualError(t, ValidateMultisigProgram(code), "invalid multisig 4 of 3")
+
+	// N not matching the keys
+	code = append([]byte{}, act.redeemScript...)
+	code[len(code)-2] = crypto.PUSH1 + 3
+	assert.EqualError(t, ValidateMultisigProgram(code), "invalid multisig program code length")
+
+	// rejected at sanity check
+	tx := buildTx()
+	tx.Programs = []*core.Program{{Code: withKeys(0, 2), Parameter: []byte{}}}
+	assert.EqualError(t, CheckAttributeProgram(tx, 0),
+		"invalid multisig program code, multisig public key 1 is not sorted")
+
+	t.Log("[TestValidateMultisigProgram] PASSED")
+}
+
 func TestRunPrograms(t *testing.T) {
 	var err error
 	var tx *core.Transaction
@@ -297,7 +389,7 @@ func TestRunPrograms(t *testing.T) {
 	t.Log("TestRunPrograms passed")
 }
 
-func newAccount(t *testing.T) *account {
+func newAccount(t testing.TB) *account {
 	a := new(account)
 	var err error
 	a.private, a.public, err = crypto.GenerateKeyPair()
@@ -10,26 +10,37 @@ import (
 	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
 )
 
-// NewMerkleBlock returns a new *MerkleBlock
+// NewMerkleBlock returns a new *MerkleBlock of the transactions of the block
+// matching the filter, and the indexes of the matched transactions. The
+// transaction ids, the output program hashes and the spent outpoints are
+// matched against the filter.
 func NewMerkleBlock(block *core.Block, filter *Filter) (*msg.MerkleBlock, []uint32) {
-	NumTx := uint32(len(block.Transactions))
-	mBlock := MBlock{
-		NumTx:       NumTx,
-		AllHashes:   make([]*common.Uint256, 0, NumTx),
-		MatchedBits: make([]byte, 0, NumTx),
-	}
+	hashes := make([]*common.Uint256, 0, len(block.Transactions))
+	matchedBits := make([]byte, 0, len(block.Transactions))
 
 	// Find and keep track of any transactions that match the filter.
 	var matchedIndexes []uint32
 	for index, tx := range block.Transactions {
 		if filter.MatchTxAndUpdate(tx) {
-			mBlock.MatchedBits = append(mBlock.MatchedBits, 0x01)
+			matchedBits = append(matchedBits, 0x01)
 			matchedIndexes = append(matchedIndexes, uint32(index))
 		} else {
-			mBlock.MatchedBits = append(mBlock.MatchedBits, 0x00)
+			matchedBits = append(matchedBits, 0x00)
 		}
 		txHash := tx.Hash()
-		mBlock.AllHashes = append(mBlock.AllHashes, &txHash)
+		hashes = append(hashes, &txHash)
+	}
+
+	return newMerkleBlock(&block.Header, hashes, matchedBits), matchedIndexes
+}
+
+// newMerkleBlock builds the partial merkle tree of the transaction hashes
+// proving the transactions whose matched bit is set.
+func newMerkleBlock(header *core.Header, hashes []*common.Uint256, matchedBits []byte) *msg.MerkleBlock {
+	mBlock := MBlock{
+		NumTx:       uint32(len(hashes)),
+		AllHashes:   hashes,
+		MatchedBits: matchedBits,
 	}
 
 	// Calculate the number of merkle branches (height) in the tree.
@@ -43,19 +54,26 @@ func NewMerkleBlock(block *core.Block, filter *Filter) (*msg.MerkleBlock, []uint
 
 	// Create and return the merkle block.
 	merkleBlock := &msg.MerkleBlock{
-		Header:       &block.Header,
+		Header:       header,
 		Transactions: mBlock.NumTx,
 		Hashes:       make([]*common.Uint256, 0, len(mBlock.FinalHashes)),
-		Flags:        make([]byte, (len(mBlock.Bits)+7)/8),
+		Flags:        packFlags(mBlock.Bits),
 	}
 	for _, hash := range mBlock.FinalHashes {
 		merkleBlock.Hashes = append(merkleBlock.Hashes, hash)
 	}
-	for i := uint32(0); i < uint32(len(mBlock.Bits)); i++ {
-		merkleBlock.Flags[i/8] |= mBlock.Bits[i] << (i % 8)
-	}
+	return merkleBlock
+}
 
-	return merkleBlock, matchedIndexes
+// packFlags packs the depth-first traversal bits of a partial merkle tree
+// into the flag bytes of a merkle block, the first bit is the least
+// significant bit of the first byte.
+func packFlags(bits []byte) []byte {
+	flags := make([]byte, (len(bits)+7)/8)
+	for i := 0; i < len(bits); i++ {
+		flags[i/8] |= bits[i] << uint(i%8)
+	}
+	return flags
 }
 
 type merkleNode struct {
@@ -0,0 +1,74 @@
+package bloom
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackFlags(t *testing.T) {
+	vectors := []struct {
+		bits  []byte
+		flags []byte
+	}{
+		{bits: nil, flags: []byte{}},
+		{bits: []byte{1}, flags: []byte{0x01}},
+		{bits: []byte{0}, flags: []byte{0x00}},
+		{bits: []byte{1, 0, 1, 1, 0}, flags: []byte{0x0d}},
+		{bits: []byte{1, 1, 1, 1, 1, 1, 1, 1}, flags: []byte{0xff}},
+		{bits: []byte{1, 1, 1, 1, 0, 0, 0, 0, 1}, flags: []byte{0x0f, 0x01}},
+	}
+	for i, v := range vectors {
+		assert.Equal(t, v.flags, packFlags(v.bits), "vector %d", i)
+	}
+
+	t.Log("[TestPackFlags] PASSED")
+}
+
+func TestNewMerkleBlock_Flags(t *testing.T) {
+	hashes := make([]*common.Uint256, 4)
+	for i := range hashes {
+		hashes[i] = &common.Uint256{byte(i + 1)}
+	}
+	h01 := HashMerkleBranches(hashes[0], hashes[1])
+	h23 := HashMerkleBranches(hashes[2], hashes[3])
+	root := HashMerkleBranches(h01, h23)
+	header := &core.Header{MerkleRoot: *root}
+
+	// case 1: the third transaction matched, the left branch is pruned
+	merkleBlock := newMerkleBlock(header, hashes, []byte{0, 0, 1, 0})
+	assert.Equal(t, uint32(4), merkleBlock.Transactions)
+	assert.Equal(t, []byte{0x0d}, merkleBlock.Flags)
+	assert.Equal(t, []*common.Uint256{h01, hashes[2], hashes[3]}, merkleBlock.Hashes)
+	txIds, err := CheckMerkleBlock(*merkleBlock)
+	assert.NoError(t, err)
+	assert.Equal(t, []*common.Uint256{hashes[2]}, txIds)
+
+	// case 2: no transaction matched, only the root is sent
+	merkleBlock = newMerkleBlock(header, hashes, []byte{0, 0, 0, 0})
+	assert.Equal(t, []byte{0x00}, merkleBlock.Flags)
+	assert.Equal(t, []*common.Uint256{root}, merkleBlock.Hashes)
+
+	// case 3: all the transactions matched
+	merkleBlock = newMerkleBlock(header, hashes, []byte{1, 1, 1, 1})
+	assert.Equal(t, []byte{0x7f}, merkleBlock.Flags)
+	assert.Equal(t, hashes, merkleBlock.Hashes)
+	txIds, err = CheckMerkleBlock(*merkleBlock)
+	assert.NoError(t, err)
+	assert.Equal(t, hashes, txIds)
+
+	// case 4: odd number of transactions, the last one is hashed with itself
+	h22 := HashMerkleBranches(hashes[2], hashes[2])
+	header = &core.Header{MerkleRoot: *HashMerkleBranches(h01, h22)}
+	merkleBlock = newMerkleBlock(header, hashes[:3], []byte{0, 0, 1})
+	assert.Equal(t, []byte{0x0d}, merkleBlock.Flags)
+	assert.Equal(t, []*common.Uint256{h01, hashes[2]}, merkleBlock.Hashes)
+	txIds, err = CheckMerkleBlock(*merkleBlock)
+	assert.NoError(t, err)
+	assert.Equal(t, []*common.Uint256{hashes[2]}, txIds)
+
+	t.Log("[TestNewMerkleBlock_Flags] PASSED")
+}
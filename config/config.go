@@ -15,40 +15,75 @@ const (
 )
 
 var (
+	// mainChainAddressPrefixes are the program hash prefixes of the standard
+	// and multi-sign addresses of the main chain.
+	mainChainAddressPrefixes = []byte{0x21, 0x12}
+
 	Parameters configParams
 	Version    string
 	mainNet    = &ChainParams{
 		Name:               "MainNet",
+		Magic:              7630400,
+		NodePort:           20608,
+		HttpInfoPort:       20603,
+		HttpRestPort:       20604,
+		HttpWsPort:         20605,
+		HttpJsonPort:       20606,
+		FoundationAddress:  "8VYXVxKKSAxkmRrfmGpQR2Kc66XhG6m3ta",
 		PowLimit:           new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1)),
 		PowLimitBits:       0x1f0008ff,
 		TargetTimespan:     time.Second * 60 * 2 * 720,
 		TargetTimePerBlock: time.Second * 60 * 2,
 		AdjustmentFactor:   int64(4),
 		MaxOrphanBlocks:    10000,
+		MaxOrphanTxs:       1000,
 		MinMemoryNodes:     20160,
 		SpendCoinbaseSpan:  100,
+		AddressPrefixes:    mainChainAddressPrefixes,
 	}
 	testNet = &ChainParams{
-		Name:               "TestNet",
-		PowLimit:           new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1)),
-		PowLimitBits:       0x1e1da5ff,
-		TargetTimespan:     time.Second * 10 * 10,
-		TargetTimePerBlock: time.Second * 10,
-		AdjustmentFactor:   int64(4),
-		MaxOrphanBlocks:    10000,
-		MinMemoryNodes:     20160,
-		SpendCoinbaseSpan:  100,
+		Name:                 "TestNet",
+		Magic:                7630402,
+		NodePort:             20338,
+		HttpInfoPort:         20333,
+		HttpRestPort:         20334,
+		HttpWsPort:           20335,
+		HttpJsonPort:         20336,
+		FoundationAddress:    "8ZNizBf4KhhPjeJRGpox6rPcHE5Np6tFx3",
+		PowLimit:             new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1)),
+		PowLimitBits:         0x1e1da5ff,
+		TargetTimespan:       time.Second * 10 * 10,
+		TargetTimePerBlock:   time.Second * 10,
+		AdjustmentFactor:     int64(4),
+		ReduceMinDifficulty:  true,
+		MinDiffReductionTime: time.Second * 10 * 2,
+		MaxOrphanBlocks:      10000,
+		MaxOrphanTxs:         1000,
+		MinMemoryNodes:       20160,
+		SpendCoinbaseSpan:    100,
+		AddressPrefixes:      mainChainAddressPrefixes,
 	}
 	regNet = &ChainParams{
 		Name:               "RegNet",
+		AllowGenerate:      true,
+		Magic:              7630404,
+		SeedList:           []string{"127.0.0.1:21338"},
+		NodePort:           21338,
+		HttpInfoPort:       21333,
+		HttpRestPort:       21334,
+		HttpWsPort:         21335,
+		HttpJsonPort:       21336,
+		FoundationAddress:  "8ZNizBf4KhhPjeJRGpox6rPcHE5Np6tFx3",
 		PowLimit:           new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1)),
 		PowLimitBits:       0x207fffff,
 		TargetTimespan:     time.Second * 1 * 10,
 		TargetTimePerBlock: time.Second * 1,
 		AdjustmentFactor:   int64(4),
 		MaxOrphanBlocks:    10000,
+		MaxOrphanTxs:       1000,
 		MinMemoryNodes:     20160,
 		SpendCoinbaseSpan:  100,
+		AddressPrefixes:    mainChainAddressPrefixes,
 	}
 )
 
@@ -101,22 +136,217 @@ type Configuration struct {
 	PowConfiguration           PowConfiguration `json:"PowConfiguration"`
 	FoundationAddress          string           `json:"FoundationAddress"`
 	MainChainFoundationAddress string           `json:"MainChainFoundationAddress"`
+	RelativeLockHeight         uint32           `json:"RelativeLockHeight"`
+	EnableRBF                  bool             `json:"EnableRBF"`
+	MaxTxChainDepth            int              `json:"MaxTxChainDepth"`
+	MaxTxAncestors             int              `json:"MaxTxAncestors"`
+	MaxTxDescendants           int              `json:"MaxTxDescendants"`
+	MaxTxAncestorSize          int              `json:"MaxTxAncestorSize"`
+	MaxRechargeTxInBlock       int              `json:"MaxRechargeTransactionInBlock"`
+	MaxRegisteredAssets        uint32           `json:"MaxRegisteredAssets"`
+	DustThreshold              int64            `json:"DustThreshold"`
+	AssetDustThresholds        map[string]int64 `json:"AssetDustThresholds"`
+	EnableMergedMining         bool             `json:"EnableMergedMining"`
+	AuxPowChainID              int              `json:"AuxPowChainID"`
+	AssetFeeRates              map[string]int64 `json:"AssetFeeRates"`
+	MaxBlockTimeOffset         int              `json:"MaxBlockTimeOffset"`
+	MaxTxOutputs               int              `json:"MaxTxOutputs"`
+	DisableCheckpoints         bool             `json:"DisableCheckpoints"`
+	PruneMode                  bool             `json:"PruneMode"`
+	PruneRetention             uint32           `json:"PruneRetention"`
+	MaxReorgDepth              uint32           `json:"MaxReorgDepth"`
+	MaxRecordDataSize          int              `json:"MaxRecordDataSize"`
+	AllowedRecordTypes         []string         `json:"AllowedRecordTypes"`
+	MinAssetNameLength         int              `json:"MinAssetNameLength"`
+	MaxAssetNameLength         int              `json:"MaxAssetNameLength"`
+	AssetNameCharset           string           `json:"AssetNameCharset"`
+	MaxAssetDescriptionLength  int              `json:"MaxAssetDescriptionLength"`
+	MaxCrossChainOutputs       int              `json:"MaxCrossChainOutputs"`
+	RechargeConfirmations      uint32           `json:"RechargeConfirmations"`
+	MaxNormalTxSize            int              `json:"MaxNormalTxSize"`
+	MaxRechargeTxSize          int              `json:"MaxRechargeTxSize"`
+	MaxStandardAttributeSize   int              `json:"MaxStandardAttributeSize"`
+	MaxStandardCodeSize        int              `json:"MaxStandardCodeSize"`
+	MaxStandardParameterSize   int              `json:"MaxStandardParameterSize"`
+	MaxStandardTxPrograms      int              `json:"MaxStandardTxPrograms"`
+	StandardAttributeUsages    []byte           `json:"StandardAttributeUsages"`
+	MaxMemoSize                int              `json:"MaxMemoSize"`
+	MemoFeePerByte             int              `json:"MemoFeePerByte"`
+	CoinbaseMaturities         map[string]int   `json:"CoinbaseMaturities"`
+	RewardRules                []RewardRule     `json:"RewardRules"`
+	MaxWsSubscriptions         int              `json:"MaxWsSubscriptions"`
+	MaxTxFeePerKB              int64            `json:"MaxTxFeePerKB"`
+	ConfirmedCrossChainInputs  bool             `json:"ConfirmedCrossChainInputs"`
+	MaxRpcBatchSize            int              `json:"MaxRpcBatchSize"`
+	MaxRpcBatchResponseSize    int              `json:"MaxRpcBatchResponseSize"`
+	RpcBatchWorkers            int              `json:"RpcBatchWorkers"`
+	ArbitratorsAddress         string           `json:"ArbitratorsAddress"`
+	DisableHttpRest            bool             `json:"DisableHttpRest"`
+	HttpAllowedOrigins         []string         `json:"HttpAllowedOrigins"`
+	HttpAllowedMethods         []string         `json:"HttpAllowedMethods"`
+	HttpUser                   string           `json:"HttpUser"`
+	HttpPass                   string           `json:"HttpPass"`
+	HttpOpenReadOnly           bool             `json:"HttpOpenReadOnly"`
+	HttpCertPath               string           `json:"HttpCertPath"`
+	HttpKeyPath                string           `json:"HttpKeyPath"`
+	OutputProgramHashPrefixes  []byte           `json:"OutputProgramHashPrefixes"`
+	MainChainGenesisHash       string           `json:"MainChainGenesisHash"`
+	GenesisAssetName           string           `json:"GenesisAssetName"`
+	GenesisAssetPrecision      byte             `json:"GenesisAssetPrecision"`
+	GenesisTimestamp           uint32           `json:"GenesisTimestamp"`
 }
 
 type ConfigFile struct {
 	ConfigFile Configuration `json:"Configuration"`
 }
 
+// Checkpoint identifies a known good block on the chain, Hash is the block
+// hash in hex string as shown by the RPC.
+type Checkpoint struct {
+	Height uint32
+	Hash   string
+}
+
+// RewardRule requires the coinbase to pay at least MinFraction of the block
+// reward to Address, besides the foundation reward.
+type RewardRule struct {
+	Address     string
+	MinFraction float64
+}
+
 type ChainParams struct {
-	Name               string
-	PowLimit           *big.Int
-	PowLimitBits       uint32
-	TargetTimespan     time.Duration
-	TargetTimePerBlock time.Duration
-	AdjustmentFactor   int64
-	MaxOrphanBlocks    int
-	MinMemoryNodes     uint32
-	SpendCoinbaseSpan  uint32
+	Name string
+
+	// Magic, SeedList, the ports and FoundationAddress are the defaults of
+	// the network, the configured values take precedence over them.
+	Magic             uint32
+	SeedList          []string
+	NodePort          uint16
+	HttpInfoPort      uint16
+	HttpRestPort      int
+	HttpWsPort        int
+	HttpJsonPort      int
+	FoundationAddress string
+
+	PowLimit             *big.Int
+	PowLimitBits         uint32
+	TargetTimespan       time.Duration
+	TargetTimePerBlock   time.Duration
+	AdjustmentFactor     int64
+	ReduceMinDifficulty  bool
+	MinDiffReductionTime time.Duration
+	Checkpoints          []Checkpoint
+	MaxOrphanBlocks      int
+	MaxOrphanTxs         int
+	MinMemoryNodes       uint32
+	SpendCoinbaseSpan    uint32
+
+	// StateRootHeight is the height from which the block headers commit to
+	// the state root, zero disables the state root.
+	StateRootHeight uint32
+
+	// CoinbaseMaturityHeight is the height from which the coinbase maturity
+	// counts from the height the coinbase is stored at instead of its lock
+	// time, zero keeps counting from the lock time.
+	CoinbaseMaturityHeight uint32
+
+	// BatchRechargeHeight is the height from which a recharge transaction
+	// can carry several deposits in the batched payload version, zero
+	// disables the batched payload.
+	BatchRechargeHeight uint32
+
+	// LockTimeHeight is the height from which time based lock times are
+	// compared to the median time past and maxed out input sequences are
+	// math.MaxUint32, zero keeps comparing every lock time to the height.
+	LockTimeHeight uint32
+
+	// TxSizeLimitHeight is the height from which the transactions other than
+	// the coinbase are limited by the size of their type, MaxNormalTxSize or
+	// MaxRechargeTxSize, zero limits them by MaxBlockSize only.
+	TxSizeLimitHeight uint32
+
+	// TxOutputsLimitHeight is the height from which the number of outputs of
+	// a transaction is limited by MaxTxOutputs, zero leaves it unlimited.
+	TxOutputsLimitHeight uint32
+
+	// RecordLimitHeight is the height from which the record data size is
+	// limited by MaxRecordDataSize and the record type by AllowedRecordTypes,
+	// zero leaves the record payload unchecked.
+	RecordLimitHeight uint32
+
+	// AssetNameLimitHeight is the height from which the registered asset
+	// names are limited by MinAssetNameLength, MaxAssetNameLength and
+	// AssetNameCharset, zero only rejects the empty names.
+	AssetNameLimitHeight uint32
+
+	// ProgramLimitHeight is the height from which the programs of a
+	// transaction are limited in number and size, zero leaves them unlimited.
+	ProgramLimitHeight uint32
+
+	// CrossChainOutputsHeight is the height from which the number of cross
+	// chain outputs of a transaction is limited by MaxCrossChainOutputs, zero
+	// leaves it unlimited.
+	CrossChainOutputsHeight uint32
+
+	// RequiredAttributeUsages are the attribute usages every transaction
+	// other than the coinbase must carry, none on the known networks.
+	RequiredAttributeUsages []byte
+
+	// AddressPrefixes are the program hash prefixes of the main chain
+	// addresses on the network, cross chain transfers to the main chain
+	// must use one of them.
+	AddressPrefixes []byte
+
+	// AllowGenerate enables the generate RPCs mining blocks on demand, it is
+	// only set on the networks for testing.
+	AllowGenerate bool
+}
+
+// NetParams returns the chain parameters of all the known networks.
+func NetParams() []*ChainParams {
+	return []*ChainParams{mainNet, testNet, regNet}
+}
+
+// GetNetParams returns the chain parameters of the named network, MainNet if
+// the name is empty.
+func GetNetParams(name string) (*ChainParams, bool) {
+	if name == "" {
+		return mainNet, true
+	}
+	for _, params := range NetParams() {
+		if params.Name == name {
+			return params, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyNetDefaults sets the network defaults of the fields not configured.
+func (c *Configuration) ApplyNetDefaults(params *ChainParams) {
+	if c.Magic == 0 {
+		c.Magic = params.Magic
+	}
+	if len(c.SeedList) == 0 {
+		c.SeedList = params.SeedList
+	}
+	if c.NodePort == 0 {
+		c.NodePort = params.NodePort
+	}
+	if c.HttpInfoPort == 0 {
+		c.HttpInfoPort = params.HttpInfoPort
+	}
+	if c.HttpRestPort == 0 {
+		c.HttpRestPort = params.HttpRestPort
+	}
+	if c.HttpWsPort == 0 {
+		c.HttpWsPort = params.HttpWsPort
+	}
+	if c.HttpJsonPort == 0 {
+		c.HttpJsonPort = params.HttpJsonPort
+	}
+	if c.FoundationAddress == "" {
+		c.FoundationAddress = params.FoundationAddress
+	}
 }
 
 type configParams struct {
@@ -141,11 +371,11 @@ func init() {
 	}
 	//	Parameters = &(config.ConfigFile)
 	Parameters.Configuration = &(config.ConfigFile)
-	if Parameters.PowConfiguration.ActiveNet == "MainNet" {
-		Parameters.ChainParam = mainNet
-	} else if Parameters.PowConfiguration.ActiveNet == "TestNet" {
-		Parameters.ChainParam = testNet
-	} else if Parameters.PowConfiguration.ActiveNet == "RegNet" {
-		Parameters.ChainParam = regNet
+	chainParam, ok := GetNetParams(Parameters.PowConfiguration.ActiveNet)
+	if !ok {
+		log.Fatalf("Unknown ActiveNet %s", Parameters.PowConfiguration.ActiveNet)
+		os.Exit(1)
 	}
+	Parameters.ChainParam = chainParam
+	Parameters.ApplyNetDefaults(chainParam)
 }
@@ -3,6 +3,7 @@ package core
 import (
 	"errors"
 	"io"
+	"strings"
 
 	"github.com/elastos/Elastos.ELA.Utility/common"
 )
@@ -36,6 +37,13 @@ type Asset struct {
 	RecordType  AssetRecordType
 }
 
+// NormalizeAssetName returns the canonical form of an asset name, the name
+// trimmed, internal whitespaces collapsed to one space and case folded. Asset
+// names are unique by their canonical forms.
+func NormalizeAssetName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
 // Serialize is the implement of SignableData interface.
 func (a *Asset) Serialize(w io.Writer) error {
 	err := common.WriteVarString(w, a.Name)
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -16,6 +17,7 @@ const (
 	DescriptionUrl AttributeUsage = 0x81
 	Description    AttributeUsage = 0x90
 	Memo           AttributeUsage = 0x91
+	Expiry         AttributeUsage = 0x92
 )
 
 func (self AttributeUsage) Name() string {
@@ -28,6 +30,10 @@ func (self AttributeUsage) Name() string {
 		return "DescriptionUrl"
 	case Description:
 		return "Description"
+	case Memo:
+		return "Memo"
+	case Expiry:
+		return "Expiry"
 	default:
 		return "Unknown"
 	}
@@ -35,7 +41,8 @@ func (self AttributeUsage) Name() string {
 
 func IsValidAttributeType(usage AttributeUsage) bool {
 	return usage == Nonce || usage == Script ||
-		usage == DescriptionUrl || usage == Description || usage == Memo
+		usage == DescriptionUrl || usage == Description || usage == Memo ||
+		usage == Expiry
 }
 
 type Attribute struct {
@@ -60,7 +67,11 @@ func NewAttribute(u AttributeUsage, d []byte) Attribute {
 
 func (u *Attribute) GetSize() uint32 {
 	if u.Usage == DescriptionUrl {
-		return uint32(len([]byte{(byte(0xff))}) + len([]byte{(byte(0xff))}) + len(u.Data))
+		var buffer bytes.Buffer
+		if err := u.Serialize(&buffer); err != nil {
+			return 0
+		}
+		return uint32(buffer.Len())
 	}
 	return 0
 }
@@ -13,6 +13,10 @@ const (
 	BlockVersion     uint32 = 0
 	GenesisNonce     uint32 = 3194347904
 	InvalidBlockSize int    = -1
+
+	// StateRootVersion is the block version from which the header commits
+	// to the state root.
+	StateRootVersion uint32 = 1
 )
 
 type Block struct {
@@ -17,6 +17,7 @@ type Header struct {
 	Bits       uint32
 	Nonce      uint32
 	Height     uint32
+	StateRoot  Uint256
 	SideAuxPow auxpow.SideAuxPow
 }
 
@@ -48,6 +49,11 @@ func (header *Header) Deserialize(r io.Reader) error {
 	if err != nil {
 		return err
 	}
+	if header.Version >= StateRootVersion {
+		if err := header.StateRoot.Deserialize(r); err != nil {
+			return err
+		}
+	}
 
 	// SideAuxPow
 	err = header.SideAuxPow.Deserialize(r)
@@ -61,7 +67,7 @@ func (header *Header) Deserialize(r io.Reader) error {
 }
 
 func (header *Header) serializeNoAux(w io.Writer) error {
-	return WriteElements(w,
+	err := WriteElements(w,
 		header.Version,
 		header.Previous,
 		header.MerkleRoot,
@@ -70,6 +76,13 @@ func (header *Header) serializeNoAux(w io.Writer) error {
 		header.Nonce,
 		header.Height,
 	)
+	if err != nil {
+		return err
+	}
+	if header.Version >= StateRootVersion {
+		return header.StateRoot.Serialize(w)
+	}
+	return nil
 }
 
 func (header *Header) Hash() Uint256 {
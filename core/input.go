@@ -9,6 +9,29 @@ import (
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
+const (
+	// SequenceLockTimeDisabled is the flag which disables the relative lock
+	// time of an input, the sequence is not interpreted as a relative lock
+	// time if the flag is set.
+	SequenceLockTimeDisabled = 1 << 31
+
+	// SequenceLockTimeIsSeconds is the flag which indicates the relative
+	// lock time is in units of 512 seconds instead of blocks.
+	SequenceLockTimeIsSeconds = 1 << 22
+
+	// SequenceLockTimeMask is the mask to extract the relative lock time
+	// from the sequence.
+	SequenceLockTimeMask = 0x0000ffff
+
+	// SequenceLockTimeGranularity is the shift of the time based relative
+	// lock time, which means the unit is 2^9 = 512 seconds.
+	SequenceLockTimeGranularity = 9
+
+	// MaxReplaceableSequence is the max sequence which signals the
+	// transaction can be replaced by a higher fee one in the pool.
+	MaxReplaceableSequence = 0xfffffffd
+)
+
 type Input struct {
 	// Reference outpoint of this input
 	Previous OutPoint
@@ -3,6 +3,7 @@ package core
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 
 	ela "github.com/elastos/Elastos.ELA/core"
@@ -11,9 +12,25 @@ import (
 
 const RechargeToSideChainPayloadVersion byte = 0x00
 
+// RechargeToSideChainBatchPayloadVersion is the payload version which carries
+// several main chain deposits in one recharge transaction.
+const RechargeToSideChainBatchPayloadVersion byte = 0x01
+
+// MaxRechargeDeposits is the max number of deposits in a batched recharge
+// payload.
+const MaxRechargeDeposits = 100
+
+// RechargeDeposit is a main chain deposit transaction with the merkle proof of
+// its inclusion in the main chain.
+type RechargeDeposit struct {
+	MerkleProof          []byte
+	MainChainTransaction []byte
+}
+
 type PayloadRechargeToSideChain struct {
 	MerkleProof          []byte
 	MainChainTransaction []byte
+	Deposits             []RechargeDeposit
 }
 
 func (t *PayloadRechargeToSideChain) Data(version byte) []byte {
@@ -26,6 +43,18 @@ func (t *PayloadRechargeToSideChain) Data(version byte) []byte {
 }
 
 func (t *PayloadRechargeToSideChain) Serialize(w io.Writer, version byte) error {
+	if version >= RechargeToSideChainBatchPayloadVersion {
+		if err := common.WriteVarUint(w, uint64(len(t.Deposits))); err != nil {
+			return errors.New("[PayloadRechargeToSideChain], Deposits count serialize failed.")
+		}
+		for _, deposit := range t.Deposits {
+			if err := deposit.Serialize(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	err := common.WriteVarBytes(w, t.MerkleProof)
 	if err != nil {
 		return errors.New("[PayloadRechargeToSideChain], MerkleProof serialize failed.")
@@ -38,6 +67,26 @@ func (t *PayloadRechargeToSideChain) Serialize(w io.Writer, version byte) error
 }
 
 func (t *PayloadRechargeToSideChain) Deserialize(r io.Reader, version byte) error {
+	if version >= RechargeToSideChainBatchPayloadVersion {
+		count, err := common.ReadVarUint(r, 0)
+		if err != nil {
+			return errors.New("[PayloadRechargeToSideChain], Deposits count deserialize failed.")
+		}
+		if count > MaxRechargeDeposits {
+			return fmt.Errorf("[PayloadRechargeToSideChain], deposits count %d exceeds the max %d",
+				count, MaxRechargeDeposits)
+		}
+		t.Deposits = nil
+		for i := uint64(0); i < count; i++ {
+			var deposit RechargeDeposit
+			if err := deposit.Deserialize(r); err != nil {
+				return err
+			}
+			t.Deposits = append(t.Deposits, deposit)
+		}
+		return nil
+	}
+
 	var err error
 	if t.MerkleProof, err = common.ReadVarBytes(r); err != nil {
 		return errors.New("[PayloadRechargeToSideChain], MerkleProof deserialize failed.")
@@ -49,13 +98,61 @@ func (t *PayloadRechargeToSideChain) Deserialize(r io.Reader, version byte) erro
 	return nil
 }
 
-func (t *PayloadRechargeToSideChain) GetMainchainTxHash() (*common.Uint256, error) {
+// GetDeposits returns the main chain deposits carried by the payload, the
+// single deposit of a non batched payload is returned as a one item list.
+func (t *PayloadRechargeToSideChain) GetDeposits() []RechargeDeposit {
+	if len(t.Deposits) > 0 {
+		return t.Deposits
+	}
+	return []RechargeDeposit{{
+		MerkleProof:          t.MerkleProof,
+		MainChainTransaction: t.MainChainTransaction,
+	}}
+}
+
+// GetMainchainTxHashes returns the hashes of all main chain deposit
+// transactions carried by the payload.
+func (t *PayloadRechargeToSideChain) GetMainchainTxHashes() ([]common.Uint256, error) {
+	deposits := t.GetDeposits()
+	hashes := make([]common.Uint256, 0, len(deposits))
+	for _, deposit := range deposits {
+		hash, err := deposit.GetMainchainTxHash()
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, *hash)
+	}
+	return hashes, nil
+}
+
+func (d *RechargeDeposit) Serialize(w io.Writer) error {
+	if err := common.WriteVarBytes(w, d.MerkleProof); err != nil {
+		return errors.New("[RechargeDeposit], MerkleProof serialize failed.")
+	}
+	if err := common.WriteVarBytes(w, d.MainChainTransaction); err != nil {
+		return errors.New("[RechargeDeposit], DepositTransaction serialize failed.")
+	}
+	return nil
+}
+
+func (d *RechargeDeposit) Deserialize(r io.Reader) error {
+	var err error
+	if d.MerkleProof, err = common.ReadVarBytes(r); err != nil {
+		return errors.New("[RechargeDeposit], MerkleProof deserialize failed.")
+	}
+	if d.MainChainTransaction, err = common.ReadVarBytes(r); err != nil {
+		return errors.New("[RechargeDeposit], DepositTransaction deserialize failed.")
+	}
+	return nil
+}
+
+func (d *RechargeDeposit) GetMainchainTxHash() (*common.Uint256, error) {
 	mainchainTx := new(ela.Transaction)
-	reader := bytes.NewReader(t.MainChainTransaction)
+	reader := bytes.NewReader(d.MainChainTransaction)
 	if err := mainchainTx.Deserialize(reader); err != nil {
 		return nil, errors.New("RechargeToSideChain mainChainTransaction deserialize failed")
 	}
 
 	hash := mainchainTx.Hash()
 	return &hash, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+func TestPayloadRechargeToSideChain_Deserialize(t *testing.T) {
+	payload := &PayloadRechargeToSideChain{
+		Deposits: []RechargeDeposit{
+			{MerkleProof: []byte{1, 2}, MainChainTransaction: []byte{3}},
+			{MerkleProof: []byte{4}, MainChainTransaction: []byte{5, 6}},
+		},
+	}
+	buf := new(bytes.Buffer)
+	if err := payload.Serialize(buf, RechargeToSideChainBatchPayloadVersion); err != nil {
+		t.Fatal(err)
+	}
+	payload2 := new(PayloadRechargeToSideChain)
+	if err := payload2.Deserialize(buf, RechargeToSideChainBatchPayloadVersion); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload2.Deposits) != 2 || !bytes.Equal(payload2.Deposits[1].MainChainTransaction, []byte{5, 6}) {
+		t.Error("Deposits deserialize error!")
+	}
+
+	// the deposits count is bounded before any deposit is read
+	for _, count := range []uint64{MaxRechargeDeposits + 1, ^uint64(0)} {
+		buf.Reset()
+		common.WriteVarUint(buf, count)
+		if err := payload2.Deserialize(buf, RechargeToSideChainBatchPayloadVersion); err == nil {
+			t.Errorf("Deposits count %d not rejected", count)
+		}
+	}
+}
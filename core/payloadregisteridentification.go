@@ -10,6 +10,10 @@ import (
 
 const RegisterIdentificationVersion = 0x00
 
+// RegisterIdentificationNonceVersion is the payload version which carries a
+// nonce, so the same contents can be registered again with a higher nonce.
+const RegisterIdentificationNonceVersion = 0x01
+
 type RegisterIdentificationValue struct {
 	DataHash common.Uint256
 	Proof    string
@@ -24,11 +28,12 @@ type PayloadRegisterIdentification struct {
 	ID       string
 	Sign     []byte
 	Contents []RegisterIdentificationContent
+	Nonce    uint64
 }
 
 func (a *PayloadRegisterIdentification) Data(version byte) []byte {
 	buf := new(bytes.Buffer)
-	a.Serialize(buf, RegisterIdentificationVersion)
+	a.Serialize(buf, version)
 	return buf.Bytes()
 }
 
@@ -52,6 +57,12 @@ func (a *PayloadRegisterIdentification) Serialize(w io.Writer, version byte) err
 		}
 	}
 
+	if version >= RegisterIdentificationNonceVersion {
+		if err := common.WriteUint64(w, a.Nonce); err != nil {
+			return errors.New("[RegisterIdentification], Nonce serialize failed.")
+		}
+	}
+
 	return nil
 }
 
@@ -81,6 +92,13 @@ func (a *PayloadRegisterIdentification) Deserialize(r io.Reader, version byte) e
 		a.Contents[i] = content
 	}
 
+	if version >= RegisterIdentificationNonceVersion {
+		a.Nonce, err = common.ReadUint64(r)
+		if err != nil {
+			return errors.New("[RegisterIdentification], Nonce deserialize failed.")
+		}
+	}
+
 	return nil
 }
 
@@ -88,6 +106,13 @@ func (a *PayloadRegisterIdentification) GetData() []byte {
 	return a.Data(RegisterIdentificationVersion)
 }
 
+// Hash returns the hash of the path and values of the content.
+func (a *RegisterIdentificationContent) Hash() common.Uint256 {
+	buf := new(bytes.Buffer)
+	a.Serialize(buf, RegisterIdentificationVersion)
+	return common.Uint256(common.Sha256D(buf.Bytes()))
+}
+
 func (a *RegisterIdentificationContent) Serialize(w io.Writer, version byte) error {
 	if err := common.WriteVarString(w, a.Path); err != nil {
 		return errors.New("[RegisterIdentificationContent], path serialize failed.")
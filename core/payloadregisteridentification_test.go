@@ -63,3 +63,49 @@ func TestPayloadRegisterIdentification_Deserialize(t *testing.T) {
 		t.Error("ID content values proof deserialize error!")
 	}
 }
+
+func TestPayloadRegisterIdentification_Nonce(t *testing.T) {
+	payload := &PayloadRegisterIdentification{
+		ID:   "ij8rfb6A4Ri7c5CRE1nDVdVCUMuUxkk2c6",
+		Sign: []byte{1, 1, 1},
+		Contents: []RegisterIdentificationContent{{
+			Path: "kyc/person/identityCard",
+			Values: []RegisterIdentificationValue{{
+				DataHash: common.Uint256{2, 2, 2},
+				Proof:    "testproof1",
+			}}},
+		},
+		Nonce: 7,
+	}
+
+	// the nonce is carried since the nonce version
+	buf := new(bytes.Buffer)
+	if err := payload.Serialize(buf, RegisterIdentificationNonceVersion); err != nil {
+		t.Error("ID serialize error!")
+	}
+	payload2 := PayloadRegisterIdentification{}
+	if err := payload2.Deserialize(buf, RegisterIdentificationNonceVersion); err != nil {
+		t.Error("ID deserialize error!")
+	}
+	if payload2.Nonce != 7 {
+		t.Errorf("ID nonce deserialize error, got %d", payload2.Nonce)
+	}
+
+	// old payloads have no nonce
+	buf = new(bytes.Buffer)
+	if err := payload.Serialize(buf, RegisterIdentificationVersion); err != nil {
+		t.Error("ID serialize error!")
+	}
+	payload2 = PayloadRegisterIdentification{}
+	if err := payload2.Deserialize(buf, RegisterIdentificationVersion); err != nil {
+		t.Error("ID deserialize error!")
+	}
+	if payload2.Nonce != 0 || buf.Len() != 0 {
+		t.Error("ID old version deserialize error!")
+	}
+
+	// the content hash does not depend on the nonce
+	if payload.Contents[0].Hash() != payload2.Contents[0].Hash() {
+		t.Error("ID content hash depends on the nonce!")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain/vm/interfaces"
 
 	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
 )
 
 //for different transaction types with different payload format
@@ -57,8 +58,24 @@ func (self TransactionType) Name() string {
 
 const (
 	InvalidTransactionSize = -1
+
+	// InputSize is the serialized size of an input, the referenced
+	// transaction id and output index followed by the sequence.
+	InputSize = UINT256SIZE + 2 + 4
+
+	// OutputSize is the serialized size of an output, the asset id, the
+	// value, the output lock and the program hash.
+	OutputSize = UINT256SIZE + 8 + 4 + 21
+
+	// StandardProgramSize is the serialized size of the program of a
+	// standard signature, the signature followed by the redeem script.
+	StandardProgramSize = 1 + crypto.SignatureScriptLength + 1 + crypto.PublicKeyScriptLength
 )
 
+// LockTimeThreshold is the number below which a lock time is interpreted to
+// be a block height, otherwise it is interpreted as a unix timestamp.
+const LockTimeThreshold = 500000000
+
 type Transaction struct {
 	TxType         TransactionType
 	PayloadVersion byte
@@ -269,6 +286,40 @@ func (tx *Transaction) GetSize() int {
 	return buffer.Len()
 }
 
+// EstimateTransactionSize returns the serialized size of a transfer asset
+// transaction of the given numbers of inputs, outputs and standard signature
+// programs, and one attribute of attrDataLen bytes data if attrDataLen is
+// positive, so the fee can be computed before the transaction is built.
+func EstimateTransactionSize(inputs, outputs, programs int, attrDataLen int) int {
+	// transaction type and payload version, the transfer asset payload is empty
+	size := 2
+	if attrDataLen > 0 {
+		size += varUintSize(1) + 1 + varUintSize(uint64(attrDataLen)) + attrDataLen
+	} else {
+		size += varUintSize(0)
+	}
+	size += varUintSize(uint64(inputs)) + inputs*InputSize
+	size += varUintSize(uint64(outputs)) + outputs*OutputSize
+	// lock time
+	size += 4
+	size += varUintSize(uint64(programs)) + programs*StandardProgramSize
+	return size
+}
+
+// varUintSize returns the serialized size of a variable length integer.
+func varUintSize(value uint64) int {
+	switch {
+	case value < 0xfd:
+		return 1
+	case value <= 0xffff:
+		return 3
+	case value <= 0xffffffff:
+		return 5
+	default:
+		return 9
+	}
+}
+
 func (tx *Transaction) Hash() Uint256 {
 	if tx.hash == nil {
 		buf := new(bytes.Buffer)
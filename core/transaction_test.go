@@ -0,0 +1,53 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+)
+
+func TestEstimateTransactionSize(t *testing.T) {
+	_, publicKey, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := crypto.CreateStandardRedeemScript(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTx := func(inputs, outputs, programs, attrDataLen int) *Transaction {
+		tx := &Transaction{TxType: TransferAsset, Payload: &PayloadTransferAsset{}}
+		if attrDataLen > 0 {
+			attr := NewAttribute(Nonce, make([]byte, attrDataLen))
+			tx.Attributes = append(tx.Attributes, &attr)
+		}
+		for i := 0; i < inputs; i++ {
+			tx.Inputs = append(tx.Inputs, &Input{})
+		}
+		for i := 0; i < outputs; i++ {
+			tx.Outputs = append(tx.Outputs, &Output{})
+		}
+		for i := 0; i < programs; i++ {
+			tx.Programs = append(tx.Programs, &Program{
+				Code:      code,
+				Parameter: make([]byte, crypto.SignatureScriptLength),
+			})
+		}
+		return tx
+	}
+
+	cases := [][4]int{
+		{1, 1, 1, 0},
+		{2, 3, 1, 8},
+		{10, 2, 3, 300},
+		{300, 1, 1, 8},
+	}
+	for _, c := range cases {
+		size := newTx(c[0], c[1], c[2], c[3]).GetSize()
+		estimate := EstimateTransactionSize(c[0], c[1], c[2], c[3])
+		if estimate != size {
+			t.Errorf("estimated size %d of %v mismatches the size %d", estimate, c, size)
+		}
+	}
+}
@@ -23,18 +23,34 @@ const (
 	ErrIneffectiveCoinbase  ErrCode = 45018
 	ErrUTXOLocked           ErrCode = 45019
 	ErrRechargeToSideChain  ErrCode = 45020
+	ErrTxChainTooLong       ErrCode = 45021
+	ErrTooManyAssets        ErrCode = 45022
+	ErrTransactionExpired   ErrCode = 45023
+	ErrIdentificationUpdate ErrCode = 45024
+	ErrNonStandard          ErrCode = 45025
+	ErrTransactionLocked    ErrCode = 45026
+	ErrBlockRejected        ErrCode = 45027
+	ErrUnconfirmedInput     ErrCode = 45028
+	ErrEmptyAssetName       ErrCode = 45029
+	ErrAssetDescription     ErrCode = 45030
+	ErrDuplicateAssetName   ErrCode = 45031
+	ErrAssetNameLength      ErrCode = 45032
+	ErrAssetNameCharset     ErrCode = 45033
 
 	SessionExpired          ErrCode = 41001
 	IllegalDataFormat       ErrCode = 41003
 	PowServiceNotStarted    ErrCode = 41004
+	TooManySubscriptions    ErrCode = 41005
 	InvalidMethod           ErrCode = 42001
 	InvalidParams           ErrCode = 42002
 	InvalidToken            ErrCode = 42003
 	InvalidTransaction      ErrCode = 43001
 	InvalidAsset            ErrCode = 43002
+	HighTransactionFee      ErrCode = 43003
 	UnknownTransaction      ErrCode = 44001
 	UnknownAsset            ErrCode = 44002
 	UnknownBlock            ErrCode = 44003
+	PrunedData              ErrCode = 44004
 	InternalError           ErrCode = 45002
 )
 
@@ -44,14 +60,17 @@ var ErrMap = map[ErrCode]string{
 	SessionExpired:          "Session expired",
 	IllegalDataFormat:       "Illegal Dataformat",
 	PowServiceNotStarted:    "pow service not started",
+	TooManySubscriptions:    "Too many subscriptions",
 	InvalidMethod:           "Invalid method",
 	InvalidParams:           "Invalid Params",
 	InvalidToken:            "Verify token error",
 	InvalidTransaction:      "Invalid transaction",
 	InvalidAsset:            "Invalid asset",
+	HighTransactionFee:      "Transaction fee too high",
 	UnknownTransaction:      "Unknown Transaction",
 	UnknownAsset:            "Unknown asset",
 	UnknownBlock:            "Unknown Block",
+	PrunedData:              "Data pruned",
 	InternalError:           "Internal error",
 	ErrUTXOLocked:           "Error utxo locked",
 	ErrInvalidInput:         "INTERNAL ERROR, ErrInvalidInput",
@@ -68,6 +87,19 @@ var ErrMap = map[ErrCode]string{
 	ErrUnknownReferedTxn:    "INTERNAL ERROR, ErrUnknownReferedTxn",
 	ErrInvalidReferedTxn:    "INTERNAL ERROR, ErrInvalidReferedTxn",
 	ErrIneffectiveCoinbase:  "INTERNAL ERROR, ErrIneffectiveCoinbase",
+	ErrTxChainTooLong:       "INTERNAL ERROR, ErrTxChainTooLong",
+	ErrTooManyAssets:        "INTERNAL ERROR, ErrTooManyAssets",
+	ErrTransactionExpired:   "INTERNAL ERROR, ErrTransactionExpired",
+	ErrIdentificationUpdate: "INTERNAL ERROR, ErrIdentificationUpdate",
+	ErrNonStandard:          "INTERNAL ERROR, ErrNonStandard",
+	ErrTransactionLocked:    "INTERNAL ERROR, ErrTransactionLocked",
+	ErrBlockRejected:        "INTERNAL ERROR, ErrBlockRejected",
+	ErrUnconfirmedInput:     "INTERNAL ERROR, ErrUnconfirmedInput",
+	ErrEmptyAssetName:       "INTERNAL ERROR, ErrEmptyAssetName",
+	ErrAssetDescription:     "INTERNAL ERROR, ErrAssetDescription",
+	ErrDuplicateAssetName:   "INTERNAL ERROR, ErrDuplicateAssetName",
+	ErrAssetNameLength:      "INTERNAL ERROR, ErrAssetNameLength",
+	ErrAssetNameCharset:     "INTERNAL ERROR, ErrAssetNameCharset",
 }
 
 func (code ErrCode) Message() string {
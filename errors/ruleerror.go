@@ -0,0 +1,58 @@
+package errors
+
+// RuleError is returned when a transaction or a block is rejected by a rule,
+// ErrorCode classifies the rule and Description tells the failure in detail.
+type RuleError struct {
+	ErrorCode   ErrCode
+	Description string
+}
+
+func (e RuleError) Error() string {
+	return e.Description
+}
+
+// RuleMessages are the messages returned by the RPC with the codes of the
+// rejected transactions and blocks. The codes are returned as they are, so a
+// client can tell the rejection classes apart by the code.
+var RuleMessages = map[ErrCode]string{
+	ErrInvalidInput:         "invalid transaction input",
+	ErrInvalidOutput:        "invalid transaction output",
+	ErrAssetPrecision:       "invalid asset precision",
+	ErrTransactionBalance:   "transaction fee too low or outputs exceed inputs",
+	ErrAttributeProgram:     "invalid transaction attribute or program",
+	ErrTransactionSignature: "invalid transaction signature",
+	ErrTransactionPayload:   "invalid transaction payload",
+	ErrDoubleSpend:          "transaction double spends an output",
+	ErrTxHashDuplicate:      "transaction already exists",
+	ErrSidechainTxDuplicate: "duplicate side chain transaction",
+	ErrMainchainTxDuplicate: "main chain transaction already recharged",
+	ErrXmitFail:             "transaction relay failed",
+	ErrTransactionSize:      "invalid transaction size",
+	ErrUnknownReferedTxn:    "referenced transaction not found",
+	ErrInvalidReferedTxn:    "invalid referenced transaction",
+	ErrIneffectiveCoinbase:  "coinbase output is not mature",
+	ErrUTXOLocked:           "output is locked",
+	ErrRechargeToSideChain:  "invalid recharge to side chain transaction",
+	ErrTxChainTooLong:       "too many unconfirmed ancestors or descendants",
+	ErrTooManyAssets:        "too many registered assets",
+	ErrTransactionExpired:   "transaction expired",
+	ErrIdentificationUpdate: "invalid identification update",
+	ErrNonStandard:          "non standard transaction",
+	ErrTransactionLocked:    "transaction lock time not reached",
+	ErrBlockRejected:        "block rejected",
+	ErrUnconfirmedInput:     "input spends an unconfirmed transaction",
+	ErrEmptyAssetName:       "asset name is empty",
+	ErrAssetDescription:     "invalid asset description",
+	ErrDuplicateAssetName:   "asset name already registered",
+	ErrAssetNameLength:      "asset name length out of range",
+	ErrAssetNameCharset:     "asset name contains an invalid character",
+}
+
+// RuleMessage returns the message of the rule rejection code, or the message
+// of ErrMap if the code is not a rule rejection.
+func (code ErrCode) RuleMessage() string {
+	if message, ok := RuleMessages[code]; ok {
+		return message
+	}
+	return code.Message()
+}
@@ -0,0 +1,71 @@
+package errors
+
+import "testing"
+
+func TestRuleMessages(t *testing.T) {
+	// the codes are returned by the RPC, they must not change
+	codes := map[ErrCode]int{
+		ErrInvalidInput:         45003,
+		ErrInvalidOutput:        45004,
+		ErrAssetPrecision:       45005,
+		ErrTransactionBalance:   45006,
+		ErrAttributeProgram:     45007,
+		ErrTransactionSignature: 45008,
+		ErrTransactionPayload:   45009,
+		ErrDoubleSpend:          45010,
+		ErrTxHashDuplicate:      45011,
+		ErrSidechainTxDuplicate: 45012,
+		ErrMainchainTxDuplicate: 45013,
+		ErrXmitFail:             45014,
+		ErrTransactionSize:      45015,
+		ErrUnknownReferedTxn:    45016,
+		ErrInvalidReferedTxn:    45017,
+		ErrIneffectiveCoinbase:  45018,
+		ErrUTXOLocked:           45019,
+		ErrRechargeToSideChain:  45020,
+		ErrTxChainTooLong:       45021,
+		ErrTooManyAssets:        45022,
+		ErrTransactionExpired:   45023,
+		ErrIdentificationUpdate: 45024,
+		ErrNonStandard:          45025,
+		ErrTransactionLocked:    45026,
+		ErrBlockRejected:        45027,
+		ErrUnconfirmedInput:     45028,
+		ErrEmptyAssetName:       45029,
+		ErrAssetDescription:     45030,
+		ErrDuplicateAssetName:   45031,
+		ErrAssetNameLength:      45032,
+		ErrAssetNameCharset:     45033,
+	}
+	if len(codes) != len(RuleMessages) {
+		t.Error("rule codes and messages mismatch")
+	}
+
+	messages := make(map[string]ErrCode)
+	for code, value := range codes {
+		if int(code) != value {
+			t.Errorf("code %d changed to %d", value, code)
+		}
+		message, ok := RuleMessages[code]
+		if !ok || message == "" {
+			t.Errorf("code %d has no message", value)
+		}
+		if other, ok := messages[message]; ok {
+			t.Errorf("codes %d and %d have the same message", other, code)
+		}
+		messages[message] = code
+		if code.RuleMessage() != message {
+			t.Errorf("rule message of code %d mismatch", value)
+		}
+	}
+
+	// not a rule rejection
+	if InvalidParams.RuleMessage() != InvalidParams.Message() {
+		t.Error("message of InvalidParams mismatch")
+	}
+
+	err := error(RuleError{ErrorCode: ErrDoubleSpend, Description: "double spent"})
+	if err.Error() != "double spent" {
+		t.Error("rule error description mismatch")
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"flag"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 
 	"github.com/elastos/Elastos.ELA.SideChain/blockchain"
 	"github.com/elastos/Elastos.ELA.SideChain/config"
@@ -24,7 +27,15 @@ const (
 	DefaultMultiCoreNum = 4
 )
 
+var noCheckpoints = flag.Bool("nocheckpoints", false,
+	"disable checkpoints and fully validate all blocks")
+
 func init() {
+	flag.Parse()
+	if *noCheckpoints {
+		config.Parameters.DisableCheckpoints = true
+	}
+
 	log.Init(
 		config.Parameters.PrintLevel,
 		config.Parameters.MaxPerLogSize,
@@ -44,6 +55,25 @@ func init() {
 	}
 	blockchain.FoundationAddress = *address
 
+	for _, rule := range config.Parameters.RewardRules {
+		programHash, err := common.Uint168FromAddress(rule.Address)
+		if err != nil || rule.MinFraction <= 0 || rule.MinFraction > 1 {
+			log.Info("Please set correct reward rules in config file")
+			os.Exit(-1)
+		}
+		blockchain.RegisterRewardRule(blockchain.NewAddressRewardRule(
+			rule.Address, *programHash, rule.MinFraction))
+	}
+
+	if config.Parameters.ArbitratorsAddress != "" {
+		programHash, err := common.Uint168FromAddress(config.Parameters.ArbitratorsAddress)
+		if err != nil {
+			log.Info("Please set correct arbitrators address in config file")
+			os.Exit(-1)
+		}
+		blockchain.Arbitrators = blockchain.StaticArbitrators(*programHash)
+	}
+
 	log.Debug("The Core number is ", coreNum)
 	runtime.GOMAXPROCS(coreNum)
 }
@@ -56,6 +86,23 @@ func startConsensus(noder protocol.Noder) {
 	}
 }
 
+// handleInterrupt shuts down the node on SIGINT or SIGTERM, the miner is
+// halted first, then the chain store is closed after the block being
+// connected is fully committed.
+func handleInterrupt(chainStore blockchain.IChainStore) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+
+	log.Info("Shutting down...")
+	if servers.LocalPow != nil {
+		servers.LocalPow.Halt()
+	}
+	chainStore.Close()
+	log.Info("Shutdown complete")
+	os.Exit(0)
+}
+
 func main() {
 	//var blockChain *ledger.Blockchain
 	var err error
@@ -68,6 +115,7 @@ func main() {
 		goto ERROR
 	}
 	defer chainStore.Close()
+	go handleInterrupt(chainStore)
 
 	err = blockchain.Init(chainStore)
 	if err != nil {
@@ -80,6 +128,7 @@ func main() {
 		log.Fatal(err, "SPV module initialize failed")
 		goto ERROR
 	}
+	blockchain.MainChainHeaders = spv.MainChainHeaders{}
 
 	log.Info("3. Start the P2P networks")
 	noder = node.InitLocalNode()
@@ -90,7 +139,9 @@ func main() {
 
 	log.Info("4. --Start the RPC service")
 	go httpjsonrpc.StartRPCServer()
-	go httprestful.StartServer()
+	if !config.Parameters.DisableHttpRest {
+		go httprestful.StartServer()
+	}
 	go httpwebsocket.StartServer()
 	if config.Parameters.HttpInfoStart {
 		go httpnodeinfo.StartServer()
@@ -0,0 +1,238 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a counter only increased, it is updated atomically.
+type Counter struct {
+	value uint64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+// CounterVec is a set of counters labeled by an integer, such as an ErrCode.
+type CounterVec struct {
+	label    string
+	mtx      sync.RWMutex
+	counters map[int]*Counter
+}
+
+// With returns the counter of the label value, the counter is created the
+// first time the value is seen.
+func (v *CounterVec) With(value int) *Counter {
+	v.mtx.RLock()
+	counter, ok := v.counters[value]
+	v.mtx.RUnlock()
+	if ok {
+		return counter
+	}
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if counter, ok = v.counters[value]; !ok {
+		counter = new(Counter)
+		v.counters[value] = counter
+	}
+	return counter
+}
+
+// Values returns the counter values by the label value.
+func (v *CounterVec) Values() map[int]uint64 {
+	v.mtx.RLock()
+	defer v.mtx.RUnlock()
+	values := make(map[int]uint64, len(v.counters))
+	for value, counter := range v.counters {
+		values[value] = counter.Value()
+	}
+	return values
+}
+
+// Gauge is a value going up and down, it is updated atomically.
+type Gauge struct {
+	value int64
+}
+
+func (g *Gauge) Set(value int64) {
+	atomic.StoreInt64(&g.value, value)
+}
+
+func (g *Gauge) Add(delta int64) {
+	atomic.AddInt64(&g.value, delta)
+}
+
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+// Summary is the count and the total duration of the observed events.
+type Summary struct {
+	count uint64
+	sum   int64
+}
+
+func (s *Summary) Observe(d time.Duration) {
+	atomic.AddUint64(&s.count, 1)
+	atomic.AddInt64(&s.sum, int64(d))
+}
+
+// ObserveSince observes the duration since start, it is deferred as
+// defer s.ObserveSince(time.Now()).
+func (s *Summary) ObserveSince(start time.Time) {
+	s.Observe(time.Since(start))
+}
+
+func (s *Summary) Count() uint64 {
+	return atomic.LoadUint64(&s.count)
+}
+
+func (s *Summary) Sum() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.sum))
+}
+
+const (
+	typeCounter = "counter"
+	typeGauge   = "gauge"
+	typeSummary = "summary"
+)
+
+// entry is a metric registered with its name and help.
+type entry struct {
+	name   string
+	help   string
+	typ    string
+	metric interface{}
+}
+
+var registry struct {
+	sync.RWMutex
+	entries []*entry
+}
+
+func register(name, help, typ string, metric interface{}) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.entries = append(registry.entries, &entry{name: name, help: help, typ: typ, metric: metric})
+}
+
+// NewCounter registers a counter of the name.
+func NewCounter(name, help string) *Counter {
+	counter := new(Counter)
+	register(name, help, typeCounter, counter)
+	return counter
+}
+
+// NewCounterVec registers a set of counters of the name labeled by label.
+func NewCounterVec(name, help, label string) *CounterVec {
+	vec := &CounterVec{label: label, counters: make(map[int]*Counter)}
+	register(name, help, typeCounter, vec)
+	return vec
+}
+
+// NewGauge registers a gauge of the name.
+func NewGauge(name, help string) *Gauge {
+	gauge := new(Gauge)
+	register(name, help, typeGauge, gauge)
+	return gauge
+}
+
+// NewGaugeFunc registers a gauge of the name whose value is read from value
+// when the metrics are collected.
+func NewGaugeFunc(name, help string, value func() int64) {
+	register(name, help, typeGauge, value)
+}
+
+// NewSummary registers a summary of the name, the durations are reported in
+// seconds.
+func NewSummary(name, help string) *Summary {
+	summary := new(Summary)
+	register(name, help, typeSummary, summary)
+	return summary
+}
+
+func copyEntries() []*entry {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]*entry(nil), registry.entries...)
+}
+
+// WriteText writes the registered metrics in the Prometheus text format.
+func WriteText(w io.Writer) error {
+	for _, e := range copyEntries() {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", e.name, e.help, e.name, e.typ); err != nil {
+			return err
+		}
+		var err error
+		switch m := e.metric.(type) {
+		case *Counter:
+			_, err = fmt.Fprintf(w, "%s %d\n", e.name, m.Value())
+		case *CounterVec:
+			values := m.Values()
+			keys := make([]int, 0, len(values))
+			for key := range values {
+				keys = append(keys, key)
+			}
+			sort.Ints(keys)
+			for _, key := range keys {
+				if _, err = fmt.Fprintf(w, "%s{%s=\"%d\"} %d\n", e.name, m.label, key, values[key]); err != nil {
+					break
+				}
+			}
+		case *Gauge:
+			_, err = fmt.Fprintf(w, "%s %d\n", e.name, m.Value())
+		case func() int64:
+			_, err = fmt.Fprintf(w, "%s %d\n", e.name, m())
+		case *Summary:
+			_, err = fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", e.name, m.Sum().Seconds(), e.name, m.Count())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Snapshot returns the values of the registered metrics by name, the labeled
+// counters are maps of the label values and the summaries are maps of the
+// count and the sum in seconds.
+func Snapshot() map[string]interface{} {
+	snapshot := make(map[string]interface{})
+	for _, e := range copyEntries() {
+		switch m := e.metric.(type) {
+		case *Counter:
+			snapshot[e.name] = m.Value()
+		case *CounterVec:
+			values := make(map[string]uint64)
+			for key, value := range m.Values() {
+				values[strconv.Itoa(key)] = value
+			}
+			snapshot[e.name] = values
+		case *Gauge:
+			snapshot[e.name] = m.Value()
+		case func() int64:
+			snapshot[e.name] = m()
+		case *Summary:
+			snapshot[e.name] = map[string]interface{}{
+				"count": m.Count(),
+				"sum":   m.Sum().Seconds(),
+			}
+		}
+	}
+	return snapshot
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteText(t *testing.T) {
+	counter := NewCounter("test_counter_total", "A test counter.")
+	vec := NewCounterVec("test_codes_total", "Test counters by code.", "code")
+	gauge := NewGauge("test_gauge", "A test gauge.")
+	NewGaugeFunc("test_gauge_func", "A test gauge func.", func() int64 { return 7 })
+	summary := NewSummary("test_duration_seconds", "A test summary.")
+
+	counter.Add(2)
+	counter.Inc()
+	vec.With(45001).Inc()
+	vec.With(0).Add(5)
+	gauge.Set(10)
+	gauge.Add(-4)
+	summary.Observe(time.Second)
+	summary.Observe(time.Second / 2)
+
+	buf := new(bytes.Buffer)
+	if !assert.NoError(t, WriteText(buf)) {
+		t.FailNow()
+	}
+	text := buf.String()
+	for _, line := range []string{
+		"# HELP test_counter_total A test counter.",
+		"# TYPE test_counter_total counter",
+		"test_counter_total 3",
+		"test_codes_total{code=\"0\"} 5\ntest_codes_total{code=\"45001\"} 1",
+		"# TYPE test_gauge gauge",
+		"test_gauge 6",
+		"test_gauge_func 7",
+		"# TYPE test_duration_seconds summary",
+		"test_duration_seconds_sum 1.5\ntest_duration_seconds_count 2",
+	} {
+		assert.True(t, strings.Contains(text, line), line)
+	}
+
+	snapshot := Snapshot()
+	assert.Equal(t, uint64(3), snapshot["test_counter_total"])
+	assert.Equal(t, map[string]uint64{"0": 5, "45001": 1}, snapshot["test_codes_total"])
+	assert.Equal(t, int64(6), snapshot["test_gauge"])
+	assert.Equal(t, int64(7), snapshot["test_gauge_func"])
+	assert.Equal(t, map[string]interface{}{"count": uint64(2), "sum": 1.5}, snapshot["test_duration_seconds"])
+
+	t.Log("[TestWriteText] PASSED")
+}
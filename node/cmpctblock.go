@@ -0,0 +1,370 @@
+package node
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	"github.com/dchest/siphash"
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+)
+
+const (
+	CmdCmpctBlock  = "cmpctblock"
+	CmdGetBlockTxn = "getblocktxn"
+	CmdBlockTxn    = "blocktxn"
+
+	// ShortIDLength is the serialized length of a short transaction id.
+	ShortIDLength = 6
+)
+
+var (
+	// ErrShortIDCollision is returned when a short transaction id matches
+	// more than one transaction, the full block should be requested.
+	ErrShortIDCollision = errors.New("short transaction id collision")
+
+	// ErrMerkleRootMismatch is returned when the reconstructed transactions
+	// do not match the merkle root of the block header.
+	ErrMerkleRootMismatch = errors.New("reconstructed block merkle root mismatch")
+)
+
+// PrefilledTx is a transaction sent in full within a compact block.
+type PrefilledTx struct {
+	Index uint16
+	Tx    *core.Transaction
+}
+
+// CmpctBlock announces a block by its header and the short ids of its
+// transactions, the receiver reconstructs the block from its transaction pool.
+type CmpctBlock struct {
+	Header       core.Header
+	Nonce        uint64
+	ShortIDs     []uint64
+	PrefilledTxs []PrefilledTx
+}
+
+// NewCmpctBlock creates a compact block of the block salted with the nonce,
+// the coinbase transaction is always prefilled.
+func NewCmpctBlock(block *core.Block, nonce uint64) *CmpctBlock {
+	m := &CmpctBlock{
+		Header:       block.Header,
+		Nonce:        nonce,
+		ShortIDs:     make([]uint64, 0, len(block.Transactions)),
+		PrefilledTxs: []PrefilledTx{{Index: 0, Tx: block.Transactions[0]}},
+	}
+	for _, tx := range block.Transactions[1:] {
+		m.ShortIDs = append(m.ShortIDs, m.ShortID(tx.Hash()))
+	}
+	return m
+}
+
+// ShortID returns the short id of a transaction, the siphash of the txid keyed
+// by the block hash and the nonce truncated to ShortIDLength bytes.
+func (m *CmpctBlock) ShortID(txId Uint256) uint64 {
+	buf := new(bytes.Buffer)
+	m.Header.Hash().Serialize(buf)
+	WriteUint64(buf, m.Nonce)
+	key := sha256.Sum256(buf.Bytes())
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+	return siphash.Hash(k0, k1, txId[:]) & (1<<(8*ShortIDLength) - 1)
+}
+
+// TxCount returns the number of transactions in the block.
+func (m *CmpctBlock) TxCount() int {
+	return len(m.ShortIDs) + len(m.PrefilledTxs)
+}
+
+// Reconstruct fills the transactions of the block from the pool, it returns
+// the indexes of the transactions not found in the pool.
+func (m *CmpctBlock) Reconstruct(pool map[Uint256]*core.Transaction) ([]*core.Transaction, []uint16, error) {
+	txs := make([]*core.Transaction, m.TxCount())
+	for _, prefilled := range m.PrefilledTxs {
+		if int(prefilled.Index) >= len(txs) || txs[prefilled.Index] != nil {
+			return nil, nil, errors.New("invalid prefilled transaction index")
+		}
+		txs[prefilled.Index] = prefilled.Tx
+	}
+
+	// Map the short ids to the indexes of the block transactions
+	indexes := make(map[uint64]int, len(m.ShortIDs))
+	next := 0
+	for _, shortID := range m.ShortIDs {
+		for txs[next] != nil {
+			next++
+		}
+		if _, ok := indexes[shortID]; ok {
+			return nil, nil, ErrShortIDCollision
+		}
+		indexes[shortID] = next
+		next++
+	}
+
+	matched := make(map[int]bool, len(indexes))
+	for txId, tx := range pool {
+		index, ok := indexes[m.ShortID(txId)]
+		if !ok {
+			continue
+		}
+		if matched[index] {
+			return nil, nil, ErrShortIDCollision
+		}
+		matched[index] = true
+		txs[index] = tx
+	}
+
+	var missing []uint16
+	for index, tx := range txs {
+		if tx == nil {
+			missing = append(missing, uint16(index))
+		}
+	}
+	return txs, missing, nil
+}
+
+// maxBlockTxs returns the max number of transactions in a block message, the
+// transactions are indexed by uint16 and bounded by MaxTxInBlock if it is
+// configured.
+func maxBlockTxs() uint64 {
+	max := uint64(math.MaxUint16) + 1
+	if n := config.Parameters.MaxTxInBlock; n > 0 && uint64(n) < max {
+		return uint64(n)
+	}
+	return max
+}
+
+// readCount reads a count of the message and checks it is not greater than
+// max before anything is allocated for it.
+func readCount(r io.Reader, name string, max uint64) (uint64, error) {
+	count, err := ReadVarUint(r, 0)
+	if err != nil {
+		return 0, err
+	}
+	if count > max {
+		return 0, fmt.Errorf("%s count %d exceeds the max %d", name, count, max)
+	}
+	return count, nil
+}
+
+func (m *CmpctBlock) CMD() string {
+	return CmdCmpctBlock
+}
+
+func (m *CmpctBlock) MaxLength() uint32 {
+	return uint32(config.Parameters.MaxBlockSize)
+}
+
+func (m *CmpctBlock) Serialize(w io.Writer) error {
+	if err := m.Header.Serialize(w); err != nil {
+		return err
+	}
+	if err := WriteUint64(w, m.Nonce); err != nil {
+		return err
+	}
+
+	if err := WriteVarUint(w, uint64(len(m.ShortIDs))); err != nil {
+		return err
+	}
+	for _, shortID := range m.ShortIDs {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], shortID)
+		if _, err := w.Write(buf[:ShortIDLength]); err != nil {
+			return err
+		}
+	}
+
+	if err := WriteVarUint(w, uint64(len(m.PrefilledTxs))); err != nil {
+		return err
+	}
+	for _, prefilled := range m.PrefilledTxs {
+		if err := WriteElements(w, prefilled.Index); err != nil {
+			return err
+		}
+		if err := prefilled.Tx.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *CmpctBlock) Deserialize(r io.Reader) error {
+	if err := m.Header.Deserialize(r); err != nil {
+		return err
+	}
+	nonce, err := ReadUint64(r)
+	if err != nil {
+		return err
+	}
+	m.Nonce = nonce
+
+	count, err := readCount(r, "short id", maxBlockTxs())
+	if err != nil {
+		return err
+	}
+	m.ShortIDs = make([]uint64, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var buf [8]byte
+		if _, err := io.ReadFull(r, buf[:ShortIDLength]); err != nil {
+			return err
+		}
+		m.ShortIDs = append(m.ShortIDs, binary.LittleEndian.Uint64(buf[:]))
+	}
+
+	count, err = readCount(r, "prefilled transaction", maxBlockTxs())
+	if err != nil {
+		return err
+	}
+	m.PrefilledTxs = make([]PrefilledTx, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var index uint16
+		if err := ReadElements(r, &index); err != nil {
+			return err
+		}
+		tx := new(core.Transaction)
+		if err := tx.Deserialize(r); err != nil {
+			return err
+		}
+		m.PrefilledTxs = append(m.PrefilledTxs, PrefilledTx{Index: index, Tx: tx})
+	}
+	return nil
+}
+
+// GetBlockTxn requests the transactions of a block missing in the receiver's
+// transaction pool.
+type GetBlockTxn struct {
+	BlockHash Uint256
+	Indexes   []uint16
+}
+
+func (m *GetBlockTxn) CMD() string {
+	return CmdGetBlockTxn
+}
+
+func (m *GetBlockTxn) MaxLength() uint32 {
+	return uint32(config.Parameters.MaxBlockSize)
+}
+
+func (m *GetBlockTxn) Serialize(w io.Writer) error {
+	if err := m.BlockHash.Serialize(w); err != nil {
+		return err
+	}
+	if err := WriteVarUint(w, uint64(len(m.Indexes))); err != nil {
+		return err
+	}
+	for _, index := range m.Indexes {
+		if err := WriteElements(w, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *GetBlockTxn) Deserialize(r io.Reader) error {
+	if err := m.BlockHash.Deserialize(r); err != nil {
+		return err
+	}
+	count, err := readCount(r, "index", uint64(math.MaxUint16)+1)
+	if err != nil {
+		return err
+	}
+	m.Indexes = make([]uint16, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var index uint16
+		if err := ReadElements(r, &index); err != nil {
+			return err
+		}
+		m.Indexes = append(m.Indexes, index)
+	}
+	return nil
+}
+
+// BlockTxn responds to GetBlockTxn with the requested transactions in the
+// order of the requested indexes.
+type BlockTxn struct {
+	BlockHash Uint256
+	Txs       []*core.Transaction
+}
+
+func (m *BlockTxn) CMD() string {
+	return CmdBlockTxn
+}
+
+func (m *BlockTxn) MaxLength() uint32 {
+	return uint32(config.Parameters.MaxBlockSize)
+}
+
+func (m *BlockTxn) Serialize(w io.Writer) error {
+	if err := m.BlockHash.Serialize(w); err != nil {
+		return err
+	}
+	if err := WriteVarUint(w, uint64(len(m.Txs))); err != nil {
+		return err
+	}
+	for _, tx := range m.Txs {
+		if err := tx.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *BlockTxn) Deserialize(r io.Reader) error {
+	if err := m.BlockHash.Deserialize(r); err != nil {
+		return err
+	}
+	count, err := readCount(r, "transaction", maxBlockTxs())
+	if err != nil {
+		return err
+	}
+	m.Txs = make([]*core.Transaction, 0, count)
+	for i := uint64(0); i < count; i++ {
+		tx := new(core.Transaction)
+		if err := tx.Deserialize(r); err != nil {
+			return err
+		}
+		m.Txs = append(m.Txs, tx)
+	}
+	return nil
+}
+
+// partialBlock is a compact block waiting for the missing transactions.
+type partialBlock struct {
+	header  core.Header
+	txs     []*core.Transaction
+	missing []uint16
+}
+
+// fill fills the missing transactions and returns the block if the
+// transactions match the merkle root of the header.
+func (p *partialBlock) fill(txs []*core.Transaction) (*core.Block, error) {
+	if len(txs) != len(p.missing) {
+		return nil, errors.New("missing transactions count mismatch")
+	}
+	for i, index := range p.missing {
+		p.txs[index] = txs[i]
+	}
+	return newReconstructedBlock(p.header, p.txs)
+}
+
+func newReconstructedBlock(header core.Header, txs []*core.Transaction) (*core.Block, error) {
+	txIds := make([]Uint256, 0, len(txs))
+	for _, tx := range txs {
+		txIds = append(txIds, tx.Hash())
+	}
+	root, err := crypto.ComputeRoot(txIds)
+	if err != nil {
+		return nil, err
+	}
+	if !header.MerkleRoot.IsEqual(root) {
+		return nil, ErrMerkleRootMismatch
+	}
+	return &core.Block{Header: header, Transactions: txs}, nil
+}
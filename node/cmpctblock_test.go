@@ -0,0 +1,142 @@
+package node
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBlock(t *testing.T, count int) *core.Block {
+	txs := []*core.Transaction{{
+		TxType:  core.CoinBase,
+		Payload: &core.PayloadCoinBase{CoinbaseData: []byte("coinbase")},
+	}}
+	for i := 0; i < count; i++ {
+		txs = append(txs, &core.Transaction{
+			TxType:   core.TransferAsset,
+			Payload:  &core.PayloadTransferAsset{},
+			LockTime: uint32(i),
+		})
+	}
+
+	txIds := make([]common.Uint256, 0, len(txs))
+	for _, tx := range txs {
+		txIds = append(txIds, tx.Hash())
+	}
+	root, err := crypto.ComputeRoot(txIds)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return &core.Block{Header: core.Header{MerkleRoot: root, Height: 100}, Transactions: txs}
+}
+
+func TestCmpctBlock_Reconstruct(t *testing.T) {
+	block := newTestBlock(t, 10)
+	cmpctBlock := NewCmpctBlock(block, 12345)
+	assert.Equal(t, len(block.Transactions), cmpctBlock.TxCount())
+
+	// all transactions in pool
+	pool := make(map[common.Uint256]*core.Transaction)
+	for _, tx := range block.Transactions[1:] {
+		pool[tx.Hash()] = tx
+	}
+	txs, missing, err := cmpctBlock.Reconstruct(pool)
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+	reconstructed, err := newReconstructedBlock(cmpctBlock.Header, txs)
+	assert.NoError(t, err)
+	assert.Equal(t, block.Hash(), reconstructed.Hash())
+
+	// missing transactions requested and filled
+	delete(pool, block.Transactions[3].Hash())
+	delete(pool, block.Transactions[7].Hash())
+	txs, missing, err = cmpctBlock.Reconstruct(pool)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{3, 7}, missing)
+	partial := &partialBlock{header: cmpctBlock.Header, txs: txs, missing: missing}
+	reconstructed, err = partial.fill([]*core.Transaction{block.Transactions[3], block.Transactions[7]})
+	assert.NoError(t, err)
+	assert.Equal(t, block.Hash(), reconstructed.Hash())
+
+	// wrong transactions filled
+	txs, missing, err = cmpctBlock.Reconstruct(pool)
+	assert.NoError(t, err)
+	partial = &partialBlock{header: cmpctBlock.Header, txs: txs, missing: missing}
+	_, err = partial.fill([]*core.Transaction{block.Transactions[7], block.Transactions[3]})
+	assert.Equal(t, ErrMerkleRootMismatch, err)
+	_, err = partial.fill([]*core.Transaction{block.Transactions[3]})
+	assert.Error(t, err)
+
+	// short id collision within the block
+	collided := *cmpctBlock
+	collided.ShortIDs = append([]uint64{}, cmpctBlock.ShortIDs...)
+	collided.ShortIDs[1] = collided.ShortIDs[0]
+	_, _, err = collided.Reconstruct(pool)
+	assert.Equal(t, ErrShortIDCollision, err)
+
+	// invalid prefilled index
+	invalid := *cmpctBlock
+	invalid.PrefilledTxs = []PrefilledTx{{Index: uint16(cmpctBlock.TxCount()), Tx: block.Transactions[0]}}
+	_, _, err = invalid.Reconstruct(pool)
+	assert.Error(t, err)
+
+	// short ids differ with the nonce
+	assert.NotEqual(t, cmpctBlock.ShortIDs, NewCmpctBlock(block, 54321).ShortIDs)
+
+	t.Log("[TestCmpctBlock_Reconstruct] PASSED")
+}
+
+func TestBlockTxn_Serialize(t *testing.T) {
+	block := newTestBlock(t, 3)
+
+	getBlockTxn := &GetBlockTxn{BlockHash: block.Hash(), Indexes: []uint16{1, 3}}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, getBlockTxn.Serialize(buf))
+	var getBlockTxn2 GetBlockTxn
+	assert.NoError(t, getBlockTxn2.Deserialize(buf))
+	assert.Equal(t, *getBlockTxn, getBlockTxn2)
+
+	blockTxn := &BlockTxn{BlockHash: block.Hash(), Txs: block.Transactions[1:]}
+	buf = new(bytes.Buffer)
+	assert.NoError(t, blockTxn.Serialize(buf))
+	var blockTxn2 BlockTxn
+	assert.NoError(t, blockTxn2.Deserialize(buf))
+	assert.Equal(t, blockTxn.BlockHash, blockTxn2.BlockHash)
+	for i, tx := range blockTxn.Txs {
+		assert.Equal(t, tx.Hash(), blockTxn2.Txs[i].Hash())
+	}
+
+	t.Log("[TestBlockTxn_Serialize] PASSED")
+}
+
+func TestCmpctBlock_DeserializeCounts(t *testing.T) {
+	block := newTestBlock(t, 1)
+	hash := block.Hash()
+
+	// a count beyond the bound is rejected before anything is allocated
+	buf := new(bytes.Buffer)
+	assert.NoError(t, hash.Serialize(buf))
+	common.WriteVarUint(buf, ^uint64(0))
+	var getBlockTxn GetBlockTxn
+	assert.Error(t, getBlockTxn.Deserialize(buf))
+
+	buf = new(bytes.Buffer)
+	assert.NoError(t, hash.Serialize(buf))
+	common.WriteVarUint(buf, maxBlockTxs()+1)
+	var blockTxn BlockTxn
+	assert.Error(t, blockTxn.Deserialize(buf))
+
+	buf = new(bytes.Buffer)
+	assert.NoError(t, block.Header.Serialize(buf))
+	common.WriteUint64(buf, 0)
+	common.WriteVarUint(buf, ^uint64(0))
+	var cmpctBlock CmpctBlock
+	assert.Error(t, cmpctBlock.Deserialize(buf))
+
+	t.Log("[TestCmpctBlock_DeserializeCounts] PASSED")
+}
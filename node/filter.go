@@ -0,0 +1,72 @@
+package node
+
+import (
+	"fmt"
+	"io"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const (
+	CmdFilterAdd   = "filteradd"
+	CmdFilterClear = "filterclear"
+
+	// MaxFilterAddDataSize is the max size in bytes of the data element a
+	// filteradd message adds to the bloom filter.
+	MaxFilterAddDataSize = 520
+)
+
+// FilterAdd adds a data element to the bloom filter loaded by the peer, such
+// as a program hash or an outpoint the wallet starts watching.
+type FilterAdd struct {
+	Data []byte
+}
+
+func (m *FilterAdd) CMD() string {
+	return CmdFilterAdd
+}
+
+func (m *FilterAdd) MaxLength() uint32 {
+	return MaxFilterAddDataSize + 9
+}
+
+func (m *FilterAdd) Serialize(w io.Writer) error {
+	if err := WriteVarUint(w, uint64(len(m.Data))); err != nil {
+		return err
+	}
+	_, err := w.Write(m.Data)
+	return err
+}
+
+func (m *FilterAdd) Deserialize(r io.Reader) error {
+	size, err := ReadVarUint(r, 0)
+	if err != nil {
+		return err
+	}
+	if size > MaxFilterAddDataSize {
+		return fmt.Errorf("filteradd data size %d exceeds the max %d", size, MaxFilterAddDataSize)
+	}
+	m.Data = make([]byte, size)
+	_, err = io.ReadFull(r, m.Data)
+	return err
+}
+
+// FilterClear removes the bloom filter loaded by the peer, the blocks and
+// the transactions are relayed in full again.
+type FilterClear struct{}
+
+func (m *FilterClear) CMD() string {
+	return CmdFilterClear
+}
+
+func (m *FilterClear) MaxLength() uint32 {
+	return 0
+}
+
+func (m *FilterClear) Serialize(w io.Writer) error {
+	return nil
+}
+
+func (m *FilterClear) Deserialize(r io.Reader) error {
+	return nil
+}
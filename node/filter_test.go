@@ -0,0 +1,33 @@
+package node
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterAdd_Serialize(t *testing.T) {
+	// case 1: a program hash added to the filter
+	programHash := common.Uint168{common.PrefixStandard, 0x01, 0x02}
+	filterAdd := &FilterAdd{Data: programHash[:]}
+	buf := new(bytes.Buffer)
+	if !assert.NoError(t, filterAdd.Serialize(buf)) {
+		t.FailNow()
+	}
+	decoded := new(FilterAdd)
+	assert.NoError(t, decoded.Deserialize(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, filterAdd.Data, decoded.Data)
+
+	// case 2: data larger than MaxFilterAddDataSize
+	filterAdd = &FilterAdd{Data: make([]byte, MaxFilterAddDataSize+1)}
+	buf = new(bytes.Buffer)
+	if !assert.NoError(t, filterAdd.Serialize(buf)) {
+		t.FailNow()
+	}
+	err := new(FilterAdd).Deserialize(bytes.NewReader(buf.Bytes()))
+	assert.EqualError(t, err, "filteradd data size 521 exceeds the max 520")
+
+	t.Log("[TestFilterAdd_Serialize] PASSED")
+}
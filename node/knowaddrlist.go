@@ -1,13 +1,22 @@
 package node
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
 	"math/rand"
+	"net"
+	"sort"
 	"sync"
 	"time"
 
+	chain "github.com/elastos/Elastos.ELA.SideChain/blockchain"
 	"github.com/elastos/Elastos.ELA.SideChain/log"
 	. "github.com/elastos/Elastos.ELA.SideChain/protocol"
 
+	"github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA.Utility/p2p"
 )
 
@@ -21,19 +30,30 @@ const (
 	// numRetries is the number of tried without a single success before
 	// we assume an address is bad.
 	numRetries = 10
+	// newBucketCount is the number of buckets the addresses never connected
+	// successfully are spread over by network group.
+	newBucketCount = 1024
+	// triedBucketCount is the number of buckets the addresses connected
+	// successfully are spread over by network group.
+	triedBucketCount = 256
+	// peersDBFile is the leveldb file the known addresses are persisted to.
+	peersDBFile = "Peers"
 )
 
 type KnownAddress struct {
 	srcAddr        p2p.NetAddress
 	lastattempt    time.Time
 	lastDisconnect time.Time
+	lastSuccess    time.Time
 	attempts       int
+	tried          bool
 }
 
 type KnownAddressList struct {
 	sync.RWMutex
 	List      map[uint64]*KnownAddress
 	addrCount uint64
+	store     chain.IStore
 }
 
 func (ka *KnownAddress) LastAttempt() time.Time {
@@ -54,6 +74,81 @@ func (ka *KnownAddress) updateLastDisconnect() {
 	ka.lastDisconnect = time.Now()
 }
 
+// markGood moves the address to the tried buckets and resets the failed
+// attempts after a successful handshake.
+func (ka *KnownAddress) markGood() {
+	ka.lastSuccess = time.Now()
+	ka.attempts = 0
+	ka.tried = true
+}
+
+// group returns the network group of the address, the /16 of an IPv4 address
+// or the /32 of an IPv6 address.
+func (ka *KnownAddress) group() string {
+	ip := net.IP(ka.srcAddr.IP[:])
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d", ip4[0], ip4[1])
+	}
+	return ip.Mask(net.CIDRMask(32, 128)).String()
+}
+
+// bucket returns the index of the new or tried bucket of the address.
+func (ka *KnownAddress) bucket() int {
+	h := fnv.New32a()
+	h.Write([]byte(ka.group()))
+	if ka.tried {
+		return int(h.Sum32() % triedBucketCount)
+	}
+	return int(h.Sum32() % newBucketCount)
+}
+
+// knownAddressRecord is the persisted form of a known address.
+type knownAddressRecord struct {
+	Time        int64
+	Services    uint64
+	IP          [16]byte
+	Port        uint16
+	ID          uint64
+	LastAttempt int64
+	LastSuccess int64
+	Attempts    int32
+	Tried       bool
+}
+
+func (ka *KnownAddress) Serialize(w io.Writer) error {
+	na := ka.srcAddr
+	return binary.Write(w, binary.LittleEndian, &knownAddressRecord{
+		Time:        na.Time,
+		Services:    na.Services,
+		IP:          na.IP,
+		Port:        na.Port,
+		ID:          na.ID,
+		LastAttempt: ka.lastattempt.Unix(),
+		LastSuccess: ka.lastSuccess.Unix(),
+		Attempts:    int32(ka.attempts),
+		Tried:       ka.tried,
+	})
+}
+
+func (ka *KnownAddress) Deserialize(r io.Reader) error {
+	var record knownAddressRecord
+	if err := binary.Read(r, binary.LittleEndian, &record); err != nil {
+		return err
+	}
+	ka.srcAddr = p2p.NetAddress{
+		Time:     record.Time,
+		Services: record.Services,
+		IP:       record.IP,
+		Port:     record.Port,
+		ID:       record.ID,
+	}
+	ka.lastattempt = time.Unix(record.LastAttempt, 0)
+	ka.lastSuccess = time.Unix(record.LastSuccess, 0)
+	ka.attempts = int(record.Attempts)
+	ka.tried = record.Tried
+	return nil
+}
+
 // chance returns the selection probability for a known address.  The priority
 // depends upon how recently the address has been seen, how recently it was last
 // attempted and how often attempts to connect to it have failed.
@@ -77,6 +172,11 @@ func (ka *KnownAddress) chance() float64 {
 		c /= 1.5
 	}
 
+	// Addresses never connected are less likely to be tried.
+	if !ka.tried {
+		c *= 0.5
+	}
+
 	return c
 }
 
@@ -154,6 +254,84 @@ func (al *KnownAddressList) UpdateLastDisconn(id uint64) {
 	ka.updateLastDisconnect()
 }
 
+// AddressGood marks the address connected successfully, it is moved to the
+// tried buckets.
+func (al *KnownAddressList) AddressGood(id uint64) {
+	al.Lock()
+	defer al.Unlock()
+
+	ka, ok := al.List[id]
+	if !ok {
+		return
+	}
+	ka.markGood()
+	al.saveAddress(ka)
+}
+
+// AddressInfo returns the bucket and connection stats of the address.
+func (al *KnownAddressList) AddressInfo(id uint64) (AddressInfo, bool) {
+	al.RLock()
+	defer al.RUnlock()
+
+	ka, ok := al.List[id]
+	if !ok {
+		return AddressInfo{}, false
+	}
+	return AddressInfo{
+		Tried:       ka.tried,
+		Bucket:      ka.bucket(),
+		LastSeen:    time.Unix(0, ka.srcAddr.Time).Unix(),
+		LastAttempt: ka.lastattempt.Unix(),
+		LastSuccess: ka.lastSuccess.Unix(),
+		Attempts:    ka.attempts,
+	}, true
+}
+
+func (al *KnownAddressList) saveAddress(ka *KnownAddress) {
+	if al.store == nil {
+		return
+	}
+	key := new(bytes.Buffer)
+	common.WriteUint64(key, ka.GetID())
+	value := new(bytes.Buffer)
+	if err := ka.Serialize(value); err != nil {
+		log.Warn("serialize known address failed:", err)
+		return
+	}
+	if err := al.store.Put(key.Bytes(), value.Bytes()); err != nil {
+		log.Warn("save known address failed:", err)
+	}
+}
+
+func (al *KnownAddressList) deleteAddress(id uint64) {
+	if al.store == nil {
+		return
+	}
+	key := new(bytes.Buffer)
+	common.WriteUint64(key, id)
+	al.store.Delete(key.Bytes())
+}
+
+// loadAddresses loads the addresses persisted in the store, the bad ones are
+// dropped.
+func (al *KnownAddressList) loadAddresses() {
+	iter := al.store.NewIterator(nil)
+	defer iter.Release()
+	for iter.Next() {
+		ka := new(KnownAddress)
+		if err := ka.Deserialize(bytes.NewReader(iter.Value())); err != nil {
+			log.Warn("invalid known address:", err)
+			continue
+		}
+		if ka.isBad() {
+			al.store.Delete(iter.Key())
+			continue
+		}
+		al.List[ka.GetID()] = ka
+		al.addrCount++
+	}
+}
+
 func (al *KnownAddressList) AddAddressToKnownAddress(na p2p.NetAddress) {
 	al.Lock()
 	defer al.Unlock()
@@ -163,10 +341,12 @@ func (al *KnownAddressList) AddAddressToKnownAddress(na p2p.NetAddress) {
 	if al.AddressExisted(ka.GetID()) {
 		log.Debug("It is a existed addr\n")
 		al.UpdateAddress(ka.GetID(), na)
+		ka = al.List[ka.GetID()]
 	} else {
 		al.List[ka.GetID()] = ka
 		al.addrCount++
 	}
+	al.saveAddress(ka)
 }
 
 func (al *KnownAddressList) DelAddressFromList(id uint64) bool {
@@ -178,6 +358,7 @@ func (al *KnownAddressList) DelAddressFromList(id uint64) bool {
 		return false
 	}
 	delete(al.List, id)
+	al.deleteAddress(id)
 	return true
 }
 
@@ -192,6 +373,14 @@ func (al *KnownAddressList) GetAddressCnt() uint64 {
 
 func (al *KnownAddressList) init() {
 	al.List = make(map[uint64]*KnownAddress)
+
+	store, err := chain.NewLevelDB(peersDBFile)
+	if err != nil {
+		log.Warn("open peers database failed, known addresses will not be persisted:", err)
+		return
+	}
+	al.store = store
+	al.loadAddresses()
 }
 
 func isInNbrList(id uint64, nbrAddrs []p2p.NetAddress) bool {
@@ -203,52 +392,60 @@ func isInNbrList(id uint64, nbrAddrs []p2p.NetAddress) bool {
 	return false
 }
 
+// RandGetAddresses selects the addresses to connect to, addresses with higher
+// chance are preferred and at most one address is selected from a network
+// group unless there are not enough groups.
 func (al *KnownAddressList) RandGetAddresses(nbrAddrs []p2p.NetAddress) []p2p.NetAddress {
-	al.RLock()
-	defer al.RUnlock()
-	var keys []uint64
-	for k := range al.List {
-		isInNbr := isInNbrList(k, nbrAddrs)
-		isBad := al.List[k].isBad()
-		if isInNbr == false && isBad == false {
-			keys = append(keys, k)
-		}
+	al.Lock()
+	defer al.Unlock()
+
+	count := MaxOutBoundCount - len(nbrAddrs)
+	if count <= 0 {
+		return nil
 	}
 
-	addrLen := len(keys)
-	var i int
-	addrs := []p2p.NetAddress{}
-	if MaxOutBoundCount-len(nbrAddrs) > addrLen {
-		for _, v := range keys {
-			ka, ok := al.List[v]
-			if !ok {
-				continue
-			}
-			ka.increaseAttempts()
-			ka.updateLastAttempt()
-			addrs = append(addrs, ka.srcAddr)
+	groups := make(map[string]bool)
+	for _, na := range nbrAddrs {
+		ka := KnownAddress{srcAddr: na}
+		groups[ka.group()] = true
+	}
+
+	var candidates []*KnownAddress
+	for k, ka := range al.List {
+		if !isInNbrList(k, nbrAddrs) && !ka.isBad() {
+			candidates = append(candidates, ka)
 		}
-	} else {
-		order := rand.Perm(addrLen)
-		var count int
-		count = MaxOutBoundCount - len(nbrAddrs)
-		for i = 0; i < count; i++ {
-			for j, v := range keys {
-				if j == order[j] {
-					ka, ok := al.List[v]
-					if !ok {
-						continue
-					}
-					ka.increaseAttempts()
-					ka.updateLastAttempt()
-					addrs = append(addrs, ka.srcAddr)
-					keys = append(keys[:j], keys[j+1:]...)
-					break
-				}
-			}
+	}
+	for i := len(candidates) - 1; i > 0; i-- {
+		j := rand.Intn(i + 1)
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].chance() > candidates[j].chance()
+	})
+
+	selected := make([]*KnownAddress, 0, count)
+	picked := make(map[uint64]bool)
+	for _, ka := range candidates {
+		if len(selected) < count && !groups[ka.group()] {
+			groups[ka.group()] = true
+			picked[ka.GetID()] = true
+			selected = append(selected, ka)
+		}
+	}
+	for _, ka := range candidates {
+		if len(selected) < count && !picked[ka.GetID()] {
+			selected = append(selected, ka)
 		}
 	}
 
+	addrs := make([]p2p.NetAddress, 0, len(selected))
+	for _, ka := range selected {
+		ka.increaseAttempts()
+		ka.updateLastAttempt()
+		al.saveAddress(ka)
+		addrs = append(addrs, ka.srcAddr)
+	}
 	return addrs
 }
 
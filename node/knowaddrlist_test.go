@@ -0,0 +1,100 @@
+package node
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain/protocol"
+
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/stretchr/testify/assert"
+)
+
+func newNetAddress(id uint64, ip string) p2p.NetAddress {
+	na := p2p.NetAddress{Time: time.Now().UnixNano(), Port: 20608, ID: id}
+	copy(na.IP[:], net.ParseIP(ip).To16())
+	return na
+}
+
+func TestKnownAddress_Serialize(t *testing.T) {
+	ka := &KnownAddress{srcAddr: newNetAddress(1, "10.1.2.3")}
+	ka.increaseAttempts()
+	ka.updateLastAttempt()
+	ka.markGood()
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, ka.Serialize(buf))
+	ka2 := new(KnownAddress)
+	assert.NoError(t, ka2.Deserialize(buf))
+	assert.Equal(t, ka.srcAddr, ka2.srcAddr)
+	assert.Equal(t, ka.lastattempt.Unix(), ka2.lastattempt.Unix())
+	assert.Equal(t, ka.lastSuccess.Unix(), ka2.lastSuccess.Unix())
+	assert.Equal(t, 0, ka2.attempts)
+	assert.True(t, ka2.tried)
+
+	t.Log("[TestKnownAddress_Serialize] PASSED")
+}
+
+func TestKnownAddress_Bucket(t *testing.T) {
+	ka1 := &KnownAddress{srcAddr: newNetAddress(1, "10.1.2.3")}
+	ka2 := &KnownAddress{srcAddr: newNetAddress(2, "10.1.200.4")}
+	ka3 := &KnownAddress{srcAddr: newNetAddress(3, "2001:db8::1")}
+
+	// same /16 in the same group
+	assert.Equal(t, "10.1", ka1.group())
+	assert.Equal(t, ka1.group(), ka2.group())
+	assert.Equal(t, ka1.bucket(), ka2.bucket())
+	assert.Equal(t, "2001:db8::", ka3.group())
+
+	// moved to the tried buckets after connected
+	assert.True(t, ka1.bucket() < newBucketCount)
+	ka1.markGood()
+	assert.True(t, ka1.tried)
+	assert.True(t, ka1.bucket() < triedBucketCount)
+
+	t.Log("[TestKnownAddress_Bucket] PASSED")
+}
+
+func TestKnownAddressList_RandGetAddresses(t *testing.T) {
+	var al KnownAddressList
+	al.List = make(map[uint64]*KnownAddress)
+
+	// many addresses in one group and one address in each other group
+	for id := uint64(1); id <= 10; id++ {
+		al.AddAddressToKnownAddress(newNetAddress(id, fmt.Sprintf("10.1.0.%d", id)))
+	}
+	al.AddAddressToKnownAddress(newNetAddress(11, "10.2.0.1"))
+	al.AddAddressToKnownAddress(newNetAddress(12, "10.3.0.1"))
+	al.AddAddressToKnownAddress(newNetAddress(13, "10.4.0.1"))
+
+	// one address from each group before filling with the same group
+	nbrAddrs := []p2p.NetAddress{newNetAddress(100, "10.4.0.2")}
+	addrs := al.RandGetAddresses(nbrAddrs)
+	assert.Len(t, addrs, protocol.MaxOutBoundCount-len(nbrAddrs))
+	groups := make(map[string]int)
+	for _, na := range addrs {
+		ka := KnownAddress{srcAddr: na}
+		groups[ka.group()]++
+	}
+	assert.Equal(t, 1, groups["10.2"])
+	assert.Equal(t, 1, groups["10.3"])
+
+	// failed attempts decay the chance
+	for _, na := range addrs {
+		assert.Equal(t, 1, al.List[na.ID].attempts)
+	}
+	al.AddressGood(11)
+	assert.Equal(t, 0, al.List[11].attempts)
+	info, ok := al.AddressInfo(11)
+	assert.True(t, ok)
+	assert.True(t, info.Tried)
+
+	// no address needed
+	nbrAddrs = make([]p2p.NetAddress, protocol.MaxOutBoundCount)
+	assert.Empty(t, al.RandGetAddresses(nbrAddrs))
+
+	t.Log("[TestKnownAddressList_RandGetAddresses] PASSED")
+}
@@ -6,7 +6,7 @@ import (
 	"time"
 
 	chain "github.com/elastos/Elastos.ELA.SideChain/blockchain"
-	"github.com/elastos/Elastos.ELA.SideChain/bloom"
+	"github.com/elastos/Elastos.ELA.SideChain/config"
 	"github.com/elastos/Elastos.ELA.SideChain/core"
 	"github.com/elastos/Elastos.ELA.SideChain/errors"
 	"github.com/elastos/Elastos.ELA.SideChain/events"
@@ -21,14 +21,19 @@ import (
 type MsgHandlerV1 struct {
 	node         protocol.Noder
 	continueHash *common.Uint256
+	partial      *partialBlock
 }
 
 // When something wrong on read or decode message
 // this method will callback the error
 func (h *MsgHandlerV1) OnError(err error) {
 	switch err {
+	case p2p.ErrUnmatchedMagic:
+		// the peer runs another network
+		log.Warnf("[MsgHandler] %s, peer %s is not on %s", err, h.node.Addr(),
+			config.Parameters.ChainParam.Name)
+		h.node.CloseConn()
 	case p2p.ErrInvalidHeader,
-		p2p.ErrUnmatchedMagic,
 		p2p.ErrMsgSizeExceeded:
 		log.Error(err)
 		h.node.CloseConn()
@@ -62,6 +67,10 @@ func (h *MsgHandlerV1) OnMakeMessage(cmd string) (message p2p.Message, err error
 		message = new(msg.Pong)
 	case p2p.CmdFilterLoad:
 		message = new(msg.FilterLoad)
+	case CmdFilterAdd:
+		message = new(FilterAdd)
+	case CmdFilterClear:
+		message = new(FilterClear)
 	case p2p.CmdGetBlocks:
 		message = new(msg.GetBlocks)
 	case p2p.CmdInv:
@@ -78,6 +87,12 @@ func (h *MsgHandlerV1) OnMakeMessage(cmd string) (message p2p.Message, err error
 		message = new(msg.MemPool)
 	case p2p.CmdReject:
 		message = new(msg.Reject)
+	case CmdCmpctBlock:
+		message = new(CmpctBlock)
+	case CmdGetBlockTxn:
+		message = new(GetBlockTxn)
+	case CmdBlockTxn:
+		message = new(BlockTxn)
 	default:
 		err = fmt.Errorf("unknown message type")
 	}
@@ -104,6 +119,10 @@ func (h *MsgHandlerV1) OnMessageDecoded(message p2p.Message) {
 		err = h.onPong(message)
 	case *msg.FilterLoad:
 		err = h.onFilterLoad(message)
+	case *FilterAdd:
+		err = h.onFilterAdd(message)
+	case *FilterClear:
+		err = h.onFilterClear(message)
 	case *msg.GetBlocks:
 		err = h.onGetBlocks(message)
 	case *msg.Inventory:
@@ -120,6 +139,12 @@ func (h *MsgHandlerV1) OnMessageDecoded(message p2p.Message) {
 		err = h.onMemPool(message)
 	case *msg.Reject:
 		err = h.onReject(message)
+	case *CmpctBlock:
+		err = h.onCmpctBlock(message)
+	case *GetBlockTxn:
+		err = h.onGetBlockTxn(message)
+	case *BlockTxn:
+		err = h.onBlockTxn(message)
 	default:
 		err = fmt.Errorf("unknown message type")
 	}
@@ -191,6 +216,7 @@ func (h *MsgHandlerV1) onVerAck(verAck *msg.VerAck) error {
 	}
 
 	node.SetState(p2p.ESTABLISH)
+	LocalNode.AddressGood(node.ID())
 	go node.Heartbeat()
 
 	if LocalNode.NeedMoreAddresses() {
@@ -242,6 +268,34 @@ func (h *MsgHandlerV1) onFilterLoad(msg *msg.FilterLoad) error {
 	return nil
 }
 
+func (h *MsgHandlerV1) onFilterAdd(msg *FilterAdd) error {
+	// Only allow filteradd requests if server enabled OpenService
+	if LocalNode.Services()&protocol.OpenService != protocol.OpenService {
+		h.node.CloseConn()
+		return fmt.Errorf("peer %d sent filteradd request with open service disabled", h.node.ID())
+	}
+
+	// An element can only be added to a loaded filter
+	if !h.node.BloomFilter().IsLoaded() {
+		h.node.CloseConn()
+		return fmt.Errorf("peer %d sent filteradd request with no filter loaded", h.node.ID())
+	}
+
+	h.node.BloomFilter().Add(msg.Data)
+	return nil
+}
+
+func (h *MsgHandlerV1) onFilterClear(msg *FilterClear) error {
+	// Only allow filterclear requests if server enabled OpenService
+	if LocalNode.Services()&protocol.OpenService != protocol.OpenService {
+		h.node.CloseConn()
+		return fmt.Errorf("peer %d sent filterclear request with open service disabled", h.node.ID())
+	}
+
+	h.node.BloomFilter().Unload()
+	return nil
+}
+
 func (h *MsgHandlerV1) onPing(ping *msg.Ping) error {
 	h.node.SetHeight(ping.Nonce)
 	h.node.Send(msg.NewPong(chain.DefaultLedger.Blockchain.BestChain.Height))
@@ -331,6 +385,7 @@ func (h *MsgHandlerV1) onInventory(inv *msg.Inventory) error {
 				SendGetBlocks(node, locator, common.EmptyHash)
 			}
 		case msg.InvTypeTx:
+			LocalNode.txRelay.AddKnown(node.ID(), hash)
 			if _, ok := LocalNode.GetTxInPool(hash); !ok {
 				getData.AddInvVect(iv)
 			}
@@ -391,15 +446,7 @@ func (h *MsgHandlerV1) onGetData(getData *msg.GetData) error {
 				return err
 			}
 
-			merkle, matchedIndexes := bloom.NewMerkleBlock(block, h.node.BloomFilter())
-
-			// Send merkleblock
-			node.Send(merkle)
-
-			// Send any matched transactions
-			for _, index := range matchedIndexes {
-				node.Send(msg.NewTx(block.Transactions[index]))
-			}
+			sendMerkleBlock(node, block)
 
 		default:
 			log.Warnf("Unknown type in inventory request %d", iv.Type)
@@ -424,6 +471,13 @@ func (h *MsgHandlerV1) onBlock(msgBlock *msg.Block) error {
 		return nil
 	}
 
+	return h.acceptBlock(block, msgBlock.CMD())
+}
+
+func (h *MsgHandlerV1) acceptBlock(block *core.Block, cmd string) error {
+	node := h.node
+	hash := block.Hash()
+
 	// Update sync timer
 	LocalNode.syncTimer.update()
 	chain.DefaultLedger.Store.RemoveHeaderListElement(hash)
@@ -431,10 +485,13 @@ func (h *MsgHandlerV1) onBlock(msgBlock *msg.Block) error {
 
 	_, isOrphan, err := chain.DefaultLedger.Blockchain.AddBlock(block)
 	if err != nil {
-		reject := msg.NewReject(msgBlock.CMD(), msg.RejectInvalid, err.Error())
+		reject := msg.NewReject(cmd, msg.RejectInvalid, err.Error())
 		reject.Hash = block.Hash()
 
 		node.Send(reject)
+		if err == chain.ErrCheckpointMismatch {
+			node.CloseConn()
+		}
 		return fmt.Errorf("Block add failed: %s ,block hash %s ", err.Error(), hash.String())
 	}
 
@@ -452,6 +509,81 @@ func (h *MsgHandlerV1) onBlock(msgBlock *msg.Block) error {
 	return nil
 }
 
+func (h *MsgHandlerV1) onCmpctBlock(cmpctBlock *CmpctBlock) error {
+	node := h.node
+	hash := cmpctBlock.Header.Hash()
+	if !LocalNode.IsNeighborNoder(node) {
+		return fmt.Errorf("received compact block message from unknown peer")
+	}
+
+	if chain.DefaultLedger.BlockInLedger(hash) {
+		log.Trace("Receive duplicated compact block, ", hash.String())
+		return nil
+	}
+
+	txs, missing, err := cmpctBlock.Reconstruct(LocalNode.GetTxsInPool())
+	if err != nil {
+		h.requestBlock(hash)
+		return fmt.Errorf("Compact block reconstruct failed: %s ,block hash %s ", err.Error(), hash.String())
+	}
+
+	if len(missing) > 0 {
+		h.partial = &partialBlock{header: cmpctBlock.Header, txs: txs, missing: missing}
+		node.Send(&GetBlockTxn{BlockHash: hash, Indexes: missing})
+		return nil
+	}
+
+	block, err := newReconstructedBlock(cmpctBlock.Header, txs)
+	if err != nil {
+		h.requestBlock(hash)
+		return fmt.Errorf("Compact block reconstruct failed: %s ,block hash %s ", err.Error(), hash.String())
+	}
+	return h.acceptBlock(block, cmpctBlock.CMD())
+}
+
+func (h *MsgHandlerV1) onGetBlockTxn(req *GetBlockTxn) error {
+	block, err := chain.DefaultLedger.Store.GetBlock(req.BlockHash)
+	if err != nil {
+		notFound := msg.NewNotFound()
+		notFound.AddInvVect(msg.NewInvVect(msg.InvTypeBlock, &req.BlockHash))
+		h.node.Send(notFound)
+		return err
+	}
+
+	resp := &BlockTxn{BlockHash: req.BlockHash, Txs: make([]*core.Transaction, 0, len(req.Indexes))}
+	for _, index := range req.Indexes {
+		if int(index) >= len(block.Transactions) {
+			return fmt.Errorf("peer %d requested block transaction index %d out of range", h.node.ID(), index)
+		}
+		resp.Txs = append(resp.Txs, block.Transactions[index])
+	}
+	h.node.Send(resp)
+	return nil
+}
+
+func (h *MsgHandlerV1) onBlockTxn(blockTxn *BlockTxn) error {
+	partial := h.partial
+	if partial == nil || !partial.header.Hash().IsEqual(blockTxn.BlockHash) {
+		return fmt.Errorf("received unrequested block transactions of block %s", blockTxn.BlockHash.String())
+	}
+	h.partial = nil
+
+	block, err := partial.fill(blockTxn.Txs)
+	if err != nil {
+		h.requestBlock(blockTxn.BlockHash)
+		return fmt.Errorf("Compact block reconstruct failed: %s ,block hash %s ", err.Error(), blockTxn.BlockHash.String())
+	}
+	return h.acceptBlock(block, blockTxn.CMD())
+}
+
+// requestBlock falls back to request the full block from the peer.
+func (h *MsgHandlerV1) requestBlock(hash common.Uint256) {
+	LocalNode.AddRequestedBlock(hash)
+	getData := msg.NewGetData()
+	getData.AddInvVect(msg.NewInvVect(msg.InvTypeBlock, &hash))
+	h.node.Send(getData)
+}
+
 func (h *MsgHandlerV1) onTx(msgTx *msg.Tx) error {
 	node := h.node
 	tx := msgTx.Transaction.(*core.Transaction)
@@ -464,6 +596,7 @@ func (h *MsgHandlerV1) onTx(msgTx *msg.Tx) error {
 		return nil
 	}
 
+	LocalNode.txRelay.AddKnown(node.ID(), tx.Hash())
 	if LocalNode.ExistedID(tx.Hash()) {
 		reject := msg.NewReject(msgTx.CMD(), msg.RejectDuplicate, "duplicate transaction")
 		reject.Hash = tx.Hash()
@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net"
 	"runtime"
 	"strconv"
@@ -53,6 +54,7 @@ type node struct {
 	eventQueue                  // The event queue to notice notice other modules
 	chain.TxPool                // Unconfirmed transaction pool
 	idCache                     // The buffer to store the id of the items which already be processed
+	txRelay                     // The transaction inventories known by and to be relayed to the neighbors
 	filter        *bloom.Filter // The bloom filter of a spv node
 	/*
 	 * |--|--|--|--|--|--|isSyncFailed|isSyncHeaders|
@@ -100,6 +102,10 @@ func InitLocalNode() Noder {
 	if Parameters.OpenService {
 		LocalNode.services += protocol.OpenService
 	}
+	LocalNode.services += CompactBlockService
+	if Parameters.PruneMode {
+		LocalNode.services += LimitedHistoryService
+	}
 	LocalNode.relay = true
 	idHash := sha256.Sum256([]byte(strconv.Itoa(int(time.Now().UnixNano()))))
 	binary.Read(bytes.NewBuffer(idHash[:8]), binary.LittleEndian, &(LocalNode.id))
@@ -110,14 +116,17 @@ func InitLocalNode() Noder {
 	LocalNode.TxPool.Init()
 	LocalNode.eventQueue.init()
 	LocalNode.idCache.init()
+	LocalNode.txRelay.init()
 	LocalNode.cachedHashes = make([]Uint256, 0)
 	LocalNode.nodeDisconnectSubscriber = LocalNode.GetEvent("disconnect").Subscribe(events.EventNodeDisconnect, LocalNode.NodeDisconnect)
+	chain.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventBlockPersistCompleted, LocalNode.BlockPersistCompleted)
 	LocalNode.RequestedBlockList = make(map[Uint256]time.Time)
 	LocalNode.handshakeQueue.init()
 	LocalNode.syncTimer = newSyncTimer(LocalNode.stopSyncing)
 	LocalNode.initConnection()
 	go LocalNode.updateConnection()
 	go LocalNode.updateNodeInfo()
+	go LocalNode.relayTransactions()
 
 	return LocalNode
 }
@@ -197,6 +206,7 @@ func (n *node) NodeDisconnect(v interface{}) {
 		conn := node.GetConn()
 		conn.Close()
 		LocalNode.nbrNodes.DelNbrNode(n.ID())
+		LocalNode.txRelay.RemovePeer(node.ID())
 	}
 }
 
@@ -309,6 +319,7 @@ func (node *node) Relay(from Noder, message interface{}) error {
 		return nil
 	}
 
+	var cmpctBlock *CmpctBlock
 	for _, nbr := range node.GetNeighborNoder() {
 		if from == nil || nbr.ID() != from.ID() {
 
@@ -316,20 +327,19 @@ func (node *node) Relay(from Noder, message interface{}) error {
 			case *Transaction:
 				log.Debug("Relay transaction message")
 
-				if nbr.ExistHash(message.Hash()) {
+				txId := message.Hash()
+				if nbr.ExistHash(txId) {
 					continue
 				}
 
-				if nbr.BloomFilter().IsLoaded() && nbr.BloomFilter().MatchTxAndUpdate(message) {
-					inv := msg.NewInventory()
-					txId := message.Hash()
-					inv.AddInvVect(msg.NewInvVect(msg.InvTypeTx, &txId))
-					nbr.Send(inv)
+				if nbr.BloomFilter().IsLoaded() {
+					if nbr.BloomFilter().MatchTxAndUpdate(message) {
+						node.txRelay.Queue(nbr.ID(), txId)
+					}
 					continue
 				}
 
-				if nbr.IsRelay() {
-					nbr.Send(msg.NewTx(message))
+				if nbr.IsRelay() && node.txRelay.Queue(nbr.ID(), txId) {
 					node.txnCnt++
 				}
 			case *Block:
@@ -340,15 +350,19 @@ func (node *node) Relay(from Noder, message interface{}) error {
 				}
 
 				if nbr.BloomFilter().IsLoaded() {
-					inv := msg.NewInventory()
-					blockHash := message.Hash()
-					inv.AddInvVect(msg.NewInvVect(msg.InvTypeBlock, &blockHash))
-					nbr.Send(inv)
+					sendMerkleBlock(nbr, message)
 					continue
 				}
 
 				if nbr.IsRelay() {
-					nbr.Send(msg.NewBlock(message))
+					if !supportsCmpctBlock(nbr) {
+						nbr.Send(msg.NewBlock(message))
+						continue
+					}
+					if cmpctBlock == nil {
+						cmpctBlock = NewCmpctBlock(message, rand.Uint64())
+					}
+					nbr.Send(cmpctBlock)
 				}
 			default:
 				log.Warn("unknown relay message type")
@@ -360,6 +374,24 @@ func (node *node) Relay(from Noder, message interface{}) error {
 	return nil
 }
 
+// sendMerkleBlock sends the merkle block of the transactions of the block
+// matching the bloom filter of the neighbor, followed by the matched
+// transactions.
+func sendMerkleBlock(nbr Noder, block *Block) {
+	merkle, matchedIndexes := bloom.NewMerkleBlock(block, nbr.BloomFilter())
+	nbr.Send(merkle)
+	for _, index := range matchedIndexes {
+		nbr.Send(msg.NewTx(block.Transactions[index]))
+	}
+}
+
+// supportsCmpctBlock returns if both the local node and the neighbor
+// advertised the compact block service in the version handshake.
+func supportsCmpctBlock(nbr Noder) bool {
+	return LocalNode.Services()&CompactBlockService != 0 &&
+		nbr.Services()&CompactBlockService != 0
+}
+
 func (node *node) ExistHash(hash Uint256) bool {
 	node.cachelock.Lock()
 	defer node.cachelock.Unlock()
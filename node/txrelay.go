@@ -0,0 +1,199 @@
+package node
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.SideChain/core"
+	. "github.com/elastos/Elastos.ELA.SideChain/protocol"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+)
+
+const (
+	// TxRelayInterval is the interval to flush the pending transaction
+	// inventories to the neighbors.
+	TxRelayInterval = 500 * time.Millisecond
+
+	// TxRelayMaxDelay is the max random delay added to each neighbor's flush,
+	// so the neighbors can not tell the origin of a transaction by timing.
+	TxRelayMaxDelay = 200 * time.Millisecond
+
+	// MaxTxInvPerMsg is the max number of transaction inventories sent in one
+	// inventory message.
+	MaxTxInvPerMsg = 1000
+
+	// MaxKnownInventory is the max number of transaction hashes remembered as
+	// known by each neighbor.
+	MaxKnownInventory = 5000
+)
+
+// knownInventory is a bounded set of transaction hashes, the oldest hash is
+// evicted when the set is full.
+type knownInventory struct {
+	index  int
+	hashes []Uint256
+	set    map[Uint256]struct{}
+}
+
+func newKnownInventory(capacity int) *knownInventory {
+	return &knownInventory{
+		hashes: make([]Uint256, 0, capacity),
+		set:    make(map[Uint256]struct{}, capacity),
+	}
+}
+
+func (k *knownInventory) add(hash Uint256) {
+	if _, ok := k.set[hash]; ok {
+		return
+	}
+	if len(k.hashes) < cap(k.hashes) {
+		k.hashes = append(k.hashes, hash)
+	} else {
+		delete(k.set, k.hashes[k.index])
+		k.hashes[k.index] = hash
+		k.index = (k.index + 1) % len(k.hashes)
+	}
+	k.set[hash] = struct{}{}
+}
+
+func (k *knownInventory) exists(hash Uint256) bool {
+	_, ok := k.set[hash]
+	return ok
+}
+
+// peerInventory is the relay state of a neighbor.
+type peerInventory struct {
+	known   *knownInventory
+	pending []Uint256
+}
+
+// txRelay tracks the transactions known by each neighbor and batches the
+// transaction inventories to be announced to them.
+type txRelay struct {
+	sync.Mutex
+	peers map[uint64]*peerInventory
+}
+
+func (r *txRelay) init() {
+	r.peers = make(map[uint64]*peerInventory)
+}
+
+func (r *txRelay) peer(id uint64) *peerInventory {
+	peer, ok := r.peers[id]
+	if !ok {
+		peer = &peerInventory{known: newKnownInventory(MaxKnownInventory)}
+		r.peers[id] = peer
+	}
+	return peer
+}
+
+// AddKnown marks the transaction as known by the neighbor, it will never be
+// announced to the neighbor.
+func (r *txRelay) AddKnown(id uint64, hash Uint256) {
+	r.Lock()
+	defer r.Unlock()
+	r.peer(id).known.add(hash)
+}
+
+// Queue queues the transaction to be announced to the neighbor, it returns
+// false if the neighbor already knows the transaction.
+func (r *txRelay) Queue(id uint64, hash Uint256) bool {
+	r.Lock()
+	defer r.Unlock()
+	peer := r.peer(id)
+	if peer.known.exists(hash) {
+		return false
+	}
+	peer.known.add(hash)
+	peer.pending = append(peer.pending, hash)
+	return true
+}
+
+// Take removes and returns the pending transactions of the neighbor.
+func (r *txRelay) Take(id uint64) []Uint256 {
+	r.Lock()
+	defer r.Unlock()
+	peer, ok := r.peers[id]
+	if !ok {
+		return nil
+	}
+	pending := peer.pending
+	peer.pending = nil
+	return pending
+}
+
+// RemoveMined removes the transactions included in a block from the pending
+// inventories, they are still remembered as known by the neighbors.
+func (r *txRelay) RemoveMined(block *Block) {
+	mined := make(map[Uint256]struct{}, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		mined[tx.Hash()] = struct{}{}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	for _, peer := range r.peers {
+		pending := peer.pending[:0]
+		for _, hash := range peer.pending {
+			if _, ok := mined[hash]; !ok {
+				pending = append(pending, hash)
+			}
+		}
+		peer.pending = pending
+	}
+}
+
+// RemovePeer removes the relay state of a disconnected neighbor.
+func (r *txRelay) RemovePeer(id uint64) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.peers, id)
+}
+
+func (node *node) BlockPersistCompleted(v interface{}) {
+	if block, ok := v.(*Block); ok {
+		node.txRelay.RemoveMined(block)
+	}
+}
+
+// relayTransactions flushes the pending transaction inventories to the
+// neighbors every TxRelayInterval.
+func (node *node) relayTransactions() {
+	ticker := time.NewTicker(TxRelayInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, nbr := range node.GetNeighborNoder() {
+			hashes := node.txRelay.Take(nbr.ID())
+			if len(hashes) == 0 {
+				continue
+			}
+
+			nbr := nbr
+			delay := time.Duration(rand.Int63n(int64(TxRelayMaxDelay)))
+			time.AfterFunc(delay, func() {
+				sendTxInventory(nbr, hashes)
+			})
+		}
+	}
+}
+
+// sendTxInventory announces the transactions to the neighbor, in inventory
+// messages of at most MaxTxInvPerMsg entries.
+func sendTxInventory(nbr Noder, hashes []Uint256) {
+	for len(hashes) > 0 {
+		count := len(hashes)
+		if count > MaxTxInvPerMsg {
+			count = MaxTxInvPerMsg
+		}
+
+		inv := msg.NewInventory()
+		for i := range hashes[:count] {
+			inv.AddInvVect(msg.NewInvVect(msg.InvTypeTx, &hashes[i]))
+		}
+		nbr.Send(inv)
+		hashes = hashes[count:]
+	}
+}
@@ -0,0 +1,72 @@
+package node
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain/core"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxRelay(t *testing.T) {
+	var relay txRelay
+	relay.init()
+
+	txs := make([]*core.Transaction, 3)
+	hashes := make([]common.Uint256, len(txs))
+	for i := range txs {
+		txs[i] = &core.Transaction{TxType: core.TransferAsset, Payload: &core.PayloadTransferAsset{}}
+		txs[i].LockTime = uint32(i)
+		hashes[i] = txs[i].Hash()
+	}
+
+	// never announced back to the neighbor it came from
+	relay.AddKnown(1, hashes[0])
+	assert.False(t, relay.Queue(1, hashes[0]))
+	assert.True(t, relay.Queue(2, hashes[0]))
+
+	// announced once to each neighbor
+	assert.False(t, relay.Queue(2, hashes[0]))
+	assert.True(t, relay.Queue(2, hashes[1]))
+	assert.True(t, relay.Queue(2, hashes[2]))
+
+	// mined transactions are removed from the pending inventories
+	block := &core.Block{Transactions: txs[:2]}
+	relay.RemoveMined(block)
+	assert.Equal(t, []common.Uint256{hashes[2]}, relay.Take(2))
+	assert.Nil(t, relay.Take(2))
+
+	// mined transactions are still known by the neighbor
+	assert.False(t, relay.Queue(2, hashes[1]))
+
+	// no state after the neighbor disconnected
+	relay.RemovePeer(2)
+	assert.Nil(t, relay.Take(2))
+	assert.True(t, relay.Queue(2, hashes[1]))
+
+	t.Log("[TestTxRelay] PASSED")
+}
+
+func TestKnownInventory(t *testing.T) {
+	known := newKnownInventory(2)
+	hashes := make([]common.Uint256, 3)
+	for i := range hashes {
+		rand.Read(hashes[i][:])
+	}
+
+	known.add(hashes[0])
+	known.add(hashes[1])
+	known.add(hashes[1])
+	assert.True(t, known.exists(hashes[0]))
+	assert.True(t, known.exists(hashes[1]))
+
+	// the oldest hash is evicted
+	known.add(hashes[2])
+	assert.False(t, known.exists(hashes[0]))
+	assert.True(t, known.exists(hashes[1]))
+	assert.True(t, known.exists(hashes[2]))
+
+	t.Log("[TestKnownInventory] PASSED")
+}
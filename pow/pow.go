@@ -5,7 +5,6 @@ import (
 	"errors"
 	"math"
 	"math/rand"
-	"sort"
 	"sync"
 	"time"
 
@@ -47,6 +46,9 @@ type PowService struct {
 	manualMining bool
 	localNode    protocol.Noder
 
+	// generateMutex serializes the on demand block generations
+	generateMutex sync.Mutex
+
 	blockPersistCompletedSubscriber events.Subscriber
 	RollbackTransactionSubscriber   events.Subscriber
 
@@ -91,18 +93,20 @@ func (pow *PowService) CreateCoinBaseTx(nextBlockHeight uint32, addr string) (*c
 			Sequence: math.MaxUint32,
 		},
 	}
-	txn.Outputs = []*core.Output{
-		{
-			AssetID:     DefaultLedger.Blockchain.AssetID,
-			Value:       0,
-			ProgramHash: FoundationAddress,
-		},
-		{
+	// one output for each reward rule followed by the miner output
+	for _, rule := range RewardRules() {
+		programHash, _ := rule.Reward(0)
+		txn.Outputs = append(txn.Outputs, &core.Output{
 			AssetID:     DefaultLedger.Blockchain.AssetID,
 			Value:       0,
-			ProgramHash: *minerProgramHash,
-		},
+			ProgramHash: programHash,
+		})
 	}
+	txn.Outputs = append(txn.Outputs, &core.Output{
+		AssetID:     DefaultLedger.Blockchain.AssetID,
+		Value:       0,
+		ProgramHash: *minerProgramHash,
+	})
 
 	nonce := make([]byte, 8)
 	binary.BigEndian.PutUint64(nonce, rand.Uint64())
@@ -113,12 +117,6 @@ func (pow *PowService) CreateCoinBaseTx(nextBlockHeight uint32, addr string) (*c
 	return txn, nil
 }
 
-type byFeeDesc []*core.Transaction
-
-func (s byFeeDesc) Len() int           { return len(s) }
-func (s byFeeDesc) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-func (s byFeeDesc) Less(i, j int) bool { return s[i].FeePerKB > s[j].FeePerKB }
-
 func (pow *PowService) GenerateBlock(addr string) (*core.Block, error) {
 	nextBlockHeight := DefaultLedger.Blockchain.GetBestHeight() + 1
 	coinBaseTx, err := pow.CreateCoinBaseTx(nextBlockHeight, addr)
@@ -142,43 +140,26 @@ func (pow *PowService) GenerateBlock(addr string) (*core.Block, error) {
 	}
 
 	msgBlock.Transactions = append(msgBlock.Transactions, coinBaseTx)
-	totalTxsSize := coinBaseTx.GetSize()
-	txCount := 1
-	totalFee := common.Fixed64(0)
-	var txsByFeeDesc byFeeDesc
 	txsInPool := pow.localNode.GetTxsInPool()
-	txsByFeeDesc = make([]*core.Transaction, 0, len(txsInPool))
-	for _, v := range txsInPool {
-		txsByFeeDesc = append(txsByFeeDesc, v)
-	}
-	sort.Sort(txsByFeeDesc)
-
-	for _, tx := range txsByFeeDesc {
-		totalTxsSize = totalTxsSize + tx.GetSize()
-		if totalTxsSize > config.Parameters.MaxBlockSize {
-			break
-		}
-		if txCount >= config.Parameters.MaxTxInBlock {
-			break
+	for hash, tx := range txsInPool {
+		if GetTxFee(tx, DefaultLedger.Blockchain.AssetID) != tx.Fee {
+			delete(txsInPool, hash)
 		}
-
-		if !IsFinalizedTransaction(tx, nextBlockHeight) {
-			continue
-		}
-
-		fee := GetTxFee(tx, DefaultLedger.Blockchain.AssetID)
-		if fee != tx.Fee {
-			continue
-		}
-		msgBlock.Transactions = append(msgBlock.Transactions, tx)
-		totalFee += fee
-		txCount++
 	}
+	medianTime := CalcPastMedianTime(DefaultLedger.Blockchain.BestChain)
+	assembler := NewBlockAssembler(nextBlockHeight, medianTime, coinBaseTx.GetSize(), 1)
+	txs, totalFee := assembler.Assemble(txsInPool)
+	msgBlock.Transactions = append(msgBlock.Transactions, txs...)
 
 	reward := totalFee
-	rewardFoundation := common.Fixed64(float64(reward) * 0.3)
-	msgBlock.Transactions[0].Outputs[0].Value = rewardFoundation
-	msgBlock.Transactions[0].Outputs[1].Value = common.Fixed64(reward) - rewardFoundation
+	minerReward := reward
+	outputs := msgBlock.Transactions[0].Outputs
+	for i, rule := range RewardRules() {
+		_, ruleReward := rule.Reward(reward)
+		outputs[i].Value = ruleReward
+		minerReward -= ruleReward
+	}
+	outputs[len(outputs)-1].Value = minerReward
 
 	txHash := make([]common.Uint256, 0, len(msgBlock.Transactions))
 	for _, tx := range msgBlock.Transactions {
@@ -186,8 +167,12 @@ func (pow *PowService) GenerateBlock(addr string) (*core.Block, error) {
 	}
 	txRoot, _ := crypto.ComputeRoot(txHash)
 	msgBlock.Header.MerkleRoot = txRoot
+	if err := SetStateRoot(msgBlock, DefaultLedger.Blockchain.BestChain); err != nil {
+		return nil, err
+	}
 
-	msgBlock.Header.Bits, err = CalcNextRequiredDifficulty(DefaultLedger.Blockchain.BestChain, time.Now())
+	msgBlock.Header.Bits, err = CalcNextRequiredDifficulty(DefaultLedger.Blockchain.BestChain,
+		time.Unix(int64(msgBlock.Header.Timestamp), 0), config.Parameters.ChainParam)
 	log.Info("difficulty: ", msgBlock.Header.Bits)
 
 	return msgBlock, err
@@ -247,6 +232,56 @@ func (pow *PowService) DiscreteMining(n uint32) ([]*common.Uint256, error) {
 	}
 }
 
+// Generate mines n blocks paying the coinbase to addr and returns their
+// hashes, the blocks are generated the same way as the CPU miner does and are
+// added to the chain before it returns.
+func (pow *PowService) Generate(n uint32, addr string) ([]*common.Uint256, error) {
+	if !config.Parameters.ChainParam.AllowGenerate {
+		return nil, errors.New("Generate is not allowed on " + config.Parameters.ChainParam.Name)
+	}
+	if _, err := common.Uint168FromAddress(addr); err != nil {
+		return nil, errors.New("Invalid address " + addr)
+	}
+
+	pow.generateMutex.Lock()
+	defer pow.generateMutex.Unlock()
+
+	pow.Mutex.Lock()
+	mining := pow.started || pow.manualMining
+	pow.Mutex.Unlock()
+	if mining {
+		return nil, errors.New("Server is already CPU mining.")
+	}
+
+	ticker := time.NewTicker(time.Second * hashUpdateSecs)
+	defer ticker.Stop()
+
+	blockHashes := make([]*common.Uint256, 0, n)
+	for uint32(len(blockHashes)) < n {
+		msgBlock, err := pow.GenerateBlock(addr)
+		if err != nil {
+			return blockHashes, err
+		}
+
+		// the block is regenerated if the chain tip changed while solving
+		if !pow.SolveBlock(msgBlock, ticker) ||
+			msgBlock.Header.Height != DefaultLedger.Blockchain.GetBestHeight()+1 {
+			continue
+		}
+		inMainChain, isOrphan, err := DefaultLedger.Blockchain.AddBlock(msgBlock)
+		if err != nil {
+			return blockHashes, err
+		}
+		if isOrphan || !inMainChain {
+			continue
+		}
+		pow.BroadcastBlock(msgBlock)
+		hash := msgBlock.Hash()
+		blockHashes = append(blockHashes, &hash)
+	}
+	return blockHashes, nil
+}
+
 func (pow *PowService) SolveBlock(MsgBlock *core.Block, ticker *time.Ticker) bool {
 	genesisHash, err := DefaultLedger.Store.GetBlockHash(0)
 	if err != nil {
@@ -29,9 +29,21 @@ const (
 )
 
 const (
-	OpenService = 1 << 2
+	OpenService           = 1 << 2
+	CompactBlockService   = 1 << 3
+	LimitedHistoryService = 1 << 4
 )
 
+// AddressInfo is the address manager state of a peer address.
+type AddressInfo struct {
+	Tried       bool
+	Bucket      int
+	LastSeen    int64
+	LastAttempt int64
+	LastSuccess int64
+	Attempts    int
+}
+
 type Noder interface {
 	Version() uint32
 	ID() uint64
@@ -53,6 +65,7 @@ type Noder interface {
 	GetConnectionCnt() uint
 	GetTxsInPool() map[common.Uint256]*core.Transaction
 	AppendToTxnPool(*core.Transaction) errors.ErrCode
+	TestAcceptTransaction(*core.Transaction) (map[common.Uint256]common.Fixed64, errors.ErrCode)
 	IsDuplicateMainchainTx(mainchainTxHash common.Uint256) bool
 	ExistedID(id common.Uint256) bool
 	DumpInfo()
@@ -86,6 +99,8 @@ type Noder interface {
 	IsAddrInNbrList(addr string) bool
 	GetAddressCnt() uint64
 	AddAddressToKnownAddress(na p2p.NetAddress)
+	AddressGood(id uint64)
+	AddressInfo(id uint64) (AddressInfo, bool)
 	RandGetAddresses(nbrAddrs []p2p.NetAddress) []p2p.NetAddress
 	NeedMoreAddresses() bool
 	RandSelectAddresses() []p2p.NetAddress
@@ -11,6 +11,7 @@ const TlsPort = 443
 type AttributeInfo struct {
 	Usage AttributeUsage `json:"usage"`
 	Data  string         `json:"data"`
+	Memo  string         `json:"memo,omitempty"`
 }
 
 type InputInfo struct {
@@ -41,7 +42,8 @@ type TransactionInfo struct {
 	LockTime       uint32          `json:"locktime"`
 	Inputs         []InputInfo     `json:"vin"`
 	Outputs        []OutputInfo    `json:"vout"`
-	BlockHash      string          `json:"blockhash"`
+	BlockHash      string          `json:"blockhash,omitempty"`
+	Height         uint32          `json:"height,omitempty"`
 	Confirmations  uint32          `json:"confirmations"`
 	Time           uint32          `json:"time"`
 	BlockTime      uint32          `json:"blocktime"`
@@ -74,6 +76,26 @@ type BlockInfo struct {
 	AuxPow            string        `json:"auxpow"`
 }
 
+type BlockTemplateTxInfo struct {
+	Data string `json:"data"`
+	Hash string `json:"hash"`
+	Fee  string `json:"fee"`
+}
+
+type BlockTemplateInfo struct {
+	Version           uint32                `json:"version"`
+	PreviousBlockHash string                `json:"previousblockhash"`
+	MerkleRoot        string                `json:"merkleroot"`
+	Bits              string                `json:"bits"`
+	Height            uint32                `json:"height"`
+	CurTime           uint32                `json:"curtime"`
+	MinTime           uint32                `json:"mintime"`
+	MaxTime           uint32                `json:"maxtime"`
+	CoinbaseTxn       string                `json:"coinbasetxn"`
+	CoinbaseValue     string                `json:"coinbasevalue"`
+	Transactions      []BlockTemplateTxInfo `json:"transactions"`
+}
+
 type NodeInfo struct {
 	State    uint   // NodeForServers status
 	Port     uint16 // The nodes's port
@@ -85,6 +107,58 @@ type NodeInfo struct {
 	Height   uint64 // The NodeForServers latest block height
 	TxnCnt   uint64 // The transactions be transmit by this NodeForServers
 	RxTxnCnt uint64 // The transaction received by this NodeForServers
+
+	// The validation, mempool and sync metrics
+	Metrics map[string]interface{}
+}
+
+type PeerInfo struct {
+	ID          uint64 `json:"id"`
+	Addr        string `json:"addr"`
+	Services    uint64 `json:"services"`
+	Relay       bool   `json:"relay"`
+	Height      uint64 `json:"height"`
+	LastActive  int64  `json:"lastactive"`
+	Bucket      string `json:"bucket"`
+	LastSeen    int64  `json:"lastseen"`
+	LastSuccess int64  `json:"lastsuccess"`
+	Attempts    int    `json:"attempts"`
+}
+
+type AddedNodeInfo struct {
+	AddedNode string `json:"addednode"`
+	Connected bool   `json:"connected"`
+}
+
+type SigCacheInfo struct {
+	Size    int     `json:"size"`
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hitrate"`
+}
+
+type MainchainTxFilterInfo struct {
+	Lookups           uint64  `json:"lookups"`
+	Positives         uint64  `json:"positives"`
+	FalsePositives    uint64  `json:"falsepositives"`
+	FalsePositiveRate float64 `json:"falsepositiverate"`
+}
+
+type IdentificationInfo struct {
+	Id         string                            `json:"id"`
+	Path       string                            `json:"path"`
+	Values     []RegisterIdentificationValueInfo `json:"values"`
+	Controller string                            `json:"controller"`
+	TxID       string                            `json:"txid"`
+	Height     uint32                            `json:"height"`
+}
+
+type MempoolAcceptInfo struct {
+	TxId    string            `json:"txid"`
+	Allowed bool              `json:"allowed"`
+	Code    int               `json:"code,omitempty"`
+	Reason  string            `json:"reason,omitempty"`
+	Fees    map[string]string `json:"fees,omitempty"`
 }
 
 type ArbitratorGroupInfo struct {
@@ -99,9 +173,10 @@ type CoinbaseInfo struct {
 }
 
 type RegisterAssetInfo struct {
-	Asset      Asset
-	Amount     string
-	Controller string
+	Asset         Asset
+	CanonicalName string
+	Amount        string
+	Controller    string
 }
 
 type SideChainPowInfo struct {
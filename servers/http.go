@@ -0,0 +1,154 @@
+package servers
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/elastos/Elastos.ELA.SideChain/config"
+	"github.com/elastos/Elastos.ELA.SideChain/log"
+)
+
+// DefaultHttpAllowedMethods are the HTTP methods allowed to the cross origin
+// requests when HttpAllowedMethods is not configured.
+var DefaultHttpAllowedMethods = []string{"GET", "POST", "OPTIONS"}
+
+// AuthRealm is the realm of the basic authentication challenge.
+const AuthRealm = "elastos"
+
+// WriteCORSHeaders writes the CORS headers of the response if the origin of
+// the request is listed in HttpAllowedOrigins, "*" allows any origin. It
+// returns false if no origins are configured.
+func WriteCORSHeaders(w http.ResponseWriter, r *http.Request) bool {
+	origins := config.Parameters.HttpAllowedOrigins
+	if len(origins) == 0 {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" || !isAllowedOrigin(origins, origin) {
+		return true
+	}
+	methods := config.Parameters.HttpAllowedMethods
+	if len(methods) == 0 {
+		methods = DefaultHttpAllowedMethods
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Add("Vary", "Origin")
+	return true
+}
+
+func isAllowedOrigin(origins []string, origin string) bool {
+	for _, allowed := range origins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticated returns if the request carries the basic auth credentials of
+// HttpUser and HttpPass, any request is authenticated if they are not
+// configured.
+func Authenticated(r *http.Request) bool {
+	if config.Parameters.HttpUser == "" && config.Parameters.HttpPass == "" {
+		return true
+	}
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	userMatch := subtle.ConstantTimeCompare([]byte(user), []byte(config.Parameters.HttpUser)) == 1
+	passMatch := subtle.ConstantTimeCompare([]byte(pass), []byte(config.Parameters.HttpPass)) == 1
+	return userMatch && passMatch
+}
+
+// Authorized returns if a request authenticated or not may call a method,
+// an unauthenticated request may only call the read only methods and only if
+// HttpOpenReadOnly is set.
+func Authorized(authenticated, mutating bool) bool {
+	return authenticated || (!mutating && config.Parameters.HttpOpenReadOnly)
+}
+
+// WriteUnauthorized writes the 401 status with the basic auth challenge.
+func WriteUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+AuthRealm+`"`)
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+// TLSConfigured returns if the HTTP servers listen with TLS.
+func TLSConfigured() bool {
+	return config.Parameters.HttpCertPath != "" && config.Parameters.HttpKeyPath != ""
+}
+
+// Listen listens on the port, with the certificate of HttpCertPath and
+// HttpKeyPath if TLS is configured.
+func Listen(port int) (net.Listener, error) {
+	address := ":" + strconv.Itoa(port)
+	if !TLSConfigured() {
+		return net.Listen("tcp", address)
+	}
+	certs, err := getCertReloader()
+	if err != nil {
+		return nil, err
+	}
+	log.Info("TLS listen port is ", port)
+	return tls.Listen("tcp", address, &tls.Config{GetCertificate: certs.getCertificate})
+}
+
+// certReloader holds the certificate of the HTTP servers, the certificate is
+// reloaded from HttpCertPath and HttpKeyPath on SIGHUP.
+type certReloader struct {
+	sync.RWMutex
+	cert *tls.Certificate
+}
+
+var (
+	reloaderOnce sync.Once
+	reloader     *certReloader
+	reloaderErr  error
+)
+
+// getCertReloader returns the certificate reloader shared by the servers.
+func getCertReloader() (*certReloader, error) {
+	reloaderOnce.Do(func() {
+		cert, err := tls.LoadX509KeyPair(config.Parameters.HttpCertPath, config.Parameters.HttpKeyPath)
+		if err != nil {
+			reloaderErr = err
+			return
+		}
+		reloader = &certReloader{cert: &cert}
+		go reloader.reloadOnSignal()
+	})
+	return reloader, reloaderErr
+}
+
+func (r *certReloader) reloadOnSignal() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		cert, err := tls.LoadX509KeyPair(config.Parameters.HttpCertPath, config.Parameters.HttpKeyPath)
+		if err != nil {
+			log.Error("Reload HTTP certificate failed, keep the current one: ", err)
+			continue
+		}
+		r.Lock()
+		r.cert = &cert
+		r.Unlock()
+		log.Info("HTTP certificate reloaded")
+	}
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.cert, nil
+}
@@ -0,0 +1,119 @@
+package httpjsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	. "github.com/elastos/Elastos.ELA.SideChain/config"
+)
+
+const (
+	// DefaultMaxRpcBatchSize is the max number of requests in a batch when
+	// MaxRpcBatchSize is not configured.
+	DefaultMaxRpcBatchSize = 1000
+
+	// DefaultMaxRpcBatchResponseSize is the max size in bytes of the
+	// responses of a batch when MaxRpcBatchResponseSize is not configured.
+	DefaultMaxRpcBatchResponseSize = 32 * 1024 * 1024
+
+	// DefaultRpcBatchWorkers is the number of requests of a batch handled
+	// concurrently when RpcBatchWorkers is not configured.
+	DefaultRpcBatchWorkers = 4
+)
+
+// handleBatch handles a JSON-RPC 2.0 batch, the requests are handled by a
+// bounded number of workers and the responses are returned in the order of
+// the requests. An invalid, unauthorized or failed request fails its own
+// response only.
+func handleBatch(w http.ResponseWriter, body []byte, authenticated bool) {
+	var requests []json.RawMessage
+	if err := json.Unmarshal(body, &requests); err != nil {
+		RPCError(w, http.StatusBadRequest, ParseError, "rpc json parse error:"+err.Error())
+		return
+	}
+	if len(requests) == 0 {
+		RPCError(w, http.StatusBadRequest, InvalidRequest, "empty batch")
+		return
+	}
+	if maxSize := maxBatchSize(); len(requests) > maxSize {
+		RPCError(w, http.StatusBadRequest, InvalidRequest,
+			fmt.Sprintf("batch size %d exceeds the max %d", len(requests), maxSize))
+		return
+	}
+
+	responses := make([]json.RawMessage, len(requests))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < batchWorkers(len(requests)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				responses[index] = handleBatchRequest(requests[index], authenticated)
+			}
+		}()
+	}
+	for index := range requests {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+
+	// the responses exceeding the max size are replaced by errors
+	maxResponseSize := maxBatchResponseSize()
+	size := 0
+	for i := range responses {
+		if size+len(responses[i]) > maxResponseSize {
+			responses[i], _ = json.Marshal(errorResponse(InternalError,
+				fmt.Sprintf("batch response exceeds the max size %d", maxResponseSize)))
+		}
+		size += len(responses[i])
+	}
+
+	data, _ := json.Marshal(responses)
+	w.Write(data)
+}
+
+// handleBatchRequest returns the marshaled response of a request in a batch.
+func handleBatchRequest(raw json.RawMessage, authenticated bool) json.RawMessage {
+	var response map[string]interface{}
+	request := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &request); err != nil {
+		response = errorResponse(InvalidRequest, "rpc json parse error:"+err.Error())
+	} else {
+		_, response = handleRequest(request, authenticated)
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		data, _ = json.Marshal(errorResponse(InternalError, "rpc json marshal error:"+err.Error()))
+	}
+	return data
+}
+
+func maxBatchSize() int {
+	if Parameters.MaxRpcBatchSize > 0 {
+		return Parameters.MaxRpcBatchSize
+	}
+	return DefaultMaxRpcBatchSize
+}
+
+func maxBatchResponseSize() int {
+	if Parameters.MaxRpcBatchResponseSize > 0 {
+		return Parameters.MaxRpcBatchResponseSize
+	}
+	return DefaultMaxRpcBatchResponseSize
+}
+
+// batchWorkers returns the number of workers handling a batch of the size.
+func batchWorkers(size int) int {
+	workers := Parameters.RpcBatchWorkers
+	if workers <= 0 {
+		workers = DefaultRpcBatchWorkers
+	}
+	if workers > size {
+		workers = size
+	}
+	return workers
+}
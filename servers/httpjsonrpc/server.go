@@ -1,10 +1,11 @@
 package httpjsonrpc
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strconv"
 
 	. "github.com/elastos/Elastos.ELA.SideChain/config"
 	"github.com/elastos/Elastos.ELA.SideChain/errors"
@@ -23,12 +24,28 @@ const (
 	InvalidParams  = -32602
 	InternalError  = -32603
 	//-32000 to -32099	Server error, waiting for defining
+	Unauthorized = -32001
 )
 
+// mutatingMethods are the methods changing the state of the node, they are
+// only called by authenticated requests.
+var mutatingMethods = map[string]bool{
+	"setloglevel":         true,
+	"sendtransactioninfo": true,
+	"sendrawtransaction":  true,
+	"submitsideauxblock":  true,
+	"togglemining":        true,
+	"discretemining":      true,
+	"generate":            true,
+	"generatetoaddress":   true,
+	"submitblock":         true,
+}
+
 func StartRPCServer() {
 	mainMux = make(map[string]func(Params) map[string]interface{})
 
 	http.HandleFunc("/", Handle)
+	http.HandleFunc("/metrics", MetricsHandler)
 
 	mainMux["setloglevel"] = SetLogLevel
 	mainMux["getinfo"] = GetInfo
@@ -42,12 +59,18 @@ func StartRPCServer() {
 	mainMux["getnodestate"] = GetNodeState
 	mainMux["sendtransactioninfo"] = SendTransactionInfo
 	mainMux["sendrawtransaction"] = SendRawTransaction
+	mainMux["testmempoolaccept"] = TestMempoolAccept
+	mainMux["verifyrechargeproof"] = VerifyRechargeProof
 	mainMux["getbestblockhash"] = GetBestBlockHash
 	mainMux["getblockcount"] = GetBlockCount
 	mainMux["getblockbyheight"] = GetBlockByHeight
 	mainMux["getdestroyedtransactions"] = GetDestroyedTransactionsByHeight
 	mainMux["getexistdeposittransactions"] = GetExistDepositTransactions
 	mainMux["getidentificationtxbyidandpath"] = GetIdentificationTxByIdAndPath
+	mainMux["getpeerinfo"] = GetPeerInfo
+	mainMux["getaddednodeinfo"] = GetAddedNodeInfo
+	mainMux["getsigcacheinfo"] = GetSigCacheInfo
+	mainMux["getmainchaintxfilterinfo"] = GetMainchainTxFilterInfo
 
 	// aux interfaces
 	mainMux["help"] = AuxHelp
@@ -56,9 +79,16 @@ func StartRPCServer() {
 	// mining interfaces
 	mainMux["togglemining"] = ToggleMining
 	mainMux["discretemining"] = DiscreteMining
+	mainMux["generate"] = Generate
+	mainMux["generatetoaddress"] = GenerateToAddress
+	mainMux["getblocktemplate"] = GetBlockTemplate
+	mainMux["submitblock"] = SubmitBlock
 
-	err := http.ListenAndServe(":"+strconv.Itoa(Parameters.HttpJsonPort), nil)
+	listener, err := Listen(Parameters.HttpJsonPort)
 	if err != nil {
+		log.Fatal("net.Listen: ", err.Error())
+	}
+	if err := http.Serve(listener, nil); err != nil {
 		log.Fatal("ListenAndServe: ", err.Error())
 	}
 }
@@ -66,6 +96,11 @@ func StartRPCServer() {
 //this is the funciton that should be called in order to answer an rpc call
 //should be registered like "http.AddMethod("/", httpjsonrpc.Handle)"
 func Handle(w http.ResponseWriter, r *http.Request) {
+	//a preflight of a cross origin request is answered with the CORS headers
+	if WriteCORSHeaders(w, r) && r.Method == "OPTIONS" {
+		return
+	}
+
 	//JSON RPC commands should be POSTs
 	if r.Method != "POST" {
 		log.Warn("HTTP JSON RPC Handle - Method!=\"POST\"")
@@ -80,6 +115,12 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 
 	//read the body of the request
 	body, _ := ioutil.ReadAll(r.Body)
+	authenticated := Authenticated(r)
+	//a JSON array is a batch of requests
+	if trimmed := bytes.TrimLeft(body, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '[' {
+		handleBatch(w, body, authenticated)
+		return
+	}
 	request := make(map[string]interface{})
 	error := json.Unmarshal(body, &request)
 	if error != nil {
@@ -87,16 +128,32 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 		RPCError(w, http.StatusBadRequest, ParseError, "rpc json parse error:"+error.Error())
 		return
 	}
+
+	status, response := handleRequest(request, authenticated)
+	if status == http.StatusUnauthorized {
+		WriteUnauthorized(w)
+	} else if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	data, _ := json.Marshal(response)
+	w.Write(data)
+}
+
+// handleRequest calls the method of the request, and returns the HTTP status
+// and the response of the request. A panic of the method is returned as an
+// internal error of the request.
+func handleRequest(request map[string]interface{}, authenticated bool) (status int, response map[string]interface{}) {
 	//get the corresponding function
 	requestMethod, ok := request["method"].(string)
 	if !ok {
-		RPCError(w, http.StatusBadRequest, InvalidRequest, "need a method!")
-		return
+		return http.StatusBadRequest, errorResponse(InvalidRequest, "need a method!")
 	}
 	method, ok := mainMux[requestMethod]
 	if !ok {
-		RPCError(w, http.StatusNotFound, MethodNotFound, "method "+requestMethod+" not found")
-		return
+		return http.StatusNotFound, errorResponse(MethodNotFound, "method "+requestMethod+" not found")
+	}
+	if !Authorized(authenticated, mutatingMethods[requestMethod]) {
+		return http.StatusUnauthorized, errorResponse(Unauthorized, "method "+requestMethod+" requires authentication")
 	}
 
 	requestParams := request["params"]
@@ -112,44 +169,54 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 	case map[string]interface{}:
 		params = Params(requestParams)
 	default:
-		RPCError(w, http.StatusBadRequest, InvalidRequest, "params format error, must be an array or a map")
-		return
+		return http.StatusBadRequest, errorResponse(InvalidRequest, "params format error, must be an array or a map")
 	}
 
-	response := method(params)
-	var data []byte
-	if response["Error"] != errors.ErrCode(0) {
-		data, _ = json.Marshal(map[string]interface{}{
-			"jsonrpc": "2.0",
-			"error": map[string]interface{}{
-				"code":    response["Error"],
-				"message": response["Result"],
-				"id":      request["id"],
-			},
-		})
-
-	} else {
-		data, _ = json.Marshal(map[string]interface{}{
-			"jsonrpc": "2.0",
-			"result":  response["Result"],
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("HTTP JSON RPC Handle - method ", requestMethod, " panic: ", r)
+			status = http.StatusInternalServerError
+			response = errorResponse(InternalError, fmt.Sprint("method ", requestMethod, " failed: ", r))
+		}
+	}()
+	resp := method(params)
+	if resp["Error"] != errors.ErrCode(0) {
+		rpcError := map[string]interface{}{
+			"code":    resp["Error"],
+			"message": resp["Result"],
 			"id":      request["id"],
-			"error":   nil,
-		})
+		}
+		if desc, ok := resp["Desc"]; ok {
+			rpcError["desc"] = desc
+		}
+		return http.StatusOK, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"error":   rpcError,
+		}
+	}
+	return http.StatusOK, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"result":  resp["Result"],
+		"id":      request["id"],
+		"error":   nil,
 	}
-	w.Write(data)
 }
 
 func RPCError(w http.ResponseWriter, httpStatus int, code errors.ErrCode, message string) {
 	w.WriteHeader(httpStatus)
-	data, _ := json.Marshal(map[string]interface{}{
+	data, _ := json.Marshal(errorResponse(code, message))
+	w.Write(data)
+}
+
+func errorResponse(code errors.ErrCode, message string) map[string]interface{} {
+	return map[string]interface{}{
 		"jsonrpc": "2.0",
 		"error": map[string]interface{}{
 			"code":    code,
 			"message": message,
 			"id":      nil,
 		},
-	})
-	w.Write(data)
+	}
 }
 
 func convertParams(method string, params []interface{}) Params {
@@ -172,6 +239,14 @@ func convertParams(method string, params []interface{}) Params {
 		return FromArray(params, "mine")
 	case "discretemining":
 		return FromArray(params, "count")
+	case "generate":
+		return FromArray(params, "count")
+	case "generatetoaddress":
+		return FromArray(params, "count", "address")
+	case "getblocktemplate":
+		return FromArray(params, "paytoaddress")
+	case "submitblock":
+		return FromArray(params, "block")
 	default:
 		return Params{}
 	}
@@ -0,0 +1,147 @@
+package httprestful
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	. "github.com/elastos/Elastos.ELA.SideChain/errors"
+	"github.com/elastos/Elastos.ELA.SideChain/log"
+	"github.com/elastos/Elastos.ELA.SideChain/servers"
+)
+
+// The resource routes return the same results as the RPC with the HTTP status
+// of the error, a raw=true query returns the hex serialized block, transaction
+// or asset instead.
+const (
+	Api_BlockByHeight = "/api/v1/block/height/:height"
+	Api_BlockByHash   = "/api/v1/block/hash/:hash"
+	Api_Transaction   = "/api/v1/transaction/:txid"
+	Api_Asset         = "/api/v1/asset/:assetid"
+	Api_UTXOs         = "/api/v1/utxos/:addr"
+)
+
+// blockHashLength is the length of a reversed hex block hash, a shorter
+// parameter of Api_BlockByHash is the height of Api_Getblockhash.
+const blockHashLength = 64
+
+// initResourceHandler registers the resource routes, they are registered
+// before the get handlers so they take precedence over the routes of the same
+// pattern.
+func (rt *restServer) initResourceHandler() {
+	rt.router.Get(Api_BlockByHeight, func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := rawQuery(r)
+		if !ok {
+			rt.resourceResponse(w, servers.ResponsePack(InvalidParams, "invalid raw query"))
+			return
+		}
+		if _, err := strconv.ParseUint(getParam(r, "height"), 10, 32); err != nil {
+			rt.resourceResponse(w, servers.ResponsePack(InvalidParams, "invalid block height"))
+			return
+		}
+		rt.resourceResponse(w, servers.GetBlockByHeight(servers.Params{
+			"height":    getParam(r, "height"),
+			"verbosity": blockVerbosity(raw),
+		}))
+	})
+
+	rt.router.Get(Api_BlockByHash, func(w http.ResponseWriter, r *http.Request) {
+		hash := getParam(r, "hash")
+		if len(hash) != blockHashLength {
+			rt.response(w, servers.GetBlockHash(servers.Params{"height": hash}))
+			return
+		}
+		raw, ok := rawQuery(r)
+		if !ok {
+			rt.resourceResponse(w, servers.ResponsePack(InvalidParams, "invalid raw query"))
+			return
+		}
+		rt.resourceResponse(w, servers.GetBlockByHash(servers.Params{
+			"blockhash": hash,
+			"verbosity": blockVerbosity(raw),
+		}))
+	})
+
+	rt.router.Get(Api_Transaction, func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := rawQuery(r)
+		if !ok {
+			rt.resourceResponse(w, servers.ResponsePack(InvalidParams, "invalid raw query"))
+			return
+		}
+		rt.resourceResponse(w, servers.GetRawTransaction(servers.Params{
+			"txid":    getParam(r, "txid"),
+			"verbose": !raw,
+		}))
+	})
+
+	rt.router.Get(Api_Asset, func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := rawQuery(r)
+		if !ok {
+			rt.resourceResponse(w, servers.ResponsePack(InvalidParams, "invalid raw query"))
+			return
+		}
+		rt.resourceResponse(w, servers.GetAssetByHash(servers.Params{
+			"hash": getParam(r, "assetid"),
+			"raw":  raw,
+		}))
+	})
+
+	rt.router.Get(Api_UTXOs, func(w http.ResponseWriter, r *http.Request) {
+		params := servers.Params{"addr": getParam(r, "addr")}
+		if assetId := r.URL.Query().Get("assetid"); assetId != "" {
+			params["assetid"] = assetId
+			rt.resourceResponse(w, servers.GetUnspendOutput(params))
+			return
+		}
+		rt.resourceResponse(w, servers.GetUnspends(params))
+	})
+}
+
+// rawQuery returns the raw query of the request, false if it is not a bool.
+func rawQuery(r *http.Request) (bool, bool) {
+	value := r.URL.Query().Get("raw")
+	if value == "" {
+		return false, true
+	}
+	raw, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, false
+	}
+	return raw, true
+}
+
+// blockVerbosity returns the verbosity of getBlock, the hex serialized block
+// or the block with the transaction details.
+func blockVerbosity(raw bool) string {
+	if raw {
+		return "0"
+	}
+	return "2"
+}
+
+// httpStatus returns the HTTP status of the response error code.
+func httpStatus(errCode ErrCode) int {
+	switch errCode {
+	case Success:
+		return http.StatusOK
+	case InvalidParams, InvalidTransaction, InvalidAsset, IllegalDataFormat:
+		return http.StatusBadRequest
+	case UnknownTransaction, UnknownAsset, UnknownBlock, PrunedData:
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func (rt *restServer) resourceResponse(w http.ResponseWriter, resp map[string]interface{}) {
+	errCode := resp["Error"].(ErrCode)
+	if _, ok := resp["Desc"]; !ok {
+		resp["Desc"] = ErrMap[errCode]
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Error("HTTP Handle - json.Marshal: ", err)
+		rt.writeStatus(w, http.StatusInternalServerError, []byte{})
+		return
+	}
+	rt.writeStatus(w, httpStatus(errCode), data)
+}
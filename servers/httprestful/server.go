@@ -64,6 +64,7 @@ func InitRestServer() ApiServer {
 	rt := &restServer{}
 	rt.router = &Router{}
 	rt.initializeMethod()
+	rt.initResourceHandler()
 	rt.initGetHandler()
 	rt.initPostHandler()
 	return rt
@@ -74,7 +75,13 @@ func (rt *restServer) Start() {
 		log.Fatal("Not configure HttpRestPort port ")
 	}
 
-	if Parameters.HttpRestPort%1000 == servers.TlsPort {
+	if servers.TLSConfigured() {
+		var err error
+		rt.listener, err = servers.Listen(Parameters.HttpRestPort)
+		if err != nil {
+			log.Fatal("net.Listen: ", err.Error())
+		}
+	} else if Parameters.HttpRestPort%1000 == servers.TlsPort {
 		var err error
 		rt.listener, err = rt.initTlsListen()
 		if err != nil {
@@ -87,7 +94,7 @@ func (rt *restServer) Start() {
 			log.Fatal("net.Listen: ", err.Error())
 		}
 	}
-	rt.server = &http.Server{Handler: rt.router}
+	rt.server = &http.Server{Handler: http.HandlerFunc(rt.serveHTTP)}
 	err := rt.server.Serve(rt.listener)
 
 	if err != nil {
@@ -95,6 +102,21 @@ func (rt *restServer) Start() {
 	}
 }
 
+// serveHTTP answers the preflight of a cross origin request and checks the
+// authentication of the request before routing it, restart and the posts
+// change the state of the node.
+func (rt *restServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if servers.WriteCORSHeaders(w, r) && r.Method == "OPTIONS" {
+		return
+	}
+	mutating := r.Method == "POST" || r.URL.Path == Api_Restart
+	if !servers.Authorized(servers.Authenticated(r), mutating) {
+		servers.WriteUnauthorized(w)
+		return
+	}
+	rt.router.ServeHTTP(w, r)
+}
+
 func (rt *restServer) initializeMethod() {
 
 	getMethodMap := map[string]Action{
@@ -255,14 +277,24 @@ func (rt *restServer) initPostHandler() {
 }
 
 func (rt *restServer) write(w http.ResponseWriter, data []byte) {
-	w.Header().Add("Access-Control-Allow-Headers", "Content-Type")
+	rt.writeStatus(w, http.StatusOK, data)
+}
+
+func (rt *restServer) writeStatus(w http.ResponseWriter, status int, data []byte) {
+	// any origin is allowed unless HttpAllowedOrigins is configured
+	if len(Parameters.HttpAllowedOrigins) == 0 {
+		w.Header().Add("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	}
 	w.Header().Set("content-type", "application/json;charset=utf-8")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(status)
 	w.Write(data)
 }
 
 func (rt *restServer) response(w http.ResponseWriter, resp map[string]interface{}) {
-	resp["Desc"] = ErrMap[resp["Error"].(ErrCode)]
+	if _, ok := resp["Desc"]; !ok {
+		resp["Desc"] = ErrMap[resp["Error"].(ErrCode)]
+	}
 	data, err := json.Marshal(resp)
 	if err != nil {
 		log.Fatal("HTTP Handle - json.Marshal: %v", err)
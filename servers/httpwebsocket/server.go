@@ -19,7 +19,6 @@ import (
 	. "github.com/elastos/Elastos.ELA.SideChain/servers"
 
 	. "github.com/elastos/Elastos.ELA.Utility/common"
-	"github.com/pborman/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -34,14 +33,18 @@ var (
 
 type Handler func(Params) map[string]interface{}
 
+// SessionHandler handles an action on the state of the session.
+type SessionHandler func(*Session, Params) map[string]interface{}
+
 type WebSocketServer struct {
 	sync.RWMutex
 	*http.Server
 	net.Listener
 	websocket.Upgrader
 
-	SessionList *SessionList
-	ActionMap   map[string]Handler
+	SessionList      *SessionList
+	ActionMap        map[string]Handler
+	SessionActionMap map[string]SessionHandler
 }
 
 func StartServer() {
@@ -53,6 +56,8 @@ func StartServer() {
 
 	chain.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventBlockPersistCompleted, SendBlock2WSclient)
 	chain.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventNewTransactionPutInPool, SendTransaction2WSclient)
+	chain.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventBlockPersistCompleted, NotifyBlock)
+	chain.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventNewTransactionPutInPool, NotifyTransaction)
 }
 
 func (server *WebSocketServer) Start() {
@@ -97,6 +102,10 @@ func (server *WebSocketServer) initializeMethods() {
 		"heartbeat":          server.hearBeat,
 		"getsessioncount":    server.getSessionCount,
 	}
+	server.SessionActionMap = map[string]SessionHandler{
+		"subscribe":   server.subscribe,
+		"unsubscribe": server.unsubscribe,
+	}
 }
 
 func (server *WebSocketServer) hearBeat(cmd Params) map[string]interface{} {
@@ -146,11 +155,7 @@ func (server *WebSocketServer) webSocketHandler(w http.ResponseWriter, r *http.R
 	}
 	defer wsConn.Close()
 
-	newSession := &Session{
-		Connection: wsConn,
-		LastActive: time.Now().Unix(),
-		SessionId:  uuid.NewUUID().String(),
-	}
+	newSession := NewSession(wsConn)
 	server.SessionList.OnlineList[newSession.SessionId] = newSession
 
 	defer func() {
@@ -199,7 +204,8 @@ func (server *WebSocketServer) OnDataHandle(currentSession *Session, bysMsg []by
 	actionName := req["Action"].(string)
 
 	action, ok := server.ActionMap[actionName]
-	if !ok {
+	sessionAction, isSessionAction := server.SessionActionMap[actionName]
+	if !ok && !isSessionAction {
 		resp := ResponsePack(InvalidMethod, "")
 		server.response(currentSession.SessionId, resp)
 		return false
@@ -216,7 +222,12 @@ func (server *WebSocketServer) OnDataHandle(currentSession *Session, bysMsg []by
 		req["Raw"] = strconv.FormatInt(int64(raw), 10)
 	}
 
-	resp := action(req)
+	var resp map[string]interface{}
+	if isSessionAction {
+		resp = sessionAction(currentSession, req)
+	} else {
+		resp = action(req)
+	}
 	resp["Action"] = actionName
 
 	server.response(currentSession.SessionId, resp)
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/pborman/uuid"
 )
 
 type Session struct {
@@ -13,6 +14,12 @@ type Session struct {
 	Connection *websocket.Conn
 	LastActive int64
 	SessionId  string
+
+	subLock       sync.RWMutex
+	subscriptions map[string]struct{}
+	queue         chan []byte
+	quit          chan struct{}
+	closeOnce     sync.Once
 }
 
 type SessionList struct {
@@ -22,6 +29,35 @@ type SessionList struct {
 
 const SessionTimeOut int64 = 120
 
+const (
+	// sessionQueueSize is the number of notifications queued for a session,
+	// the notifications are dropped when the client does not keep up.
+	sessionQueueSize = 64
+
+	// pingInterval is the interval of the pings sent to the client, a pong
+	// keeps the session active.
+	pingInterval = time.Second * time.Duration(SessionTimeOut/2)
+)
+
+// NewSession creates a session of the connection and starts sending the
+// queued notifications and the pings to it.
+func NewSession(conn *websocket.Conn) *Session {
+	s := &Session{
+		Connection:    conn,
+		LastActive:    time.Now().Unix(),
+		SessionId:     uuid.NewUUID().String(),
+		subscriptions: make(map[string]struct{}),
+		queue:         make(chan []byte, sessionQueueSize),
+		quit:          make(chan struct{}),
+	}
+	conn.SetPongHandler(func(string) error {
+		s.LastActive = time.Now().Unix()
+		return nil
+	})
+	go s.writeLoop()
+	return s
+}
+
 func (s *Session) Send(data []byte) error {
 	if s.Connection == nil {
 		return errors.New("WebSocket is null")
@@ -32,6 +68,65 @@ func (s *Session) Send(data []byte) error {
 	return s.Connection.WriteMessage(websocket.TextMessage, data)
 }
 
+// Push queues the notification to be sent to the client without blocking,
+// it returns false if the queue of the session is full.
+func (s *Session) Push(data []byte) bool {
+	select {
+	case s.queue <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Session) writeLoop() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case data := <-s.queue:
+			if err := s.Send(data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			deadline := time.Now().Add(pingInterval)
+			if err := s.Connection.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// Subscribe subscribes the session to the topic, a session subscribes to at
+// most maxSubscriptions topics.
+func (s *Session) Subscribe(topic string) error {
+	s.subLock.Lock()
+	defer s.subLock.Unlock()
+	if _, ok := s.subscriptions[topic]; ok {
+		return nil
+	}
+	if len(s.subscriptions) >= maxSubscriptions() {
+		return errors.New("too many subscriptions")
+	}
+	s.subscriptions[topic] = struct{}{}
+	return nil
+}
+
+func (s *Session) Unsubscribe(topic string) {
+	s.subLock.Lock()
+	defer s.subLock.Unlock()
+	delete(s.subscriptions, topic)
+}
+
+func (s *Session) IsSubscribed(topic string) bool {
+	s.subLock.RLock()
+	defer s.subLock.RUnlock()
+	_, ok := s.subscriptions[topic]
+	return ok
+}
+
 func (s *Session) SessionTimeoverCheck() bool {
 	nCurTime := time.Now().Unix()
 	if nCurTime-s.LastActive > SessionTimeOut { //sec
@@ -43,6 +138,7 @@ func (s *Session) SessionTimeoverCheck() bool {
 
 func (sl *SessionList) CloseSession(session *Session) {
 	delete(sl.OnlineList, session.SessionId)
+	session.closeOnce.Do(func() { close(session.quit) })
 	session.Connection.Close()
 	session.SessionId = ""
 }
@@ -53,4 +149,4 @@ func (sl *SessionList) ForEachSession(visit func(*Session)) {
 	for _, v := range sl.OnlineList {
 		visit(v)
 	}
-}
\ No newline at end of file
+}
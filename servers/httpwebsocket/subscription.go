@@ -0,0 +1,217 @@
+package httpwebsocket
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	chain "github.com/elastos/Elastos.ELA.SideChain/blockchain"
+	. "github.com/elastos/Elastos.ELA.SideChain/config"
+	. "github.com/elastos/Elastos.ELA.SideChain/core"
+	. "github.com/elastos/Elastos.ELA.SideChain/errors"
+	"github.com/elastos/Elastos.ELA.SideChain/log"
+	. "github.com/elastos/Elastos.ELA.SideChain/servers"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const (
+	// TopicNewBlock notifies the header of each connected block.
+	TopicNewBlock = "newblock"
+
+	// TopicNewTransaction notifies the hash and fee of each transaction
+	// accepted by the pool.
+	TopicNewTransaction = "newtransaction"
+
+	// TopicAddressPrefix followed by an address notifies the connected block
+	// and pool transactions creating or spending an output of the address.
+	TopicAddressPrefix = "address:"
+
+	// DefaultMaxWsSubscriptions is the max number of topics subscribed by a
+	// session when MaxWsSubscriptions is not configured.
+	DefaultMaxWsSubscriptions = 16
+)
+
+type SubscriptionInfo struct {
+	Topic     string `json:"topic"`
+	Height    uint32 `json:"height"`
+	BlockHash string `json:"blockhash"`
+}
+
+type TransactionNotifyInfo struct {
+	TxId string `json:"txid"`
+	Fee  string `json:"fee"`
+}
+
+type AddressActivityInfo struct {
+	Address   string `json:"address"`
+	TxId      string `json:"txid"`
+	BlockHash string `json:"blockhash,omitempty"`
+	Height    uint32 `json:"height,omitempty"`
+}
+
+func maxSubscriptions() int {
+	if Parameters.MaxWsSubscriptions > 0 {
+		return Parameters.MaxWsSubscriptions
+	}
+	return DefaultMaxWsSubscriptions
+}
+
+func checkTopic(topic string) error {
+	switch topic {
+	case TopicNewBlock, TopicNewTransaction:
+		return nil
+	}
+	if !strings.HasPrefix(topic, TopicAddressPrefix) {
+		return errors.New("unknown topic")
+	}
+	_, err := Uint168FromAddress(strings.TrimPrefix(topic, TopicAddressPrefix))
+	return err
+}
+
+func (server *WebSocketServer) subscribe(session *Session, cmd Params) map[string]interface{} {
+	topic, ok := cmd.String("Topic")
+	if !ok || checkTopic(topic) != nil {
+		return ResponsePack(InvalidParams, "")
+	}
+	if err := session.Subscribe(topic); err != nil {
+		return ResponsePack(TooManySubscriptions, "")
+	}
+
+	// replay the current tip, so the client knows where the notifications
+	// start from
+	height := chain.DefaultLedger.Blockchain.GetBestHeight()
+	hash, err := chain.DefaultLedger.Store.GetBlockHash(height)
+	if err != nil {
+		return ResponsePack(UnknownBlock, "")
+	}
+	if topic == TopicNewBlock {
+		if block, err := chain.DefaultLedger.Store.GetBlock(hash); err == nil {
+			if data, err := notification(topic, GetBlockInfo(block, false)); err == nil {
+				session.Push(data)
+			}
+		}
+	}
+	return ResponsePack(Success, SubscriptionInfo{
+		Topic:     topic,
+		Height:    height,
+		BlockHash: ToReversedString(hash),
+	})
+}
+
+func (server *WebSocketServer) unsubscribe(session *Session, cmd Params) map[string]interface{} {
+	topic, ok := cmd.String("Topic")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	session.Unsubscribe(topic)
+	return ResponsePack(Success, topic)
+}
+
+func notification(topic string, result interface{}) ([]byte, error) {
+	resp := ResponsePack(Success, result)
+	resp["Action"] = "notify"
+	resp["Topic"] = topic
+	resp["Desc"] = ErrMap[Success]
+	return json.Marshal(resp)
+}
+
+// notify queues the notification to the sessions subscribed to the topic, a
+// slow client misses the notifications instead of blocking the others.
+func (server *WebSocketServer) notify(topic string, result func() interface{}) {
+	var sessions []*Session
+	server.SessionList.ForEachSession(func(s *Session) {
+		if s.IsSubscribed(topic) {
+			sessions = append(sessions, s)
+		}
+	})
+	if len(sessions) == 0 {
+		return
+	}
+
+	data, err := notification(topic, result())
+	if err != nil {
+		log.Error("Websocket notify:", err)
+		return
+	}
+	for _, s := range sessions {
+		if !s.Push(data) {
+			log.Warn("Websocket notification dropped, session ", s.SessionId, " is too slow")
+		}
+	}
+}
+
+// NotifyBlock notifies a block connected to the chain.
+func NotifyBlock(v interface{}) {
+	block, ok := v.(*Block)
+	if !ok {
+		return
+	}
+	instance.notify(TopicNewBlock, func() interface{} { return GetBlockInfo(block, false) })
+
+	blockHash := ToReversedString(block.Hash())
+	for _, tx := range block.Transactions {
+		txId := ToReversedString(tx.Hash())
+		for _, address := range activeAddresses(tx) {
+			info := AddressActivityInfo{
+				Address:   address,
+				TxId:      txId,
+				BlockHash: blockHash,
+				Height:    block.Header.Height,
+			}
+			instance.notify(TopicAddressPrefix+address, func() interface{} { return info })
+		}
+	}
+}
+
+// NotifyTransaction notifies a transaction accepted by the pool.
+func NotifyTransaction(v interface{}) {
+	tx, ok := v.(*Transaction)
+	if !ok {
+		return
+	}
+	txId := ToReversedString(tx.Hash())
+	instance.notify(TopicNewTransaction, func() interface{} {
+		return TransactionNotifyInfo{TxId: txId, Fee: tx.Fee.String()}
+	})
+
+	for _, address := range activeAddresses(tx) {
+		info := AddressActivityInfo{Address: address, TxId: txId}
+		instance.notify(TopicAddressPrefix+address, func() interface{} { return info })
+	}
+}
+
+// activeAddresses returns the addresses of the outputs created and spent by
+// the transaction, the spent outputs are looked up in the chain and the pool.
+func activeAddresses(tx *Transaction) []string {
+	var addresses []string
+	seen := make(map[Uint168]struct{})
+	add := func(programHash Uint168) {
+		if _, ok := seen[programHash]; ok {
+			return
+		}
+		seen[programHash] = struct{}{}
+		if address, err := programHash.ToAddress(); err == nil {
+			addresses = append(addresses, address)
+		}
+	}
+
+	for _, output := range tx.Outputs {
+		add(output.ProgramHash)
+	}
+	if tx.IsCoinBaseTx() || tx.IsRechargeToSideChainTx() {
+		return addresses
+	}
+	for _, input := range tx.Inputs {
+		referTxn, _, err := chain.DefaultLedger.Store.GetTransaction(input.Previous.TxID)
+		if err != nil {
+			if referTxn = NodeForServers.GetTransaction(input.Previous.TxID); referTxn == nil {
+				continue
+			}
+		}
+		if int(input.Previous.Index) < len(referTxn.Outputs) {
+			add(referTxn.Outputs[input.Previous.Index].ProgramHash)
+		}
+	}
+	return addresses
+}
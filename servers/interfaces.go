@@ -6,13 +6,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	chain "github.com/elastos/Elastos.ELA.SideChain/blockchain"
 	"github.com/elastos/Elastos.ELA.SideChain/config"
 	. "github.com/elastos/Elastos.ELA.SideChain/core"
 	. "github.com/elastos/Elastos.ELA.SideChain/errors"
 	"github.com/elastos/Elastos.ELA.SideChain/log"
+	"github.com/elastos/Elastos.ELA.SideChain/metrics"
 	"github.com/elastos/Elastos.ELA.SideChain/pow"
 	. "github.com/elastos/Elastos.ELA.SideChain/protocol"
 
@@ -22,6 +26,13 @@ import (
 const (
 	AUXBLOCK_GENERATED_INTERVAL_SECONDS = 5
 	DESTROY_ADDRESS                     = "0000000000000000000000000000000000"
+	// the block template is regenerated when the fee of the transactions in
+	// pool but not in template reaches 1/BLOCKTEMPLATE_FEE_REFRESH_DIVISOR of
+	// the template fee
+	BLOCKTEMPLATE_FEE_REFRESH_DIVISOR = 10
+	// the max fee per KB of a sent transaction when MaxTxFeePerKB is not
+	// configured, a higher fee is taken as a mistake unless allowhighfees
+	DEFAULT_MAX_TX_FEE_PER_KB = 100000000
 )
 
 var NodeForServers Noder
@@ -30,6 +41,13 @@ var PreChainHeight uint64
 var PreTime int64
 var PreTransactionCount int
 
+var blockTemplate struct {
+	sync.Mutex
+	block   *Block
+	address string
+	fee     Fixed64
+}
+
 func ToReversedString(hash Uint256) string {
 	return BytesToHexString(BytesReverse(hash[:]))
 }
@@ -67,6 +85,9 @@ func GetTransactionInfo(header *Header, tx *Transaction) *TransactionInfo {
 	for i, v := range tx.Attributes {
 		attributes[i].Usage = v.Usage
 		attributes[i].Data = BytesToHexString(v.Data)
+		if v.Usage == Memo && utf8.Valid(v.Data) {
+			attributes[i].Memo = string(v.Data)
+		}
 	}
 
 	programs := make([]ProgramInfo, len(tx.Programs))
@@ -79,10 +100,12 @@ func GetTransactionInfo(header *Header, tx *Transaction) *TransactionInfo {
 	var txHashStr = ToReversedString(txHash)
 	var size = uint32(tx.GetSize())
 	var blockHash string
+	var height uint32
 	var confirmations uint32
 	var time uint32
 	var blockTime uint32
 	if header != nil {
+		height = header.Height
 		confirmations = chain.DefaultLedger.Blockchain.GetBestHeight() - header.Height + 1
 		blockHash = ToReversedString(header.Hash())
 		time = header.Timestamp
@@ -99,6 +122,7 @@ func GetTransactionInfo(header *Header, tx *Transaction) *TransactionInfo {
 		Inputs:         inputs,
 		Outputs:        outputs,
 		BlockHash:      blockHash,
+		Height:         height,
 		Confirmations:  confirmations,
 		Time:           time,
 		BlockTime:      blockTime,
@@ -227,17 +251,23 @@ func GetRawTransaction(param Params) map[string]interface{} {
 	if err != nil {
 		return ResponsePack(InvalidTransaction, "")
 	}
+	// the header of the block is loaded by the stored height of the
+	// transaction, a transaction in the pool has no block
+	var header *Header
 	tx, height, err := chain.DefaultLedger.Store.GetTransaction(hash)
 	if err != nil {
-		return ResponsePack(UnknownTransaction, "")
-	}
-	bHash, err := chain.DefaultLedger.Store.GetBlockHash(height)
-	if err != nil {
-		return ResponsePack(UnknownTransaction, "")
-	}
-	header, err := chain.DefaultLedger.Store.GetHeader(bHash)
-	if err != nil {
-		return ResponsePack(UnknownTransaction, "")
+		if tx = NodeForServers.GetTransaction(hash); tx == nil {
+			return ResponsePack(txErrCode(), "")
+		}
+	} else {
+		bHash, err := chain.DefaultLedger.Store.GetBlockHash(height)
+		if err != nil {
+			return ResponsePack(UnknownTransaction, "")
+		}
+		header, err = chain.DefaultLedger.Store.GetHeader(bHash)
+		if err != nil {
+			return ResponsePack(UnknownTransaction, "")
+		}
 	}
 
 	verbose, ok := param.Bool("verbose")
@@ -266,10 +296,66 @@ func GetNodeState(param Params) map[string]interface{} {
 		Height:   NodeForServers.Height(),
 		TxnCnt:   NodeForServers.GetTxnCnt(),
 		RxTxnCnt: NodeForServers.GetRxTxnCnt(),
+		Metrics:  metrics.Snapshot(),
 	}
 	return ResponsePack(Success, n)
 }
 
+func GetPeerInfo(param Params) map[string]interface{} {
+	peers := make([]PeerInfo, 0)
+	for _, n := range NodeForServers.GetNeighborNoder() {
+		peer := PeerInfo{
+			ID:         n.ID(),
+			Addr:       n.Addr() + ":" + strconv.Itoa(int(n.Port())),
+			Services:   n.Services(),
+			Relay:      n.IsRelay(),
+			Height:     n.Height(),
+			LastActive: n.GetLastActiveTime().Unix(),
+		}
+		if info, ok := NodeForServers.AddressInfo(n.ID()); ok {
+			peer.Bucket = fmt.Sprintf("new/%d", info.Bucket)
+			if info.Tried {
+				peer.Bucket = fmt.Sprintf("tried/%d", info.Bucket)
+			}
+			peer.LastSeen = info.LastSeen
+			peer.LastSuccess = info.LastSuccess
+			peer.Attempts = info.Attempts
+		}
+		peers = append(peers, peer)
+	}
+	return ResponsePack(Success, peers)
+}
+
+func GetAddedNodeInfo(param Params) map[string]interface{} {
+	connected := make(map[string]bool)
+	for _, n := range NodeForServers.GetNeighborNoder() {
+		connected[n.Addr()+":"+strconv.Itoa(int(n.Port()))] = true
+	}
+	nodes := make([]AddedNodeInfo, 0, len(config.Parameters.SeedList))
+	for _, addr := range config.Parameters.SeedList {
+		nodes = append(nodes, AddedNodeInfo{AddedNode: addr, Connected: connected[addr]})
+	}
+	return ResponsePack(Success, nodes)
+}
+
+func GetSigCacheInfo(param Params) map[string]interface{} {
+	size, hits, misses := chain.SigCacheStats()
+	info := SigCacheInfo{Size: size, Hits: hits, Misses: misses}
+	if hits+misses > 0 {
+		info.HitRate = float64(hits) / float64(hits+misses)
+	}
+	return ResponsePack(Success, info)
+}
+
+func GetMainchainTxFilterInfo(param Params) map[string]interface{} {
+	lookups, positives, falsePositives := chain.DefaultLedger.Store.MainchainTxFilterStats()
+	info := MainchainTxFilterInfo{Lookups: lookups, Positives: positives, FalsePositives: falsePositives}
+	if positives > 0 {
+		info.FalsePositiveRate = float64(falsePositives) / float64(positives)
+	}
+	return ResponsePack(Success, info)
+}
+
 func SetLogLevel(param Params) map[string]interface{} {
 	level, ok := param["level"].(float64)
 	if !ok || level < 0 {
@@ -456,6 +542,133 @@ func ToggleMining(param Params) map[string]interface{} {
 	return ResponsePack(Success, message)
 }
 
+// isBlockTemplateStale returns if the block template should be regenerated,
+// must be called with the block template lock held.
+func isBlockTemplateStale(address string) bool {
+	template := blockTemplate.block
+	if template == nil || blockTemplate.address != address {
+		return true
+	}
+	if !template.Header.Previous.IsEqual(*chain.DefaultLedger.Blockchain.BestChain.Hash) {
+		return true
+	}
+
+	txsInPool := NodeForServers.GetTxsInPool()
+	for _, tx := range template.Transactions[1:] {
+		hash := tx.Hash()
+		if _, ok := txsInPool[hash]; !ok {
+			return true
+		}
+		delete(txsInPool, hash)
+	}
+	var newFee Fixed64
+	for _, tx := range txsInPool {
+		newFee += tx.Fee
+	}
+	threshold := blockTemplate.fee / BLOCKTEMPLATE_FEE_REFRESH_DIVISOR
+	if minTxFee := Fixed64(config.Parameters.PowConfiguration.MinTxFee); threshold < minTxFee {
+		threshold = minTxFee
+	}
+	return newFee >= threshold
+}
+
+func GetBlockTemplate(param Params) map[string]interface{} {
+	if LocalPow == nil {
+		return ResponsePack(PowServiceNotStarted, "")
+	}
+	addr, ok := param.String("paytoaddress")
+	if !ok {
+		addr = config.Parameters.PowConfiguration.PayToAddr
+	}
+	if _, err := Uint168FromAddress(addr); err != nil {
+		return ResponsePack(InvalidParams, "invalid pay to address")
+	}
+
+	blockTemplate.Lock()
+	defer blockTemplate.Unlock()
+	if isBlockTemplateStale(addr) {
+		block, err := LocalPow.GenerateBlock(addr)
+		if err != nil {
+			return ResponsePack(InternalError, "generate block template failed")
+		}
+		var fee Fixed64
+		for _, output := range block.Transactions[0].Outputs {
+			fee += output.Value
+		}
+		blockTemplate.block = block
+		blockTemplate.address = addr
+		blockTemplate.fee = fee
+	}
+	block := blockTemplate.block
+
+	coinbase := new(bytes.Buffer)
+	if err := block.Transactions[0].Serialize(coinbase); err != nil {
+		return ResponsePack(InternalError, "serialize coinbase failed")
+	}
+	txs := make([]BlockTemplateTxInfo, 0, len(block.Transactions)-1)
+	for _, tx := range block.Transactions[1:] {
+		buf := new(bytes.Buffer)
+		if err := tx.Serialize(buf); err != nil {
+			return ResponsePack(InternalError, "serialize transaction failed")
+		}
+		txs = append(txs, BlockTemplateTxInfo{
+			Data: BytesToHexString(buf.Bytes()),
+			Hash: ToReversedString(tx.Hash()),
+			Fee:  tx.Fee.String(),
+		})
+	}
+
+	medianTime, err := chain.DefaultLedger.Blockchain.GetMedianTimePast(block.Header.Previous)
+	if err != nil {
+		return ResponsePack(InternalError, "get median time past failed")
+	}
+	maxTime := chain.DefaultLedger.Blockchain.MedianAdjustedTime().Add(chain.MaxBlockTimeOffset())
+	return ResponsePack(Success, &BlockTemplateInfo{
+		Version:           block.Header.Version,
+		PreviousBlockHash: ToReversedString(block.Header.Previous),
+		MerkleRoot:        ToReversedString(block.Header.MerkleRoot),
+		Bits:              fmt.Sprintf("%x", block.Header.Bits),
+		Height:            block.Header.Height,
+		CurTime:           block.Header.Timestamp,
+		MinTime:           uint32(medianTime.Unix()) + 1,
+		MaxTime:           uint32(maxTime.Unix()),
+		CoinbaseTxn:       BytesToHexString(coinbase.Bytes()),
+		CoinbaseValue:     blockTemplate.fee.String(),
+		Transactions:      txs,
+	})
+}
+
+func SubmitBlock(param Params) map[string]interface{} {
+	str, ok := param.String("block")
+	if !ok {
+		return ResponsePack(InvalidParams, "block not found")
+	}
+	data, err := HexStringToBytes(str)
+	if err != nil {
+		return ResponsePack(InvalidParams, "invalid block hex")
+	}
+	var block Block
+	if err := block.Deserialize(bytes.NewReader(data)); err != nil {
+		return ResponsePack(InvalidParams, "deserialize block failed")
+	}
+
+	inMainChain, isOrphan, err := chain.DefaultLedger.Blockchain.AddBlock(&block)
+	if err != nil {
+		log.Trace("[json-rpc:SubmitBlock]", err)
+		return RulePack(ErrBlockRejected, err)
+	}
+	if isOrphan || !inMainChain {
+		return ResponsePack(InternalError, "block is not connected to main chain")
+	}
+	NodeForServers.Relay(nil, &block)
+
+	blockTemplate.Lock()
+	blockTemplate.block = nil
+	blockTemplate.Unlock()
+
+	return ResponsePack(Success, ToReversedString(block.Hash()))
+}
+
 func DiscreteMining(param Params) map[string]interface{} {
 	if LocalPow == nil {
 		return ResponsePack(PowServiceNotStarted, "")
@@ -479,6 +692,52 @@ func DiscreteMining(param Params) map[string]interface{} {
 	return ResponsePack(Success, ret)
 }
 
+// Generate mines count blocks paying the coinbase to PayToAddr, it is only
+// allowed on the networks for testing.
+func Generate(param Params) map[string]interface{} {
+	count, ok := param.Uint("count")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	return generate(count, config.Parameters.PowConfiguration.PayToAddr)
+}
+
+// GenerateToAddress mines count blocks paying the coinbase to address, it is
+// only allowed on the networks for testing.
+func GenerateToAddress(param Params) map[string]interface{} {
+	count, ok := param.Uint("count")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	address, ok := param.String("address")
+	if !ok {
+		return ResponsePack(InvalidParams, "")
+	}
+	if _, err := Uint168FromAddress(address); err != nil {
+		return ResponsePack(InvalidParams, "invalid address")
+	}
+	return generate(count, address)
+}
+
+func generate(count uint32, address string) map[string]interface{} {
+	if !config.Parameters.ChainParam.AllowGenerate {
+		return ResponsePack(InvalidMethod, "generate is not allowed on "+config.Parameters.ChainParam.Name)
+	}
+	if LocalPow == nil {
+		return ResponsePack(PowServiceNotStarted, "")
+	}
+
+	blockHashes, err := LocalPow.Generate(count, address)
+	if err != nil {
+		return ResponsePack(Error, err.Error())
+	}
+	ret := make([]string, len(blockHashes))
+	for i, hash := range blockHashes {
+		ret[i] = ToReversedString(*hash)
+	}
+	return ResponsePack(Success, ret)
+}
+
 func GetConnectionCount(param Params) map[string]interface{} {
 	return ResponsePack(Success, NodeForServers.GetConnectionCnt())
 }
@@ -536,10 +795,28 @@ func GetBlockInfo(block *Block, verbose bool) BlockInfo {
 	}
 }
 
+// blockErrCode returns the error code of a block failed to load, PrunedData
+// if its transactions are deleted in prune mode.
+func blockErrCode(err error) ErrCode {
+	if err == chain.ErrBlockPruned {
+		return PrunedData
+	}
+	return UnknownBlock
+}
+
+// txErrCode returns the error code of a transaction not found, PrunedData if
+// the store is pruned since the transaction may have been deleted.
+func txErrCode() ErrCode {
+	if chain.DefaultLedger.Store.GetPrunedHeight() > 0 {
+		return PrunedData
+	}
+	return UnknownTransaction
+}
+
 func getBlock(hash Uint256, format uint32) (interface{}, ErrCode) {
 	block, err := chain.DefaultLedger.Store.GetBlock(hash)
 	if err != nil {
-		return "", UnknownBlock
+		return "", blockErrCode(err)
 	}
 	switch format {
 	case 0:
@@ -564,7 +841,7 @@ func GetBlockByHash(param Params) map[string]interface{} {
 		return ResponsePack(InvalidParams, "invalid block hash")
 	}
 	if err := hash.Deserialize(bytes.NewReader(hashBytes)); err != nil {
-		ResponsePack(InvalidParams, "invalid block hash")
+		return ResponsePack(InvalidParams, "invalid block hash")
 	}
 
 	verbosity, ok := param.Uint("verbosity")
@@ -622,13 +899,99 @@ func SendRawTransaction(param Params) map[string]interface{} {
 		return ResponsePack(InvalidTransaction, "transaction deserialize error")
 	}
 
+	// protect the sender from paying a fee too high by mistake
+	if allowHighFees, _ := param.Bool("allowhighfees"); !allowHighFees {
+		feeMap, errCode := NodeForServers.TestAcceptTransaction(&txn)
+		if errCode != Success {
+			return ResponsePack(errCode, errCode.RuleMessage())
+		}
+		if err := checkFeeRate(&txn, feeMap); err != nil {
+			return ResponsePack(HighTransactionFee, err.Error())
+		}
+	}
+
 	if errCode := VerifyAndSendTx(&txn); errCode != Success {
-		return ResponsePack(errCode, errCode.Message())
+		return ResponsePack(errCode, errCode.RuleMessage())
 	}
 
 	return ResponsePack(Success, ToReversedString(txn.Hash()))
 }
 
+// checkFeeRate checks the fee per KB of the transaction, normalized to the
+// chain asset, does not exceed MaxTxFeePerKB.
+func checkFeeRate(txn *Transaction, feeMap map[Uint256]Fixed64) error {
+	maxFeePerKB := Fixed64(config.Parameters.MaxTxFeePerKB)
+	if maxFeePerKB <= 0 {
+		maxFeePerKB = DEFAULT_MAX_TX_FEE_PER_KB
+	}
+	feePerKB := chain.NormalizedFee(feeMap) * 1000 / Fixed64(txn.GetSize())
+	if feePerKB > maxFeePerKB {
+		return fmt.Errorf("transaction fee %s per KB exceeds %s, set allowhighfees to send it",
+			feePerKB.String(), maxFeePerKB.String())
+	}
+	return nil
+}
+
+// TestMempoolAccept checks a raw transaction would be accepted by the
+// transaction pool at the current tip, the transaction is neither added to
+// the pool nor relayed.
+func TestMempoolAccept(param Params) map[string]interface{} {
+	str, ok := param.String("data")
+	if !ok {
+		return ResponsePack(InvalidParams, "need a string parameter named data")
+	}
+
+	bys, err := HexStringToBytes(str)
+	if err != nil {
+		return ResponsePack(InvalidParams, "hex string to bytes error")
+	}
+	var txn Transaction
+	if err := txn.Deserialize(bytes.NewReader(bys)); err != nil {
+		return ResponsePack(InvalidTransaction, "transaction deserialize error")
+	}
+
+	info := MempoolAcceptInfo{TxId: ToReversedString(txn.Hash())}
+	feeMap, errCode := NodeForServers.TestAcceptTransaction(&txn)
+	if errCode != Success {
+		info.Code = int(errCode)
+		info.Reason = errCode.RuleMessage()
+		return ResponsePack(Success, info)
+	}
+	info.Allowed = true
+	info.Fees = make(map[string]string, len(feeMap))
+	for assetID, fee := range feeMap {
+		info.Fees[ToReversedString(assetID)] = fee.String()
+	}
+	return ResponsePack(Success, info)
+}
+
+// VerifyRechargeProof pre-validates the deposits of a raw recharge to side
+// chain transaction before it is sent.
+func VerifyRechargeProof(param Params) map[string]interface{} {
+	str, ok := param.String("data")
+	if !ok {
+		return ResponsePack(InvalidParams, "need a string parameter named data")
+	}
+
+	bys, err := HexStringToBytes(str)
+	if err != nil {
+		return ResponsePack(InvalidParams, "hex string to bytes error")
+	}
+	var txn Transaction
+	if err := txn.Deserialize(bytes.NewReader(bys)); err != nil {
+		return ResponsePack(InvalidTransaction, "transaction deserialize error")
+	}
+	payload, ok := txn.Payload.(*PayloadRechargeToSideChain)
+	if !ok {
+		return ResponsePack(InvalidTransaction, "not a recharge to side chain transaction")
+	}
+
+	if err := chain.VerifyRechargeProof(payload); err != nil {
+		return ResponsePack(InvalidTransaction, err.Error())
+	}
+	return ResponsePack(Success, true)
+}
+
 func GetBlockHeight(param Params) map[string]interface{} {
 	return ResponsePack(Success, chain.DefaultLedger.Blockchain.BlockHeight)
 }
@@ -694,7 +1057,7 @@ func GetTransactionsByHeight(param Params) map[string]interface{} {
 	}
 	block, err := chain.DefaultLedger.Store.GetBlock(hash)
 	if err != nil {
-		return ResponsePack(UnknownBlock, "")
+		return ResponsePack(blockErrCode(err), "")
 	}
 	return ResponsePack(Success, GetBlockTransactions(block))
 }
@@ -710,7 +1073,11 @@ func GetBlockByHeight(param Params) map[string]interface{} {
 		return ResponsePack(UnknownBlock, "")
 	}
 
-	result, errCode := getBlock(hash, 2)
+	verbosity, ok := param.Uint("verbosity")
+	if !ok {
+		verbosity = 2
+	}
+	result, errCode := getBlock(hash, verbosity)
 
 	return ResponsePack(errCode, result)
 }
@@ -734,7 +1101,7 @@ func GetAssetByHash(param Params) map[string]interface{} {
 	if err != nil {
 		return ResponsePack(UnknownAsset, "")
 	}
-	if false {
+	if raw, _ := param.Bool("raw"); raw {
 		w := new(bytes.Buffer)
 		asset.Serialize(w)
 		return ResponsePack(Success, BytesToHexString(w.Bytes()))
@@ -752,12 +1119,13 @@ func GetBalanceByAddr(param Params) map[string]interface{} {
 	if err != nil {
 		return ResponsePack(InvalidParams, "")
 	}
-	unspends, err := chain.DefaultLedger.Store.GetUnspentsFromProgramHash(*programHash)
+	utxos, err := chain.DefaultLedger.Store.GetUTXOsByProgramHash(*programHash)
+	if err != nil {
+		return ResponsePack(InternalError, "")
+	}
 	var balance Fixed64 = 0
-	for _, u := range unspends {
-		for _, v := range u {
-			balance = balance + v.Value
-		}
+	for _, u := range utxos {
+		balance = balance + u.Value
 	}
 	return ResponsePack(Success, balance.String())
 }
@@ -893,7 +1261,7 @@ func GetTransactionByHash(param Params) map[string]interface{} {
 	}
 	txn, height, err := chain.DefaultLedger.Store.GetTransaction(hash)
 	if err != nil {
-		return ResponsePack(UnknownTransaction, "")
+		return ResponsePack(txErrCode(), "")
 	}
 	bHash, err := chain.DefaultLedger.Store.GetBlockHash(height)
 	if err != nil {
@@ -980,7 +1348,7 @@ func GetDestroyedTransactionsByHeight(param Params) map[string]interface{} {
 	}
 	block, err := chain.DefaultLedger.Store.GetBlock(hash)
 	if err != nil {
-		return ResponsePack(UnknownBlock, "")
+		return ResponsePack(blockErrCode(err), "")
 	}
 
 	destroyHash := Uint168{}
@@ -998,6 +1366,8 @@ func GetDestroyedTransactionsByHeight(param Params) map[string]interface{} {
 	}))
 }
 
+// GetIdentificationTxByIdAndPath returns the latest values registered to the
+// path of the ID, with the registration transaction and its height.
 func GetIdentificationTxByIdAndPath(param Params) map[string]interface{} {
 	id, ok := param.String("id")
 	if !ok {
@@ -1017,7 +1387,7 @@ func GetIdentificationTxByIdAndPath(param Params) map[string]interface{} {
 	buf.WriteString(path)
 	txHashBytes, err := chain.DefaultLedger.Store.GetRegisterIdentificationTx(buf.Bytes())
 	if err != nil {
-		return ResponsePack(InvalidParams, "")
+		return ResponsePack(UnknownTransaction, "identification path not found")
 	}
 	txHash, err := Uint256FromBytes(txHashBytes)
 	if err != nil {
@@ -1026,18 +1396,36 @@ func GetIdentificationTxByIdAndPath(param Params) map[string]interface{} {
 
 	txn, height, err := chain.DefaultLedger.Store.GetTransaction(*txHash)
 	if err != nil {
-		return ResponsePack(UnknownTransaction, "")
+		return ResponsePack(txErrCode(), "")
 	}
-	bHash, err := chain.DefaultLedger.Store.GetBlockHash(height)
-	if err != nil {
-		return ResponsePack(UnknownBlock, "")
+	payload, ok := txn.Payload.(*PayloadRegisterIdentification)
+	if !ok {
+		return ResponsePack(InternalError, "invalid register identification payload")
 	}
-	header, err := chain.DefaultLedger.Store.GetHeader(bHash)
-	if err != nil {
-		return ResponsePack(UnknownBlock, "")
+
+	info := IdentificationInfo{
+		Id:     id,
+		Path:   path,
+		Values: []RegisterIdentificationValueInfo{},
+		TxID:   ToReversedString(*txHash),
+		Height: height,
+	}
+	for _, content := range payload.Contents {
+		if content.Path != path {
+			continue
+		}
+		for _, value := range content.Values {
+			info.Values = append(info.Values, RegisterIdentificationValueInfo{
+				DataHash: ToReversedString(value.DataHash),
+				Proof:    value.Proof,
+			})
+		}
+	}
+	if controller, err := chain.DefaultLedger.Store.GetIdentificationController(id); err == nil {
+		info.Controller, _ = controller.ToAddress()
 	}
 
-	return ResponsePack(Success, GetTransactionInfo(header, txn))
+	return ResponsePack(Success, info)
 }
 
 func getPayload(pInfo PayloadInfo) (Payload, error) {
@@ -1091,6 +1479,7 @@ func getPayloadInfo(p Payload) PayloadInfo {
 	case *PayloadRegisterAsset:
 		obj := new(RegisterAssetInfo)
 		obj.Asset = object.Asset
+		obj.CanonicalName = NormalizeAssetName(object.Asset.Name)
 		obj.Amount = object.Amount.String()
 		obj.Controller = BytesToHexString(BytesReverse(object.Controller.Bytes()))
 		return obj
@@ -1177,6 +1566,11 @@ func getTransactionInfo(txInfoBytes []byte) (*TransactionInfo, error) {
 }
 
 func VerifyAndSendTx(txn *Transaction) ErrCode {
+	// reject the malformed transaction before it reaches the transaction pool
+	if errCode := chain.CheckTransaction(txn, false); errCode != Success {
+		log.Info("[httpjsonrpc] VerifyTransaction failed when CheckTransaction.")
+		return errCode
+	}
 	// if transaction is verified unsucessfully then will not put it into transaction pool
 	if errCode := NodeForServers.AppendToTxnPool(txn); errCode != Success {
 		log.Warn("Can NOT add the transaction to TxnPool")
@@ -1190,6 +1584,18 @@ func VerifyAndSendTx(txn *Transaction) ErrCode {
 	return Success
 }
 
+// RulePack returns the response of a transaction or a block rejected by a
+// rule, the code of a RuleError replaces errCode and the error is returned as
+// the description.
+func RulePack(errCode ErrCode, err error) map[string]interface{} {
+	if ruleErr, ok := err.(RuleError); ok {
+		errCode = ruleErr.ErrorCode
+	}
+	resp := ResponsePack(errCode, errCode.RuleMessage())
+	resp["Desc"] = err.Error()
+	return resp
+}
+
 func ResponsePack(errCode ErrCode, result interface{}) map[string]interface{} {
 	if errCode != 0 && (result == "" || result == nil) {
 		result = ErrMap[errCode]
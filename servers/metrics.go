@@ -0,0 +1,49 @@
+package servers
+
+import (
+	"net/http"
+
+	chain "github.com/elastos/Elastos.ELA.SideChain/blockchain"
+	"github.com/elastos/Elastos.ELA.SideChain/log"
+	"github.com/elastos/Elastos.ELA.SideChain/metrics"
+)
+
+func init() {
+	metrics.NewGaugeFunc("elastos_chain_height", "Height of the best chain.", func() int64 {
+		if chain.DefaultLedger == nil || chain.DefaultLedger.Blockchain == nil {
+			return 0
+		}
+		return int64(chain.DefaultLedger.Blockchain.GetBestHeight())
+	})
+	metrics.NewGaugeFunc("elastos_best_known_height", "Best height known from the peers.", func() int64 {
+		if NodeForServers == nil {
+			return 0
+		}
+		var best uint64
+		for _, height := range NodeForServers.GetNeighborHeights() {
+			if height > best {
+				best = height
+			}
+		}
+		return int64(best)
+	})
+	metrics.NewGaugeFunc("elastos_peers", "Connected peers.", func() int64 {
+		if NodeForServers == nil {
+			return 0
+		}
+		return int64(NodeForServers.GetConnectionCnt())
+	})
+}
+
+// MetricsHandler serves the metrics in the Prometheus text format, the
+// metrics are read only.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !Authorized(Authenticated(r), false) {
+		WriteUnauthorized(w)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := metrics.WriteText(w); err != nil {
+		log.Error("Write metrics failed: ", err)
+	}
+}
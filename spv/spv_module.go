@@ -53,25 +53,27 @@ func SpvInit() error {
 }
 
 func VerifyTransaction(tx *core.Transaction) error {
-	proof := new(MerkleProof)
-	mainChainTransaction := new(ela.Transaction)
-
 	payloadObj, ok := tx.Payload.(*core.PayloadRechargeToSideChain)
 	if !ok {
 		return errors.New("Invalid payload core.PayloadRechargeToSideChain")
 	}
 
-	reader := bytes.NewReader(payloadObj.MerkleProof)
-	if err := proof.Deserialize(reader); err != nil {
-		return errors.New("RechargeToSideChain payload deserialize failed")
-	}
-	reader = bytes.NewReader(payloadObj.MainChainTransaction)
-	if err := mainChainTransaction.Deserialize(reader); err != nil {
-		return errors.New("RechargeToSideChain mainChainTransaction deserialize failed")
-	}
+	for _, deposit := range payloadObj.GetDeposits() {
+		proof := new(MerkleProof)
+		mainChainTransaction := new(ela.Transaction)
+
+		reader := bytes.NewReader(deposit.MerkleProof)
+		if err := proof.Deserialize(reader); err != nil {
+			return errors.New("RechargeToSideChain payload deserialize failed")
+		}
+		reader = bytes.NewReader(deposit.MainChainTransaction)
+		if err := mainChainTransaction.Deserialize(reader); err != nil {
+			return errors.New("RechargeToSideChain mainChainTransaction deserialize failed")
+		}
 
-	if err := spvService.VerifyTransaction(*proof, *mainChainTransaction); err != nil {
-		return errors.New("SPV module verify transaction failed.")
+		if err := spvService.VerifyTransaction(*proof, *mainChainTransaction); err != nil {
+			return errors.New("SPV module verify transaction failed.")
+		}
 	}
 
 	return nil
@@ -87,6 +89,26 @@ func VerifyElaHeader(hash *common.Uint256) error {
 	return nil
 }
 
+// MainChainHeaders looks up the main chain block headers in the SPV header
+// store.
+type MainChainHeaders struct{}
+
+func (MainChainHeaders) GetHeader(hash common.Uint256) (common.Uint256, uint32, error) {
+	header, err := spvService.HeaderStore().GetHeader(&hash)
+	if err != nil {
+		return common.Uint256{}, 0, err
+	}
+	return header.MerkleRoot, header.Height, nil
+}
+
+func (MainChainHeaders) GetBestHeight() uint32 {
+	header, err := spvService.HeaderStore().GetBestHeader()
+	if err != nil {
+		return 0
+	}
+	return header.Height
+}
+
 type SpvListener struct {
 	ListenAddress string
 }